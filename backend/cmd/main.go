@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -12,8 +14,12 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/mailer"
 	"github.com/harrisin2037/todoapp/internal/middlewares"
 	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/oidc"
+	"github.com/harrisin2037/todoapp/internal/policy"
+	"github.com/harrisin2037/todoapp/internal/ratelimit"
 	"github.com/harrisin2037/todoapp/internal/repository"
 	"github.com/harrisin2037/todoapp/internal/service"
 	"github.com/harrisin2037/todoapp/internal/websocket"
@@ -26,7 +32,7 @@ func main() {
 		dbHost = os.Getenv("DB_HOST")
 		dbPort = os.Getenv("DB_PORT")
 		dbName = os.Getenv("DB_NAME")
-		dsn    = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", dbUser, dbPass, dbHost, dbPort, dbName)
+		dsn    = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=UTC", dbUser, dbPass, dbHost, dbPort, dbName)
 	)
 
 	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
@@ -34,15 +40,18 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
-	err = db.AutoMigrate(&models.Todo{}, &models.User{}, &models.TaskTemplate{})
+	err = db.AutoMigrate(&models.Todo{}, &models.User{}, &models.TaskTemplate{}, &models.Project{}, &models.IdempotencyRecord{}, &models.RefreshToken{}, &models.PersonalAccessToken{}, &models.OIDCLoginState{}, &models.RecoveryCode{}, &models.AccountToken{}, &models.RateLimitBucket{}, &models.CustomRole{}, &models.AuditEvent{}, &models.Invitation{}, &models.Setting{}, &models.Avatar{}, &models.CalendarFeed{}, &models.Reminder{}, &models.ReminderRule{}, &models.Notification{}, &models.EscalationRule{}, &models.TodoEvent{})
 	if err != nil {
 		log.Fatalf("Failed to auto migrate: %v", err)
 	}
 
+	now := time.Now()
 	admin := &models.User{
 		Username: "admin",
 		Email:    "admin",
 		Role:     models.RoleAdmin,
+
+		EmailVerifiedAt: &now,
 	}
 	admin.SetPassword("admin123")
 	_ = db.Create(admin)
@@ -50,59 +59,303 @@ func main() {
 	hub := websocket.NewHub()
 	go hub.Run()
 
+	accessTokenTTL := durationFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+	refreshTokenTTL := durationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+
+	idempotencyTTL := durationFromEnv("IDEMPOTENCY_TTL", 24*time.Hour)
+
+	totpIssuer := os.Getenv("TOTP_ISSUER")
+	if totpIssuer == "" {
+		totpIssuer = "todoapp"
+	}
+	requireAdminTwoFactor := os.Getenv("REQUIRE_ADMIN_2FA") == "true"
+
+	mail, err := mailer.New(mailer.Config{
+		Driver:   os.Getenv("MAIL_DRIVER"),
+		From:     os.Getenv("MAIL_FROM"),
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		Dir:      os.Getenv("MAIL_DIR"),
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up mailer: %v", err)
+	}
+
+	apiBaseURL := urlFromEnv("API_BASE_URL", "http://localhost:8080")
+	frontendURL := urlFromEnv("FRONTEND_URL", "http://localhost:3000")
+	requireVerifiedEmail := os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true"
+	invitationTTL := durationFromEnv("INVITATION_TTL", 7*24*time.Hour)
+	reminderInterval := durationFromEnv("REMINDER_INTERVAL", 30*time.Second)
+	registrationOpen := os.Getenv("REGISTRATION_OPEN") != "false"
+	maxAvatarBytes := int64(intFromEnv("AVATAR_MAX_BYTES", 5<<20))
+
+	lockout := service.LockoutPolicy{
+		Threshold: intFromEnv("LOGIN_LOCKOUT_THRESHOLD", 5),
+		BaseDelay: durationFromEnv("LOGIN_LOCKOUT_BASE_DELAY", time.Minute),
+		MaxDelay:  durationFromEnv("LOGIN_LOCKOUT_MAX_DELAY", time.Hour),
+	}
+
+	rateLimitRepo := repository.NewRateLimitRepository(db)
+	var rateLimitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if os.Getenv("RATE_LIMIT_STORE") == "db" {
+		rateLimitStore = rateLimitRepo
+	}
+	ipLimit := limitFromEnv("RATE_LIMIT_PER_IP", "20/1m")
+	accountLimit := limitFromEnv("RATE_LIMIT_PER_ACCOUNT", "5/1m")
+
 	var (
 		router              = gin.Default()
 		userRepo            = repository.NewUserRepository(db)
-		userService         = service.NewUserService(userRepo)
+		refreshTokenRepo    = repository.NewRefreshTokenRepository(db)
+		tokenService        = service.NewTokenService(refreshTokenRepo, userRepo, accessTokenTTL, refreshTokenTTL)
+		twoFactorService    = service.NewTwoFactorService(userRepo, repository.NewRecoveryCodeRepository(db), totpIssuer, requireAdminTwoFactor)
+		userService         = service.NewUserService(userRepo, tokenService, twoFactorService, requireVerifiedEmail, lockout)
+		auditService        = service.NewAuditService(repository.NewAuditRepository(db))
+		auditHandler        = handlers.NewAuditHandler(auditService)
+		accountService      = service.NewAccountService(repository.NewAccountTokenRepository(db), userRepo, tokenService, mail, apiBaseURL+"/auth/verify-email", frontendURL+"/reset-password")
+		accountHandler      = handlers.NewAccountHandler(accountService, userService, auditService)
+		twoFactorHandler    = handlers.NewTwoFactorHandler(twoFactorService, userService, auditService)
+		projectRepo         = repository.NewProjectRepository(db)
+		policyService       = service.NewPolicyService(repository.NewRoleRepository(db), projectRepo, userRepo)
+		roleHandler         = handlers.NewRoleHandler(policyService, auditService)
+		patRepo             = repository.NewPersonalAccessTokenRepository(db)
+		patService          = service.NewPersonalAccessTokenService(patRepo, userRepo, policyService)
+		patHandler          = handlers.NewPersonalAccessTokenHandler(patService, userService, twoFactorService, auditService)
 		todoRepo            = repository.NewTodoRepository(db)
 		todoService         = service.NewTodoService(todoRepo)
 		taskTemplateRepo    = repository.NewTaskTemplateRepository(db)
 		taskTemplateService = service.NewTaskTemplateService(taskTemplateRepo)
-		userHandler         = handlers.NewUserHandler(userService)
-		todoHandler         = handlers.NewTodoHandler(todoService, userService, hub)
-		taskTemplateHandler = handlers.NewTaskTemplateHandler(taskTemplateService, userService, hub)
+		projectService      = service.NewProjectService(projectRepo)
+		userHandler         = handlers.NewUserHandler(userService, tokenService, accountService, policyService, auditService)
+		todoHandler         = handlers.NewTodoHandler(todoService, userService, projectService, policyService, hub)
+		todoAccess          = handlers.NewTodoAccess(todoService, policyService)
+		projectHandler      = handlers.NewProjectHandler(projectService, userService, policyService)
+		taskTemplateHandler = handlers.NewTaskTemplateHandler(taskTemplateService, userService, policyService, hub)
+		idempotencyRepo     = repository.NewIdempotencyRepository(db)
+		idempotencyService  = service.NewIdempotencyService(idempotencyRepo, idempotencyTTL)
+		settingService      = service.NewSettingService(repository.NewSettingRepository(db), service.Settings{RegistrationOpen: registrationOpen})
+		invitationService   = service.NewInvitationService(repository.NewInvitationRepository(db), userRepo, mail, frontendURL+"/accept-invite", invitationTTL)
+		invitationHandler   = handlers.NewInvitationHandler(invitationService, settingService, policyService, auditService)
+		profileHandler      = handlers.NewProfileHandler(service.NewProfileService(userRepo), userService, maxAvatarBytes)
+		calendarFeedService = service.NewCalendarFeedService(repository.NewCalendarFeedRepository(db), userRepo, todoRepo)
+		calendarFeedHandler = handlers.NewCalendarFeedHandler(calendarFeedService, auditService, apiBaseURL+"/feeds")
+		caldavHandler       = handlers.NewCalDAVHandler(todoService, userService, policyService, hub, apiBaseURL+"/caldav")
+		notificationService = service.NewNotificationService(repository.NewNotificationRepository(db), userRepo, hub, mail, frontendURL)
+		notificationHandler = handlers.NewNotificationHandler(notificationService)
+		reminderService     = service.NewReminderService(repository.NewReminderRepository(db), todoRepo, userRepo, policyService, notificationService)
+		reminderHandler     = handlers.NewReminderHandler(reminderService, todoService, userService, policyService)
+		escalationService   = service.NewEscalationService(repository.NewEscalationRepository(db), repository.NewTodoEventRepository(db), todoRepo, userRepo, projectRepo, notificationService)
+		escalationHandler   = handlers.NewEscalationHandler(escalationService, todoService, policyService, auditService)
+		digestService       = service.NewDigestService(todoRepo, userRepo, repository.NewAccountTokenRepository(db), mail, frontendURL, apiBaseURL+"/digest/unsubscribe")
+		digestHandler       = handlers.NewDigestHandler(digestService, userService)
 	)
 
+	go func() {
+		for range time.Tick(time.Hour) {
+			if _, err := idempotencyService.PurgeExpired(); err != nil {
+				log.Printf("Failed to purge idempotency keys: %v", err)
+			}
+			if _, err := rateLimitRepo.DeleteIdle(time.Now().Add(-24 * time.Hour)); err != nil {
+				log.Printf("Failed to purge rate limit buckets: %v", err)
+			}
+		}
+	}()
+
+	// Every replica runs the scheduler; reminders, escalations, digests and
+	// emails are claimed in the database, so each still goes out once.
+	go func() {
+		for now := range time.Tick(reminderInterval) {
+			if _, err := reminderService.Fire(now); err != nil {
+				log.Printf("Failed to fire reminders: %v", err)
+			}
+			if _, _, err := escalationService.Run(now); err != nil {
+				log.Printf("Failed to escalate overdue todos: %v", err)
+			}
+			if _, err := digestService.Send(now); err != nil {
+				log.Printf("Failed to send digests: %v", err)
+			}
+			if err := notificationService.Deliver(now); err != nil {
+				log.Printf("Failed to deliver notifications: %v", err)
+			}
+		}
+	}()
+
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", "If-Match", "Idempotency-Key"},
+		ExposeHeaders:    []string{"Content-Length", "ETag", "Idempotent-Replayed"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
-	router.POST("/register", userHandler.Register)
-	router.POST("/login", userHandler.Login)
+	if proxies := listFromEnv("TRUSTED_PROXIES"); len(proxies) > 0 {
+		if err := router.SetTrustedProxies(proxies); err != nil {
+			log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+		}
+	}
+
+	perIP := middlewares.RateLimit(rateLimitStore, "ip", ipLimit, middlewares.ClientIPKey)
+
+	router.POST("/register", perIP, invitationHandler.RequireOpenRegistration, userHandler.Register)
+	router.POST("/login", perIP, middlewares.RateLimit(rateLimitStore, "login", accountLimit, middlewares.JSONFieldKey("username")), userHandler.Login)
+	router.POST("/login/2fa", perIP, userHandler.LoginTwoFactor)
+	router.POST("/auth/refresh", userHandler.RefreshToken)
+	router.POST("/auth/forgot-password", perIP, middlewares.RateLimit(rateLimitStore, "forgot-password", accountLimit, middlewares.JSONFieldKey("email")), accountHandler.ForgotPassword)
+	router.POST("/auth/reset-password", perIP, accountHandler.ResetPassword)
+	router.GET("/auth/verify-email", accountHandler.VerifyEmail)
+	router.POST("/auth/verify-email", accountHandler.VerifyEmail)
+	router.GET("/digest/unsubscribe", digestHandler.ConfirmUnsubscribe)
+	router.POST("/digest/unsubscribe", digestHandler.Unsubscribe)
+	router.GET("/auth/invitation", perIP, invitationHandler.GetInvitation)
+	router.GET("/users/:id/avatar", profileHandler.GetAvatar)
+	router.GET("/feeds/:token", calendarFeedHandler.ServeFeed)
+	router.POST("/auth/accept-invitation", perIP, invitationHandler.AcceptInvitation)
+
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		provider := oidc.NewProvider(oidc.Config{
+			IssuerURL:    issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+			Scopes:       listFromEnv("OIDC_SCOPES"),
+			GroupsClaim:  os.Getenv("OIDC_GROUPS_CLAIM"),
+		})
+		oidcService := service.NewOIDCService(provider, repository.NewOIDCLoginStateRepository(db), userRepo, tokenService, listFromEnv("OIDC_ADMIN_GROUPS"))
+		oidcHandler := handlers.NewOIDCHandler(oidcService, auditService, os.Getenv("OIDC_POST_LOGIN_REDIRECT"))
+
+		router.GET("/auth/oidc/login", oidcHandler.Login)
+		router.GET("/auth/oidc/callback", oidcHandler.Callback)
+	}
 
 	userRouter := router.Group("/")
-	userRouter.Use(middlewares.AuthMiddleware())
+	userRouter.Use(
+		middlewares.AuthMiddleware(tokenService, patService),
+		middlewares.MethodScope(models.ScopeReadTodos, models.ScopeWriteTodos),
+		middlewares.IdempotencyMiddleware(idempotencyService),
+		middlewares.AuditImpersonation(auditService),
+	)
 	{
+		userRouter.POST("/logout", middlewares.RequireSession(), userHandler.Logout)
+
+		userRouter.GET("/tokens", middlewares.RequireSession(), patHandler.GetTokens)
+		userRouter.POST("/tokens", middlewares.RequireSession(), patHandler.CreateToken)
+		userRouter.DELETE("/tokens/:id", middlewares.RequireSession(), patHandler.RevokeToken)
+
+		userRouter.POST("/auth/verify-email/resend", middlewares.RequireSession(), accountHandler.ResendVerification)
+
+		userRouter.GET("/2fa", middlewares.RequireSession(), twoFactorHandler.GetStatus)
+		userRouter.POST("/2fa/enroll", middlewares.RequireSession(), twoFactorHandler.Enroll)
+		userRouter.POST("/2fa/confirm", middlewares.RequireSession(), twoFactorHandler.Confirm)
+		userRouter.POST("/2fa/recovery-codes", middlewares.RequireSession(), twoFactorHandler.RegenerateRecoveryCodes)
+		userRouter.POST("/2fa/disable", middlewares.RequireSession(), twoFactorHandler.Disable)
+
 		userRouter.GET("/roles", userHandler.CheckRoles)
-		userRouter.POST("/todos", todoHandler.CreateTodo)
+		userRouter.GET("/me", profileHandler.GetProfile)
+		userRouter.PUT("/me", profileHandler.UpdateProfile)
+		userRouter.PUT("/me/avatar", profileHandler.UploadAvatar)
+		userRouter.DELETE("/me/avatar", profileHandler.DeleteAvatar)
+		userRouter.GET("/me/calendar-feed", calendarFeedHandler.GetFeed)
+		userRouter.POST("/me/calendar-feed", middlewares.RequireSession(), calendarFeedHandler.RotateFeed)
+		userRouter.DELETE("/me/calendar-feed", middlewares.RequireSession(), calendarFeedHandler.DisableFeed)
+		userRouter.GET("/me/reminder-rules", reminderHandler.GetRules)
+		userRouter.POST("/me/reminder-rules", reminderHandler.CreateRule)
+		userRouter.DELETE("/me/reminder-rules/:id", reminderHandler.DeleteRule)
+		userRouter.GET("/me/digest", digestHandler.GetDigest)
+		userRouter.PUT("/me/digest", digestHandler.UpdateDigest)
+		userRouter.GET("/me/digest/preview", digestHandler.PreviewDigest)
+		userRouter.GET("/notifications", notificationHandler.GetNotifications)
+		userRouter.POST("/notifications/read", notificationHandler.MarkAllRead)
+		userRouter.POST("/notifications/:id/read", notificationHandler.MarkRead)
+		userRouter.POST("/todos", middlewares.RequirePermission(policyService, policy.TodoCreate), todoHandler.CreateTodo)
+		userRouter.POST("/todos/quick", middlewares.RequirePermission(policyService, policy.TodoCreate), todoHandler.QuickAddTodo)
+		userRouter.POST("/todos/bulk", todoHandler.BulkTodos)
 		userRouter.GET("/todos", todoHandler.GetTodos)
 		userRouter.GET("/todos/:id", todoHandler.GetTodo)
 		userRouter.PUT("/todos/:id", todoHandler.UpdateTodo)
+		userRouter.PATCH("/todos/:id", todoHandler.PatchTodo)
 		userRouter.DELETE("/todos/:id", todoHandler.DeleteTodo)
+		userRouter.GET("/todos/:id/reminders", reminderHandler.GetReminders)
+		userRouter.POST("/todos/:id/reminders", reminderHandler.CreateReminder)
+		userRouter.DELETE("/todos/:id/reminders/:reminderID", reminderHandler.DeleteReminder)
+		userRouter.GET("/todos/:id/history", escalationHandler.GetHistory)
+		userRouter.GET("/calendar", todoHandler.GetCalendar)
 
 		userRouter.GET("/users", userHandler.GetAllUsers)
 
+		userRouter.GET("/projects", projectHandler.GetProjects)
+		userRouter.POST("/projects", middlewares.RequirePermission(policyService, policy.ProjectCreate), projectHandler.CreateProject)
+		userRouter.GET("/projects/:id", projectHandler.GetProject)
+
+		userRouter.GET("/presence", hub.HandlePresence(todoAccess))
+
 		userRouter.GET("/task-templates", taskTemplateHandler.GetTaskTemplates)
-		userRouter.POST("/task-templates", taskTemplateHandler.CreateTaskTemplate)
+		userRouter.POST("/task-templates", middlewares.RequirePermission(policyService, policy.TemplateCreate), taskTemplateHandler.CreateTaskTemplate)
 		userRouter.GET("/task-templates/:id", taskTemplateHandler.GetTaskTemplate)
 		userRouter.PUT("/task-templates/:id", taskTemplateHandler.UpdateTaskTemplate)
+		userRouter.PATCH("/task-templates/:id", taskTemplateHandler.PatchTaskTemplate)
 		userRouter.DELETE("/task-templates/:id", taskTemplateHandler.DeleteTaskTemplate)
 		userRouter.GET("/task-templates/owner/:ownerID", taskTemplateHandler.GetTaskTemplatesByOwnerID)
 	}
 
+	// CalDAV clients sign in with a username and a personal access token.
+	router.GET("/.well-known/caldav", caldavHandler.WellKnown)
+	router.Handle("PROPFIND", "/.well-known/caldav", caldavHandler.WellKnown)
+	caldavRouter := router.Group("/caldav")
+	caldavRouter.Use(
+		middlewares.BasicAuthMiddleware(patService, "todoapp"),
+		middlewares.MethodScope(models.ScopeReadTodos, models.ScopeWriteTodos),
+	)
+	{
+		caldavRouter.OPTIONS("/*path", caldavHandler.Options)
+		caldavRouter.Handle("PROPFIND", "/*path", caldavHandler.PropFind)
+		caldavRouter.Handle("REPORT", "/*path", caldavHandler.Report)
+		caldavRouter.GET("/*path", caldavHandler.GetResource)
+		caldavRouter.PUT("/*path", caldavHandler.PutResource)
+		caldavRouter.DELETE("/*path", caldavHandler.DeleteResource)
+	}
+
 	adminRouter := router.Group("/admin")
-	adminRouter.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	adminRouter.Use(
+		middlewares.AuthMiddleware(tokenService, patService),
+		middlewares.RequireTwoFactor(twoFactorService),
+		middlewares.RequireScope(models.ScopeAdminUsers),
+		middlewares.IdempotencyMiddleware(idempotencyService),
+	)
 	{
-		adminRouter.PUT("/role", userHandler.ChangeRole)
-		adminRouter.PUT("/users/:id", userHandler.UpdateUser)
-		adminRouter.GET("/users", userHandler.GetAllUsers)
-		adminRouter.POST("/users", userHandler.CreateUser)
-		adminRouter.DELETE("/users/:id", userHandler.DeleteUser)
+		requireUserManage := middlewares.RequirePermission(policyService, policy.UserManage)
+		adminRouter.PUT("/role", requireUserManage, userHandler.ChangeRole)
+		adminRouter.PUT("/users/:id", requireUserManage, userHandler.UpdateUser)
+		adminRouter.GET("/users", requireUserManage, userHandler.GetAllUsers)
+		adminRouter.POST("/users", requireUserManage, userHandler.CreateUser)
+		adminRouter.DELETE("/users/:id", requireUserManage, userHandler.DeleteUser)
+		adminRouter.POST("/users/:id/unlock", requireUserManage, userHandler.UnlockUser)
+		adminRouter.POST("/users/:id/deactivate", requireUserManage, userHandler.DeactivateUser)
+		adminRouter.POST("/users/:id/reactivate", requireUserManage, userHandler.ReactivateUser)
+		adminRouter.POST("/users/:id/transfer", requireUserManage, userHandler.TransferOwnership)
+		adminRouter.GET("/invitations", requireUserManage, invitationHandler.GetInvitations)
+		adminRouter.POST("/invitations", requireUserManage, invitationHandler.CreateInvitation)
+		adminRouter.POST("/invitations/:id/resend", requireUserManage, invitationHandler.ResendInvitation)
+		adminRouter.DELETE("/invitations/:id", requireUserManage, invitationHandler.RevokeInvitation)
+		adminRouter.GET("/settings", requireUserManage, invitationHandler.GetSettings)
+		adminRouter.PUT("/settings", requireUserManage, invitationHandler.UpdateSettings)
+		adminRouter.GET("/escalation-rules", requireUserManage, escalationHandler.GetRules)
+		adminRouter.POST("/escalation-rules", requireUserManage, escalationHandler.CreateRule)
+		adminRouter.PUT("/escalation-rules/:id", requireUserManage, escalationHandler.UpdateRule)
+		adminRouter.DELETE("/escalation-rules/:id", requireUserManage, escalationHandler.DeleteRule)
+		adminRouter.POST("/impersonate/:id", middlewares.RequireSession(), middlewares.RequirePermission(policyService, policy.UserImpersonate), userHandler.Impersonate)
+
+		requireRoleManage := middlewares.RequirePermission(policyService, policy.RoleManage)
+		adminRouter.GET("/roles", requireRoleManage, roleHandler.GetRoles)
+		adminRouter.POST("/roles", requireRoleManage, roleHandler.CreateRole)
+		adminRouter.PUT("/roles/:name", requireRoleManage, roleHandler.UpdateRole)
+		adminRouter.DELETE("/roles/:name", requireRoleManage, roleHandler.DeleteRole)
+
+		requireAuditRead := middlewares.RequirePermission(policyService, policy.AuditRead)
+		adminRouter.GET("/audit", requireAuditRead, auditHandler.GetAuditEvents)
+		adminRouter.GET("/audit/export", requireAuditRead, auditHandler.ExportAuditEvents)
 	}
 
 	port := os.Getenv("PORT")
@@ -110,9 +363,7 @@ func main() {
 		port = "8080"
 	}
 
-	router.GET("/ws", func(c *gin.Context) {
-		hub.HandleWebSocket(c)
-	})
+	router.GET("/ws", hub.HandleWebSocket(tokenService, todoAccess))
 
 	go func() {
 		hub.Broadcast <- []byte(`{"message": "Welcome to the chat room!"}`)
@@ -123,3 +374,53 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return duration
+}
+
+func intFromEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return n
+}
+
+func limitFromEnv(name, fallback string) ratelimit.Limit {
+	value := os.Getenv(name)
+	if value == "" {
+		value = fallback
+	}
+	limit, err := ratelimit.ParseLimit(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return limit
+}
+
+// urlFromEnv returns a base URL without a trailing slash, so paths can be
+// appended to it.
+func urlFromEnv(name, fallback string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		value = fallback
+	}
+	return strings.TrimRight(value, "/")
+}
+
+func listFromEnv(name string) []string {
+	return strings.FieldsFunc(os.Getenv(name), func(r rune) bool { return r == ',' || r == ' ' })
+}
@@ -0,0 +1,82 @@
+// Package avatar turns uploaded pictures into small square JPEGs, so the
+// app stores and serves one predictable size whatever users upload.
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	// Register the formats users are likely to upload.
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	ContentType = "image/jpeg"
+
+	// Size is the width and height of a processed avatar in pixels.
+	Size = 256
+
+	// MaxPixels bounds the decoded size of an upload, so a small file that
+	// claims huge dimensions cannot exhaust memory.
+	MaxPixels = 40_000_000
+
+	quality = 85
+)
+
+var (
+	ErrUnsupportedImage = errors.New("avatar must be a JPEG, PNG, GIF or WebP image")
+	ErrImageTooLarge    = errors.New("avatar dimensions are too large")
+)
+
+// Process decodes an uploaded image, crops it to a centered square and
+// scales it to Size. Transparent areas become white.
+func Process(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrImageTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, Size, Size))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, centerSquare(src.Bounds()), draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func centerSquare(bounds image.Rectangle) image.Rectangle {
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	return image.Rect(x, y, x+side, y+side)
+}
@@ -0,0 +1,281 @@
+// Package caldav reads WebDAV and CalDAV request bodies and writes the
+// multistatus responses that PROPFIND and REPORT answer with. It only covers
+// what a task list needs: property queries, calendar-query and
+// calendar-multiget.
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	NamespaceDAV            = "DAV:"
+	NamespaceCalDAV         = "urn:ietf:params:xml:ns:caldav"
+	NamespaceCalendarServer = "http://calendarserver.org/ns/"
+
+	ContentType = "application/xml; charset=utf-8"
+)
+
+var (
+	ErrInvalidRequest     = errors.New("invalid WebDAV request body")
+	ErrUnsupportedRequest = errors.New("unsupported WebDAV request")
+)
+
+var prefixes = map[string]string{
+	NamespaceDAV:            "d",
+	NamespaceCalDAV:         "c",
+	NamespaceCalendarServer: "cs",
+}
+
+// Request kinds, named by the root element of the body.
+var (
+	PropFind = xml.Name{Space: NamespaceDAV, Local: "propfind"}
+	Query    = xml.Name{Space: NamespaceCalDAV, Local: "calendar-query"}
+	MultiGet = xml.Name{Space: NamespaceCalDAV, Local: "calendar-multiget"}
+)
+
+// Request is a parsed PROPFIND or REPORT body. AllProp is set when the
+// client asks for every property, including by sending no body at all.
+type Request struct {
+	Kind    xml.Name
+	AllProp bool
+	Props   []xml.Name
+	// Hrefs lists the resources a calendar-multiget asks for.
+	Hrefs []string
+	// Components lists the comp-filter names of a calendar-query, outermost
+	// first, such as VCALENDAR then VTODO.
+	Components []string
+}
+
+// Wants reports whether the request asks for the property.
+func (r *Request) Wants(name xml.Name) bool {
+	for _, prop := range r.Props {
+		if prop == name {
+			return true
+		}
+	}
+	return false
+}
+
+// node is a generic XML element, enough to walk any request body.
+type node struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []node     `xml:",any"`
+	Text     string     `xml:",chardata"`
+}
+
+func (n *node) child(name xml.Name) *node {
+	for i := range n.Children {
+		if n.Children[i].XMLName == name {
+			return &n.Children[i]
+		}
+	}
+	return nil
+}
+
+func (n *node) attr(local string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// ParseRequest reads a PROPFIND or REPORT body.
+func ParseRequest(r io.Reader) (*Request, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &Request{Kind: PropFind, AllProp: true}, nil
+	}
+
+	var root node
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, ErrInvalidRequest
+	}
+
+	request := &Request{Kind: root.XMLName}
+	switch root.XMLName {
+	case PropFind, Query, MultiGet:
+	default:
+		return nil, ErrUnsupportedRequest
+	}
+
+	if root.child(xml.Name{Space: NamespaceDAV, Local: "allprop"}) != nil {
+		request.AllProp = true
+	}
+	if prop := root.child(xml.Name{Space: NamespaceDAV, Local: "prop"}); prop != nil {
+		for _, child := range prop.Children {
+			request.Props = append(request.Props, child.XMLName)
+		}
+	} else if root.XMLName == PropFind {
+		request.AllProp = true
+	}
+
+	for _, child := range root.Children {
+		if child.XMLName == (xml.Name{Space: NamespaceDAV, Local: "href"}) {
+			request.Hrefs = append(request.Hrefs, strings.TrimSpace(child.Text))
+		}
+	}
+
+	if filter := root.child(xml.Name{Space: NamespaceCalDAV, Local: "filter"}); filter != nil {
+		compFilter := xml.Name{Space: NamespaceCalDAV, Local: "comp-filter"}
+		for current := filter.child(compFilter); current != nil; current = current.child(compFilter) {
+			request.Components = append(request.Components, strings.ToUpper(current.attr("name")))
+		}
+	}
+
+	return request, nil
+}
+
+// Prop is a property with its value as XML, already escaped.
+type Prop struct {
+	Name  xml.Name
+	Value string
+}
+
+// Response is one resource in a multistatus. A resource that could not be
+// read at all has Status set and no properties.
+type Response struct {
+	Href    string
+	Status  int
+	Props   []Prop
+	Missing []xml.Name
+}
+
+// Select answers a request from the properties a resource has: the ones
+// asked for that exist, and the names of those that do not. AllProp returns
+// everything except calendar-data, which must be asked for by name.
+func Select(href string, available []Prop, request *Request) Response {
+	response := Response{Href: href}
+	if request.AllProp {
+		for _, prop := range available {
+			if prop.Name != CalendarData {
+				response.Props = append(response.Props, prop)
+			}
+		}
+		return response
+	}
+
+	for _, name := range request.Props {
+		found := false
+		for _, prop := range available {
+			if prop.Name == name {
+				response.Props = append(response.Props, prop)
+				found = true
+				break
+			}
+		}
+		if !found {
+			response.Missing = append(response.Missing, name)
+		}
+	}
+	return response
+}
+
+// Property names the server knows.
+var (
+	ResourceType            = xml.Name{Space: NamespaceDAV, Local: "resourcetype"}
+	DisplayName             = xml.Name{Space: NamespaceDAV, Local: "displayname"}
+	CurrentUserPrincipal    = xml.Name{Space: NamespaceDAV, Local: "current-user-principal"}
+	PrincipalURL            = xml.Name{Space: NamespaceDAV, Local: "principal-URL"}
+	GetETag                 = xml.Name{Space: NamespaceDAV, Local: "getetag"}
+	GetContentType          = xml.Name{Space: NamespaceDAV, Local: "getcontenttype"}
+	GetLastModified         = xml.Name{Space: NamespaceDAV, Local: "getlastmodified"}
+	SupportedReportSet      = xml.Name{Space: NamespaceDAV, Local: "supported-report-set"}
+	CurrentUserPrivilegeSet = xml.Name{Space: NamespaceDAV, Local: "current-user-privilege-set"}
+	CalendarHomeSet         = xml.Name{Space: NamespaceCalDAV, Local: "calendar-home-set"}
+	CalendarData            = xml.Name{Space: NamespaceCalDAV, Local: "calendar-data"}
+	SupportedComponentSet   = xml.Name{Space: NamespaceCalDAV, Local: "supported-calendar-component-set"}
+	GetCTag                 = xml.Name{Space: NamespaceCalendarServer, Local: "getctag"}
+)
+
+// Resource types.
+var (
+	Collection = xml.Name{Space: NamespaceDAV, Local: "collection"}
+	Principal  = xml.Name{Space: NamespaceDAV, Local: "principal"}
+	Calendar   = xml.Name{Space: NamespaceCalDAV, Local: "calendar"}
+)
+
+// Element writes an empty element, such as <d:collection/> in a
+// resourcetype.
+func Element(name xml.Name) string {
+	open, _ := tag(name)
+	return "<" + open + "/>"
+}
+
+// Href writes an href element for a path.
+func Href(path string) string {
+	return "<d:href>" + Escape(path) + "</d:href>"
+}
+
+// Escape escapes text for use as element content.
+func Escape(text string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// WriteMultistatus writes a 207 Multi-Status body.
+func WriteMultistatus(w io.Writer, responses []Response) error {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="` + NamespaceCalDAV + `" xmlns:cs="` + NamespaceCalendarServer + `">`)
+	for _, response := range responses {
+		b.WriteString("<d:response>")
+		b.WriteString(Href(response.Href))
+		if response.Status != 0 {
+			b.WriteString(statusLine(response.Status))
+		}
+		if len(response.Props) > 0 {
+			b.WriteString("<d:propstat><d:prop>")
+			for _, prop := range response.Props {
+				open, close := tag(prop.Name)
+				if prop.Value == "" {
+					b.WriteString("<" + open + "/>")
+				} else {
+					b.WriteString("<" + open + ">" + prop.Value + "</" + close + ">")
+				}
+			}
+			b.WriteString("</d:prop>" + statusLine(http.StatusOK) + "</d:propstat>")
+		}
+		if len(response.Missing) > 0 {
+			b.WriteString("<d:propstat><d:prop>")
+			for _, name := range response.Missing {
+				b.WriteString(Element(name))
+			}
+			b.WriteString("</d:prop>" + statusLine(http.StatusNotFound) + "</d:propstat>")
+		}
+		b.WriteString("</d:response>")
+	}
+	b.WriteString("</d:multistatus>")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// tag returns the opening and closing tag names for an element, declaring
+// its namespace inline when it has no prefix.
+func tag(name xml.Name) (string, string) {
+	if prefix, ok := prefixes[name.Space]; ok {
+		qualified := prefix + ":" + name.Local
+		return qualified, qualified
+	}
+	var space strings.Builder
+	xml.EscapeText(&space, []byte(name.Space))
+	return fmt.Sprintf(`%s xmlns="%s"`, name.Local, space.String()), name.Local
+}
+
+func statusLine(code int) string {
+	return fmt.Sprintf("<d:status>HTTP/1.1 %d %s</d:status>", code, http.StatusText(code))
+}
@@ -0,0 +1,73 @@
+// Package digest renders the digest email from its HTML and plain-text
+// templates.
+package digest
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+//go:embed templates
+var templates embed.FS
+
+var (
+	htmlTemplate        = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/digest.html"))
+	textTemplate        = texttemplate.Must(texttemplate.ParseFS(templates, "templates/digest.txt"))
+	unsubscribeTemplate = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/unsubscribe.html"))
+)
+
+// Digest is what one digest email says.
+type Digest struct {
+	Name           string
+	Title          string
+	Date           string
+	Sections       []Section
+	AppURL         string
+	UnsubscribeURL string
+}
+
+// Section is a heading such as "Overdue" with the todos under it.
+type Section struct {
+	Title string
+	Items []Item
+}
+
+type Item struct {
+	Name   string
+	Detail string
+}
+
+// Empty reports whether the digest has nothing to say.
+func (d *Digest) Empty() bool {
+	for _, section := range d.Sections {
+		if len(section.Items) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Render returns the plain-text and HTML bodies of the digest.
+func Render(d *Digest) (string, string, error) {
+	var text, html bytes.Buffer
+	if err := textTemplate.Execute(&text, d); err != nil {
+		return "", "", err
+	}
+	if err := htmlTemplate.Execute(&html, d); err != nil {
+		return "", "", err
+	}
+	return text.String(), html.String(), nil
+}
+
+// RenderUnsubscribe returns the page behind the unsubscribe link: a button
+// that posts token back while done is false, and a confirmation after.
+func RenderUnsubscribe(token string, done bool) (string, error) {
+	var html bytes.Buffer
+	err := unsubscribeTemplate.Execute(&html, struct {
+		Token string
+		Done  bool
+	}{token, done})
+	return html.String(), err
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+type AccountHandler struct {
+	userService  *service.UserService
+	auditService *service.AuditService
+	service      *service.AccountService
+}
+
+func NewAccountHandler(service *service.AccountService, userService *service.UserService, auditService *service.AuditService) *AccountHandler {
+	return &AccountHandler{
+		service:      service,
+		userService:  userService,
+		auditService: auditService,
+	}
+}
+
+func (h *AccountHandler) ForgotPassword(c *gin.Context) {
+
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The answer must not depend on whether the address is known, so
+	// failures are only logged.
+	if err := h.service.ForgotPassword(req.Email); err != nil {
+		log.Printf("Failed to send password reset email: %v", err)
+	}
+
+	event := newAuditEvent(c, models.AuditPasswordResetRequest)
+	event.SetDetail("email", req.Email)
+	h.auditService.Record(event)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the address belongs to an account, a reset link has been sent"})
+}
+
+func (h *AccountHandler) ResetPassword(c *gin.Context) {
+
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditPasswordReset)
+
+	user, err := h.service.ResetPassword(req.Token, req.Password)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAccountToken) {
+			event.Fail("invalid_token")
+			h.auditService.Record(event)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	event.SetActor(user)
+	event.SetTarget(models.AuditTargetUser, user.ID, user.Username)
+	h.auditService.Record(event)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+// VerifyEmail accepts the token as JSON body or, for links opened straight
+// from the email, as the "token" query parameter.
+func (h *AccountHandler) VerifyEmail(c *gin.Context) {
+
+	var req VerifyEmailRequest
+	if c.Request.Method == http.MethodGet {
+		req.Token = c.Query("token")
+		if req.Token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
+			return
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.service.VerifyEmail(req.Token)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAccountToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditEmailVerified)
+	event.SetActor(user)
+	event.SetTarget(models.AuditTargetUser, user.ID, user.Username)
+	event.SetDetail("email", user.Email)
+	h.auditService.Record(event)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email address verified"})
+}
+
+func (h *AccountHandler) ResendVerification(c *gin.Context) {
+
+	userClaims, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	claims, ok := userClaims.(*models.Claims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
+		return
+	}
+
+	user, err := h.userService.GetUserByID(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := h.service.SendEmailVerification(user); err != nil {
+		if errors.Is(err, service.ErrEmailAlreadyVerified) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+}
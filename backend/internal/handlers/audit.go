@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+// newAuditEvent starts an audit event for the request. The authenticated
+// user, if there is one, is the actor.
+func newAuditEvent(c *gin.Context, action string) *models.AuditEvent {
+	event := &models.AuditEvent{
+		Action:    action,
+		Outcome:   models.AuditSuccess,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+
+	if user, exists := c.Get("user"); exists {
+		if claims, ok := user.(*models.Claims); ok {
+			if claims.Impersonator != nil {
+				event.SetImpersonation(claims)
+			} else {
+				id := claims.UserID
+				event.ActorID = &id
+				event.ActorName = claims.Username
+			}
+		}
+	}
+
+	return event
+}
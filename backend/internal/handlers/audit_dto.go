@@ -0,0 +1,12 @@
+package handlers
+
+import (
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+type AuditEventListResponse struct {
+	Events []models.AuditEvent `json:"events"`
+	Total  int64               `json:"total"`
+	Limit  int                 `json:"limit"`
+	Offset int                 `json:"offset"`
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type AuditHandler struct {
+	service *service.AuditService
+}
+
+func NewAuditHandler(service *service.AuditService) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+func (h *AuditHandler) GetAuditEvents(c *gin.Context) {
+
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit := defaultAuditLimit
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxAuditLimit)})
+			return
+		}
+	}
+	offset := 0
+	if value := c.Query("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return
+		}
+	}
+
+	events, total, err := h.service.List(filter, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, AuditEventListResponse{Events: events, Total: total, Limit: limit, Offset: offset})
+}
+
+// ExportAuditEvents streams every matching event as JSON Lines, oldest
+// first. Collectors pass the last ID they saw as after_id to continue.
+func (h *AuditHandler) ExportAuditEvents(c *gin.Context) {
+
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	c.Status(http.StatusOK)
+
+	// The status is already sent, so a failure can only cut the stream short.
+	if err := h.service.Export(filter, c.Writer); err != nil {
+		log.Printf("Failed to export audit events: %v", err)
+	}
+}
+
+func parseAuditFilter(c *gin.Context) (repository.AuditFilter, error) {
+	filter := repository.AuditFilter{
+		Outcome:    c.Query("outcome"),
+		TargetType: c.Query("target_type"),
+		IP:         c.Query("ip"),
+	}
+
+	if value := c.Query("action"); value != "" {
+		filter.Actions = strings.Split(value, ",")
+	}
+
+	var err error
+	if filter.ActorID, err = optionalUintQuery(c, "actor_id"); err != nil {
+		return filter, err
+	}
+	if filter.TargetID, err = optionalUintQuery(c, "target_id"); err != nil {
+		return filter, err
+	}
+	if afterID, err := optionalUintQuery(c, "after_id"); err != nil {
+		return filter, err
+	} else if afterID != nil {
+		filter.AfterID = *afterID
+	}
+	if filter.From, err = optionalTimeQuery(c, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = optionalTimeQuery(c, "to"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+func optionalUintQuery(c *gin.Context, name string) (*uint, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil, errors.New("invalid " + name)
+	}
+	id := uint(n)
+	return &id, nil
+}
+
+func optionalTimeQuery(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errors.New(name + " must be an RFC 3339 timestamp")
+	}
+	return &t, nil
+}
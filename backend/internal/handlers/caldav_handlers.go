@@ -0,0 +1,617 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/caldav"
+	"github.com/harrisin2037/todoapp/internal/ical"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/policy"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/websocket"
+)
+
+// The CalDAV tree is
+//
+//	/                             service root
+//	/principals/<username>/       the user
+//	/calendars/<username>/        their calendar home
+//	/calendars/<username>/todos/  the task list: todos they own or are assigned to
+//	/calendars/<username>/todos/<name>.ics
+//
+// where a todo's resource name is the one its CalDAV client chose, or
+// todo-<id>.ics for todos created anywhere else.
+type davKind int
+
+const (
+	davRoot davKind = iota
+	davPrincipal
+	davHome
+	davCollection
+	davObject
+)
+
+const (
+	davCollectionName = "todos"
+	davAllowedMethods = "OPTIONS, GET, PUT, DELETE, PROPFIND, REPORT"
+)
+
+type davPath struct {
+	kind     davKind
+	username string
+	name     string
+}
+
+type CalDAVHandler struct {
+	hub           *websocket.Hub
+	userService   *service.UserService
+	policyService *service.PolicyService
+	service       *service.TodoService
+	basePath      string
+	domain        string
+}
+
+// NewCalDAVHandler serves CalDAV under baseURL, the public address of the
+// /caldav route. Its path prefixes every href and its host names the UIDs
+// of todos created outside CalDAV, matching the calendar feed.
+func NewCalDAVHandler(service *service.TodoService, userService *service.UserService, policyService *service.PolicyService, hub *websocket.Hub, baseURL string) *CalDAVHandler {
+	basePath, domain := "/caldav", "todoapp"
+	if parsed, err := url.Parse(baseURL); err == nil {
+		if parsed.Path != "" {
+			basePath = strings.TrimRight(parsed.Path, "/")
+		}
+		if parsed.Hostname() != "" {
+			domain = parsed.Hostname()
+		}
+	}
+	return &CalDAVHandler{
+		service:       service,
+		userService:   userService,
+		policyService: policyService,
+		hub:           hub,
+		basePath:      basePath,
+		domain:        domain,
+	}
+}
+
+// WellKnown points clients that only know the server's address at the
+// service root.
+func (h *CalDAVHandler) WellKnown(c *gin.Context) {
+	c.Redirect(http.StatusMovedPermanently, h.basePath+"/")
+}
+
+func (h *CalDAVHandler) Options(c *gin.Context) {
+	c.Header("DAV", "1, calendar-access")
+	c.Header("Allow", davAllowedMethods)
+	c.Status(http.StatusOK)
+}
+
+func (h *CalDAVHandler) PropFind(c *gin.Context) {
+
+	claims := c.MustGet("user").(*models.Claims)
+
+	path, ok := h.resolvePath(c, claims)
+	if !ok {
+		return
+	}
+
+	request, err := caldav.ParseRequest(c.Request.Body)
+	if err == nil && request.Kind != caldav.PropFind {
+		err = caldav.ErrUnsupportedRequest
+	}
+	if err != nil {
+		respondDAVRequestError(c, err)
+		return
+	}
+
+	// Depth infinity is treated as 1; the tree is never deeper than that
+	// below a collection.
+	depth := c.GetHeader("Depth")
+	if depth == "" {
+		depth = "infinity"
+	}
+
+	var responses []caldav.Response
+	switch path.kind {
+	case davObject:
+		todo, err := h.findTodo(claims.UserID, path.name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if todo == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+			return
+		}
+		responses = append(responses, caldav.Select(h.objectHref(claims.Username, *todo), h.objectProps(*todo), request))
+	case davCollection:
+		todos, err := h.service.GetOwnedOrAssigned(claims.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		responses = append(responses, caldav.Select(h.collectionHref(claims.Username), h.collectionProps(claims, todos), request))
+		if depth != "0" {
+			for _, todo := range todos {
+				responses = append(responses, caldav.Select(h.objectHref(claims.Username, todo), h.objectProps(todo), request))
+			}
+		}
+	case davHome:
+		responses = append(responses, caldav.Select(h.homeHref(claims.Username), h.homeProps(claims), request))
+		if depth != "0" {
+			todos, err := h.service.GetOwnedOrAssigned(claims.UserID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			responses = append(responses, caldav.Select(h.collectionHref(claims.Username), h.collectionProps(claims, todos), request))
+		}
+	case davPrincipal:
+		responses = append(responses, caldav.Select(h.principalHref(claims.Username), h.principalProps(claims, true), request))
+	default:
+		responses = append(responses, caldav.Select(h.basePath+"/", h.principalProps(claims, false), request))
+	}
+
+	h.respondMultistatus(c, responses)
+}
+
+// Report answers calendar-multiget and calendar-query on the task list.
+// calendar-query only looks at which component is asked for: the list is
+// small enough to hand over whole and let the client narrow it further.
+func (h *CalDAVHandler) Report(c *gin.Context) {
+
+	claims := c.MustGet("user").(*models.Claims)
+
+	path, ok := h.resolvePath(c, claims)
+	if !ok {
+		return
+	}
+	if path.kind != davCollection {
+		c.Header("Allow", "OPTIONS, PROPFIND")
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Reports are only supported on the task list"})
+		return
+	}
+
+	request, err := caldav.ParseRequest(c.Request.Body)
+	if err == nil && request.Kind == caldav.PropFind {
+		err = caldav.ErrUnsupportedRequest
+	}
+	if err != nil {
+		respondDAVRequestError(c, err)
+		return
+	}
+
+	responses := []caldav.Response{}
+	switch request.Kind {
+	case caldav.MultiGet:
+		for _, href := range request.Hrefs {
+			target, ok := h.parsePath(href)
+			if !ok || target.kind != davObject || !strings.EqualFold(target.username, claims.Username) {
+				responses = append(responses, caldav.Response{Href: href, Status: http.StatusNotFound})
+				continue
+			}
+			todo, err := h.findTodo(claims.UserID, target.name)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if todo == nil {
+				responses = append(responses, caldav.Response{Href: href, Status: http.StatusNotFound})
+				continue
+			}
+			responses = append(responses, caldav.Select(href, h.objectProps(*todo), request))
+		}
+	case caldav.Query:
+		if len(request.Components) > 1 && request.Components[1] != "VTODO" {
+			break
+		}
+		todos, err := h.service.GetOwnedOrAssigned(claims.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, todo := range todos {
+			responses = append(responses, caldav.Select(h.objectHref(claims.Username, todo), h.objectProps(todo), request))
+		}
+	}
+
+	h.respondMultistatus(c, responses)
+}
+
+func (h *CalDAVHandler) GetResource(c *gin.Context) {
+
+	claims := c.MustGet("user").(*models.Claims)
+
+	todo, ok := h.objectTodo(c, claims)
+	if !ok {
+		return
+	}
+
+	setETag(c, todo.Version)
+	c.Header("Last-Modified", todo.UpdatedAt.UTC().Format(http.TimeFormat))
+	c.Data(http.StatusOK, ical.ContentType, []byte(h.calendarData(*todo)))
+}
+
+// PutResource stores a client's VTODO, creating the todo when the resource
+// does not exist yet. Updates go through the same version check, save and
+// websocket broadcast as UpdateTodo. No ETag is returned because the stored
+// VTODO is rewritten rather than kept byte for byte, which tells the client
+// to fetch it again.
+func (h *CalDAVHandler) PutResource(c *gin.Context) {
+
+	claims := c.MustGet("user").(*models.Claims)
+
+	path, ok := h.resolvePath(c, claims)
+	if !ok {
+		return
+	}
+	if path.kind != davObject {
+		c.Header("Allow", "OPTIONS, PROPFIND, REPORT")
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Only tasks can be written"})
+		return
+	}
+
+	subject, ok := requestSubject(c, h.policyService)
+	if !ok {
+		return
+	}
+
+	user, err := h.userService.GetUserByID(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	calendar, err := ical.Decode(c.Request.Body)
+	if err != nil || calendar.Name != "VCALENDAR" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ical.ErrInvalidCalendar.Error()})
+		return
+	}
+	component := calendar.Child("VTODO")
+	if component == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only VTODO resources can be stored"})
+		return
+	}
+
+	todo, err := h.findTodo(claims.UserID, path.name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	expectedVersion, hasIfMatch, err := ifMatchVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	switch {
+	case todo != nil && strings.TrimSpace(c.GetHeader("If-None-Match")) == "*":
+		respondPreconditionFailed(c, todo)
+		return
+	case todo == nil && c.GetHeader("If-Match") != "":
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Todo not found"})
+		return
+	case todo != nil && hasIfMatch && expectedVersion != todo.Version:
+		respondPreconditionFailed(c, todo)
+		return
+	}
+
+	if todo == nil {
+		h.createResource(c, subject, user, path.name, component)
+		return
+	}
+
+	if !h.policyService.CanTodo(subject, policy.TodoUpdate, todo) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to update this todo"})
+		return
+	}
+
+	if err := ical.ApplyTodo(component, todo, user.Location()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.UpdateTodo(todo); err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			current, err := h.service.GetTodo(todo.ID)
+			if err != nil || current == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+				return
+			}
+			respondPreconditionFailed(c, current)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.hub.Broadcast <- todoUpdatedMessage(todo)
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *CalDAVHandler) createResource(c *gin.Context, subject policy.Subject, owner *models.User, name string, component *ical.Component) {
+
+	if !h.policyService.Can(subject, policy.TodoCreate) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permission " + string(policy.TodoCreate) + " required"})
+		return
+	}
+
+	todo := &models.Todo{
+		OwnerID:    owner.ID,
+		Owner:      *owner,
+		Assignees:  []models.User{},
+		CalDAVName: name,
+	}
+	if uid, ok := component.Get("UID"); ok {
+		todo.ICalUID = uid.Value
+	}
+	if err := ical.ApplyTodo(component, todo, owner.Location()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.CreateTodo(todo, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.hub.Broadcast <- []byte(`{"message": "new todo created"}`)
+
+	c.Status(http.StatusCreated)
+}
+
+func (h *CalDAVHandler) DeleteResource(c *gin.Context) {
+
+	claims := c.MustGet("user").(*models.Claims)
+
+	subject, ok := requestSubject(c, h.policyService)
+	if !ok {
+		return
+	}
+
+	todo, ok := h.objectTodo(c, claims)
+	if !ok {
+		return
+	}
+
+	if !h.policyService.CanTodo(subject, policy.TodoDelete, todo) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to delete this todo"})
+		return
+	}
+
+	expectedVersion, hasIfMatch, err := ifMatchVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if hasIfMatch && expectedVersion != todo.Version {
+		respondPreconditionFailed(c, todo)
+		return
+	}
+
+	if err := h.service.DeleteTodo(todo.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// objectTodo resolves the request path to a todo in the user's task list,
+// responding with an error when it is not one.
+func (h *CalDAVHandler) objectTodo(c *gin.Context, claims *models.Claims) (*models.Todo, bool) {
+	path, ok := h.resolvePath(c, claims)
+	if !ok {
+		return nil, false
+	}
+	if path.kind != davObject {
+		c.Header("Allow", "OPTIONS, PROPFIND, REPORT")
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Not a task"})
+		return nil, false
+	}
+
+	todo, err := h.findTodo(claims.UserID, path.name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if todo == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+		return nil, false
+	}
+	return todo, true
+}
+
+// findTodo looks a resource name up in userID's task list, or returns nil.
+func (h *CalDAVHandler) findTodo(userID uint, name string) (*models.Todo, error) {
+	todo, err := h.service.GetTodoByCalDAVName(userID, name)
+	if err != nil || todo != nil {
+		return todo, err
+	}
+
+	digits := strings.TrimSuffix(strings.TrimPrefix(name, "todo-"), ".ics")
+	id, err := strconv.ParseUint(digits, 10, 32)
+	if err != nil || "todo-"+digits+".ics" != name {
+		return nil, nil
+	}
+
+	todo, err = h.service.GetTodo(uint(id))
+	if err != nil || todo == nil {
+		return nil, err
+	}
+	// Todos created over CalDAV are only reachable under their own name.
+	if todo.CalDAVName != "" {
+		return nil, nil
+	}
+	if todo.OwnerID == userID {
+		return todo, nil
+	}
+	for _, assignee := range todo.Assignees {
+		if assignee.ID == userID {
+			return todo, nil
+		}
+	}
+	return nil, nil
+}
+
+// resolvePath parses the request path, refusing paths of other users.
+func (h *CalDAVHandler) resolvePath(c *gin.Context, claims *models.Claims) (davPath, bool) {
+	path, ok := h.parsePath(h.basePath + c.Param("path"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return davPath{}, false
+	}
+	if path.kind != davRoot && !strings.EqualFold(path.username, claims.Username) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only access your own task list"})
+		return davPath{}, false
+	}
+	return path, true
+}
+
+// parsePath reads a path or href below the service root.
+func (h *CalDAVHandler) parsePath(raw string) (davPath, bool) {
+	if parsed, err := url.Parse(raw); err == nil {
+		raw = parsed.Path
+	}
+	rest, ok := strings.CutPrefix(raw, h.basePath)
+	if !ok {
+		return davPath{}, false
+	}
+
+	segments := []string{}
+	for _, segment := range strings.Split(rest, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	switch {
+	case len(segments) == 0:
+		return davPath{kind: davRoot}, true
+	case len(segments) == 2 && segments[0] == "principals":
+		return davPath{kind: davPrincipal, username: segments[1]}, true
+	case len(segments) == 2 && segments[0] == "calendars":
+		return davPath{kind: davHome, username: segments[1]}, true
+	case len(segments) == 3 && segments[0] == "calendars" && segments[2] == davCollectionName:
+		return davPath{kind: davCollection, username: segments[1]}, true
+	case len(segments) == 4 && segments[0] == "calendars" && segments[2] == davCollectionName && strings.HasSuffix(segments[3], ".ics"):
+		return davPath{kind: davObject, username: segments[1], name: segments[3]}, true
+	}
+	return davPath{}, false
+}
+
+func (h *CalDAVHandler) principalHref(username string) string {
+	return h.basePath + "/principals/" + url.PathEscape(username) + "/"
+}
+
+func (h *CalDAVHandler) homeHref(username string) string {
+	return h.basePath + "/calendars/" + url.PathEscape(username) + "/"
+}
+
+func (h *CalDAVHandler) collectionHref(username string) string {
+	return h.homeHref(username) + davCollectionName + "/"
+}
+
+func (h *CalDAVHandler) objectHref(username string, todo models.Todo) string {
+	return h.collectionHref(username) + url.PathEscape(davResourceName(todo))
+}
+
+func davResourceName(todo models.Todo) string {
+	if todo.CalDAVName != "" {
+		return todo.CalDAVName
+	}
+	return fmt.Sprintf("todo-%d.ics", todo.ID)
+}
+
+// principalProps describes the service root, or the principal itself when
+// isPrincipal is set. Both lead the client to the calendar home.
+func (h *CalDAVHandler) principalProps(claims *models.Claims, isPrincipal bool) []caldav.Prop {
+	resourceType := caldav.Element(caldav.Collection)
+	if isPrincipal {
+		resourceType += caldav.Element(caldav.Principal)
+	}
+	return []caldav.Prop{
+		{Name: caldav.ResourceType, Value: resourceType},
+		{Name: caldav.DisplayName, Value: caldav.Escape(claims.Username)},
+		{Name: caldav.CurrentUserPrincipal, Value: caldav.Href(h.principalHref(claims.Username))},
+		{Name: caldav.PrincipalURL, Value: caldav.Href(h.principalHref(claims.Username))},
+		{Name: caldav.CalendarHomeSet, Value: caldav.Href(h.homeHref(claims.Username))},
+	}
+}
+
+func (h *CalDAVHandler) homeProps(claims *models.Claims) []caldav.Prop {
+	return []caldav.Prop{
+		{Name: caldav.ResourceType, Value: caldav.Element(caldav.Collection)},
+		{Name: caldav.CurrentUserPrincipal, Value: caldav.Href(h.principalHref(claims.Username))},
+	}
+}
+
+// collectionProps describes the task list. Its ctag changes whenever a
+// todo in it is added, removed or updated, so clients know to sync.
+func (h *CalDAVHandler) collectionProps(claims *models.Claims, todos []models.Todo) []caldav.Prop {
+	hash := sha256.New()
+	for _, todo := range todos {
+		fmt.Fprintf(hash, "%d:%d;", todo.ID, todo.Version)
+	}
+
+	return []caldav.Prop{
+		{Name: caldav.ResourceType, Value: caldav.Element(caldav.Collection) + caldav.Element(caldav.Calendar)},
+		{Name: caldav.DisplayName, Value: "Todos"},
+		{Name: caldav.CurrentUserPrincipal, Value: caldav.Href(h.principalHref(claims.Username))},
+		{Name: caldav.SupportedComponentSet, Value: `<c:comp name="VTODO"/>`},
+		{Name: caldav.SupportedReportSet, Value: "<d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>" +
+			"<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report>"},
+		{Name: caldav.CurrentUserPrivilegeSet, Value: "<d:privilege><d:read/></d:privilege><d:privilege><d:write/></d:privilege>"},
+		{Name: caldav.GetCTag, Value: hex.EncodeToString(hash.Sum(nil))},
+	}
+}
+
+func (h *CalDAVHandler) objectProps(todo models.Todo) []caldav.Prop {
+	return []caldav.Prop{
+		{Name: caldav.ResourceType},
+		{Name: caldav.GetETag, Value: caldav.Escape(formatETag(todo.Version))},
+		{Name: caldav.GetContentType, Value: "text/calendar; charset=utf-8; component=VTODO"},
+		{Name: caldav.GetLastModified, Value: todo.UpdatedAt.UTC().Format(http.TimeFormat)},
+		{Name: caldav.CalendarData, Value: caldav.Escape(h.calendarData(todo))},
+	}
+}
+
+func (h *CalDAVHandler) calendarData(todo models.Todo) string {
+	calendar := ical.NewCalendar(calendarProductID, "")
+	calendar.Append(ical.NewTodo(todo, h.domain))
+	return calendar.String()
+}
+
+func (h *CalDAVHandler) respondMultistatus(c *gin.Context, responses []caldav.Response) {
+	var body bytes.Buffer
+	if err := caldav.WriteMultistatus(&body, responses); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusMultiStatus, caldav.ContentType, body.Bytes())
+}
+
+func respondDAVRequestError(c *gin.Context, err error) {
+	if errors.Is(err, caldav.ErrUnsupportedRequest) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// respondPreconditionFailed reports a stale ETag the WebDAV way, with 412
+// rather than the 409 the JSON API uses, and hands back the current one.
+func respondPreconditionFailed(c *gin.Context, todo *models.Todo) {
+	setETag(c, todo.Version)
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": models.ErrVersionConflict.Error()})
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+type CalendarFeedResponse struct {
+	Enabled    bool       `json:"enabled"`
+	Hint       string     `json:"hint,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	URL        string     `json:"url,omitempty"`
+}
+
+func NewCalendarFeedResponse(feed *models.CalendarFeed) CalendarFeedResponse {
+	if feed == nil {
+		return CalendarFeedResponse{}
+	}
+	return CalendarFeedResponse{
+		Enabled:    true,
+		Hint:       feed.Hint,
+		LastUsedAt: feed.LastUsedAt,
+		CreatedAt:  &feed.CreatedAt,
+	}
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/ical"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+const calendarProductID = "-//todoapp//Todos//EN"
+
+type CalendarFeedHandler struct {
+	auditService *service.AuditService
+	service      *service.CalendarFeedService
+	feedURL      string
+	domain       string
+}
+
+// NewCalendarFeedHandler serves feeds under feedURL, the public address of
+// the /feeds route. Its host also names the UIDs of feed entries.
+func NewCalendarFeedHandler(service *service.CalendarFeedService, auditService *service.AuditService, feedURL string) *CalendarFeedHandler {
+	domain := "todoapp"
+	if parsed, err := url.Parse(feedURL); err == nil && parsed.Hostname() != "" {
+		domain = parsed.Hostname()
+	}
+	return &CalendarFeedHandler{
+		service:      service,
+		auditService: auditService,
+		feedURL:      strings.TrimRight(feedURL, "/"),
+		domain:       domain,
+	}
+}
+
+func (h *CalendarFeedHandler) GetFeed(c *gin.Context) {
+
+	claims := c.MustGet("user").(*models.Claims)
+
+	feed, err := h.service.GetFeed(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, NewCalendarFeedResponse(feed))
+}
+
+// RotateFeed creates the user's subscription link, or replaces it so that
+// anyone holding the old one loses access.
+func (h *CalendarFeedHandler) RotateFeed(c *gin.Context) {
+
+	claims := c.MustGet("user").(*models.Claims)
+
+	feed, secret, err := h.service.Rotate(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditCalendarFeedRotated)
+	event.SetTarget(models.AuditTargetUser, claims.UserID, claims.Username)
+	h.auditService.Record(event)
+
+	response := NewCalendarFeedResponse(feed)
+	response.URL = h.feedURL + "/" + secret + ".ics"
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *CalendarFeedHandler) DisableFeed(c *gin.Context) {
+
+	claims := c.MustGet("user").(*models.Claims)
+
+	if err := h.service.Disable(claims.UserID); err != nil {
+		if errors.Is(err, service.ErrCalendarFeedNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Calendar feed not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditCalendarFeedDisabled)
+	event.SetTarget(models.AuditTargetUser, claims.UserID, claims.Username)
+	h.auditService.Record(event)
+
+	c.Status(http.StatusNoContent)
+}
+
+// ServeFeed writes the iCalendar feed for the secret in the URL. Todos are
+// listed as VTODOs and, when they have dates, as VEVENTs for calendars that
+// ignore tasks. project_id, status and component narrow the feed.
+func (h *CalendarFeedHandler) ServeFeed(c *gin.Context) {
+
+	user, err := h.service.Resolve(strings.TrimSuffix(c.Param("token"), ".ics"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidFeedToken) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Calendar feed not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	var filter service.CalendarFeedFilter
+	if value := c.Query("project_id"); value != "" {
+		projectID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project_id"})
+			return
+		}
+		id := uint(projectID)
+		filter.ProjectID = &id
+	}
+	if value := c.Query("status"); value != "" {
+		for _, status := range strings.Split(strings.ToLower(value), ",") {
+			if !models.IsValidTodoStatus(status) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status field"})
+				return
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	component := c.DefaultQuery("component", "all")
+	if component != "all" && component != "todo" && component != "event" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "component must be all, todo or event"})
+		return
+	}
+
+	todos, err := h.service.Todos(user.ID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	calendar := ical.NewCalendar(calendarProductID, user.Name()+"'s todos")
+	for _, todo := range todos {
+		if component != "event" {
+			calendar.Append(ical.NewTodo(todo, h.domain))
+		}
+		if component != "todo" {
+			if event, ok := ical.NewEvent(todo, h.domain); ok {
+				calendar.Append(event)
+			}
+		}
+	}
+
+	c.Header("Content-Disposition", `inline; filename="todos.ics"`)
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, ical.ContentType, []byte(calendar.String()))
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/policy"
+)
+
+// maxCalendarWindow keeps calendar queries to about a year of todos.
+const maxCalendarWindow = 366 * 24 * time.Hour
+
+// GetCalendar lists the todos whose span overlaps the from/to window. Bare
+// dates are read as midnight in the user's time zone.
+func (h *TodoHandler) GetCalendar(c *gin.Context) {
+
+	subject, ok := requestSubject(c, h.policyService)
+	if !ok {
+		return
+	}
+
+	user, err := h.userService.GetUserByID(subject.UserID)
+	if err != nil || user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	from, errFrom := parseCalendarBound(c.Query("from"), user.Location())
+	to, errTo := parseCalendarBound(c.Query("to"), user.Location())
+	if errFrom != nil || errTo != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be dates or times"})
+		return
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+	if to.Sub(from) > maxCalendarWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Calendar window cannot exceed 366 days"})
+		return
+	}
+
+	userID := subject.UserID
+	if h.policyService.Can(subject, policy.TodoRead) {
+		userID = 0
+	}
+
+	todos, err := h.service.GetCalendar(from, to, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := []CalendarEntryResponse{}
+	for _, todo := range todos {
+		if !h.policyService.CanTodo(subject, policy.TodoRead, &todo) {
+			continue
+		}
+		response = append(response, NewCalendarEntryResponse(todo))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func parseCalendarBound(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if day, err := time.ParseInLocation(time.DateOnly, value, loc); err == nil {
+		return day, nil
+	}
+	return dateparse.ParseIn(value, loc)
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import "github.com/harrisin2037/todoapp/internal/models"
+
+// DigestRequest sets Frequency to daily, weekly or off.
+type DigestRequest struct {
+	Frequency string `json:"frequency" binding:"required"`
+}
+
+// DigestUnsubscribeRequest carries the token of an unsubscribe link, as JSON
+// or as the form field posted by the confirmation page.
+type DigestUnsubscribeRequest struct {
+	Token string `json:"token" form:"token" binding:"required"`
+}
+
+type DigestResponse struct {
+	Frequency string `json:"frequency"`
+}
+
+func NewDigestResponse(user models.User) DigestResponse {
+	frequency := user.DigestFrequency
+	if frequency == "" {
+		frequency = "off"
+	}
+	return DigestResponse{Frequency: frequency}
+}
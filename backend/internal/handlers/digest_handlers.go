@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/harrisin2037/todoapp/internal/digest"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+type DigestHandler struct {
+	service     *service.DigestService
+	userService *service.UserService
+}
+
+func NewDigestHandler(service *service.DigestService, userService *service.UserService) *DigestHandler {
+	return &DigestHandler{service: service, userService: userService}
+}
+
+func (h *DigestHandler) GetDigest(c *gin.Context) {
+	claims := c.MustGet("user").(*models.Claims)
+
+	user, err := h.userService.GetUserByID(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, NewDigestResponse(*user))
+}
+
+func (h *DigestHandler) UpdateDigest(c *gin.Context) {
+	claims := c.MustGet("user").(*models.Claims)
+
+	var req DigestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.SetFrequency(claims.UserID, req.Frequency); err != nil {
+		if errors.Is(err, models.ErrInvalidDigestFrequency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userService.GetUserByID(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, NewDigestResponse(*user))
+}
+
+// PreviewDigest renders the digest the user would get now, as HTML or, with
+// format=text, as plain text. frequency defaults to the user's own, or daily
+// when they have not subscribed.
+func (h *DigestHandler) PreviewDigest(c *gin.Context) {
+	claims := c.MustGet("user").(*models.Claims)
+
+	user, err := h.userService.GetUserByID(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	frequency := c.Query("frequency")
+	if frequency == "" {
+		frequency = user.DigestFrequency
+	}
+	if frequency == "" {
+		frequency = models.DigestDaily
+	}
+
+	d, err := h.service.Preview(user.ID, frequency, time.Now())
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidDigestFrequency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	text, html, err := digest.Render(d)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "text" {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(text))
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+}
+
+// ConfirmUnsubscribe shows the page behind the unsubscribe link. Opening the
+// link must not unsubscribe by itself, since mail scanners follow links, so
+// the page asks the user to confirm with a POST.
+func (h *DigestHandler) ConfirmUnsubscribe(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
+		return
+	}
+
+	html, err := digest.RenderUnsubscribe(token, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+}
+
+// Unsubscribe turns the digest off. It accepts the token as JSON, as the
+// form field posted by the confirmation page, or as the "token" query
+// parameter of a one-click unsubscribe from the mail client (RFC 8058).
+func (h *DigestHandler) Unsubscribe(c *gin.Context) {
+
+	var req DigestUnsubscribeRequest
+	if req.Token = c.Query("token"); req.Token == "" {
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if _, err := h.service.Unsubscribe(req.Token); err != nil {
+		if errors.Is(err, service.ErrInvalidAccountToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if c.ContentType() == binding.MIMEJSON {
+		c.JSON(http.StatusOK, gin.H{"message": "You will no longer get the digest email"})
+		return
+	}
+	html, err := digest.RenderUnsubscribe("", true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+}
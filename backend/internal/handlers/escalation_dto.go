@@ -0,0 +1,9 @@
+package handlers
+
+// EscalationRuleRequest notifies Notify, one of owner, assignees or
+// project_lead, once a todo has been overdue for After seconds.
+type EscalationRuleRequest struct {
+	After  *int   `json:"after" binding:"required"`
+	Notify string `json:"notify" binding:"required"`
+	Email  bool   `json:"email"`
+}
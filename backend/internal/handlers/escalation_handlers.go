@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/policy"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+type EscalationHandler struct {
+	service       *service.EscalationService
+	todoService   *service.TodoService
+	policyService *service.PolicyService
+	auditService  *service.AuditService
+}
+
+func NewEscalationHandler(service *service.EscalationService, todoService *service.TodoService, policyService *service.PolicyService, auditService *service.AuditService) *EscalationHandler {
+	return &EscalationHandler{
+		service:       service,
+		todoService:   todoService,
+		policyService: policyService,
+		auditService:  auditService,
+	}
+}
+
+// GetRules lists the escalation rules in the order they go off.
+func (h *EscalationHandler) GetRules(c *gin.Context) {
+	rules, err := h.service.GetRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *EscalationHandler) CreateRule(c *gin.Context) {
+
+	var req EscalationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := &models.EscalationRule{After: *req.After, Notify: req.Notify, Email: req.Email}
+	if err := h.service.CreateRule(rule); err != nil {
+		respondEscalationError(c, err)
+		return
+	}
+
+	h.record(c, models.AuditEscalationRuleCreated, rule)
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *EscalationHandler) UpdateRule(c *gin.Context) {
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+
+	var req EscalationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.service.GetRule(uint(id))
+	if err != nil {
+		respondEscalationError(c, err)
+		return
+	}
+
+	rule.After, rule.Notify, rule.Email = *req.After, req.Notify, req.Email
+	if err := h.service.UpdateRule(rule); err != nil {
+		respondEscalationError(c, err)
+		return
+	}
+
+	h.record(c, models.AuditEscalationRuleUpdated, rule)
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *EscalationHandler) DeleteRule(c *gin.Context) {
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+
+	if err := h.service.DeleteRule(uint(id)); err != nil {
+		respondEscalationError(c, err)
+		return
+	}
+
+	h.record(c, models.AuditEscalationRuleDeleted, &models.EscalationRule{ID: uint(id)})
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetHistory lists what happened to a todo, such as it becoming overdue and
+// each escalation step, oldest first.
+func (h *EscalationHandler) GetHistory(c *gin.Context) {
+
+	subject, ok := requestSubject(c, h.policyService)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	todo, err := h.todoService.GetTodo(uint(id))
+	if err != nil || todo == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+		return
+	}
+
+	if !h.policyService.CanTodo(subject, policy.TodoRead, todo) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to view this todo"})
+		return
+	}
+
+	events, err := h.service.History(todo.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+func (h *EscalationHandler) record(c *gin.Context, action string, rule *models.EscalationRule) {
+	event := newAuditEvent(c, action)
+	event.SetTarget(models.AuditTargetEscalation, rule.ID, rule.Notify)
+	h.auditService.Record(event)
+}
+
+func respondEscalationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrEscalationRuleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidEscalationRule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errInvalidIfMatch = errors.New("invalid If-Match header")
+
+func formatETag(version uint) string {
+	return strconv.Quote(strconv.FormatUint(uint64(version), 10))
+}
+
+func setETag(c *gin.Context, version uint) {
+	c.Header("ETag", formatETag(version))
+}
+
+// ifMatchVersion reads the version the client expects from the If-Match
+// header. The second return value is false when the header is absent or is
+// the "*" wildcard, in which case any current version is accepted.
+func ifMatchVersion(c *gin.Context) (uint, bool, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return 0, false, nil
+	}
+
+	// Only a single entity tag is meaningful for one resource; weak
+	// validators are accepted because the version is the only thing compared.
+	tag := strings.TrimPrefix(header, "W/")
+	unquoted, err := strconv.Unquote(tag)
+	if err != nil {
+		return 0, false, errInvalidIfMatch
+	}
+
+	version, err := strconv.ParseUint(unquoted, 10, 32)
+	if err != nil {
+		return 0, false, errInvalidIfMatch
+	}
+
+	return uint(version), true, nil
+}
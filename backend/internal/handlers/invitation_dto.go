@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+type InvitationCreateRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required"`
+}
+
+type InvitationAcceptRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+type InvitationResponse struct {
+	ID         uint       `json:"id"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	Status     string     `json:"status"`
+	InvitedBy  string     `json:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	SentAt     time.Time  `json:"sent_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func NewInvitationResponse(invitation models.Invitation) InvitationResponse {
+	return InvitationResponse{
+		ID:         invitation.ID,
+		Email:      invitation.Email,
+		Role:       string(invitation.Role),
+		Status:     invitation.Status(time.Now()),
+		InvitedBy:  invitation.InvitedBy.Username,
+		ExpiresAt:  invitation.ExpiresAt,
+		SentAt:     invitation.SentAt,
+		AcceptedAt: invitation.AcceptedAt,
+		RevokedAt:  invitation.RevokedAt,
+		CreatedAt:  invitation.CreatedAt,
+	}
+}
+
+type SettingsUpdateRequest struct {
+	RegistrationOpen *bool `json:"registration_open"`
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/utils"
+)
+
+type InvitationHandler struct {
+	service        *service.InvitationService
+	settingService *service.SettingService
+	policyService  *service.PolicyService
+	auditService   *service.AuditService
+}
+
+func NewInvitationHandler(service *service.InvitationService, settingService *service.SettingService, policyService *service.PolicyService, auditService *service.AuditService) *InvitationHandler {
+	return &InvitationHandler{
+		service:        service,
+		settingService: settingService,
+		policyService:  policyService,
+		auditService:   auditService,
+	}
+}
+
+func (h *InvitationHandler) GetInvitations(c *gin.Context) {
+	invitations, err := h.service.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]InvitationResponse, 0, len(invitations))
+	for _, invitation := range invitations {
+		response = append(response, NewInvitationResponse(invitation))
+	}
+	c.JSON(http.StatusOK, gin.H{"invitations": response})
+}
+
+func (h *InvitationHandler) CreateInvitation(c *gin.Context) {
+
+	var req InvitationCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.policyService.RoleExists(models.Role(req.Role)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+
+	claims := c.MustGet("user").(*models.Claims)
+	if !h.policyService.CanGrantRole(claims.Role, models.Role(req.Role)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": errRoleNotGrantable.Error()})
+		return
+	}
+	invitation, err := h.service.Invite(req.Email, models.Role(req.Role), claims.UserID)
+	if err != nil && !errors.Is(err, service.ErrInvitationNotSent) {
+		respondInvitationError(c, err)
+		return
+	}
+
+	h.record(c, models.AuditInvitationCreated, invitation)
+
+	response := gin.H{"invitation": NewInvitationResponse(*invitation), "email_sent": err == nil}
+	if err != nil {
+		log.Printf("Failed to send invitation %d: %v", invitation.ID, err)
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+func (h *InvitationHandler) ResendInvitation(c *gin.Context) {
+
+	id, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	invitation, err := h.service.Resend(id)
+	if err != nil && !errors.Is(err, service.ErrInvitationNotSent) {
+		respondInvitationError(c, err)
+		return
+	}
+
+	h.record(c, models.AuditInvitationResent, invitation)
+
+	if err != nil {
+		log.Printf("Failed to send invitation %d: %v", invitation.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"invitation": NewInvitationResponse(*invitation), "email_sent": true})
+}
+
+func (h *InvitationHandler) RevokeInvitation(c *gin.Context) {
+
+	id, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	invitation, err := h.service.Revoke(id)
+	if err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+
+	h.record(c, models.AuditInvitationRevoked, invitation)
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetInvitation shows the invitee which address and role a link is for.
+func (h *InvitationHandler) GetInvitation(c *gin.Context) {
+	invitation, err := h.service.Lookup(c.Query("token"))
+	if err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"email":      invitation.Email,
+		"role":       invitation.Role,
+		"invited_by": invitation.InvitedBy.Username,
+		"expires_at": invitation.ExpiresAt,
+	})
+}
+
+// AcceptInvitation creates the invitee's account. It works while open
+// registration is turned off.
+func (h *InvitationHandler) AcceptInvitation(c *gin.Context) {
+
+	var req InvitationAcceptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, invitation, err := h.service.Accept(req.Token, req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInvitation) {
+			event := newAuditEvent(c, models.AuditInvitationAccepted)
+			event.SetTarget(models.AuditTargetUser, 0, req.Username)
+			event.Fail("invalid_token")
+			h.auditService.Record(event)
+		}
+		respondInvitationError(c, err)
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditInvitationAccepted)
+	event.SetActor(user)
+	event.SetTarget(models.AuditTargetInvitation, invitation.ID, invitation.Email)
+	event.SetDetail("role", string(user.Role))
+	h.auditService.Record(event)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Account created successfully", "user": NewUserResponse(*user)})
+}
+
+func (h *InvitationHandler) GetSettings(c *gin.Context) {
+	settings, err := h.settingService.Get()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+func (h *InvitationHandler) UpdateSettings(c *gin.Context) {
+
+	var req SettingsUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.RegistrationOpen != nil {
+		if err := h.settingService.SetRegistrationOpen(*req.RegistrationOpen); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		event := newAuditEvent(c, models.AuditSettingsUpdated)
+		event.SetDetail(models.SettingRegistrationOpen, strconv.FormatBool(*req.RegistrationOpen))
+		h.auditService.Record(event)
+	}
+
+	h.GetSettings(c)
+}
+
+// RequireOpenRegistration refuses sign-ups while registration is
+// invite-only.
+func (h *InvitationHandler) RequireOpenRegistration(c *gin.Context) {
+	settings, err := h.settingService.Get()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+	if !settings.RegistrationOpen {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is by invitation only"})
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func (h *InvitationHandler) record(c *gin.Context, action string, invitation *models.Invitation) {
+	event := newAuditEvent(c, action)
+	event.SetTarget(models.AuditTargetInvitation, invitation.ID, invitation.Email)
+	event.SetDetail("role", string(invitation.Role))
+	h.auditService.Record(event)
+}
+
+func respondInvitationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvitationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidInvitation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvitationPending), errors.Is(err, service.ErrInvitationClosed),
+		errors.Is(err, service.ErrEmailAlreadyExists), errors.Is(err, service.ErrUserAlreadyExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
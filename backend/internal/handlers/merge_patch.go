@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+
+// PatchField carries one member of an RFC 7396 merge patch. A member that is
+// absent from the document leaves Set false, an explicit null sets Null, and
+// any other value is decoded into Value.
+type PatchField[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+func (f *PatchField[T]) UnmarshalJSON(data []byte) error {
+	f.Set = true
+	if string(data) == "null" {
+		f.Null = true
+		return nil
+	}
+	return json.Unmarshal(data, &f.Value)
+}
+
+// HasValue reports whether the patch sets the member to a non-null value.
+func (f PatchField[T]) HasValue() bool {
+	return f.Set && !f.Null
+}
+
+// Pointer returns the value when the patch sets one, and nil otherwise.
+func (f PatchField[T]) Pointer() *T {
+	if !f.HasValue() {
+		return nil
+	}
+	return &f.Value
+}
+
+// optional turns an optional member of a plain JSON body into a patch field
+// that sets the value when present and never clears it.
+func optional[T any](value *T) PatchField[T] {
+	if value == nil {
+		return PatchField[T]{}
+	}
+	return PatchField[T]{Set: true, Value: *value}
+}
+
+func isMergePatchRequest(c *gin.Context) bool {
+	contentType := strings.TrimSpace(strings.Split(c.GetHeader("Content-Type"), ";")[0])
+	return contentType == mergePatchContentType || contentType == "application/json"
+}
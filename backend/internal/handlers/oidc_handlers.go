@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+// oidcStateCookie ties a login to the browser that started it, so nobody
+// can complete their own login in someone else's browser.
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/auth/oidc"
+)
+
+type OIDCHandler struct {
+	service      *service.OIDCService
+	auditService *service.AuditService
+	postLoginURL string
+}
+
+// NewOIDCHandler creates the single sign-on handler. When postLoginURL is
+// set, the callback redirects there with the tokens in the URL fragment
+// instead of answering with JSON.
+func NewOIDCHandler(service *service.OIDCService, auditService *service.AuditService, postLoginURL string) *OIDCHandler {
+	return &OIDCHandler{
+		service:      service,
+		auditService: auditService,
+		postLoginURL: postLoginURL,
+	}
+}
+
+func (h *OIDCHandler) Login(c *gin.Context) {
+	authURL, state, err := h.service.BeginLogin(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to start single sign-on: " + err.Error()})
+		return
+	}
+
+	// Lax, as the provider sends the browser back with a top-level GET.
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, 10*60, oidcStateCookiePath, "", c.Request.TLS != nil, true)
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, oidcStateCookiePath, "", c.Request.TLS != nil, true)
+
+	if errorCode := c.Query("error"); errorCode != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Identity provider returned " + errorCode})
+		return
+	}
+
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "state and code are required"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login was not started in this browser"})
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditLogin)
+	event.SetDetail("method", "oidc")
+
+	user, tokens, err := h.service.CompleteLogin(c.Request.Context(), state, code)
+	if err != nil {
+		var challenge *service.TwoFactorRequiredError
+		if errors.As(err, &challenge) {
+			// /login/2fa records the login once the code checks out.
+			h.respondTwoFactor(c, challenge)
+		} else if errors.Is(err, service.ErrInvalidOIDCState) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else if errors.Is(err, service.ErrOIDCEmailNotVerified) || errors.Is(err, service.ErrOIDCAccountLinked) {
+			event.Fail("oidc_not_linked")
+			h.auditService.Record(event)
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		} else if errors.Is(err, service.ErrUserDeactivated) {
+			event.Fail("account_deactivated")
+			h.auditService.Record(event)
+			c.JSON(http.StatusForbidden, gin.H{"error": "This account has been deactivated"})
+		} else {
+			event.Fail("oidc_failed")
+			h.auditService.Record(event)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Single sign-on failed: " + err.Error()})
+		}
+		return
+	}
+
+	event.SetActor(user)
+	event.SetTarget(models.AuditTargetUser, user.ID, user.Username)
+	h.auditService.Record(event)
+
+	if h.postLoginURL != "" {
+		fragment := url.Values{}
+		fragment.Set("token", tokens.AccessToken)
+		fragment.Set("refresh_token", tokens.RefreshToken)
+		fragment.Set("expires_in", strconv.FormatInt(int64(tokens.ExpiresIn.Seconds()), 10))
+		c.Redirect(http.StatusFound, h.postLoginURL+"#"+fragment.Encode())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Login successful",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    int64(tokens.ExpiresIn.Seconds()),
+		"user": gin.H{
+			"id":       user.ID,
+			"username": user.Username,
+			"email":    user.Email,
+			"role":     user.Role,
+		},
+	})
+}
+
+func (h *OIDCHandler) respondTwoFactor(c *gin.Context, challenge *service.TwoFactorRequiredError) {
+	expiresIn := int64(challenge.ExpiresIn.Seconds())
+
+	if h.postLoginURL != "" {
+		fragment := url.Values{}
+		fragment.Set("two_factor_challenge", challenge.Challenge)
+		fragment.Set("expires_in", strconv.FormatInt(expiresIn, 10))
+		c.Redirect(http.StatusFound, h.postLoginURL+"#"+fragment.Encode())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Two-factor authentication required",
+		"two_factor_required": true,
+		"challenge":           challenge.Challenge,
+		"expires_in":          expiresIn,
+	})
+}
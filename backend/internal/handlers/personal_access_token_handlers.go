@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+type PersonalAccessTokenHandler struct {
+	userService      *service.UserService
+	twoFactorService *service.TwoFactorService
+	auditService     *service.AuditService
+	service          *service.PersonalAccessTokenService
+}
+
+func NewPersonalAccessTokenHandler(service *service.PersonalAccessTokenService, userService *service.UserService, twoFactorService *service.TwoFactorService, auditService *service.AuditService) *PersonalAccessTokenHandler {
+	return &PersonalAccessTokenHandler{
+		service:          service,
+		userService:      userService,
+		twoFactorService: twoFactorService,
+		auditService:     auditService,
+	}
+}
+
+func (h *PersonalAccessTokenHandler) CreateToken(c *gin.Context) {
+
+	userClaims, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	claims, ok := userClaims.(*models.Claims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
+		return
+	}
+
+	var req PersonalAccessTokenCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+
+	// Admin tokens would otherwise be a way around the two-factor policy.
+	if containsString(req.Scopes, models.ScopeAdminUsers) && !claims.TwoFactor && h.twoFactorService.RequiredFor(claims.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required to create admin tokens"})
+		return
+	}
+
+	user, err := h.userService.GetUserByID(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	token, secret, err := h.service.CreateToken(user, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidScope):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrScopeNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditTokenCreated)
+	event.SetTarget(models.AuditTargetToken, token.ID, token.Name)
+	event.SetDetail("scopes", token.Scopes)
+	h.auditService.Record(event)
+
+	response := NewPersonalAccessTokenResponse(*token)
+	response.Token = secret
+
+	c.JSON(http.StatusCreated, response)
+}
+
+func (h *PersonalAccessTokenHandler) GetTokens(c *gin.Context) {
+
+	userClaims, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	claims, ok := userClaims.(*models.Claims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
+		return
+	}
+
+	tokens, err := h.service.GetTokens(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := []PersonalAccessTokenResponse{}
+	for _, token := range tokens {
+		response = append(response, NewPersonalAccessTokenResponse(token))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *PersonalAccessTokenHandler) RevokeToken(c *gin.Context) {
+
+	userClaims, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	claims, ok := userClaims.(*models.Claims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	if err := h.service.RevokeToken(uint(id), claims.UserID); err != nil {
+		if errors.Is(err, service.ErrAccessTokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditTokenRevoked)
+	event.SetTarget(models.AuditTargetToken, uint(id), "")
+	h.auditService.Record(event)
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/policy"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+var errRoleNotGrantable = errors.New("you cannot grant a role with permissions you do not have")
+
+// requestSubject returns the policy subject for the authenticated user. When
+// there is none it has already answered the request and returns false.
+func requestSubject(c *gin.Context, policyService *service.PolicyService) (policy.Subject, bool) {
+	userClaims, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return policy.Subject{}, false
+	}
+
+	claims, ok := userClaims.(*models.Claims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
+		return policy.Subject{}, false
+	}
+
+	subject, err := policyService.Subject(claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return policy.Subject{}, false
+	}
+
+	return subject, true
+}
+
+// TodoAccess answers the websocket hub's questions about which todos a user
+// may read.
+type TodoAccess struct {
+	todoService   *service.TodoService
+	policyService *service.PolicyService
+}
+
+func NewTodoAccess(todoService *service.TodoService, policyService *service.PolicyService) *TodoAccess {
+	return &TodoAccess{todoService: todoService, policyService: policyService}
+}
+
+func (a *TodoAccess) CanReadTodo(claims *models.Claims, todoID uint) bool {
+	if claims == nil {
+		return false
+	}
+	todo, err := a.todoService.GetTodo(todoID)
+	if err != nil || todo == nil {
+		return false
+	}
+	subject, err := a.policyService.Subject(claims)
+	if err != nil {
+		return false
+	}
+	return a.policyService.CanTodo(subject, policy.TodoRead, todo)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+type ProfileUpdateRequest struct {
+	DisplayName *string `json:"display_name" binding:"omitempty,max=100"`
+	Timezone    *string `json:"timezone"`
+	Locale      *string `json:"locale"`
+	WeekStart   *int    `json:"week_start"`
+	Color       *string `json:"color"`
+}
+
+func (r ProfileUpdateRequest) Update() service.ProfileUpdate {
+	return service.ProfileUpdate{
+		DisplayName: r.DisplayName,
+		Timezone:    r.Timezone,
+		Locale:      r.Locale,
+		WeekStart:   r.WeekStart,
+		Color:       r.Color,
+	}
+}
+
+// ProfileResponse is what users see about themselves: the public user
+// fields plus their own preferences.
+type ProfileResponse struct {
+	UserResponse
+	Timezone  string `json:"timezone"`
+	Locale    string `json:"locale"`
+	WeekStart int    `json:"week_start"`
+}
+
+func NewProfileResponse(user models.User) ProfileResponse {
+	timezone := user.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+
+	return ProfileResponse{
+		UserResponse: NewUserResponse(user),
+		Timezone:     timezone,
+		Locale:       user.Locale,
+		WeekStart:    user.WeekStart,
+	}
+}
+
+// avatarURL changes whenever the avatar does, so clients can cache it.
+func avatarURL(user models.User) string {
+	if user.AvatarUpdatedAt == nil {
+		return ""
+	}
+	return fmt.Sprintf("/users/%d/avatar?v=%d", user.ID, user.AvatarUpdatedAt.Unix())
+}
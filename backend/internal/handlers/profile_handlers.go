@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/avatar"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/utils"
+)
+
+type ProfileHandler struct {
+	service        *service.ProfileService
+	userService    *service.UserService
+	maxAvatarBytes int64
+}
+
+// NewProfileHandler refuses avatar uploads larger than maxAvatarBytes before
+// they are decoded.
+func NewProfileHandler(service *service.ProfileService, userService *service.UserService, maxAvatarBytes int64) *ProfileHandler {
+	return &ProfileHandler{
+		service:        service,
+		userService:    userService,
+		maxAvatarBytes: maxAvatarBytes,
+	}
+}
+
+func (h *ProfileHandler) GetProfile(c *gin.Context) {
+	claims := c.MustGet("user").(*models.Claims)
+
+	user, err := h.userService.GetUserByID(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, NewProfileResponse(*user))
+}
+
+func (h *ProfileHandler) UpdateProfile(c *gin.Context) {
+	claims := c.MustGet("user").(*models.Claims)
+
+	var req ProfileUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.service.UpdateProfile(claims.UserID, req.Update())
+	if err != nil {
+		respondProfileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, NewProfileResponse(*user))
+}
+
+// UploadAvatar takes the image as the "avatar" field of a multipart form.
+func (h *ProfileHandler) UploadAvatar(c *gin.Context) {
+	claims := c.MustGet("user").(*models.Claims)
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxAvatarBytes)
+	file, _, err := c.Request.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Avatar must be at most " + strconv.FormatInt(h.maxAvatarBytes, 10) + " bytes"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "An image is required in the avatar field"})
+		}
+		return
+	}
+	defer file.Close()
+
+	user, err := h.service.SetAvatar(claims.UserID, file)
+	if err != nil {
+		respondProfileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, NewProfileResponse(*user))
+}
+
+func (h *ProfileHandler) DeleteAvatar(c *gin.Context) {
+	claims := c.MustGet("user").(*models.Claims)
+
+	if err := h.service.RemoveAvatar(claims.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetAvatar serves avatars without authentication so they can be used as
+// image sources. Versioned URLs never change, so they are cached for long.
+func (h *ProfileHandler) GetAvatar(c *gin.Context) {
+	userID, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	stored, err := h.service.Avatar(userID)
+	if err != nil {
+		respondProfileError(c, err)
+		return
+	}
+
+	etag := `"` + strconv.FormatInt(stored.UpdatedAt.UnixNano(), 36) + `"`
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Header("ETag", etag)
+	if c.Query("v") != "" {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+	c.Data(http.StatusOK, stored.ContentType, stored.Data)
+}
+
+func respondProfileError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrAvatarNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidTimezone), errors.Is(err, service.ErrInvalidLocale),
+		errors.Is(err, service.ErrInvalidWeekStart), errors.Is(err, service.ErrInvalidColor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, avatar.ErrUnsupportedImage):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, avatar.ErrImageTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
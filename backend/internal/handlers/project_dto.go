@@ -0,0 +1,29 @@
+package handlers
+
+import "github.com/harrisin2037/todoapp/internal/models"
+
+type ProjectCreateRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	MemberIDs   []uint `json:"member_ids"`
+}
+
+type ProjectResponse struct {
+	ID          uint           `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	LeadID      uint           `json:"lead_id"`
+	Lead        UserResponse   `json:"lead"`
+	Members     []UserResponse `json:"members"`
+}
+
+func NewProjectResponse(project models.Project) ProjectResponse {
+	return ProjectResponse{
+		ID:          project.ID,
+		Name:        project.Name,
+		Description: project.Description,
+		LeadID:      project.LeadID,
+		Lead:        NewUserResponse(project.Lead),
+		Members:     NewUsersResponse(project.Members),
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/policy"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+type ProjectHandler struct {
+	userService   *service.UserService
+	service       *service.ProjectService
+	policyService *service.PolicyService
+}
+
+func NewProjectHandler(service *service.ProjectService, userService *service.UserService, policyService *service.PolicyService) *ProjectHandler {
+	return &ProjectHandler{
+		service:       service,
+		userService:   userService,
+		policyService: policyService,
+	}
+}
+
+func (h *ProjectHandler) CreateProject(c *gin.Context) {
+
+	userClaims, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	claims, ok := userClaims.(*models.Claims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
+		return
+	}
+
+	var req ProjectCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lead, err := h.userService.GetUserByID(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lead ID"})
+		return
+	}
+
+	memberIDs := uniqueIDs(req.MemberIDs)
+	if len(memberIDs) > 0 {
+		members, err := h.userService.GetUsersByIDs(memberIDs)
+		if err != nil || len(members) != len(memberIDs) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid member ID"})
+			return
+		}
+		if addsDeactivatedUser(members, nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot add a deactivated user"})
+			return
+		}
+	}
+
+	project := &models.Project{
+		Name:        req.Name,
+		Description: req.Description,
+		LeadID:      lead.ID,
+		Lead:        *lead,
+	}
+
+	if err := h.service.CreateProject(project, memberIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, NewProjectResponse(*project))
+}
+
+// GetProjects lists the projects the user may read: for most users the ones
+// they lead or are a member of.
+func (h *ProjectHandler) GetProjects(c *gin.Context) {
+
+	subject, ok := requestSubject(c, h.policyService)
+	if !ok {
+		return
+	}
+
+	projects, err := h.service.GetProjects()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := []ProjectResponse{}
+	for _, project := range projects {
+		if h.policyService.CanProject(subject, policy.ProjectRead, &project) {
+			response = append(response, NewProjectResponse(project))
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *ProjectHandler) GetProject(c *gin.Context) {
+	subject, ok := requestSubject(c, h.policyService)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	project, err := h.service.GetProject(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	if !h.policyService.CanProject(subject, policy.ProjectRead, project) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to view this project"})
+		return
+	}
+
+	c.JSON(http.StatusOK, NewProjectResponse(*project))
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import "github.com/harrisin2037/todoapp/internal/models"
+
+// ReminderRequest sets a reminder at RemindAt, read in the user's time zone
+// unless it names one, or Offset seconds before the due date.
+type ReminderRequest struct {
+	RemindAt *string `json:"remind_at"`
+	Offset   *int    `json:"offset"`
+	Email    bool    `json:"email"`
+}
+
+type ReminderRuleRequest struct {
+	Offset *int `json:"offset" binding:"required"`
+	Email  bool `json:"email"`
+}
+
+type NotificationListResponse struct {
+	Notifications []models.Notification `json:"notifications"`
+	Unread        int64                 `json:"unread"`
+}
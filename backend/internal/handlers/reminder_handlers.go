@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/araddon/dateparse"
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/policy"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+type ReminderHandler struct {
+	userService   *service.UserService
+	policyService *service.PolicyService
+	todoService   *service.TodoService
+	service       *service.ReminderService
+}
+
+func NewReminderHandler(service *service.ReminderService, todoService *service.TodoService, userService *service.UserService, policyService *service.PolicyService) *ReminderHandler {
+	return &ReminderHandler{
+		service:       service,
+		todoService:   todoService,
+		userService:   userService,
+		policyService: policyService,
+	}
+}
+
+// GetReminders lists the reminders the user set on a todo.
+func (h *ReminderHandler) GetReminders(c *gin.Context) {
+
+	subject, todo, ok := h.readableTodo(c)
+	if !ok {
+		return
+	}
+
+	reminders, err := h.service.GetReminders(todo.ID, subject.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, reminders)
+}
+
+func (h *ReminderHandler) CreateReminder(c *gin.Context) {
+
+	subject, todo, ok := h.readableTodo(c)
+	if !ok {
+		return
+	}
+
+	var req ReminderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userService.GetUserByID(subject.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	reminder := &models.Reminder{
+		TodoID: todo.ID,
+		UserID: subject.UserID,
+		Offset: req.Offset,
+		Email:  req.Email,
+	}
+	if req.RemindAt != nil {
+		at, err := dateparse.ParseIn(*req.RemindAt, user.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidDateFormat.Error()})
+			return
+		}
+		at = at.UTC()
+		reminder.RemindAt = &at
+	}
+
+	if err := h.service.AddReminder(reminder); err != nil {
+		if errors.Is(err, models.ErrInvalidReminder) || errors.Is(err, models.ErrReminderInPast) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, reminder)
+}
+
+func (h *ReminderHandler) DeleteReminder(c *gin.Context) {
+
+	subject, todo, ok := h.readableTodo(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("reminderID"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reminder ID"})
+		return
+	}
+
+	if err := h.service.DeleteReminder(uint(id), todo.ID, subject.UserID); err != nil {
+		if errors.Is(err, service.ErrReminderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetRules lists the user's default reminders.
+func (h *ReminderHandler) GetRules(c *gin.Context) {
+
+	claims := c.MustGet("user").(*models.Claims)
+
+	rules, err := h.service.GetRules(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *ReminderHandler) CreateRule(c *gin.Context) {
+
+	claims := c.MustGet("user").(*models.Claims)
+
+	var req ReminderRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := &models.ReminderRule{UserID: claims.UserID, Offset: *req.Offset, Email: req.Email}
+	if err := h.service.AddRule(rule); err != nil {
+		if errors.Is(err, models.ErrInvalidReminder) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *ReminderHandler) DeleteRule(c *gin.Context) {
+
+	claims := c.MustGet("user").(*models.Claims)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+
+	if err := h.service.DeleteRule(uint(id), claims.UserID); err != nil {
+		if errors.Is(err, service.ErrReminderRuleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// readableTodo loads the todo in the path, which the user must be able to
+// read to set reminders on it.
+func (h *ReminderHandler) readableTodo(c *gin.Context) (policy.Subject, *models.Todo, bool) {
+
+	subject, ok := requestSubject(c, h.policyService)
+	if !ok {
+		return policy.Subject{}, nil, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return policy.Subject{}, nil, false
+	}
+
+	todo, err := h.todoService.GetTodo(uint(id))
+	if err != nil || todo == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+		return policy.Subject{}, nil, false
+	}
+
+	if !h.policyService.CanTodo(subject, policy.TodoRead, todo) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to view this todo"})
+		return policy.Subject{}, nil, false
+	}
+
+	return subject, todo, true
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/policy"
+)
+
+type RoleCreateRequest struct {
+	Name        string                                  `json:"name" binding:"required"`
+	Description string                                  `json:"description" binding:"max=255"`
+	Grants      map[policy.Permission][]policy.Relation `json:"grants" binding:"required"`
+}
+
+type RoleUpdateRequest struct {
+	Description string                                  `json:"description" binding:"max=255"`
+	Grants      map[policy.Permission][]policy.Relation `json:"grants" binding:"required"`
+}
+
+type RoleListResponse struct {
+	Roles       []policy.Role                           `json:"roles"`
+	Permissions map[policy.Permission][]policy.Relation `json:"permissions"`
+}
+
+func (r RoleCreateRequest) Role() policy.Role {
+	return policy.Role{Name: models.Role(r.Name), Description: r.Description, Grants: r.Grants}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/policy"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+type RoleHandler struct {
+	policyService *service.PolicyService
+	auditService  *service.AuditService
+}
+
+func NewRoleHandler(policyService *service.PolicyService, auditService *service.AuditService) *RoleHandler {
+	return &RoleHandler{policyService: policyService, auditService: auditService}
+}
+
+// GetRoles lists every role together with the permissions grants can use.
+func (h *RoleHandler) GetRoles(c *gin.Context) {
+	c.JSON(http.StatusOK, RoleListResponse{
+		Roles:       h.policyService.Roles(),
+		Permissions: policy.Permissions(),
+	})
+}
+
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+
+	var req RoleCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := req.Role()
+	if err := h.policyService.CreateRole(role); err != nil {
+		respondRoleError(c, err)
+		return
+	}
+
+	h.record(c, models.AuditRoleCreated, role.Name)
+
+	c.JSON(http.StatusCreated, role)
+}
+
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+
+	var req RoleUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := policy.Role{Name: models.Role(c.Param("name")), Description: req.Description, Grants: req.Grants}
+	if err := h.policyService.UpdateRole(role); err != nil {
+		respondRoleError(c, err)
+		return
+	}
+
+	h.record(c, models.AuditRoleUpdated, role.Name)
+
+	c.JSON(http.StatusOK, role)
+}
+
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	name := models.Role(c.Param("name"))
+	if err := h.policyService.DeleteRole(name); err != nil {
+		respondRoleError(c, err)
+		return
+	}
+
+	h.record(c, models.AuditRoleDeleted, name)
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *RoleHandler) record(c *gin.Context, action string, name models.Role) {
+	event := newAuditEvent(c, action)
+	event.SetTarget(models.AuditTargetRole, 0, string(name))
+	h.auditService.Record(event)
+}
+
+func respondRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRoleExists), errors.Is(err, service.ErrRoleInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, policy.ErrBuiltInRole):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, policy.ErrInvalidRoleName), errors.Is(err, policy.ErrUnknownPermission), errors.Is(err, policy.ErrInvalidRelation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"time"
+
+	"github.com/harrisin2037/todoapp/internal/models"
 )
 
 type TaskTemplateCreateRequest struct {
@@ -15,14 +17,38 @@ type TaskTemplateUpdateRequest struct {
 	Description string `json:"description"`
 }
 
+// TaskTemplatePatchRequest is a JSON merge patch for a task template: absent
+// members are left unchanged and null members are cleared.
+type TaskTemplatePatchRequest struct {
+	Name            PatchField[string] `json:"name"`
+	Description     PatchField[string] `json:"description"`
+	DefaultDuration PatchField[int]    `json:"default_duration"`
+}
+
 type TaskTemplateResponse struct {
-	ID          uint         `json:"id"`
-	Name        string       `json:"name"`
-	Description string       `json:"description"`
-	OwnerID     uint         `json:"owner_id"`
-	Owner       UserResponse `json:"owner"`
-	CreatedAt   time.Time    `json:"created_at"`
-	UpdatedAt   time.Time    `json:"updated_at"`
+	ID              uint         `json:"id"`
+	Name            string       `json:"name"`
+	Description     string       `json:"description"`
+	DefaultDuration int          `json:"default_duration"`
+	OwnerID         uint         `json:"owner_id"`
+	Owner           UserResponse `json:"owner"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	Version         uint         `json:"version"`
+}
+
+func NewTaskTemplateResponse(template models.TaskTemplate) TaskTemplateResponse {
+	return TaskTemplateResponse{
+		ID:              template.ID,
+		Name:            template.Name,
+		Description:     template.Description,
+		DefaultDuration: template.DefaultDurationTimestamp,
+		OwnerID:         template.OwnerID,
+		Owner:           NewUserResponse(template.Owner),
+		CreatedAt:       template.CreatedAt,
+		UpdatedAt:       template.UpdatedAt,
+		Version:         template.Version,
+	}
 }
 
 type TaskTemplateListResponse struct {
@@ -1,7 +1,8 @@
 package handlers
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -9,21 +10,24 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/policy"
 	"github.com/harrisin2037/todoapp/internal/service"
 	"github.com/harrisin2037/todoapp/internal/websocket"
 )
 
 type TaskTemplateHandler struct {
-	hub         *websocket.Hub
-	userService *service.UserService
-	service     *service.TaskTemplateService
+	hub           *websocket.Hub
+	userService   *service.UserService
+	policyService *service.PolicyService
+	service       *service.TaskTemplateService
 }
 
-func NewTaskTemplateHandler(service *service.TaskTemplateService, userService *service.UserService, hub *websocket.Hub) *TaskTemplateHandler {
+func NewTaskTemplateHandler(service *service.TaskTemplateService, userService *service.UserService, policyService *service.PolicyService, hub *websocket.Hub) *TaskTemplateHandler {
 	return &TaskTemplateHandler{
-		service:     service,
-		userService: userService,
-		hub:         hub,
+		service:       service,
+		userService:   userService,
+		policyService: policyService,
+		hub:           hub,
 	}
 }
 
@@ -67,27 +71,16 @@ func (h *TaskTemplateHandler) CreateTaskTemplate(c *gin.Context) {
 
 	h.hub.Broadcast <- []byte(`{"message": "new task template created"}`)
 
-	response := TaskTemplateResponse{
-		ID:          taskTemplate.ID,
-		Name:        taskTemplate.Name,
-		Description: taskTemplate.Description,
-		OwnerID:     taskTemplate.OwnerID,
-	}
+	response := NewTaskTemplateResponse(*taskTemplate)
 
+	setETag(c, taskTemplate.Version)
 	c.JSON(http.StatusCreated, response)
 }
 
 func (h *TaskTemplateHandler) GetTaskTemplates(c *gin.Context) {
 
-	claims, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not recognized"})
-		return
-	}
-
-	user, ok := claims.(*models.Claims)
+	subject, ok := requestSubject(c, h.policyService)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
 		return
 	}
 
@@ -97,10 +90,10 @@ func (h *TaskTemplateHandler) GetTaskTemplates(c *gin.Context) {
 		templates = []models.TaskTemplate{}
 	)
 
-	if user.Role == "admin" {
+	if h.policyService.Can(subject, policy.TemplateRead) {
 		templates, err = h.service.GetTaskTemplateList("id", "asc")
 	} else {
-		templates, err = h.service.GetTaskTemplatesByOwnerID(user.UserID)
+		templates, err = h.service.GetTaskTemplatesByOwnerID(subject.UserID)
 	}
 
 	if err != nil {
@@ -109,13 +102,7 @@ func (h *TaskTemplateHandler) GetTaskTemplates(c *gin.Context) {
 	}
 
 	for _, template := range templates {
-		response = append(response, TaskTemplateResponse{
-			ID:          template.ID,
-			Name:        template.Name,
-			Description: template.Description,
-			OwnerID:     template.OwnerID,
-			Owner:       NewUserResponse(template.Owner),
-		})
+		response = append(response, NewTaskTemplateResponse(template))
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -123,6 +110,11 @@ func (h *TaskTemplateHandler) GetTaskTemplates(c *gin.Context) {
 
 func (h *TaskTemplateHandler) GetTaskTemplatesByOwnerID(c *gin.Context) {
 
+	subject, ok := requestSubject(c, h.policyService)
+	if !ok {
+		return
+	}
+
 	ownerID, err := strconv.ParseUint(c.Param("ownerID"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid owner ID"})
@@ -137,19 +129,21 @@ func (h *TaskTemplateHandler) GetTaskTemplatesByOwnerID(c *gin.Context) {
 
 	response := []TaskTemplateResponse{}
 	for _, template := range templates {
-		response = append(response, TaskTemplateResponse{
-			ID:          template.ID,
-			Name:        template.Name,
-			Description: template.Description,
-			OwnerID:     template.OwnerID,
-			Owner:       NewUserResponse(template.Owner),
-		})
+		if !h.policyService.CanTemplate(subject, policy.TemplateRead, &template) {
+			continue
+		}
+		response = append(response, NewTaskTemplateResponse(template))
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
 func (h *TaskTemplateHandler) GetTaskTemplate(c *gin.Context) {
+	subject, ok := requestSubject(c, h.policyService)
+	if !ok {
+		return
+	}
+
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
@@ -157,33 +151,26 @@ func (h *TaskTemplateHandler) GetTaskTemplate(c *gin.Context) {
 	}
 
 	template, err := h.service.GetTaskTemplateByID(uint(id))
-	if err != nil {
+	if err != nil || template == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Task template not found"})
 		return
 	}
 
-	response := TaskTemplateResponse{
-		ID:          template.ID,
-		Name:        template.Name,
-		Description: template.Description,
-		OwnerID:     template.OwnerID,
-		Owner:       NewUserResponse(template.Owner),
+	if !h.policyService.CanTemplate(subject, policy.TemplateRead, template) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to view this task template"})
+		return
 	}
 
+	response := NewTaskTemplateResponse(*template)
+
+	setETag(c, template.Version)
 	c.JSON(http.StatusOK, response)
 }
 
 func (h *TaskTemplateHandler) UpdateTaskTemplate(c *gin.Context) {
 
-	userClaims, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not recognized"})
-		return
-	}
-
-	claims, ok := userClaims.(*models.Claims)
+	subject, ok := requestSubject(c, h.policyService)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
 		return
 	}
 
@@ -200,16 +187,26 @@ func (h *TaskTemplateHandler) UpdateTaskTemplate(c *gin.Context) {
 	}
 
 	template, err := h.service.GetTaskTemplateByID(uint(id))
-	if err != nil {
+	if err != nil || template == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Task template not found"})
 		return
 	}
 
-	if template.OwnerID != claims.UserID && claims.Role != "admin" {
+	if !h.policyService.CanTemplate(subject, policy.TemplateUpdate, template) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to update this task template"})
 		return
 	}
 
+	expectedVersion, hasIfMatch, err := ifMatchVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if hasIfMatch && expectedVersion != template.Version {
+		h.respondVersionConflict(c, template)
+		return
+	}
+
 	if req.Name != "" {
 		template.Name = req.Name
 	}
@@ -218,39 +215,156 @@ func (h *TaskTemplateHandler) UpdateTaskTemplate(c *gin.Context) {
 	}
 
 	if err := h.service.UpdateTaskTemplate(template); err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			current, err := h.service.GetTaskTemplateByID(template.ID)
+			if err != nil || current == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Task template not found"})
+				return
+			}
+			h.respondVersionConflict(c, current)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	h.hub.Broadcast <- []byte(fmt.Sprintf(`
-		{
-			"message":"task template updated",
-			"taskTemplate":{
-				"id":%d,
-				"name":"%s",
-				"description":"%s",
-				"owner_id":%d
-			}
-		}`, template.ID, template.Name, template.Description, template.OwnerID))
+	h.hub.Broadcast <- taskTemplateUpdatedMessage(template)
 
-	response := TaskTemplateResponse{
-		ID:          template.ID,
-		Name:        template.Name,
-		Description: template.Description,
-		OwnerID:     template.OwnerID,
-		Owner:       NewUserResponse(template.Owner),
-	}
+	response := NewTaskTemplateResponse(*template)
 
+	setETag(c, template.Version)
 	c.JSON(http.StatusOK, response)
 }
 
+func (h *TaskTemplateHandler) PatchTaskTemplate(c *gin.Context) {
+
+	subject, ok := requestSubject(c, h.policyService)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	if !isMergePatchRequest(c) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be " + mergePatchContentType})
+		return
+	}
+
+	var req TaskTemplatePatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template, err := h.service.GetTaskTemplateByID(uint(id))
+	if err != nil || template == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task template not found"})
+		return
+	}
+
+	if !h.policyService.CanTemplate(subject, policy.TemplateUpdate, template) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to update this task template"})
+		return
+	}
+
+	expectedVersion, hasIfMatch, err := ifMatchVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if hasIfMatch && expectedVersion != template.Version {
+		h.respondVersionConflict(c, template)
+		return
+	}
+
+	if req.Name.Set {
+		if !req.Name.HasValue() || req.Name.Value == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name cannot be cleared"})
+			return
+		}
+		template.Name = req.Name.Value
+	}
+	if req.Description.Set {
+		template.Description = req.Description.Value
+	}
+	if req.DefaultDuration.Set {
+		if req.DefaultDuration.Value < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Default duration cannot be negative"})
+			return
+		}
+		template.DefaultDurationTimestamp = req.DefaultDuration.Value
+	}
+
+	if err := h.service.UpdateTaskTemplate(template); err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			current, err := h.service.GetTaskTemplateByID(template.ID)
+			if err != nil || current == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Task template not found"})
+				return
+			}
+			h.respondVersionConflict(c, current)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.hub.Broadcast <- taskTemplateUpdatedMessage(template)
+
+	setETag(c, template.Version)
+	c.JSON(http.StatusOK, NewTaskTemplateResponse(*template))
+}
+
+func taskTemplateUpdatedMessage(template *models.TaskTemplate) []byte {
+	message, _ := json.Marshal(gin.H{
+		"message": "task template updated",
+		"taskTemplate": gin.H{
+			"id":          template.ID,
+			"name":        template.Name,
+			"description": template.Description,
+			"owner_id":    template.OwnerID,
+		},
+	})
+	return message
+}
+
+// respondVersionConflict answers a failed If-Match or a lost update race with
+// the template currently stored, so the client can merge and retry.
+func (h *TaskTemplateHandler) respondVersionConflict(c *gin.Context, current *models.TaskTemplate) {
+	setETag(c, current.Version)
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":   models.ErrVersionConflict.Error(),
+		"current": NewTaskTemplateResponse(*current),
+	})
+}
+
 func (h *TaskTemplateHandler) DeleteTaskTemplate(c *gin.Context) {
+	subject, ok := requestSubject(c, h.policyService)
+	if !ok {
+		return
+	}
+
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
 		return
 	}
 
+	template, err := h.service.GetTaskTemplateByID(uint(id))
+	if err != nil || template == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task template not found"})
+		return
+	}
+
+	if !h.policyService.CanTemplate(subject, policy.TemplateDelete, template) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to delete this task template"})
+		return
+	}
+
 	if err := h.service.DeleteTaskTemplate(uint(id)); err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Task template not found"})
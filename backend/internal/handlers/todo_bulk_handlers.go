@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/policy"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+const (
+	maxBulkTodos = 500
+
+	bulkModeAllOrNothing = "all_or_nothing"
+	bulkModeBestEffort   = "best_effort"
+
+	bulkResultOK         = "ok"
+	bulkResultFailed     = "failed"
+	bulkResultRolledBack = "rolled_back"
+	bulkResultSkipped    = "skipped"
+)
+
+var (
+	errBulkTodoNotFound = errors.New("todo not found")
+	errBulkForbidden    = errors.New("you are not allowed to update this todo")
+	errBulkAborted      = errors.New("bulk operation aborted")
+)
+
+// bulkOperation is a validated bulk action with the users it refers to
+// already loaded, so each item only has to apply it.
+type bulkOperation struct {
+	action     TodoBulkAction
+	permission policy.Permission
+	assignees  []models.User
+	owner      *models.User
+}
+
+func (h *TodoHandler) BulkTodos(c *gin.Context) {
+
+	subject, ok := requestSubject(c, h.policyService)
+	if !ok {
+		return
+	}
+
+	var req TodoBulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if (len(req.IDs) > 0) == (req.Filter != nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either ids or filter"})
+		return
+	}
+
+	mode := req.Mode
+	if mode == "" {
+		mode = bulkModeAllOrNothing
+	}
+
+	op, status, err := h.prepareBulkOperation(subject, req.Action)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	ids := uniqueIDs(req.IDs)
+	if req.Filter != nil {
+		ids, err = h.resolveBulkFilter(subject, *req.Filter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if len(ids) > maxBulkTodos {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many todos in one bulk request"})
+		return
+	}
+
+	results := make([]TodoBulkItemResult, 0, len(ids))
+
+	if mode == bulkModeAllOrNothing {
+		err = h.service.WithinTransaction(func(tx *service.TodoService) error {
+			for _, id := range ids {
+				if err := applyBulkItem(tx, h.policyService, subject, id, op); err != nil {
+					results = append(results, TodoBulkItemResult{ID: id, Status: bulkResultFailed, Error: err.Error()})
+					return errBulkAborted
+				}
+				results = append(results, TodoBulkItemResult{ID: id, Status: bulkResultOK})
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errBulkAborted) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			for i := range results {
+				if results[i].Status == bulkResultOK {
+					results[i].Status = bulkResultRolledBack
+				}
+			}
+			for _, id := range ids[len(results):] {
+				results = append(results, TodoBulkItemResult{ID: id, Status: bulkResultSkipped})
+			}
+		}
+	} else {
+		for _, id := range ids {
+			if err := applyBulkItem(h.service, h.policyService, subject, id, op); err != nil {
+				results = append(results, TodoBulkItemResult{ID: id, Status: bulkResultFailed, Error: err.Error()})
+				continue
+			}
+			results = append(results, TodoBulkItemResult{ID: id, Status: bulkResultOK})
+		}
+	}
+
+	response := TodoBulkResponse{
+		Mode:    mode,
+		Action:  req.Action.Type,
+		Results: results,
+	}
+	succeededIDs := []uint{}
+	for _, result := range results {
+		switch result.Status {
+		case bulkResultOK:
+			response.Succeeded++
+			succeededIDs = append(succeededIDs, result.ID)
+		case bulkResultFailed:
+			response.Failed++
+		}
+	}
+
+	if len(succeededIDs) > 0 {
+		message, _ := json.Marshal(gin.H{
+			"message": "todos bulk updated",
+			"action":  req.Action.Type,
+			"ids":     succeededIDs,
+		})
+		h.hub.Broadcast <- message
+	}
+
+	if mode == bulkModeAllOrNothing && response.Failed > 0 {
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *TodoHandler) prepareBulkOperation(subject policy.Subject, action TodoBulkAction) (*bulkOperation, int, error) {
+	op := &bulkOperation{action: action, permission: policy.TodoUpdate}
+
+	switch action.Type {
+	case "delete":
+		op.permission = policy.TodoDelete
+	case "set_status":
+		if !models.IsValidTodoStatus(action.Status) {
+			return nil, http.StatusBadRequest, errors.New("invalid status field")
+		}
+	case "set_priority":
+		if !models.IsValidTodoPriority(action.Priority) {
+			return nil, http.StatusBadRequest, errors.New("invalid priority field")
+		}
+	case "add_tags", "remove_tags":
+		if len(action.Tags) == 0 {
+			return nil, http.StatusBadRequest, errors.New("tags are required")
+		}
+		if action.Type == "add_tags" {
+			if err := models.ValidateTags(action.Tags); err != nil {
+				return nil, http.StatusBadRequest, err
+			}
+		}
+	case "add_assignees", "remove_assignees":
+		if len(action.AssigneeIDs) == 0 {
+			return nil, http.StatusBadRequest, errors.New("assignee_ids are required")
+		}
+		assignees, err := h.userService.GetUsersByIDs(uniqueIDs(action.AssigneeIDs))
+		if err != nil || len(assignees) != len(uniqueIDs(action.AssigneeIDs)) {
+			return nil, http.StatusBadRequest, errors.New("invalid assignee ID")
+		}
+		if action.Type == "add_assignees" && addsDeactivatedUser(assignees, nil) {
+			return nil, http.StatusBadRequest, errors.New("cannot assign a deactivated user")
+		}
+		op.assignees = assignees
+	case "change_owner":
+		op.permission = policy.TodoChangeOwner
+		owner, err := h.userService.GetUserByID(action.OwnerID)
+		if err != nil || owner.IsDeactivated() {
+			return nil, http.StatusBadRequest, errors.New("invalid new owner ID")
+		}
+		op.owner = owner
+	case "move_project":
+		// Todos can only be moved into a project the user can see, which
+		// for most users means one they lead or are a member of.
+		if action.ProjectID != nil {
+			project, err := h.projectService.GetProject(*action.ProjectID)
+			if err != nil {
+				return nil, http.StatusBadRequest, errors.New("invalid project ID")
+			}
+			if !h.policyService.CanProject(subject, policy.ProjectRead, project) {
+				return nil, http.StatusForbidden, errors.New("you are not a member of this project")
+			}
+		}
+	}
+
+	return op, http.StatusOK, nil
+}
+
+func (h *TodoHandler) resolveBulkFilter(subject policy.Subject, filter TodoBulkFilter) ([]uint, error) {
+	for _, status := range filter.Statuses {
+		if !models.IsValidTodoStatus(status) {
+			return nil, errors.New("invalid status field")
+		}
+	}
+
+	var (
+		err   error
+		todos []models.Todo
+	)
+	if h.policyService.Can(subject, policy.TodoRead) {
+		todos, err = h.service.GetTodosByAdmin(filter.Statuses, "id", "asc")
+	} else {
+		todos, err = h.service.GetTodos(filter.Statuses, "id", "asc", subject.UserID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []uint{}
+	for _, todo := range todos {
+		if len(filter.Statuses) > 0 && !containsString(filter.Statuses, todo.Status) {
+			continue
+		}
+		if filter.OwnerID != nil && todo.OwnerID != *filter.OwnerID {
+			continue
+		}
+		if filter.ProjectID != nil && (todo.ProjectID == nil || *todo.ProjectID != *filter.ProjectID) {
+			continue
+		}
+		if filter.Tag != "" && !containsString(todo.TagList(), filter.Tag) {
+			continue
+		}
+		ids = append(ids, todo.ID)
+	}
+	return ids, nil
+}
+
+func applyBulkItem(svc *service.TodoService, policyService *service.PolicyService, subject policy.Subject, id uint, op *bulkOperation) error {
+	todo, err := svc.GetTodo(id)
+	if err != nil {
+		return err
+	}
+	if todo == nil {
+		return errBulkTodoNotFound
+	}
+
+	if !policyService.CanTodo(subject, op.permission, todo) {
+		return errBulkForbidden
+	}
+
+	action := op.action
+	switch action.Type {
+	case "delete":
+		return svc.DeleteTodo(todo.ID)
+	case "set_status":
+		todo.Status = action.Status
+	case "set_priority":
+		todo.Priority = action.Priority
+	case "add_tags":
+		todo.SetTagList(append(todo.TagList(), action.Tags...))
+	case "remove_tags":
+		tags := []string{}
+		for _, tag := range todo.TagList() {
+			if !containsString(action.Tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		todo.SetTagList(tags)
+	case "add_assignees":
+		for _, assignee := range op.assignees {
+			if !models.AssigneesContainsUser(todo.Assignees, assignee) {
+				todo.Assignees = append(todo.Assignees, assignee)
+			}
+		}
+	case "remove_assignees":
+		assignees := []models.User{}
+		for _, assignee := range todo.Assignees {
+			if !models.AssigneesContainsUser(op.assignees, assignee) {
+				assignees = append(assignees, assignee)
+			}
+		}
+		todo.Assignees = assignees
+	case "change_owner":
+		todo.Owner = *op.owner
+		todo.OwnerID = op.owner.ID
+	case "move_project":
+		todo.ProjectID = action.ProjectID
+	}
+
+	return svc.UpdateTodo(todo)
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := map[uint]bool{}
+	result := []uint{}
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -2,32 +2,169 @@ package handlers
 
 import (
 	"time"
+
+	"github.com/harrisin2037/todoapp/internal/models"
 )
 
 type TodoCreateRequest struct {
 	Name        string  `json:"name" binding:"required"`
 	Description string  `json:"description"`
 	DueDate     *string `json:"due_date"`
+	AllDay      *bool   `json:"all_day"`
 	Status      string  `json:"status"`
 	AssigneeIDs []uint  `json:"assignee_ids"`
+
+	StartAt           *string `json:"start_at"`
+	ScheduledAt       *string `json:"scheduled_at"`
+	EstimatedDuration *int    `json:"estimated_duration"`
 }
 
 type TodoUpdateRequest struct {
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	DueDate     *string `json:"due_date"`
+	AllDay      *bool   `json:"all_day"`
 	Status      string  `json:"status"`
 	OwnerID     *uint   `json:"owner_id"`
 	AssigneeIDs []uint  `json:"assignee_ids"`
+
+	StartAt           *string `json:"start_at"`
+	ScheduledAt       *string `json:"scheduled_at"`
+	EstimatedDuration *int    `json:"estimated_duration"`
+}
+
+// TodoPatchRequest is a JSON merge patch for a todo: absent members are left
+// unchanged and null members are cleared.
+type TodoPatchRequest struct {
+	Name        PatchField[string] `json:"name"`
+	Description PatchField[string] `json:"description"`
+	DueDate     PatchField[string] `json:"due_date"`
+	AllDay      PatchField[bool]   `json:"all_day"`
+	Status      PatchField[string] `json:"status"`
+	OwnerID     PatchField[uint]   `json:"owner_id"`
+	AssigneeIDs PatchField[[]uint] `json:"assignee_ids"`
+
+	StartAt           PatchField[string] `json:"start_at"`
+	ScheduledAt       PatchField[string] `json:"scheduled_at"`
+	EstimatedDuration PatchField[int]    `json:"estimated_duration"`
 }
 
 type TodoResponse struct {
-	ID          uint           `json:"id"`
-	Name        string         `json:"name"`
-	Description string         `json:"description"`
-	DueDate     *time.Time     `json:"due_date"`
-	Status      string         `json:"status"`
-	OwnerID     uint           `json:"owner_id"`
-	Owner       UserResponse   `json:"owner"`
-	Assignees   []UserResponse `json:"assignees"`
+	ID           uint           `json:"id"`
+	Name         string         `json:"name"`
+	Description  string         `json:"description"`
+	DueDate      *time.Time     `json:"due_date"`
+	AllDay       bool           `json:"all_day"`
+	DueTimezone  string         `json:"due_timezone,omitempty"`
+	DueLocalDate string         `json:"due_local_date,omitempty"`
+	Status       string         `json:"status"`
+	Priority     string         `json:"priority"`
+	Tags         []string       `json:"tags"`
+	ProjectID    *uint          `json:"project_id"`
+	OwnerID      uint           `json:"owner_id"`
+	Owner        UserResponse   `json:"owner"`
+	Assignees    []UserResponse `json:"assignees"`
+	Version      uint           `json:"version"`
+
+	StartAt           *time.Time `json:"start_at"`
+	ScheduledAt       *time.Time `json:"scheduled_at"`
+	EstimatedDuration int        `json:"estimated_duration"`
+	OverdueAt         *time.Time `json:"overdue_at"`
+}
+
+func NewTodoResponse(todo models.Todo) TodoResponse {
+	return TodoResponse{
+		ID:           todo.ID,
+		Name:         todo.Name,
+		Description:  todo.Description,
+		DueDate:      todo.DueDate,
+		AllDay:       todo.AllDay,
+		DueTimezone:  todo.DueTimezone,
+		DueLocalDate: todo.DueLocalDate(),
+		Status:       todo.Status,
+		Priority:     todo.Priority,
+		Tags:         todo.TagList(),
+		ProjectID:    todo.ProjectID,
+		OwnerID:      todo.OwnerID,
+		Owner:        NewUserResponse(todo.Owner),
+		Assignees:    NewUsersResponse(todo.Assignees),
+		Version:      todo.Version,
+
+		StartAt:           todo.StartAt,
+		ScheduledAt:       todo.ScheduledAt,
+		EstimatedDuration: todo.EstimatedDuration,
+		OverdueAt:         todo.OverdueAt,
+	}
+}
+
+// CalendarEntryResponse places a todo on a calendar between Start and End.
+type CalendarEntryResponse struct {
+	Start  time.Time    `json:"start"`
+	End    time.Time    `json:"end"`
+	AllDay bool         `json:"all_day"`
+	Todo   TodoResponse `json:"todo"`
+}
+
+func NewCalendarEntryResponse(todo models.Todo) CalendarEntryResponse {
+	start, end, _ := todo.Span()
+	return CalendarEntryResponse{
+		Start:  start,
+		End:    end,
+		AllDay: todo.AllDay && todo.ScheduledAt == nil && todo.StartAt == nil,
+		Todo:   NewTodoResponse(todo),
+	}
+}
+
+// TodoQuickRequest is a todo written as one line of text, such as
+// "Deploy hotfix tomorrow 3pm #infra !high @alice".
+type TodoQuickRequest struct {
+	Text    string `json:"text" binding:"required"`
+	Preview bool   `json:"preview"`
+}
+
+// TodoQuickPreviewResponse shows how a quick-add line would be saved.
+// UnknownMentions lists mentions that do not name an active user.
+type TodoQuickPreviewResponse struct {
+	Todo            TodoResponse `json:"todo"`
+	UnknownMentions []string     `json:"unknown_mentions"`
+}
+
+// TodoBulkRequest selects todos either by explicit IDs or by a filter and
+// applies one action to each of them.
+type TodoBulkRequest struct {
+	IDs    []uint          `json:"ids"`
+	Filter *TodoBulkFilter `json:"filter"`
+	Action TodoBulkAction  `json:"action" binding:"required"`
+	Mode   string          `json:"mode" binding:"omitempty,oneof=all_or_nothing best_effort"`
+}
+
+type TodoBulkFilter struct {
+	Statuses  []string `json:"status"`
+	OwnerID   *uint    `json:"owner_id"`
+	ProjectID *uint    `json:"project_id"`
+	Tag       string   `json:"tag"`
+}
+
+type TodoBulkAction struct {
+	Type        string   `json:"type" binding:"required,oneof=set_status set_priority add_tags remove_tags add_assignees remove_assignees change_owner move_project delete"`
+	Status      string   `json:"status"`
+	Priority    string   `json:"priority"`
+	Tags        []string `json:"tags"`
+	AssigneeIDs []uint   `json:"assignee_ids"`
+	OwnerID     uint     `json:"owner_id"`
+	ProjectID   *uint    `json:"project_id"`
+}
+
+type TodoBulkItemResult struct {
+	ID     uint   `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type TodoBulkResponse struct {
+	Mode      string               `json:"mode"`
+	Action    string               `json:"action"`
+	Succeeded int                  `json:"succeeded"`
+	Failed    int                  `json:"failed"`
+	Results   []TodoBulkItemResult `json:"results"`
 }
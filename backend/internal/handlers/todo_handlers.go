@@ -1,7 +1,8 @@
 package handlers
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -12,21 +13,28 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/policy"
 	"github.com/harrisin2037/todoapp/internal/service"
 	"github.com/harrisin2037/todoapp/internal/websocket"
 )
 
+var errInvalidDateFormat = errors.New("invalid date format")
+
 type TodoHandler struct {
-	hub         *websocket.Hub
-	userService *service.UserService
-	service     *service.TodoService
+	hub            *websocket.Hub
+	userService    *service.UserService
+	projectService *service.ProjectService
+	policyService  *service.PolicyService
+	service        *service.TodoService
 }
 
-func NewTodoHandler(service *service.TodoService, userService *service.UserService, hub *websocket.Hub) *TodoHandler {
+func NewTodoHandler(service *service.TodoService, userService *service.UserService, projectService *service.ProjectService, policyService *service.PolicyService, hub *websocket.Hub) *TodoHandler {
 	return &TodoHandler{
-		service:     service,
-		userService: userService,
-		hub:         hub,
+		service:        service,
+		userService:    userService,
+		projectService: projectService,
+		policyService:  policyService,
+		hub:            hub,
 	}
 }
 
@@ -50,16 +58,6 @@ func (h *TodoHandler) CreateTodo(c *gin.Context) {
 		return
 	}
 
-	var dueDate *time.Time
-	if req.DueDate != nil {
-		parsedTime, err := dateparse.ParseAny(*req.DueDate)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
-			return
-		}
-		dueDate = &parsedTime
-	}
-
 	owner, err := h.userService.GetUserByID(claims.UserID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid owner ID"})
@@ -73,17 +71,28 @@ func (h *TodoHandler) CreateTodo(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignee ID"})
 			return
 		}
+		if addsDeactivatedUser(assignees, nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot assign a deactivated user"})
+			return
+		}
 	}
 
 	todo := &models.Todo{
 		Name:        req.Name,
 		Description: req.Description,
-		DueDate:     dueDate,
 		Status:      req.Status,
 		OwnerID:     owner.ID,
 		Owner:       *owner,
 		Assignees:   assignees,
 	}
+	if err := applyDueDate(todo, req.DueDate, req.AllDay, owner.Location()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+		return
+	}
+	if err := applySchedule(todo, optional(req.StartAt), optional(req.ScheduledAt), optional(req.EstimatedDuration), owner.Location()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if todo.Status == "" {
 		todo.Status = "pending"
@@ -96,17 +105,9 @@ func (h *TodoHandler) CreateTodo(c *gin.Context) {
 
 	h.hub.Broadcast <- []byte(`{"message": "new todo created"}`)
 
-	response := TodoResponse{
-		ID:          todo.ID,
-		Name:        todo.Name,
-		Description: todo.Description,
-		DueDate:     todo.DueDate,
-		Status:      todo.Status,
-		OwnerID:     todo.OwnerID,
-		Owner:       NewUserResponse(todo.Owner),
-		Assignees:   NewUsersResponse(todo.Assignees),
-	}
+	response := NewTodoResponse(*todo)
 
+	setETag(c, todo.Version)
 	c.JSON(http.StatusCreated, response)
 }
 
@@ -118,15 +119,8 @@ func (h *TodoHandler) GetTodos(c *gin.Context) {
 		order       = c.Query("order")
 	)
 
-	claims, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not regconized"})
-		return
-	}
-
-	user, ok := claims.(*models.Claims)
+	subject, ok := requestSubject(c, h.policyService)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
 		return
 	}
 
@@ -156,10 +150,10 @@ func (h *TodoHandler) GetTodos(c *gin.Context) {
 		todos    = []models.Todo{}
 	)
 
-	if user.Role == "admin" {
+	if h.policyService.Can(subject, policy.TodoRead) {
 		todos, err = h.service.GetTodosByAdmin(statuses, sortBy, order)
 	} else {
-		todos, err = h.service.GetTodos(statuses, sortBy, order, user.UserID)
+		todos, err = h.service.GetTodos(statuses, sortBy, order, subject.UserID)
 	}
 
 	if err != nil {
@@ -168,22 +162,21 @@ func (h *TodoHandler) GetTodos(c *gin.Context) {
 	}
 
 	for _, todo := range todos {
-		response = append(response, TodoResponse{
-			ID:          todo.ID,
-			Name:        todo.Name,
-			Description: todo.Description,
-			DueDate:     todo.DueDate,
-			Status:      todo.Status,
-			OwnerID:     todo.OwnerID,
-			Owner:       NewUserResponse(todo.Owner),
-			Assignees:   NewUsersResponse(todo.Assignees),
-		})
+		if !h.policyService.CanTodo(subject, policy.TodoRead, &todo) {
+			continue
+		}
+		response = append(response, NewTodoResponse(todo))
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
 func (h *TodoHandler) GetTodo(c *gin.Context) {
+	subject, ok := requestSubject(c, h.policyService)
+	if !ok {
+		return
+	}
+
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
@@ -191,41 +184,30 @@ func (h *TodoHandler) GetTodo(c *gin.Context) {
 	}
 
 	todo, err := h.service.GetTodo(uint(id))
-	if err != nil {
+	if err != nil || todo == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
 		return
 	}
 
-	response := TodoResponse{
-		ID:          todo.ID,
-		Name:        todo.Name,
-		Description: todo.Description,
-		DueDate:     todo.DueDate,
-		Status:      todo.Status,
-		OwnerID:     todo.OwnerID,
-		Owner:       NewUserResponse(todo.Owner),
-		Assignees:   NewUsersResponse(todo.Assignees),
+	if !h.policyService.CanTodo(subject, policy.TodoRead, todo) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to view this todo"})
+		return
 	}
 
+	response := NewTodoResponse(*todo)
+
+	setETag(c, todo.Version)
 	c.JSON(http.StatusOK, response)
 }
 
 func (h *TodoHandler) UpdateTodo(c *gin.Context) {
 
-	userClaims, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not regconized"})
-		return
-	}
-
-	claims, ok := userClaims.(*models.Claims)
+	subject, ok := requestSubject(c, h.policyService)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
 		return
 	}
 
-	userId := claims.UserID
-	user, err := h.userService.GetUserByID(userId)
+	user, err := h.userService.GetUserByID(subject.UserID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -244,34 +226,45 @@ func (h *TodoHandler) UpdateTodo(c *gin.Context) {
 	}
 
 	todo, err := h.service.GetTodo(uint(id))
-	if err != nil {
+	if err != nil || todo == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
 		return
 	}
 
-	if todo.OwnerID != userId && user.Role != "admin" && !models.AssigneesContainsUser(todo.Assignees, *user) {
+	if !h.policyService.CanTodo(subject, policy.TodoUpdate, todo) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to update this todo"})
 		return
 	}
 
+	expectedVersion, hasIfMatch, err := ifMatchVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if hasIfMatch && expectedVersion != todo.Version {
+		h.respondVersionConflict(c, todo)
+		return
+	}
+
 	if req.Name != "" {
 		todo.Name = req.Name
 	}
 	if req.Description != "" {
 		todo.Description = req.Description
 	}
-	if req.DueDate != nil {
-		parsedTime, err := dateparse.ParseAny(*req.DueDate)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
-			return
-		}
-		todo.DueDate = &parsedTime
+	if err := applyDueDate(todo, req.DueDate, req.AllDay, user.Location()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+		return
+	}
+	if err := applySchedule(todo, optional(req.StartAt), optional(req.ScheduledAt), optional(req.EstimatedDuration), user.Location()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 	if req.Status != "" {
 		todo.Status = req.Status
 	}
-	if req.OwnerID != nil && *req.OwnerID == 0 && todo.OwnerID == 0 && user.Role == "admin" {
+	canChangeOwner := h.policyService.CanTodo(subject, policy.TodoChangeOwner, todo)
+	if req.OwnerID != nil && *req.OwnerID == 0 && todo.OwnerID == 0 && canChangeOwner {
 		err := h.service.ChangeOwner(todo.ID, user.ID)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "admin change owner error"})
@@ -279,9 +272,9 @@ func (h *TodoHandler) UpdateTodo(c *gin.Context) {
 		}
 	}
 	if req.OwnerID != nil && *req.OwnerID > 0 {
-		if user.Role == "admin" {
+		if canChangeOwner {
 			newOwner, err := h.userService.GetUserByID(*req.OwnerID)
-			if err != nil {
+			if err != nil || newOwner.IsDeactivated() {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid new owner ID"})
 				return
 			}
@@ -295,50 +288,228 @@ func (h *TodoHandler) UpdateTodo(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignee ID"})
 			return
 		}
+		if addsDeactivatedUser(assignees, todo.Assignees) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot assign a deactivated user"})
+			return
+		}
 		todo.Assignees = assignees
 	}
 
 	if err := h.service.UpdateTodo(todo); err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			current, err := h.service.GetTodo(todo.ID)
+			if err != nil || current == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+				return
+			}
+			h.respondVersionConflict(c, current)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	h.hub.Broadcast <- []byte(
-		fmt.Sprintf(`
-		{
-			"message":"todo updated",
-			"todo":{
-				"id":%d,
-				"name":"%s",
-				"description":"%s",
-				"due_date":"%s",
-				"status":"%s",
-				"owner_id":%d
+	h.hub.Broadcast <- todoUpdatedMessage(todo)
+
+	response := NewTodoResponse(*todo)
+
+	setETag(c, todo.Version)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *TodoHandler) PatchTodo(c *gin.Context) {
+
+	subject, ok := requestSubject(c, h.policyService)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	if !isMergePatchRequest(c) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be " + mergePatchContentType})
+		return
+	}
+
+	var req TodoPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	todo, err := h.service.GetTodo(uint(id))
+	if err != nil || todo == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+		return
+	}
+
+	if !h.policyService.CanTodo(subject, policy.TodoUpdate, todo) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to update this todo"})
+		return
+	}
+
+	expectedVersion, hasIfMatch, err := ifMatchVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if hasIfMatch && expectedVersion != todo.Version {
+		h.respondVersionConflict(c, todo)
+		return
+	}
+
+	if req.Name.Set {
+		if !req.Name.HasValue() || req.Name.Value == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name cannot be cleared"})
+			return
+		}
+		todo.Name = req.Name.Value
+	}
+	if req.Description.Set {
+		todo.Description = req.Description.Value
+	}
+	// Dates without an offset are read in the time zone of the editing user.
+	loc := time.UTC
+	if req.DueDate.HasValue() || req.StartAt.HasValue() || req.ScheduledAt.HasValue() {
+		user, err := h.userService.GetUserByID(subject.UserID)
+		if err != nil || user == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		loc = user.Location()
+	}
+	var allDay *bool
+	if req.AllDay.Set {
+		allDay = &req.AllDay.Value
+	}
+	if req.DueDate.Null {
+		todo.ClearDueDate()
+	} else if err := applyDueDate(todo, req.DueDate.Pointer(), allDay, loc); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+		return
+	}
+	if err := applySchedule(todo, req.StartAt, req.ScheduledAt, req.EstimatedDuration, loc); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status.Set {
+		// Clearing the status puts the todo back to the column default.
+		status := "pending"
+		if req.Status.HasValue() {
+			status = strings.ToLower(req.Status.Value)
+		}
+		if status != "pending" && status != "in_progress" && status != "completed" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status field"})
+			return
+		}
+		todo.Status = status
+	}
+	if req.OwnerID.Set {
+		if !req.OwnerID.HasValue() || req.OwnerID.Value == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Owner cannot be cleared"})
+			return
+		}
+		if !h.policyService.CanTodo(subject, policy.TodoChangeOwner, todo) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to change the owner"})
+			return
+		}
+		newOwner, err := h.userService.GetUserByID(req.OwnerID.Value)
+		if err != nil || newOwner.IsDeactivated() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid new owner ID"})
+			return
+		}
+		todo.Owner = *newOwner
+		todo.OwnerID = newOwner.ID
+	}
+	if req.AssigneeIDs.Set {
+		assignees := []models.User{}
+		if len(req.AssigneeIDs.Value) > 0 {
+			assignees, err = h.userService.GetUsersByIDs(req.AssigneeIDs.Value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignee ID"})
+				return
 			}
-		}`,
-			todo.ID, todo.Name, todo.Description, todo.DueDate.Format(time.RFC3339), todo.Status, todo.OwnerID))
+		}
+		if addsDeactivatedUser(assignees, todo.Assignees) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot assign a deactivated user"})
+			return
+		}
+		todo.Assignees = assignees
+	}
 
-	response := TodoResponse{
-		ID:          todo.ID,
-		Name:        todo.Name,
-		Description: todo.Description,
-		DueDate:     todo.DueDate,
-		Status:      todo.Status,
-		OwnerID:     todo.OwnerID,
-		Owner:       NewUserResponse(todo.Owner),
-		Assignees:   NewUsersResponse(todo.Assignees),
+	if err := h.service.UpdateTodo(todo); err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			current, err := h.service.GetTodo(todo.ID)
+			if err != nil || current == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+				return
+			}
+			h.respondVersionConflict(c, current)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	h.hub.Broadcast <- todoUpdatedMessage(todo)
+
+	setETag(c, todo.Version)
+	c.JSON(http.StatusOK, NewTodoResponse(*todo))
+}
+
+func todoUpdatedMessage(todo *models.Todo) []byte {
+	message, _ := json.Marshal(gin.H{
+		"message": "todo updated",
+		"todo": gin.H{
+			"id":          todo.ID,
+			"name":        todo.Name,
+			"description": todo.Description,
+			"due_date":    todo.DueDate,
+			"all_day":     todo.AllDay,
+			"status":      todo.Status,
+			"owner_id":    todo.OwnerID,
+		},
+	})
+	return message
+}
+
+// respondVersionConflict answers a failed If-Match or a lost update race with
+// the state currently stored, so the client can merge its edits and retry.
+func (h *TodoHandler) respondVersionConflict(c *gin.Context, current *models.Todo) {
+	setETag(c, current.Version)
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":   models.ErrVersionConflict.Error(),
+		"current": NewTodoResponse(*current),
+	})
 }
 
 func (h *TodoHandler) DeleteTodo(c *gin.Context) {
 
+	subject, ok := requestSubject(c, h.policyService)
+	if !ok {
+		return
+	}
+
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
 		return
 	}
 
+	todo, err := h.service.GetTodo(uint(id))
+	if err != nil || todo == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+		return
+	}
+
+	if !h.policyService.CanTodo(subject, policy.TodoDelete, todo) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to delete this todo"})
+		return
+	}
+
 	if err := h.service.DeleteTodo(uint(id)); err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
@@ -350,3 +521,70 @@ func (h *TodoHandler) DeleteTodo(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// addsDeactivatedUser reports whether users contains a deactivated account
+// that is not already in current. Deactivating a user keeps their existing
+// assignments, so only new ones are refused.
+func addsDeactivatedUser(users, current []models.User) bool {
+	for _, user := range users {
+		if user.IsDeactivated() && !models.AssigneesContainsUser(current, user) {
+			return true
+		}
+	}
+	return false
+}
+
+// applySchedule applies the start, scheduled time and estimate of a request,
+// reading times in loc, and checks the result against the due date.
+func applySchedule(todo *models.Todo, startAt, scheduledAt PatchField[string], duration PatchField[int], loc *time.Location) error {
+	for _, field := range []struct {
+		value  PatchField[string]
+		target **time.Time
+	}{
+		{startAt, &todo.StartAt},
+		{scheduledAt, &todo.ScheduledAt},
+	} {
+		switch {
+		case field.value.Null:
+			*field.target = nil
+		case field.value.Set:
+			parsed, err := dateparse.ParseIn(field.value.Value, loc)
+			if err != nil {
+				return errInvalidDateFormat
+			}
+			parsed = parsed.UTC()
+			*field.target = &parsed
+		}
+	}
+	if duration.Set {
+		todo.EstimatedDuration = duration.Value
+	}
+	return todo.ValidateSchedule()
+}
+
+// applyDueDate sets the todo's due date from a client supplied string read in
+// loc. A bare date is an all-day due date unless allDay says otherwise, and
+// allDay without a value converts the due date already stored.
+func applyDueDate(todo *models.Todo, value *string, allDay *bool, loc *time.Location) error {
+	if value == nil {
+		if allDay != nil && todo.DueDate != nil {
+			todo.SetDueDate(*todo.DueDate, *allDay, todo.DueLocation())
+		}
+		return nil
+	}
+
+	dateOnly := true
+	due, err := time.ParseInLocation(time.DateOnly, strings.TrimSpace(*value), loc)
+	if err != nil {
+		dateOnly = false
+		due, err = dateparse.ParseIn(*value, loc)
+		if err != nil {
+			return err
+		}
+	}
+	if allDay != nil {
+		dateOnly = *allDay
+	}
+	todo.SetDueDate(due, dateOnly, loc)
+	return nil
+}
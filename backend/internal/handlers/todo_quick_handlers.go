@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/quickadd"
+)
+
+// QuickAddTodo creates a todo from one line of text. With preview set it only
+// reports how the text was read, so the client can confirm before saving.
+func (h *TodoHandler) QuickAddTodo(c *gin.Context) {
+
+	subject, ok := requestSubject(c, h.policyService)
+	if !ok {
+		return
+	}
+
+	var req TodoQuickRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	owner, err := h.userService.GetUserByID(subject.UserID)
+	if err != nil || owner == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid owner ID"})
+		return
+	}
+
+	parsed := quickadd.Parse(req.Text, quickadd.Options{
+		Now:       time.Now(),
+		Location:  owner.Location(),
+		WeekStart: time.Weekday(owner.WeekStart),
+	})
+
+	todo := &models.Todo{
+		Name:     parsed.Name,
+		Status:   "pending",
+		Priority: parsed.Priority,
+		OwnerID:  owner.ID,
+		Owner:    *owner,
+	}
+	todo.SetTagList(parsed.Tags)
+	if parsed.DueDate != nil {
+		todo.SetDueDate(*parsed.DueDate, parsed.AllDay, owner.Location())
+	}
+
+	assignees, unknown, err := h.resolveMentions(parsed.Mentions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	todo.Assignees = assignees
+
+	if req.Preview {
+		c.JSON(http.StatusOK, TodoQuickPreviewResponse{
+			Todo:            NewTodoResponse(*todo),
+			UnknownMentions: unknown,
+		})
+		return
+	}
+
+	if todo.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+	if len(unknown) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active user named @" + strings.Join(unknown, ", @")})
+		return
+	}
+
+	assigneeIDs := make([]uint, len(assignees))
+	for i, assignee := range assignees {
+		assigneeIDs[i] = assignee.ID
+	}
+	if err := h.service.CreateTodo(todo, assigneeIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.hub.Broadcast <- []byte(`{"message": "new todo created"}`)
+
+	setETag(c, todo.Version)
+	c.JSON(http.StatusCreated, NewTodoResponse(*todo))
+}
+
+// resolveMentions looks up mentioned usernames. Mentions of missing or
+// deactivated users are returned separately, since they cannot be assigned.
+func (h *TodoHandler) resolveMentions(mentions []string) ([]models.User, []string, error) {
+	assignees, unknown := []models.User{}, []string{}
+	if len(mentions) == 0 {
+		return assignees, unknown, nil
+	}
+
+	users, err := h.userService.GetUsersByUsernames(mentions)
+	if err != nil {
+		return nil, nil, err
+	}
+	byName := map[string]models.User{}
+	for _, user := range users {
+		byName[strings.ToLower(user.Username)] = user
+	}
+
+	seen := map[string]bool{}
+	for _, mention := range mentions {
+		key := strings.ToLower(mention)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		user, ok := byName[key]
+		if !ok || user.IsDeactivated() {
+			unknown = append(unknown, mention)
+			continue
+		}
+		assignees = append(assignees, user)
+	}
+	return assignees, unknown, nil
+}
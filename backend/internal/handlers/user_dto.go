@@ -1,19 +1,23 @@
 package handlers
 
-import "github.com/harrisin2037/todoapp/internal/models"
+import (
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
 
 type UserCreateRequest struct {
 	Username string `json:"username" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=6"`
-	Role     string `json:"role" binding:"required,oneof=user admin"`
+	Role     string `json:"role" binding:"required"`
 }
 
 type UserUpdateRequest struct {
 	Username string `json:"username"`
 	Email    string `json:"email" binding:"omitempty,email"`
 	Password string `json:"password" binding:"omitempty,min=6"`
-	Role     string `json:"role" binding:"omitempty,oneof=user admin"`
+	Role     string `json:"role"`
 }
 
 type UserRegisterRequest struct {
@@ -27,26 +31,62 @@ type UserLoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type UserLoginTwoFactorRequest struct {
+	Challenge string `json:"challenge" binding:"required"`
+	Code      string `json:"code" binding:"required"`
+}
+
+type UserRefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type UserLogoutRequest struct {
+	AllSessions bool `json:"all_sessions"`
+}
+
+type UserDeactivateRequest struct {
+	TransferTo *uint `json:"transfer_to" binding:"omitempty,min=1"`
+}
+
+type UserTransferRequest struct {
+	ToUserID uint `json:"to_user_id" binding:"required,min=1"`
+}
+
 type UserChangeRoleRequest struct {
 	UserID  uint   `json:"user_id" binding:"required,min=1,numeric"`
-	NewRole string `json:"new_role" binding:"required,oneof=user admin"`
+	NewRole string `json:"new_role" binding:"required"`
 }
 
 type UserResponse struct {
-	ID       uint   `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Role     string `json:"role"`
-	Color    string `json:"color"`
+	ID            uint       `json:"id"`
+	Username      string     `json:"username"`
+	DisplayName   string     `json:"display_name"`
+	AvatarURL     string     `json:"avatar_url,omitempty"`
+	Email         string     `json:"email"`
+	EmailVerified bool       `json:"email_verified"`
+	Role          string     `json:"role"`
+	Color         string     `json:"color"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+	Deactivated   bool       `json:"deactivated"`
 }
 
 func NewUserResponse(user models.User) UserResponse {
+	var lockedUntil *time.Time
+	if user.IsLocked(time.Now()) {
+		lockedUntil = user.LockedUntil
+	}
+
 	return UserResponse{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Role:     user.Role.String(),
-		Color:    user.Color,
+		ID:            user.ID,
+		Username:      user.Username,
+		DisplayName:   user.DisplayName,
+		AvatarURL:     avatarURL(user),
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Role:          user.Role.String(),
+		Color:         user.Color,
+		LockedUntil:   lockedUntil,
+		Deactivated:   user.IsDeactivated(),
 	}
 }
 
@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"io"
+	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -12,11 +18,15 @@ import (
 )
 
 type UserHandler struct {
-	userService *service.UserService
+	userService    *service.UserService
+	tokenService   *service.TokenService
+	accountService *service.AccountService
+	policyService  *service.PolicyService
+	auditService   *service.AuditService
 }
 
-func NewUserHandler(userService *service.UserService) *UserHandler {
-	return &UserHandler{userService: userService}
+func NewUserHandler(userService *service.UserService, tokenService *service.TokenService, accountService *service.AccountService, policyService *service.PolicyService, auditService *service.AuditService) *UserHandler {
+	return &UserHandler{userService: userService, tokenService: tokenService, accountService: accountService, policyService: policyService, auditService: auditService}
 }
 
 func (h *UserHandler) Register(c *gin.Context) {
@@ -28,12 +38,22 @@ func (h *UserHandler) Register(c *gin.Context) {
 		return
 	}
 
-	err := h.userService.Register(req.Username, req.Email, req.Password)
+	user, err := h.userService.Register(req.Username, req.Email, req.Password)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	event := newAuditEvent(c, models.AuditUserRegistered)
+	event.SetActor(user)
+	event.SetTarget(models.AuditTargetUser, user.ID, user.Username)
+	h.auditService.Record(event)
+
+	// The account exists either way; the user can ask for another mail.
+	if err := h.accountService.SendEmailVerification(user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{"message": "User registered successfully"})
 }
 
@@ -46,15 +66,118 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
-	user, token, err := h.userService.Login(req.Username, req.Password)
+	event := newAuditEvent(c, models.AuditLogin)
+	event.SetTarget(models.AuditTargetUser, 0, req.Username)
+
+	user, tokens, err := h.userService.Login(req.Username, req.Password)
 	if err != nil {
+		var challenge *service.TwoFactorRequiredError
+		if errors.As(err, &challenge) {
+			// Only the first factor was checked; /login/2fa records the login.
+			c.JSON(http.StatusOK, gin.H{
+				"message":             "Two-factor authentication required",
+				"two_factor_required": true,
+				"challenge":           challenge.Challenge,
+				"expires_in":          int64(challenge.ExpiresIn.Seconds()),
+			})
+			return
+		}
+		var locked *service.AccountLockedError
+		if errors.As(err, &locked) {
+			event.Fail("account_locked")
+			h.auditService.Record(event)
+			respondAccountLocked(c, locked)
+			return
+		}
+		if errors.Is(err, service.ErrUserDeactivated) {
+			event.Fail("account_deactivated")
+			h.auditService.Record(event)
+			c.JSON(http.StatusForbidden, gin.H{"error": "This account has been deactivated"})
+			return
+		}
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			event.Fail("email_not_verified")
+			h.auditService.Record(event)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address before logging in"})
+			return
+		}
+		event.Fail("invalid_credentials")
+		h.auditService.Record(event)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
+	h.recordLogin(event, user, "password")
+	respondLogin(c, user, tokens)
+}
+
+func (h *UserHandler) LoginTwoFactor(c *gin.Context) {
+
+	var req UserLoginTwoFactorRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditLogin)
+	if claims, err := models.ValidateTwoFactorChallenge(req.Challenge); err == nil {
+		event.SetTarget(models.AuditTargetUser, claims.UserID, claims.Username)
+	}
+
+	user, tokens, err := h.userService.LoginTwoFactor(req.Challenge, req.Code)
+	if err != nil {
+		var locked *service.AccountLockedError
+		switch {
+		case errors.As(err, &locked):
+			event.Fail("account_locked")
+			h.auditService.Record(event)
+			respondAccountLocked(c, locked)
+		case errors.Is(err, service.ErrUserDeactivated):
+			event.Fail("account_deactivated")
+			h.auditService.Record(event)
+			c.JSON(http.StatusForbidden, gin.H{"error": "This account has been deactivated"})
+		case errors.Is(err, service.ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		case errors.Is(err, service.ErrInvalidTwoFactorCode):
+			event.Fail("invalid_two_factor_code")
+			h.auditService.Record(event)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	h.recordLogin(event, user, "two_factor")
+	respondLogin(c, user, tokens)
+}
+
+func (h *UserHandler) recordLogin(event *models.AuditEvent, user *models.User, method string) {
+	event.SetActor(user)
+	event.SetTarget(models.AuditTargetUser, user.ID, user.Username)
+	event.SetDetail("method", method)
+	h.auditService.Record(event)
+}
+
+func respondAccountLocked(c *gin.Context, locked *service.AccountLockedError) {
+	seconds := int64(math.Ceil(time.Until(locked.Until).Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	c.JSON(http.StatusLocked, gin.H{
+		"error":        "Account is temporarily locked after too many failed attempts",
+		"locked_until": locked.Until,
+	})
+}
+
+func respondLogin(c *gin.Context, user *models.User, tokens *service.TokenPair) {
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"token":   token,
+		"message":       "Login successful",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    int64(tokens.ExpiresIn.Seconds()),
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
@@ -64,6 +187,74 @@ func (h *UserHandler) Login(c *gin.Context) {
 	})
 }
 
+func (h *UserHandler) RefreshToken(c *gin.Context) {
+
+	var req UserRefreshRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, tokens, err := h.tokenService.Refresh(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    int64(tokens.ExpiresIn.Seconds()),
+	})
+}
+
+func (h *UserHandler) Logout(c *gin.Context) {
+
+	var req UserLogoutRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userClaims, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	claims, ok := userClaims.(*models.Claims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
+		return
+	}
+
+	var err error
+	if req.AllSessions {
+		err = h.tokenService.RevokeUser(claims.UserID)
+	} else {
+		err = h.tokenService.Logout(claims)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditLogout)
+	event.SetTarget(models.AuditTargetUser, claims.UserID, claims.Username)
+	if req.AllSessions {
+		event.SetDetail("all_sessions", "true")
+	}
+	h.auditService.Record(event)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logout successful"})
+}
+
 func (h *UserHandler) CheckRoles(c *gin.Context) {
 
 	userClaims, exists := c.Get("user")
@@ -78,7 +269,12 @@ func (h *UserHandler) CheckRoles(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"role": claims.Role})
+	response := gin.H{"role": claims.Role}
+	if claims.Impersonator != nil {
+		response["username"] = claims.Username
+		response["impersonated_by"] = claims.Impersonator.Username
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *UserHandler) ChangeRole(c *gin.Context) {
@@ -102,17 +298,23 @@ func (h *UserHandler) ChangeRole(c *gin.Context) {
 		return
 	}
 
-	if claims.Role != models.RoleAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin rights required to change roles"})
-		return
-	}
-
 	if claims.UserID == req.UserID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot change your own role"})
 		return
 	}
 
 	newRole := models.Role(req.NewRole)
+	if !h.policyService.RoleExists(newRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+	if !h.policyService.CanGrantRole(claims.Role, newRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": errRoleNotGrantable.Error()})
+		return
+	}
+	if !h.canManage(c, claims, req.UserID) {
+		return
+	}
 
 	err := h.userService.ChangeRole(req.UserID, newRole)
 	if err != nil {
@@ -120,6 +322,11 @@ func (h *UserHandler) ChangeRole(c *gin.Context) {
 		return
 	}
 
+	event := newAuditEvent(c, models.AuditUserRoleChanged)
+	event.SetTarget(models.AuditTargetUser, req.UserID, "")
+	event.SetDetail("role", string(newRole))
+	h.auditService.Record(event)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Role changed successfully"})
 }
 
@@ -155,18 +362,9 @@ func (h *UserHandler) GetAllUsers(c *gin.Context) {
 		return
 	}
 
-	var userResponses []UserResponse
-
-	for _, user := range users {
-		userResponses = append(userResponses, UserResponse{
-			ID:       uint(user.ID),
-			Username: user.Username,
-			Email:    user.Email,
-			Role:     string(user.Role),
-		})
-	}
-
-	c.JSON(http.StatusOK, gin.H{"users": userResponses})
+	// Deactivated users are listed too, so old todos can still show them;
+	// clients leave them out when picking assignees.
+	c.JSON(http.StatusOK, gin.H{"users": NewUsersResponse(users)})
 }
 
 func (h *UserHandler) UpdateUser(c *gin.Context) {
@@ -192,15 +390,274 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	if req.Role != "" && !h.policyService.RoleExists(models.Role(req.Role)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+	claims := c.MustGet("user").(*models.Claims)
+	if req.Role != "" && !h.policyService.CanGrantRole(claims.Role, models.Role(req.Role)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": errRoleNotGrantable.Error()})
+		return
+	}
+	if !h.canManage(c, claims, userID) {
+		return
+	}
+
 	err = h.userService.UpdateUser(userID, req.Username, req.Email, req.Password, req.Role)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	event := newAuditEvent(c, models.AuditUserUpdated)
+	event.SetTarget(models.AuditTargetUser, userID, req.Username)
+	event.SetDetail("fields", strings.Join(changedUserFields(req), ","))
+	if req.Role != "" {
+		event.SetDetail("role", req.Role)
+	}
+	h.auditService.Record(event)
+
 	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
 }
 
+// canManage checks that the acting user's role covers the target user's,
+// so that nobody can take over an account with more permissions than their
+// own, for example by changing its password. When it does not, it has
+// already answered the request.
+func (h *UserHandler) canManage(c *gin.Context, claims *models.Claims, userID uint) bool {
+	user, err := h.userService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return false
+	}
+	if !h.policyService.CanGrantRole(claims.Role, user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot manage a user with permissions you do not have"})
+		return false
+	}
+	return true
+}
+
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+
+	userID, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	claims, ok := c.MustGet("user").(*models.Claims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
+		return
+	}
+	if !h.canManage(c, claims, userID) {
+		return
+	}
+
+	if err := h.userService.UnlockUser(userID); err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditUserUnlocked)
+	event.SetTarget(models.AuditTargetUser, userID, "")
+	h.auditService.Record(event)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
+}
+
+func (h *UserHandler) DeactivateUser(c *gin.Context) {
+
+	userID, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	claims, ok := c.MustGet("user").(*models.Claims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
+		return
+	}
+
+	if claims.UserID == userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot deactivate your own account"})
+		return
+	}
+	if !h.canManage(c, claims, userID) {
+		return
+	}
+
+	// The body is optional; an empty request deactivates without a transfer.
+	var req UserDeactivateRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	transfer, err := h.userService.DeactivateUser(userID, req.TransferTo)
+	if err != nil {
+		respondDeactivationError(c, err)
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditUserDeactivated)
+	event.SetTarget(models.AuditTargetUser, userID, "")
+	if req.TransferTo != nil {
+		event.SetDetail("transfer_to", strconv.FormatUint(uint64(*req.TransferTo), 10))
+		event.SetDetail("todos", strconv.FormatInt(transfer.Todos, 10))
+		event.SetDetail("templates", strconv.FormatInt(transfer.Templates, 10))
+	}
+	h.auditService.Record(event)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deactivated successfully", "transferred": transfer})
+}
+
+func (h *UserHandler) ReactivateUser(c *gin.Context) {
+
+	userID, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	claims, ok := c.MustGet("user").(*models.Claims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
+		return
+	}
+	if !h.canManage(c, claims, userID) {
+		return
+	}
+
+	if err := h.userService.ReactivateUser(userID); err != nil {
+		respondDeactivationError(c, err)
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditUserReactivated)
+	event.SetTarget(models.AuditTargetUser, userID, "")
+	h.auditService.Record(event)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User reactivated successfully"})
+}
+
+func (h *UserHandler) TransferOwnership(c *gin.Context) {
+
+	userID, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req UserTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, ok := c.MustGet("user").(*models.Claims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
+		return
+	}
+	if !h.canManage(c, claims, userID) {
+		return
+	}
+
+	transfer, err := h.userService.TransferOwnership(userID, req.ToUserID)
+	if err != nil {
+		respondDeactivationError(c, err)
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditUserOwnershipTransfers)
+	event.SetTarget(models.AuditTargetUser, userID, "")
+	event.SetDetail("transfer_to", strconv.FormatUint(uint64(req.ToUserID), 10))
+	event.SetDetail("todos", strconv.FormatInt(transfer.Todos, 10))
+	event.SetDetail("templates", strconv.FormatInt(transfer.Templates, 10))
+	h.auditService.Record(event)
+
+	c.JSON(http.StatusOK, transfer)
+}
+
+// Impersonate issues a short-lived token that acts as another user, so an
+// admin can see the app the way that user does. Admins cannot be
+// impersonated, and changes made with the token are audited.
+func (h *UserHandler) Impersonate(c *gin.Context) {
+
+	userID, err := utils.StringToUint(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	claims, ok := c.MustGet("user").(*models.Claims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
+		return
+	}
+
+	if claims.UserID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot impersonate yourself"})
+		return
+	}
+
+	target, err := h.userService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": service.ErrUserNotFound.Error()})
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditImpersonationStarted)
+	event.SetTarget(models.AuditTargetUser, target.ID, target.Username)
+
+	if h.policyService.IsAdministrative(target.Role) {
+		event.Fail("target_is_admin")
+		h.auditService.Record(event)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admins cannot be impersonated"})
+		return
+	}
+	if target.IsDeactivated() {
+		c.JSON(http.StatusConflict, gin.H{"error": service.ErrUserDeactivated.Error()})
+		return
+	}
+
+	tokens, err := h.tokenService.Impersonate(claims, target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.auditService.Record(event)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Impersonating " + target.Username,
+		"token":      tokens.AccessToken,
+		"expires_in": int64(tokens.ExpiresIn.Seconds()),
+		"user":       NewUserResponse(*target),
+	})
+}
+
+func respondDeactivationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrUserDeactivated), errors.Is(err, service.ErrUserNotDeactivated):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTransferToSelf), errors.Is(err, service.ErrTransferTarget):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 
 	id := c.Param("id")
@@ -226,13 +683,24 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot delete your own account"})
 		return
 	}
+	if !h.canManage(c, claims, userID) {
+		return
+	}
 
 	err = h.userService.DeleteUser(userID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if errors.Is(err, service.ErrUserOwnsResources) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
+	event := newAuditEvent(c, models.AuditUserDeleted)
+	event.SetTarget(models.AuditTargetUser, userID, "")
+	h.auditService.Record(event)
+
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
 
@@ -245,13 +713,51 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
+	claims, ok := c.MustGet("user").(*models.Claims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
+		return
+	}
+
 	newRole := models.Role(req.Role)
+	if !h.policyService.RoleExists(newRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+	if !h.policyService.CanGrantRole(claims.Role, newRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": errRoleNotGrantable.Error()})
+		return
+	}
 
-	err := h.userService.CreateUser(req.Username, req.Email, req.Password, newRole)
+	user, err := h.userService.CreateUser(req.Username, req.Email, req.Password, newRole)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	event := newAuditEvent(c, models.AuditUserCreated)
+	event.SetTarget(models.AuditTargetUser, user.ID, user.Username)
+	event.SetDetail("role", req.Role)
+	h.auditService.Record(event)
+
 	c.JSON(http.StatusCreated, gin.H{"message": "User created successfully"})
 }
+
+// changedUserFields names the fields an admin update touches, without their
+// values, so passwords never end up in the audit log.
+func changedUserFields(req UserUpdateRequest) []string {
+	fields := []string{}
+	if req.Username != "" {
+		fields = append(fields, "username")
+	}
+	if req.Email != "" {
+		fields = append(fields, "email")
+	}
+	if req.Password != "" {
+		fields = append(fields, "password")
+	}
+	if req.Role != "" {
+		fields = append(fields, "role")
+	}
+	return fields
+}
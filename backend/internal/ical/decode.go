@@ -0,0 +1,173 @@
+package ical
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCalendar = errors.New("invalid iCalendar data")
+
+// Decode reads one top-level component, normally a VCALENDAR, unfolding
+// long lines on the way.
+func Decode(r io.Reader) (*Component, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		root  *Component
+		stack []*Component
+	)
+	for _, line := range unfold(string(data)) {
+		if line == "" {
+			continue
+		}
+		property, ok := parseLine(line)
+		if !ok {
+			return nil, ErrInvalidCalendar
+		}
+
+		switch strings.ToUpper(property.Name) {
+		case "BEGIN":
+			if root != nil && len(stack) == 0 {
+				return nil, ErrInvalidCalendar
+			}
+			component := NewComponent(strings.ToUpper(property.Value))
+			if len(stack) > 0 {
+				stack[len(stack)-1].Append(component)
+			} else {
+				root = component
+			}
+			stack = append(stack, component)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(property.Value) {
+				return nil, ErrInvalidCalendar
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, ErrInvalidCalendar
+			}
+			current := stack[len(stack)-1]
+			current.Properties = append(current.Properties, property)
+		}
+	}
+
+	if root == nil || len(stack) > 0 {
+		return nil, ErrInvalidCalendar
+	}
+	return root, nil
+}
+
+// Child returns the first nested component called name.
+func (c *Component) Child(name string) *Component {
+	for _, child := range c.Components {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// Param returns the value of a parameter, without quotes, or "".
+func (p Property) Param(name string) string {
+	for _, param := range p.Params {
+		key, value, _ := strings.Cut(param, "=")
+		if strings.EqualFold(key, name) {
+			return strings.Trim(value, `"`)
+		}
+	}
+	return ""
+}
+
+// Text returns the value of a TEXT property with escapes removed.
+func (p Property) Text() string {
+	return UnescapeText(p.Value)
+}
+
+// Time reads a DATE or DATE-TIME value. UTC values end in Z, TZID names
+// their zone, and floating times and dates are read in loc. dateOnly
+// reports a DATE value, which comes back as midnight in loc.
+func (p Property) Time(loc *time.Location) (t time.Time, dateOnly bool, err error) {
+	value := strings.TrimSpace(p.Value)
+
+	if strings.EqualFold(p.Param("VALUE"), "DATE") || len(value) == len(dateLayout) {
+		t, err = time.ParseInLocation(dateLayout, value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse(dateTimeLayout, value)
+		return t, false, err
+	}
+	if tzid := p.Param("TZID"); tzid != "" {
+		if zone, err := time.LoadLocation(tzid); err == nil {
+			loc = zone
+		}
+	}
+	t, err = time.ParseInLocation(strings.TrimSuffix(dateTimeLayout, "Z"), value, loc)
+	return t, false, err
+}
+
+var textUnescaper = strings.NewReplacer(
+	`\\`, `\`,
+	`\;`, ";",
+	`\,`, ",",
+	`\n`, "\n",
+	`\N`, "\n",
+)
+
+// UnescapeText reverses EscapeText.
+func UnescapeText(text string) string {
+	return textUnescaper.Replace(text)
+}
+
+// unfold splits data into content lines, joining folded continuations.
+func unfold(data string) []string {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	lines := []string{}
+	for _, line := range strings.Split(data, "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\r"))
+	}
+	return lines
+}
+
+// parseLine splits "NAME;PARAM=a;PARAM="b:c":value" into a property,
+// ignoring separators inside quoted parameter values.
+func parseLine(line string) (Property, bool) {
+	var (
+		property Property
+		quoted   bool
+		start    int
+		nameDone bool
+	)
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case ';', ':':
+			if quoted {
+				continue
+			}
+			part := line[start:i]
+			if !nameDone {
+				property.Name = part
+				nameDone = true
+			} else {
+				property.Params = append(property.Params, part)
+			}
+			start = i + 1
+			if line[i] == ':' {
+				property.Value = line[i+1:]
+				return property, property.Name != ""
+			}
+		}
+	}
+	return Property{}, false
+}
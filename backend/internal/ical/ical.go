@@ -0,0 +1,152 @@
+// Package ical writes iCalendar (RFC 5545) data: components made of
+// properties, with text escaped and long lines folded as the format requires.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	ContentType = "text/calendar; charset=utf-8"
+
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405Z"
+
+	// maxLineOctets is the longest content line before it must be folded.
+	maxLineOctets = 75
+)
+
+// Property is one content line. Params are already formatted as
+// "NAME=value" and Value is written as given.
+type Property struct {
+	Name   string
+	Params []string
+	Value  string
+}
+
+// Component is a BEGIN/END block such as VCALENDAR, VTODO or VEVENT.
+type Component struct {
+	Name       string
+	Properties []Property
+	Components []*Component
+}
+
+func NewComponent(name string) *Component {
+	return &Component{Name: name}
+}
+
+// NewCalendar returns a VCALENDAR with the properties every calendar needs.
+func NewCalendar(productID, name string) *Component {
+	calendar := NewComponent("VCALENDAR")
+	calendar.Add("VERSION", "2.0")
+	calendar.Add("PRODID", productID)
+	calendar.Add("CALSCALE", "GREGORIAN")
+	if name != "" {
+		calendar.AddText("X-WR-CALNAME", name)
+	}
+	return calendar
+}
+
+// Add appends a property whose value needs no escaping.
+func (c *Component) Add(name, value string, params ...string) {
+	c.Properties = append(c.Properties, Property{Name: name, Params: params, Value: value})
+}
+
+// AddText appends a TEXT property, escaping it as RFC 5545 section 3.3.11
+// requires.
+func (c *Component) AddText(name, text string, params ...string) {
+	c.Add(name, EscapeText(text), params...)
+}
+
+// AddDateTime appends a DATE-TIME property in UTC.
+func (c *Component) AddDateTime(name string, t time.Time) {
+	c.Add(name, t.UTC().Format(dateTimeLayout))
+}
+
+// AddDate appends a DATE property for the calendar day of t in its own
+// location.
+func (c *Component) AddDate(name string, t time.Time) {
+	c.Add(name, t.Format(dateLayout), "VALUE=DATE")
+}
+
+// Append adds a nested component.
+func (c *Component) Append(child *Component) {
+	c.Components = append(c.Components, child)
+}
+
+// Get returns the value of the first property called name.
+func (c *Component) Get(name string) (Property, bool) {
+	for _, property := range c.Properties {
+		if strings.EqualFold(property.Name, name) {
+			return property, true
+		}
+	}
+	return Property{}, false
+}
+
+// Encode writes the component with CRLF line endings and folded lines.
+func (c *Component) Encode(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	c.encode(buf)
+	return buf.Flush()
+}
+
+func (c *Component) String() string {
+	var b strings.Builder
+	c.Encode(&b)
+	return b.String()
+}
+
+func (c *Component) encode(w *bufio.Writer) {
+	writeLine(w, "BEGIN:"+c.Name)
+	for _, property := range c.Properties {
+		line := property.Name
+		for _, param := range property.Params {
+			line += ";" + param
+		}
+		writeLine(w, line+":"+property.Value)
+	}
+	for _, child := range c.Components {
+		child.encode(w)
+	}
+	writeLine(w, "END:"+c.Name)
+}
+
+// writeLine folds line into chunks of at most maxLineOctets, never splitting
+// a UTF-8 sequence, with each continuation starting with a space.
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !startsRune(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// The leading space counts towards the next line's length.
+		limit = maxLineOctets - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+func startsRune(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+var textEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+// EscapeText escapes a TEXT value.
+func EscapeText(text string) string {
+	return textEscaper.Replace(text)
+}
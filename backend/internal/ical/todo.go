@@ -0,0 +1,222 @@
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+var ErrMissingSummary = errors.New("VTODO needs a SUMMARY")
+
+var (
+	todoStatuses = map[string]string{
+		"pending":     "NEEDS-ACTION",
+		"in_progress": "IN-PROCESS",
+		"completed":   "COMPLETED",
+	}
+
+	// Priorities run from 1 (highest) to 9 (lowest); 0 means undefined.
+	todoPriorities = map[string]string{
+		"high":   "1",
+		"medium": "5",
+		"low":    "9",
+	}
+)
+
+// TodoUID identifies a todo's VTODO across feeds and syncs. Todos created
+// over CalDAV keep the UID their client gave them.
+func TodoUID(todo models.Todo, domain string) string {
+	if todo.ICalUID != "" {
+		return todo.ICalUID
+	}
+	return fmt.Sprintf("todo-%d@%s", todo.ID, domain)
+}
+
+// EventUID identifies a todo's VEVENT. It differs from the VTODO's so that
+// clients showing both do not merge them.
+func EventUID(id uint, domain string) string {
+	return fmt.Sprintf("todo-%d-event@%s", id, domain)
+}
+
+// NewTodo describes a todo as a VTODO.
+func NewTodo(todo models.Todo, domain string) *Component {
+	component := NewComponent("VTODO")
+	component.Add("UID", TodoUID(todo, domain))
+	addCommon(component, todo)
+
+	if todo.StartAt != nil {
+		component.AddDateTime("DTSTART", *todo.StartAt)
+	}
+	if todo.DueDate != nil {
+		if todo.AllDay {
+			component.AddDate("DUE", todo.DueDate.In(todo.DueLocation()))
+		} else {
+			component.AddDateTime("DUE", *todo.DueDate)
+		}
+	}
+	if status, ok := todoStatuses[todo.Status]; ok {
+		component.Add("STATUS", status)
+	}
+	if todo.Status == "completed" {
+		component.Add("PERCENT-COMPLETE", "100")
+	}
+	return component
+}
+
+// NewEvent describes the time a todo covers as a VEVENT, for calendars that
+// do not show tasks. ok is false for todos without dates.
+func NewEvent(todo models.Todo, domain string) (*Component, bool) {
+	start, end, ok := todo.Span()
+	if !ok {
+		return nil, false
+	}
+
+	component := NewComponent("VEVENT")
+	component.Add("UID", EventUID(todo.ID, domain))
+	addCommon(component, todo)
+
+	if todo.AllDay && todo.StartAt == nil && todo.ScheduledAt == nil {
+		loc := todo.DueLocation()
+		component.AddDate("DTSTART", start.In(loc))
+		component.AddDate("DTEND", end.In(loc))
+	} else {
+		component.AddDateTime("DTSTART", start)
+		if end.After(start) {
+			component.AddDateTime("DTEND", end)
+		}
+	}
+	// Only planned work blocks out time.
+	if todo.ScheduledAt == nil {
+		component.Add("TRANSP", "TRANSPARENT")
+	}
+	return component, true
+}
+
+// addCommon adds the properties VTODO and VEVENT share.
+func addCommon(component *Component, todo models.Todo) {
+	component.AddDateTime("DTSTAMP", todo.UpdatedAt)
+	component.AddDateTime("CREATED", todo.CreatedAt)
+	component.AddDateTime("LAST-MODIFIED", todo.UpdatedAt)
+	component.Add("SEQUENCE", fmt.Sprint(todo.Version-1))
+	component.AddText("SUMMARY", todo.Name)
+	if todo.Description != "" {
+		component.AddText("DESCRIPTION", todo.Description)
+	}
+	if priority, ok := todoPriorities[todo.Priority]; ok {
+		component.Add("PRIORITY", priority)
+	}
+	if tags := todo.TagList(); len(tags) > 0 {
+		for i, tag := range tags {
+			tags[i] = EscapeText(tag)
+		}
+		component.Add("CATEGORIES", strings.Join(tags, ","))
+	}
+}
+
+// ApplyTodo copies a client's VTODO onto todo, reading floating times in
+// loc. A PUT replaces the whole resource, so properties the VTODO leaves out
+// are cleared; fields iCalendar cannot carry, such as assignees, are kept.
+func ApplyTodo(component *Component, todo *models.Todo, loc *time.Location) error {
+	summary, ok := component.Get("SUMMARY")
+	if !ok || strings.TrimSpace(summary.Text()) == "" {
+		return ErrMissingSummary
+	}
+	todo.Name = summary.Text()
+
+	todo.Description = ""
+	if description, ok := component.Get("DESCRIPTION"); ok {
+		todo.Description = description.Text()
+	}
+
+	todo.Status = "pending"
+	if status, ok := component.Get("STATUS"); ok {
+		for name, value := range todoStatuses {
+			if strings.EqualFold(status.Value, value) {
+				todo.Status = name
+			}
+		}
+		if strings.EqualFold(status.Value, "CANCELLED") {
+			todo.Status = "completed"
+		}
+	}
+	if percent, ok := component.Get("PERCENT-COMPLETE"); ok && percent.Value == "100" {
+		todo.Status = "completed"
+	}
+	if _, ok := component.Get("COMPLETED"); ok {
+		todo.Status = "completed"
+	}
+
+	todo.Priority = ""
+	if priority, ok := component.Get("PRIORITY"); ok {
+		switch level, _ := strconv.Atoi(priority.Value); {
+		case level >= 1 && level <= 4:
+			todo.Priority = "high"
+		case level == 5:
+			todo.Priority = "medium"
+		case level >= 6 && level <= 9:
+			todo.Priority = "low"
+		}
+	}
+
+	tags := []string{}
+	for _, property := range component.Properties {
+		if strings.EqualFold(property.Name, "CATEGORIES") {
+			tags = append(tags, splitText(property.Value)...)
+		}
+	}
+	todo.SetTagList(tags)
+
+	todo.ClearDueDate()
+	if due, ok := component.Get("DUE"); ok {
+		at, dateOnly, err := due.Time(loc)
+		if err != nil {
+			return ErrInvalidCalendar
+		}
+		zone := loc
+		if due.Param("TZID") != "" {
+			zone = at.Location()
+		}
+		todo.SetDueDate(at, dateOnly, zone)
+	}
+
+	todo.StartAt = nil
+	if start, ok := component.Get("DTSTART"); ok {
+		at, _, err := start.Time(loc)
+		if err != nil {
+			return ErrInvalidCalendar
+		}
+		// Some clients repeat the due date as the start; that says nothing.
+		if todo.DueDate == nil || !at.Equal(*todo.DueDate) {
+			at = at.UTC()
+			todo.StartAt = &at
+		}
+	}
+
+	return todo.ValidateSchedule()
+}
+
+// splitText splits a comma separated TEXT list, keeping escaped commas.
+func splitText(value string) []string {
+	var (
+		parts   []string
+		current strings.Builder
+	)
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value):
+			current.WriteByte(value[i])
+			current.WriteByte(value[i+1])
+			i++
+		case value[i] == ',':
+			parts = append(parts, UnescapeText(current.String()))
+			current.Reset()
+		default:
+			current.WriteByte(value[i])
+		}
+	}
+	return append(parts, UnescapeText(current.String()))
+}
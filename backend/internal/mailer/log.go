@@ -0,0 +1,25 @@
+package mailer
+
+import (
+	"log"
+	"strings"
+)
+
+// LogMailer writes messages to a logger instead of delivering them.
+type LogMailer struct {
+	from   string
+	logger *log.Logger
+}
+
+// NewLogMailer logs to logger, or to the standard logger when it is nil.
+func NewLogMailer(from string, logger *log.Logger) *LogMailer {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &LogMailer{from: from, logger: logger}
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	m.logger.Printf("Mail from %s to %s: %s\n%s", m.from, strings.Join(msg.To, ", "), msg.Subject, msg.Text)
+	return nil
+}
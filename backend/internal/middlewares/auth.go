@@ -7,9 +7,13 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/policy"
+	"github.com/harrisin2037/todoapp/internal/service"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware accepts bearer access tokens that are still valid and whose
+// user and session have not been revoked, as well as personal access tokens.
+func AuthMiddleware(tokenService *service.TokenService, patService *service.PersonalAccessTokenService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -25,7 +29,15 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		claims, err := models.ValidateToken(bearerToken[1])
+		var (
+			claims *models.Claims
+			err    error
+		)
+		if strings.HasPrefix(bearerToken[1], models.PersonalAccessTokenPrefix) {
+			claims, err = patService.Authenticate(bearerToken[1])
+		} else {
+			claims, err = tokenService.Authenticate(bearerToken[1])
+		}
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
@@ -37,6 +49,35 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// BasicAuthMiddleware accepts HTTP Basic credentials made of a username and
+// one of that user's personal access tokens, for clients such as CalDAV apps
+// that cannot send bearer tokens. Failures carry a challenge so that the
+// client asks for credentials.
+func BasicAuthMiddleware(patService *service.PersonalAccessTokenService, realm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, secret, ok := c.Request.BasicAuth()
+		if !ok || !strings.HasPrefix(secret, models.PersonalAccessTokenPrefix) {
+			basicChallenge(c, realm, "Sign in with your username and a personal access token")
+			return
+		}
+
+		claims, err := patService.Authenticate(secret)
+		if err != nil || !strings.EqualFold(claims.Username, username) {
+			basicChallenge(c, realm, "Invalid credentials")
+			return
+		}
+
+		c.Set("user", claims)
+		c.Next()
+	}
+}
+
+func basicChallenge(c *gin.Context, realm, message string) {
+	c.Header("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+	c.Abort()
+}
+
 func AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, exists := c.Get("user")
@@ -62,3 +103,116 @@ func AdminMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RequirePermission rejects users whose role does not grant permission on
+// every resource. Checks against a single todo or template happen in the
+// handlers, which know the resource.
+func RequirePermission(policyService *service.PolicyService, permission policy.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := userClaims(c)
+		if !ok {
+			return
+		}
+
+		if !policyService.Can(policy.Subject{UserID: claims.UserID, Role: claims.Role}, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Permission " + string(permission) + " required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireTwoFactor enforces the two-factor policy: login sessions of roles
+// it applies to must have been started with a second factor. Personal
+// access tokens are checked when they are created instead.
+func RequireTwoFactor(twoFactorService *service.TwoFactorService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := userClaims(c)
+		if !ok {
+			return
+		}
+
+		if claims.Scopes == nil && !claims.TwoFactor && twoFactorService.RequiredFor(claims.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required; enable it and log in again"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireScope rejects personal access tokens that lack one of the scopes.
+// Requests authenticated with a login session always pass.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := userClaims(c)
+		if !ok {
+			return
+		}
+
+		for _, scope := range scopes {
+			if !claims.HasScope(scope) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Token is missing scope " + scope})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// MethodScope requires readScope for safe methods, including the WebDAV
+// queries PROPFIND and REPORT, and writeScope for everything else.
+func MethodScope(readScope, writeScope string) gin.HandlerFunc {
+	read, write := RequireScope(readScope), RequireScope(writeScope)
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND", "REPORT":
+			read(c)
+		default:
+			write(c)
+		}
+	}
+}
+
+// RequireSession rejects personal access tokens and impersonation tokens,
+// for routes such as token management that must only be reachable after the
+// user's own interactive login.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := userClaims(c)
+		if !ok {
+			return
+		}
+
+		if claims.Scopes != nil || claims.Impersonator != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint requires an interactive login"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func userClaims(c *gin.Context) (*models.Claims, bool) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		c.Abort()
+		return nil, false
+	}
+
+	claims, ok := user.(*models.Claims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
+		c.Abort()
+		return nil, false
+	}
+
+	return claims, true
+}
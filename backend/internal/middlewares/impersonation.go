@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+// AuditImpersonation records every change made with an impersonation token,
+// so the audit log shows what an admin did while acting as someone else.
+// Reads are not recorded.
+func AuditImpersonation(auditService *service.AuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return
+		}
+
+		user, exists := c.Get("user")
+		if !exists {
+			return
+		}
+		claims, ok := user.(*models.Claims)
+		if !ok || claims.Impersonator == nil {
+			return
+		}
+
+		event := &models.AuditEvent{
+			Action:    models.AuditImpersonatedRequest,
+			Outcome:   models.AuditSuccess,
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		}
+		event.SetImpersonation(claims)
+		event.SetTarget(models.AuditTargetUser, claims.UserID, claims.Username)
+		event.SetDetail("method", c.Request.Method)
+		event.SetDetail("path", c.Request.URL.Path)
+		event.SetDetail("status", strconv.Itoa(c.Writer.Status()))
+		if c.Writer.Status() >= http.StatusBadRequest {
+			event.Outcome = models.AuditFailure
+		}
+		auditService.Record(event)
+	}
+}
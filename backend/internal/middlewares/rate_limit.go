@@ -0,0 +1,83 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/ratelimit"
+)
+
+// RateLimitKey picks the bucket a request counts against. Requests for which
+// it returns "" are not limited.
+type RateLimitKey func(c *gin.Context) string
+
+// RateLimit allows limit requests per key and answers 429 with Retry-After
+// once the bucket is empty. name separates the buckets of different limits
+// sharing a store. If the store fails, or the bucket is too contended to
+// update, the request is refused as well: letting it through would let a
+// burst of parallel requests skip the limit.
+func RateLimit(store ratelimit.Store, name string, limit ratelimit.Limit, key RateLimitKey) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k := key(c)
+		if k == "" {
+			c.Next()
+			return
+		}
+
+		allowed, retryAfter, err := store.Take(name+":"+k, limit, time.Now())
+		if err != nil {
+			log.Printf("Rate limit store failed: %v", err)
+			allowed, retryAfter = false, time.Second
+		}
+
+		if !allowed {
+			SetRetryAfter(c, retryAfter)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// SetRetryAfter sets the Retry-After header in whole seconds, rounded up.
+func SetRetryAfter(c *gin.Context, wait time.Duration) {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+}
+
+func ClientIPKey(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// JSONFieldKey keys requests by a string field of their JSON body, such as
+// the username of a login attempt. The body stays readable for the handler.
+func JSONFieldKey(field string) RateLimitKey {
+	return func(c *gin.Context) string {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return ""
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var fields map[string]interface{}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return ""
+		}
+		value, _ := fields[field].(string)
+		return strings.ToLower(strings.TrimSpace(value))
+	}
+}
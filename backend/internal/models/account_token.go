@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	AccountTokenPasswordReset     = "password_reset"
+	AccountTokenEmailVerification = "email_verification"
+	AccountTokenDigestUnsubscribe = "digest_unsubscribe"
+)
+
+// AccountToken is a single-use, expiring secret mailed to a user, e.g. to
+// reset a password. Only a SHA-256 hash of the secret is stored.
+type AccountToken struct {
+	ID        uint       `gorm:"primarykey"`
+	UserID    uint       `gorm:"not null;index"`
+	Purpose   string     `gorm:"type:varchar(30);not null"`
+	Email     string     `gorm:"type:varchar(100);not null"`
+	TokenHash string     `gorm:"type:char(64);not null;uniqueIndex"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time `gorm:"default:null"`
+	CreatedAt time.Time
+}
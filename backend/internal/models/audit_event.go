@@ -0,0 +1,131 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AuditLogin                = "auth.login"
+	AuditLogout               = "auth.logout"
+	AuditPasswordResetRequest = "auth.password_reset_requested"
+	AuditPasswordReset        = "auth.password_reset"
+	AuditEmailVerified        = "auth.email_verified"
+	AuditTwoFactorEnabled     = "auth.2fa_enabled"
+	AuditTwoFactorDisabled    = "auth.2fa_disabled"
+	AuditRecoveryCodesReset   = "auth.recovery_codes_regenerated"
+	AuditTokenCreated         = "auth.token_created"
+	AuditTokenRevoked         = "auth.token_revoked"
+	AuditImpersonationStarted = "auth.impersonation_started"
+	AuditImpersonatedRequest  = "auth.impersonated_request"
+	AuditCalendarFeedRotated  = "auth.calendar_feed_rotated"
+	AuditCalendarFeedDisabled = "auth.calendar_feed_disabled"
+
+	AuditUserRegistered         = "user.registered"
+	AuditUserCreated            = "user.created"
+	AuditUserUpdated            = "user.updated"
+	AuditUserDeleted            = "user.deleted"
+	AuditUserRoleChanged        = "user.role_changed"
+	AuditUserUnlocked           = "user.unlocked"
+	AuditUserDeactivated        = "user.deactivated"
+	AuditUserReactivated        = "user.reactivated"
+	AuditUserOwnershipTransfers = "user.ownership_transferred"
+
+	AuditInvitationCreated  = "invitation.created"
+	AuditInvitationResent   = "invitation.resent"
+	AuditInvitationRevoked  = "invitation.revoked"
+	AuditInvitationAccepted = "invitation.accepted"
+
+	AuditSettingsUpdated = "settings.updated"
+
+	AuditRoleCreated = "role.created"
+	AuditRoleUpdated = "role.updated"
+	AuditRoleDeleted = "role.deleted"
+
+	AuditEscalationRuleCreated = "escalation_rule.created"
+	AuditEscalationRuleUpdated = "escalation_rule.updated"
+	AuditEscalationRuleDeleted = "escalation_rule.deleted"
+)
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+const (
+	AuditTargetUser       = "user"
+	AuditTargetRole       = "role"
+	AuditTargetToken      = "token"
+	AuditTargetInvitation = "invitation"
+	AuditTargetEscalation = "escalation_rule"
+)
+
+var ErrAuditEventImmutable = errors.New("audit events cannot be changed or deleted")
+
+// AuditEvent is one entry of the security audit log: who (actor) did what
+// (action) to whom (target), from where and with which outcome. Events are
+// append-only; the hooks refuse updates and deletes.
+type AuditEvent struct {
+	ID         uint              `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time         `json:"created_at" gorm:"not null;index"`
+	Action     string            `json:"action" gorm:"type:varchar(50);not null;index"`
+	Outcome    string            `json:"outcome" gorm:"type:varchar(20);not null"`
+	ActorID    *uint             `json:"actor_id" gorm:"index"`
+	ActorName  string            `json:"actor_name" gorm:"type:varchar(255)"`
+	TargetType string            `json:"target_type,omitempty" gorm:"type:varchar(50)"`
+	TargetID   *uint             `json:"target_id,omitempty" gorm:"index"`
+	TargetName string            `json:"target_name,omitempty" gorm:"type:varchar(255)"`
+	IP         string            `json:"ip" gorm:"type:varchar(64)"`
+	UserAgent  string            `json:"user_agent" gorm:"type:varchar(512)"`
+	Details    map[string]string `json:"details,omitempty" gorm:"type:text;serializer:json"`
+}
+
+func (e *AuditEvent) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+func (e *AuditEvent) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+// SetActor records user as the one who acted, for requests made before the
+// user is authenticated, such as logins.
+func (e *AuditEvent) SetActor(user *User) {
+	id := user.ID
+	e.ActorID = &id
+	e.ActorName = user.Username
+}
+
+// SetImpersonation credits an action taken with an impersonation token to
+// the admin behind it and records whom they were acting as.
+func (e *AuditEvent) SetImpersonation(claims *Claims) {
+	id := claims.Impersonator.UserID
+	e.ActorID = &id
+	e.ActorName = claims.Impersonator.Username
+	e.SetDetail("impersonated_user_id", strconv.FormatUint(uint64(claims.UserID), 10))
+	e.SetDetail("impersonated_user", claims.Username)
+}
+
+func (e *AuditEvent) SetTarget(targetType string, id uint, name string) {
+	e.TargetType = targetType
+	if id != 0 {
+		e.TargetID = &id
+	}
+	e.TargetName = name
+}
+
+func (e *AuditEvent) SetDetail(key, value string) {
+	if e.Details == nil {
+		e.Details = map[string]string{}
+	}
+	e.Details[key] = value
+}
+
+// Fail marks the event as a failed attempt and records why.
+func (e *AuditEvent) Fail(reason string) {
+	e.Outcome = AuditFailure
+	e.SetDetail("reason", reason)
+}
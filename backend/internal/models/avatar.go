@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// Avatar is a user's processed profile picture. It lives apart from User so
+// loading users does not load images.
+type Avatar struct {
+	UserID      uint   `gorm:"primarykey;autoIncrement:false"`
+	ContentType string `gorm:"type:varchar(50);not null"`
+	Data        []byte `gorm:"not null"`
+	UpdatedAt   time.Time
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+const CalendarFeedTokenPrefix = "tdc_"
+
+// CalendarFeed is a user's secret iCalendar subscription link. Calendar apps
+// cannot send bearer tokens, so the secret is part of the URL; only its hash
+// is stored and rotating it replaces the row.
+type CalendarFeed struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	UserID     uint       `json:"user_id" gorm:"not null;uniqueIndex"`
+	TokenHash  string     `json:"-" gorm:"type:char(64);not null;uniqueIndex"`
+	Hint       string     `json:"hint" gorm:"type:varchar(20)"`
+	LastUsedAt *time.Time `json:"last_used_at" gorm:"default:null"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// CustomRole is a role defined by an admin at runtime, next to the built-in
+// user and admin roles. Grants holds the JSON encoded permission grants.
+type CustomRole struct {
+	ID          uint   `gorm:"primarykey"`
+	Name        string `gorm:"type:varchar(30);not null;uniqueIndex"`
+	Description string `gorm:"type:varchar(255)"`
+	Grants      string `gorm:"type:text;not null"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
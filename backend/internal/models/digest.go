@@ -0,0 +1,18 @@
+package models
+
+import "errors"
+
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// DigestHour is the hour of the day, in the user's time zone, digests go
+// out at. Weekly digests go out on the first day of the user's week.
+const DigestHour = 7
+
+var ErrInvalidDigestFrequency = errors.New("frequency must be daily, weekly or off")
+
+func IsValidDigestFrequency(frequency string) bool {
+	return frequency == DigestDaily || frequency == DigestWeekly
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Who an escalation rule notifies.
+const (
+	EscalateOwner       = "owner"
+	EscalateAssignees   = "assignees"
+	EscalateProjectLead = "project_lead"
+)
+
+// MaxEscalationDelay bounds how long after a todo becomes overdue a rule can
+// wait.
+const MaxEscalationDelay = 365 * 24 * time.Hour
+
+var ErrInvalidEscalationRule = errors.New("after must be between 0 and 365 days and notify one of owner, assignees or project_lead")
+
+// EscalationRule notifies someone once a todo has been overdue for After
+// seconds, such as the owner after a day and the project lead after three.
+type EscalationRule struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	After     int       `json:"after" gorm:"column:after_seconds;not null"`
+	Notify    string    `json:"notify" gorm:"type:varchar(20);not null"`
+	Email     bool      `json:"email" gorm:"not null;default:false"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (r *EscalationRule) Validate() error {
+	if r.After < 0 || time.Duration(r.After)*time.Second > MaxEscalationDelay {
+		return ErrInvalidEscalationRule
+	}
+	switch r.Notify {
+	case EscalateOwner, EscalateAssignees, EscalateProjectLead:
+		return nil
+	}
+	return ErrInvalidEscalationRule
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// IdempotencyRecord remembers the response to a mutating request made with an
+// Idempotency-Key header, so a retry of the same request can be answered
+// without running it again. StatusCode stays zero while the first request is
+// still being processed.
+type IdempotencyRecord struct {
+	ID           uint   `gorm:"primarykey"`
+	UserID       uint   `gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	Key          string `gorm:"column:idempotency_key;type:varchar(255);not null;uniqueIndex:idx_idempotency_user_key"`
+	RequestHash  string `gorm:"type:char(64);not null"`
+	StatusCode   int    `gorm:"not null;default:0"`
+	ContentType  string `gorm:"type:varchar(255)"`
+	ETag         string `gorm:"type:varchar(255)"`
+	ResponseBody []byte `gorm:"type:mediumblob"`
+	CreatedAt    time.Time
+	ExpiresAt    time.Time `gorm:"index;not null"`
+}
+
+func (r *IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// Invitation lets someone create an account with a role an admin picked for
+// them. The link mailed to Email carries a secret of which only a SHA-256
+// hash is stored; resending replaces it.
+type Invitation struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	Email          string     `json:"email" gorm:"type:varchar(100);not null;index"`
+	Role           Role       `json:"role" gorm:"type:varchar(30);not null"`
+	TokenHash      string     `json:"-" gorm:"type:char(64);not null;uniqueIndex"`
+	InvitedByID    uint       `json:"invited_by_id" gorm:"not null"`
+	InvitedBy      User       `json:"-" gorm:"foreignKey:InvitedByID"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null"`
+	SentAt         time.Time  `json:"sent_at" gorm:"not null"`
+	AcceptedAt     *time.Time `json:"accepted_at" gorm:"default:null"`
+	AcceptedUserID *uint      `json:"accepted_user_id" gorm:"default:null"`
+	RevokedAt      *time.Time `json:"revoked_at" gorm:"default:null"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+func (i *Invitation) Status(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case !now.Before(i.ExpiresAt):
+		return InvitationExpired
+	default:
+		return InvitationPending
+	}
+}
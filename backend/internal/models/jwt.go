@@ -10,30 +10,139 @@ import (
 
 var jwtKey = []byte(os.Getenv("JWT_KEY"))
 
+const PurposeTwoFactorChallenge = "2fa"
+
 type Claims struct {
-	UserID   uint
-	Username string
-	Role     Role
+	UserID       uint
+	Username     string
+	Role         Role
+	TokenVersion uint
+	SessionID    string
+	// TwoFactor is set when the session was started with a second factor.
+	TwoFactor bool `json:",omitempty"`
+	// Purpose is only set for short-lived tokens that are not access tokens,
+	// such as the challenge handed out between the two login steps.
+	Purpose string `json:",omitempty"`
+	// Scopes is only set for personal access tokens; a nil slice means the
+	// request was made with a login session and is not restricted.
+	Scopes []string `json:",omitempty"`
+	// Impersonator is only set for tokens an admin was issued to act as the
+	// user; UserID, Username and Role then describe that user.
+	Impersonator *Impersonator `json:",omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(user *User) (string, error) {
-	expirationTime := time.Now().Add(72 * time.Hour)
+// Impersonator identifies the admin behind an impersonation token. The token
+// version lets revoking the admin's tokens end the impersonation as well.
+type Impersonator struct {
+	UserID       uint
+	Username     string
+	TokenVersion uint
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	if c.Scopes == nil {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateToken issues an access token for one login session. The token
+// version lets the server invalidate every outstanding token of a user at
+// once, e.g. after a role change.
+func GenerateToken(user *User, sessionID string, twoFactor bool, ttl time.Duration) (string, error) {
+	expirationTime := time.Now().Add(ttl)
 	claims := &Claims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Role:     user.Role,
+		UserID:       user.ID,
+		Username:     user.Username,
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
+		SessionID:    sessionID,
+		TwoFactor:    twoFactor,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtKey)
+}
+
+// GenerateImpersonationToken issues an access token that acts as user on
+// behalf of the admin behind impersonator. It belongs to the admin's login
+// session, so it ends when that session does.
+func GenerateImpersonationToken(user *User, impersonator *Claims, ttl time.Duration) (string, error) {
+	claims := &Claims{
+		UserID:       user.ID,
+		Username:     user.Username,
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
+		SessionID:    impersonator.SessionID,
+		Impersonator: &Impersonator{
+			UserID:       impersonator.UserID,
+			Username:     impersonator.Username,
+			TokenVersion: impersonator.TokenVersion,
+		},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtKey)
+}
+
+// GenerateTwoFactorChallenge issues the token that proves the password step
+// of a login succeeded. It is rejected everywhere an access token is
+// expected.
+func GenerateTwoFactorChallenge(user *User, ttl time.Duration) (string, error) {
+	claims := &Claims{
+		UserID:       user.ID,
+		Username:     user.Username,
+		TokenVersion: user.TokenVersion,
+		Purpose:      PurposeTwoFactorChallenge,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(jwtKey)
 }
 
+func ValidateTwoFactorChallenge(tokenString string) (*Claims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != PurposeTwoFactorChallenge {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
 func ValidateToken(tokenString string) (*Claims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+func parseToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
 		return jwtKey, nil
 	})
 	if err != nil {
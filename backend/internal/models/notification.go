@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+const (
+	NotificationReminder   = "reminder"
+	NotificationEscalation = "escalation"
+)
+
+// Notification is an entry in a user's in-app inbox. Key identifies the
+// event it reports, such as one firing of a reminder; its unique index is
+// what keeps schedulers on several replicas from creating it twice.
+//
+// RelayedAt is set by the replica that pushed the notification to the
+// user's open connections.
+//
+// Notifications that should also be emailed have Email set until
+// EmailedAt is; EmailClaimedUntil keeps other replicas from sending the
+// same email while one is on it, and holds off the next attempt after
+// EmailAttempts failed ones.
+type Notification struct {
+	ID                uint       `json:"id" gorm:"primarykey"`
+	UserID            uint       `json:"user_id" gorm:"not null;index"`
+	TodoID            *uint      `json:"todo_id" gorm:"default:null"`
+	Kind              string     `json:"kind" gorm:"type:varchar(30);not null"`
+	Key               string     `json:"-" gorm:"column:notification_key;type:varchar(191);not null;uniqueIndex"`
+	Title             string     `json:"title" gorm:"not null"`
+	Body              string     `json:"body"`
+	RelayedAt         *time.Time `json:"-" gorm:"default:null"`
+	Email             bool       `json:"-" gorm:"not null;default:false"`
+	EmailedAt         *time.Time `json:"-" gorm:"default:null"`
+	EmailClaimedUntil *time.Time `json:"-" gorm:"default:null"`
+	EmailAttempts     int        `json:"-" gorm:"not null;default:0"`
+	ReadAt            *time.Time `json:"read_at" gorm:"default:null"`
+	CreatedAt         time.Time  `json:"created_at" gorm:"index"`
+}
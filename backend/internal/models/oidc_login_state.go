@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// OIDCLoginState holds the secrets of an authorization request between the
+// redirect to the identity provider and its callback. It is deleted as soon
+// as the callback consumes it.
+type OIDCLoginState struct {
+	ID           uint      `gorm:"primarykey"`
+	State        string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	Nonce        string    `gorm:"type:varchar(64);not null"`
+	CodeVerifier string    `gorm:"type:varchar(128);not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time
+}
+
+func (OIDCLoginState) TableName() string {
+	return "oidc_login_states"
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+const PersonalAccessTokenPrefix = "tdp_"
+
+const (
+	ScopeReadTodos  = "read:todos"
+	ScopeWriteTodos = "write:todos"
+	ScopeAdminUsers = "admin:users"
+)
+
+var personalAccessTokenScopes = []string{ScopeReadTodos, ScopeWriteTodos, ScopeAdminUsers}
+
+// PersonalAccessToken is a long-lived, named credential for scripts. Only a
+// hash of the secret is stored; Hint keeps its first characters so users can
+// tell their tokens apart.
+type PersonalAccessToken struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	Name       string     `json:"name" gorm:"type:varchar(100);not null"`
+	TokenHash  string     `json:"-" gorm:"type:char(64);not null;uniqueIndex"`
+	Hint       string     `json:"hint" gorm:"type:varchar(20)"`
+	Scopes     string     `json:"scopes" gorm:"type:varchar(255);not null"`
+	ExpiresAt  *time.Time `json:"expires_at" gorm:"default:null"`
+	LastUsedAt *time.Time `json:"last_used_at" gorm:"default:null"`
+	RevokedAt  *time.Time `json:"revoked_at" gorm:"default:null"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func IsValidScope(scope string) bool {
+	for _, s := range personalAccessTokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *PersonalAccessToken) ScopeList() []string {
+	scopes := []string{}
+	for _, scope := range strings.Split(t.Scopes, ",") {
+		if scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+func (t *PersonalAccessToken) Active(now time.Time) bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || now.Before(*t.ExpiresAt)
+}
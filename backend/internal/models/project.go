@@ -0,0 +1,26 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+type Project struct {
+	gorm.Model
+	Name        string `json:"name" gorm:"type:varchar(255);not null"`
+	Description string `json:"description" gorm:"type:text"`
+	LeadID      uint   `json:"lead_id" gorm:"not null"`
+	Lead        User   `json:"lead" gorm:"foreignKey:LeadID"`
+	Members     []User `json:"members" gorm:"many2many:project_members;"`
+}
+
+func (p *Project) HasMember(userID uint) bool {
+	if p.LeadID == userID {
+		return true
+	}
+	for _, member := range p.Members {
+		if member.ID == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// RateLimitBucket is the shared state of one token bucket when rate limits
+// are kept in the database. Version guards concurrent updates.
+type RateLimitBucket struct {
+	BucketKey  string    `gorm:"type:varchar(191);primaryKey"`
+	Tokens     float64   `gorm:"not null"`
+	RefilledAt time.Time `gorm:"not null;index"`
+	Version    int64     `gorm:"not null;default:0"`
+}
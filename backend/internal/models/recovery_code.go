@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// RecoveryCode is a one-time code that stands in for a TOTP code when the
+// authenticator is lost. Only a SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primarykey"`
+	UserID    uint       `gorm:"not null;index"`
+	CodeHash  string     `gorm:"type:char(64);not null;index"`
+	UsedAt    *time.Time `gorm:"default:null"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken is one link in the rotation chain of a login session. Only a
+// SHA-256 hash of the token is stored; every refresh revokes the presented
+// token and issues a new one with the same SessionID. TwoFactor records
+// whether the session was started with a second factor.
+type RefreshToken struct {
+	ID        uint       `gorm:"primarykey"`
+	UserID    uint       `gorm:"not null;index"`
+	SessionID string     `gorm:"type:varchar(64);not null;index"`
+	TokenHash string     `gorm:"type:char(64);not null;uniqueIndex"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	RevokedAt *time.Time `gorm:"default:null"`
+	TwoFactor bool       `gorm:"not null;default:false"`
+	CreatedAt time.Time
+}
+
+func (t *RefreshToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// MaxReminderOffset bounds how long before the due date a reminder can go
+// off, which also bounds how far ahead the scheduler looks for due dates.
+const MaxReminderOffset = 30 * 24 * time.Hour
+
+var (
+	ErrInvalidReminder = errors.New("a reminder needs either remind_at or an offset between 0 and 30 days")
+	ErrReminderInPast  = errors.New("remind_at must be in the future")
+)
+
+// Reminder asks for a notification about one todo, either at a fixed time
+// (RemindAt) or Offset seconds before its due date. Reminders belong to the
+// user who set them; relative ones follow the due date when it moves.
+type Reminder struct {
+	ID       uint       `json:"id" gorm:"primarykey"`
+	TodoID   uint       `json:"todo_id" gorm:"not null;index"`
+	UserID   uint       `json:"user_id" gorm:"not null;index"`
+	RemindAt *time.Time `json:"remind_at" gorm:"default:null;index"`
+	Offset   *int       `json:"offset" gorm:"column:offset_seconds;default:null"`
+	// Email also sends the reminder by email, besides the in-app inbox.
+	Email     bool      `json:"email" gorm:"not null;default:false"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReminderRule is a user's default reminder, Offset seconds before the due
+// date of every todo they own or are assigned to that has no reminder of
+// their own.
+type ReminderRule struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Offset    int       `json:"offset" gorm:"column:offset_seconds;not null"`
+	Email     bool      `json:"email" gorm:"not null;default:false"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ValidReminderOffset reports whether offset, in seconds, is in range.
+func ValidReminderOffset(offset int) bool {
+	return offset >= 0 && time.Duration(offset)*time.Second <= MaxReminderOffset
+}
+
+// Validate checks that exactly one of RemindAt and Offset is set and in
+// range.
+func (r *Reminder) Validate() error {
+	if (r.RemindAt == nil) == (r.Offset == nil) {
+		return ErrInvalidReminder
+	}
+	if r.Offset != nil && !ValidReminderOffset(*r.Offset) {
+		return ErrInvalidReminder
+	}
+	return nil
+}
+
+// FireAt is when the reminder goes off for todo. ok is false for relative
+// reminders on todos without a due date.
+func (r *Reminder) FireAt(todo *Todo) (time.Time, bool) {
+	if r.RemindAt != nil {
+		return *r.RemindAt, true
+	}
+	return offsetBefore(todo, *r.Offset)
+}
+
+// FireAt is when the rule goes off for todo, if it has a due date.
+func (r *ReminderRule) FireAt(todo *Todo) (time.Time, bool) {
+	return offsetBefore(todo, r.Offset)
+}
+
+func offsetBefore(todo *Todo, offset int) (time.Time, bool) {
+	if todo.DueDate == nil {
+		return time.Time{}, false
+	}
+	return todo.DueDate.Add(-time.Duration(offset) * time.Second), true
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+const SettingRegistrationOpen = "registration_open"
+
+// Setting is an instance-wide option that admins change at runtime.
+type Setting struct {
+	Key       string `gorm:"type:varchar(50);primarykey"`
+	Value     string `gorm:"type:varchar(255);not null"`
+	UpdatedAt time.Time
+}
@@ -11,4 +11,12 @@ type TaskTemplate struct {
 	DefaultDurationTimestamp int    `json:"default_duration" gorm:"not null"`
 	OwnerID                  uint   `json:"owner_id" gorm:"not null"`
 	Owner                    User   `json:"owner" gorm:"foreignKey:OwnerID"`
+	Version                  uint   `json:"version" gorm:"not null;default:1"`
+}
+
+func (t *TaskTemplate) BeforeCreate(tx *gorm.DB) error {
+	if t.Version == 0 {
+		t.Version = 1
+	}
+	return nil
 }
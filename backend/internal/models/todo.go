@@ -1,6 +1,8 @@
 package models
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -11,10 +13,232 @@ type Todo struct {
 	Name        string     `json:"name" gorm:"not null"`
 	Description string     `json:"description"`
 	DueDate     *time.Time `json:"due_date" gorm:"default:null"`
+	AllDay      bool       `json:"all_day" gorm:"not null;default:false"`
+	DueTimezone string     `json:"due_timezone"`
 	Status      string     `json:"status" gorm:"default:'pending'"`
 	Priority    string     `json:"priority"`
 	Tags        string     `json:"tags"`
 	OwnerID     uint       `json:"owner_id"`
 	Owner       User       `json:"owner" gorm:"foreignKey:OwnerID"`
 	Assignees   []User     `json:"assignees" gorm:"many2many:todo_assignees;"`
+	ProjectID   *uint      `json:"project_id" gorm:"index"`
+	Version     uint       `json:"version" gorm:"not null;default:1"`
+
+	// StartAt is the earliest time work can begin and ScheduledAt the time
+	// it is planned for. EstimatedDuration is in seconds, like a template's
+	// default duration.
+	StartAt           *time.Time `json:"start_at" gorm:"default:null"`
+	ScheduledAt       *time.Time `json:"scheduled_at" gorm:"default:null;index"`
+	EstimatedDuration int        `json:"estimated_duration" gorm:"not null;default:0"`
+
+	// OverdueAt is set by the overdue job to the moment the todo became
+	// overdue, and cleared once it is completed or its due date moves on.
+	OverdueAt *time.Time `json:"overdue_at" gorm:"default:null;index"`
+
+	// EscalatedAt is when the escalation job last took the todo's steps and
+	// NextEscalationAt when its next step comes due, nil once none is left,
+	// so each run only looks at todos it has new work for.
+	EscalatedAt      *time.Time `json:"-" gorm:"default:null"`
+	NextEscalationAt *time.Time `json:"-" gorm:"default:null;index"`
+
+	// ICalUID and CalDAVName are set for todos created by a CalDAV client,
+	// which chooses its own UID and resource name and expects them back.
+	ICalUID    string `json:"-" gorm:"column:ical_uid;type:varchar(255);index"`
+	CalDAVName string `json:"-" gorm:"column:caldav_name;type:varchar(255);index"`
+}
+
+// MaxEstimatedDuration bounds EstimatedDuration, which also bounds how far
+// back a calendar query has to look for blocks that reach into its window.
+const MaxEstimatedDuration = 30 * 24 * time.Hour
+
+var (
+	ErrStartAfterDue     = errors.New("start_at must be before the due date")
+	ErrScheduledAfterDue = errors.New("scheduled_at must be before the due date")
+	ErrInvalidDuration   = errors.New("estimated_duration must be between 0 and 30 days")
+	ErrInvalidTag        = errors.New("tags cannot be blank or contain commas")
+)
+
+var (
+	todoStatuses   = []string{"pending", "in_progress", "completed"}
+	todoPriorities = []string{"low", "medium", "high"}
+)
+
+func IsValidTodoStatus(status string) bool {
+	for _, s := range todoStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func IsValidTodoPriority(priority string) bool {
+	for _, p := range todoPriorities {
+		if p == priority {
+			return true
+		}
+	}
+	return false
+}
+
+// TagList splits the comma separated Tags column into its tags.
+func (t *Todo) TagList() []string {
+	tags := []string{}
+	for _, tag := range strings.Split(t.Tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ValidateTags checks that each of tags can be stored in the comma separated
+// Tags column as it is.
+func ValidateTags(tags []string) error {
+	for _, tag := range tags {
+		if strings.TrimSpace(tag) == "" || strings.Contains(tag, ",") {
+			return ErrInvalidTag
+		}
+	}
+	return nil
+}
+
+// SetTagList stores tags in the Tags column, dropping blanks and duplicates.
+func (t *Todo) SetTagList(tags []string) {
+	var (
+		seen   = map[string]bool{}
+		result = []string{}
+	)
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	t.Tags = strings.Join(result, ",")
+}
+
+// SetDueDate stores due as a UTC instant together with the zone it was entered
+// in. All-day due dates are moved to the start of their day in that zone.
+func (t *Todo) SetDueDate(due time.Time, allDay bool, loc *time.Location) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	if allDay {
+		year, month, day := due.In(loc).Date()
+		due = time.Date(year, month, day, 0, 0, 0, 0, loc)
+	}
+	due = due.UTC()
+	t.DueDate = &due
+	t.AllDay = allDay
+	t.DueTimezone = loc.String()
+}
+
+// ClearDueDate removes the due date along with its all-day flag and zone.
+func (t *Todo) ClearDueDate() {
+	t.DueDate = nil
+	t.AllDay = false
+	t.DueTimezone = ""
+}
+
+// DueLocation is the zone the due date was entered in, UTC if unknown.
+func (t *Todo) DueLocation() *time.Location {
+	if t.DueTimezone != "" {
+		if loc, err := time.LoadLocation(t.DueTimezone); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// DueLocalDate is the calendar date of the due date in its own zone, or ""
+// when the todo has no due date.
+func (t *Todo) DueLocalDate() string {
+	if t.DueDate == nil {
+		return ""
+	}
+	return t.DueDate.In(t.DueLocation()).Format(time.DateOnly)
+}
+
+// DueEnd is the instant the todo stops being due: the due date itself, or
+// the following midnight for all-day todos.
+func (t *Todo) DueEnd() *time.Time {
+	if t.DueDate == nil {
+		return nil
+	}
+	end := *t.DueDate
+	if t.AllDay {
+		end = end.In(t.DueLocation()).AddDate(0, 0, 1).UTC()
+	}
+	return &end
+}
+
+// IsOverdue reports whether the todo's due date has passed by now without it
+// being completed.
+func (t *Todo) IsOverdue(now time.Time) bool {
+	end := t.DueEnd()
+	return end != nil && !now.Before(*end) && t.Status != "completed"
+}
+
+// ValidateSchedule checks that the start and scheduled times come before the
+// due date and that the estimate is in range.
+func (t *Todo) ValidateSchedule() error {
+	if t.EstimatedDuration < 0 || time.Duration(t.EstimatedDuration)*time.Second > MaxEstimatedDuration {
+		return ErrInvalidDuration
+	}
+	end := t.DueEnd()
+	if end == nil {
+		return nil
+	}
+	if t.StartAt != nil && !t.StartAt.Before(*end) {
+		return ErrStartAfterDue
+	}
+	if t.ScheduledAt != nil && !t.ScheduledAt.Before(*end) {
+		return ErrScheduledAfterDue
+	}
+	return nil
+}
+
+// Span is the stretch of time the todo covers on a calendar. A scheduled
+// todo is a block of its estimated duration; otherwise it runs from StartAt
+// to the due date. ok is false for todos without any date.
+func (t *Todo) Span() (start, end time.Time, ok bool) {
+	duration := time.Duration(t.EstimatedDuration) * time.Second
+
+	switch {
+	case t.ScheduledAt != nil:
+		return *t.ScheduledAt, t.ScheduledAt.Add(duration), true
+	case t.StartAt != nil && t.DueDate != nil:
+		return *t.StartAt, *t.DueEnd(), true
+	case t.StartAt != nil:
+		return *t.StartAt, t.StartAt.Add(duration), true
+	case t.DueDate != nil && t.AllDay:
+		return *t.DueDate, *t.DueEnd(), true
+	case t.DueDate != nil:
+		return t.DueDate.Add(-duration), *t.DueDate, true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// Overlaps reports whether the todo's span touches [from, to). Spans without
+// length count when their instant lies in the window.
+func (t *Todo) Overlaps(from, to time.Time) bool {
+	start, end, ok := t.Span()
+	if !ok || !start.Before(to) {
+		return false
+	}
+	if end.Equal(start) {
+		return !start.Before(from)
+	}
+	return end.After(from)
+}
+
+func (t *Todo) BeforeCreate(tx *gorm.DB) error {
+	if t.Version == 0 {
+		t.Version = 1
+	}
+	return nil
 }
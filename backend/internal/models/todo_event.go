@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+	TodoEventOverdue   = "overdue"
+	TodoEventEscalated = "escalated"
+)
+
+// TodoEvent is an entry in a todo's history. Key names what happened, such
+// as one escalation step for one due date; its unique index keeps jobs on
+// several replicas from recording it twice.
+type TodoEvent struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	TodoID    uint      `json:"todo_id" gorm:"not null;uniqueIndex:idx_todo_event_key"`
+	Key       string    `json:"-" gorm:"column:event_key;type:varchar(191);not null;uniqueIndex:idx_todo_event_key"`
+	Kind      string    `json:"kind" gorm:"type:varchar(30);not null"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -1,6 +1,11 @@
 package models
 
 import (
+	"time"
+	// Embed the zone database so user time zones resolve on hosts without
+	// one, such as minimal containers.
+	_ "time/tzdata"
+
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
@@ -25,6 +30,46 @@ type User struct {
 	Password string `gorm:"not null"`
 	Role     Role   `gorm:"type:varchar(20);default:'user'"`
 	Color    string `gorm:"type:varchar(30);default:'#000000'"`
+
+	// Profile. Timezone is an IANA zone name used to read the dates the
+	// user types; empty means UTC. WeekStart is 0 for Sunday through 6 for
+	// Saturday. AvatarUpdatedAt is set while the user has an avatar.
+	DisplayName     string     `gorm:"type:varchar(100)"`
+	Timezone        string     `gorm:"type:varchar(64)"`
+	Locale          string     `gorm:"type:varchar(35)"`
+	WeekStart       int        `gorm:"not null;default:0"`
+	AvatarUpdatedAt *time.Time `gorm:"default:null"`
+
+	// DigestFrequency is DigestDaily or DigestWeekly for users who opted in
+	// to the digest email. DigestSentFor names the last period one was sent
+	// for, so schedulers on several replicas send each once.
+	DigestFrequency string `gorm:"type:varchar(10);not null;default:''"`
+	DigestSentFor   string `gorm:"type:varchar(30);not null;default:''"`
+
+	// OIDCIssuer and OIDCSubject identify the single sign-on account the
+	// user is linked to. They are null until the first single sign-on login.
+	OIDCIssuer  *string `gorm:"column:oidc_issuer;type:varchar(191);uniqueIndex:idx_users_oidc_identity"`
+	OIDCSubject *string `gorm:"column:oidc_subject;type:varchar(191);uniqueIndex:idx_users_oidc_identity"`
+
+	TokenVersion    uint       `gorm:"not null;default:0"`
+	EmailVerifiedAt *time.Time `gorm:"default:null"`
+
+	// DeactivatedAt is set for users who left. They cannot log in, but stay
+	// in the table so todos and history keep showing who they were.
+	DeactivatedAt *time.Time `gorm:"default:null"`
+
+	// FailedLoginAttempts counts wrong passwords and second factors since
+	// the last successful login; LockedUntil is set once it reaches the
+	// lockout threshold.
+	FailedLoginAttempts int        `gorm:"not null;default:0"`
+	LockedUntil         *time.Time `gorm:"default:null"`
+
+	// TOTPSecret is set as soon as enrollment starts, but only counts once
+	// TOTPEnabled is true. TOTPLastCounter is the last time step a code was
+	// accepted for, so a code cannot be replayed.
+	TOTPSecret      string `gorm:"column:totp_secret;type:varchar(64)"`
+	TOTPEnabled     bool   `gorm:"column:totp_enabled;not null;default:false"`
+	TOTPLastCounter int64  `gorm:"column:totp_last_counter;not null;default:0"`
 }
 
 func (r Role) String() string {
@@ -56,13 +101,45 @@ func (u *User) CheckPassword(password string) bool {
 	return err == nil
 }
 
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
+func (u *User) IsDeactivated() bool {
+	return u.DeactivatedAt != nil
+}
+
+// Location returns the user's time zone, or UTC when none is set or it is
+// no longer known.
+func (u *User) Location() *time.Location {
+	if u.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Name is how the user is shown to others: the display name if set,
+// otherwise the username.
+func (u *User) Name() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Username
+}
+
 func (u *User) AfterCreate(tx *gorm.DB) error {
 	u.Color = utils.GenerateColor(u.ID)
 	return tx.Save(u).Error
 }
 
 func (u *User) AfterUpdate(tx *gorm.DB) error {
-	if u.Color == "" {
+	// Column updates through Model(&User{}) run this hook on an empty struct,
+	// which must not be saved as a new row.
+	if u.ID != 0 && u.Color == "" {
 		u.Color = utils.GenerateColor(u.ID)
 		return tx.Save(u).Error
 	}
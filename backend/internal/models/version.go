@@ -0,0 +1,7 @@
+package models
+
+import "errors"
+
+// ErrVersionConflict is returned when a row was modified by someone else
+// between reading it and writing it back.
+var ErrVersionConflict = errors.New("resource was modified by another request")
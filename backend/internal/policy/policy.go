@@ -0,0 +1,263 @@
+// Package policy decides what a user may do. Roles grant permissions, and
+// each grant says which resources it covers: all of them, or only those the
+// user owns, is assigned to or is a project member of.
+package policy
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+type Permission string
+
+const (
+	TodoRead        Permission = "todo.read"
+	TodoCreate      Permission = "todo.create"
+	TodoUpdate      Permission = "todo.update"
+	TodoDelete      Permission = "todo.delete"
+	TodoChangeOwner Permission = "todo.change_owner"
+
+	TemplateRead   Permission = "template.read"
+	TemplateCreate Permission = "template.create"
+	TemplateUpdate Permission = "template.update"
+	TemplateDelete Permission = "template.delete"
+
+	ProjectRead   Permission = "project.read"
+	ProjectCreate Permission = "project.create"
+
+	UserManage      Permission = "user.manage"
+	UserImpersonate Permission = "user.impersonate"
+	RoleManage      Permission = "role.manage"
+	AuditRead       Permission = "audit.read"
+)
+
+// AdminPermissions are the permissions that make a role administrative.
+// Users holding any of them cannot be impersonated.
+var AdminPermissions = []Permission{UserManage, UserImpersonate, RoleManage, AuditRead}
+
+// Relation limits a grant to resources the user has that relation to.
+type Relation string
+
+const (
+	Any           Relation = "any"
+	Owner         Relation = "owner"
+	Assignee      Relation = "assignee"
+	ProjectMember Relation = "project_member"
+)
+
+// relations lists, per permission, the relations a grant may use.
+var relations = map[Permission][]Relation{
+	TodoRead:        {Any, Owner, Assignee, ProjectMember},
+	TodoCreate:      {Any},
+	TodoUpdate:      {Any, Owner, Assignee, ProjectMember},
+	TodoDelete:      {Any, Owner, Assignee, ProjectMember},
+	TodoChangeOwner: {Any, Owner},
+	TemplateRead:    {Any, Owner},
+	TemplateCreate:  {Any},
+	TemplateUpdate:  {Any, Owner},
+	TemplateDelete:  {Any, Owner},
+	ProjectRead:     {Any, Owner, ProjectMember},
+	ProjectCreate:   {Any},
+	UserManage:      {Any},
+	UserImpersonate: {Any},
+	RoleManage:      {Any},
+	AuditRead:       {Any},
+}
+
+var (
+	ErrInvalidRoleName   = errors.New("role names are 1-30 lowercase letters, digits, dashes or underscores")
+	ErrBuiltInRole       = errors.New("built-in roles cannot be changed")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrInvalidRelation   = errors.New("relation is not allowed for this permission")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,30}$`)
+
+type Role struct {
+	Name        models.Role               `json:"name"`
+	Description string                    `json:"description"`
+	Grants      map[Permission][]Relation `json:"grants"`
+	BuiltIn     bool                      `json:"built_in"`
+}
+
+// Validate checks a custom role definition.
+func (r Role) Validate() error {
+	if !roleNamePattern.MatchString(string(r.Name)) {
+		return ErrInvalidRoleName
+	}
+	if _, ok := builtInRoles[r.Name]; ok {
+		return ErrBuiltInRole
+	}
+	for permission, granted := range r.Grants {
+		allowed, ok := relations[permission]
+		if !ok {
+			return ErrUnknownPermission
+		}
+		for _, relation := range granted {
+			if !containsRelation(allowed, relation) {
+				return ErrInvalidRelation
+			}
+		}
+	}
+	return nil
+}
+
+// Covers reports whether r grants at least everything other grants, so that
+// someone holding r gives nothing away by handing other out.
+func (r Role) Covers(other Role) bool {
+	for permission, granted := range other.Grants {
+		held := r.Grants[permission]
+		if containsRelation(held, Any) {
+			continue
+		}
+		for _, relation := range granted {
+			if !containsRelation(held, relation) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Subject is the user a decision is made for.
+type Subject struct {
+	UserID uint
+	Role   models.Role
+	// ProjectIDs are the projects the user leads or is a member of.
+	ProjectIDs []uint
+}
+
+// Resource holds the facts about a todo, template or project that grants
+// with a relation are checked against.
+type Resource struct {
+	OwnerID     uint
+	AssigneeIDs []uint
+	ProjectID   *uint
+}
+
+func (r *Resource) relatedBy(subject Subject, relation Relation) bool {
+	switch relation {
+	case Any:
+		return true
+	case Owner:
+		return r.OwnerID == subject.UserID
+	case Assignee:
+		for _, id := range r.AssigneeIDs {
+			if id == subject.UserID {
+				return true
+			}
+		}
+	case ProjectMember:
+		if r.ProjectID == nil {
+			return false
+		}
+		for _, id := range subject.ProjectIDs {
+			if id == *r.ProjectID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Engine evaluates permissions against the built-in roles and the custom
+// roles it was last given.
+type Engine struct {
+	mu     sync.RWMutex
+	custom map[models.Role]Role
+}
+
+func NewEngine() *Engine {
+	return &Engine{custom: map[models.Role]Role{}}
+}
+
+// SetCustomRoles replaces all custom roles.
+func (e *Engine) SetCustomRoles(roles []Role) {
+	custom := make(map[models.Role]Role, len(roles))
+	for _, role := range roles {
+		custom[role.Name] = role
+	}
+
+	e.mu.Lock()
+	e.custom = custom
+	e.mu.Unlock()
+}
+
+func (e *Engine) Role(name models.Role) (Role, bool) {
+	if role, ok := builtInRoles[name]; ok {
+		return role, true
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	role, ok := e.custom[name]
+	return role, ok
+}
+
+// Roles returns the built-in roles followed by the custom ones by name.
+func (e *Engine) Roles() []Role {
+	roles := []Role{builtInRoles[models.RoleUser], builtInRoles[models.RoleAdmin]}
+
+	e.mu.RLock()
+	custom := make([]Role, 0, len(e.custom))
+	for _, role := range e.custom {
+		custom = append(custom, role)
+	}
+	e.mu.RUnlock()
+
+	sort.Slice(custom, func(i, j int) bool { return custom[i].Name < custom[j].Name })
+	return append(roles, custom...)
+}
+
+// Can reports whether subject has permission on resource. A nil resource
+// asks whether the permission is granted for every resource, which is also
+// what permissions without resources such as user.manage need.
+func (e *Engine) Can(subject Subject, permission Permission, resource *Resource) bool {
+	role, ok := e.Role(subject.Role)
+	if !ok {
+		return false
+	}
+
+	for _, relation := range role.Grants[permission] {
+		if relation == Any {
+			return true
+		}
+		if resource != nil && resource.relatedBy(subject, relation) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanGrant reports whether a user with role actor may give role target to
+// someone, which needs actor to cover everything target grants.
+func (e *Engine) CanGrant(actor, target models.Role) bool {
+	actorRole, ok := e.Role(actor)
+	if !ok {
+		return false
+	}
+	targetRole, ok := e.Role(target)
+	return ok && actorRole.Covers(targetRole)
+}
+
+// Permissions lists every permission with the relations it supports.
+func Permissions() map[Permission][]Relation {
+	result := make(map[Permission][]Relation, len(relations))
+	for permission, allowed := range relations {
+		result[permission] = append([]Relation(nil), allowed...)
+	}
+	return result
+}
+
+func containsRelation(relations []Relation, relation Relation) bool {
+	for _, r := range relations {
+		if r == relation {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package policy
+
+import (
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+// builtInRoles keep the behaviour the app always had: admins may do
+// everything, users work on their own todos and templates and on todos they
+// are assigned to or that belong to their projects, and only see the
+// projects they lead or are a member of.
+var builtInRoles = map[models.Role]Role{
+	models.RoleUser: {
+		Name:        models.RoleUser,
+		Description: "Works on own todos and templates",
+		BuiltIn:     true,
+		Grants: map[Permission][]Relation{
+			TodoRead:       {Owner, Assignee, ProjectMember},
+			TodoCreate:     {Any},
+			TodoUpdate:     {Owner, Assignee},
+			TodoDelete:     {Owner},
+			TemplateRead:   {Owner},
+			TemplateCreate: {Any},
+			TemplateUpdate: {Owner},
+			TemplateDelete: {Owner},
+			ProjectRead:    {Owner, ProjectMember},
+			ProjectCreate:  {Any},
+		},
+	},
+	models.RoleAdmin: {
+		Name:        models.RoleAdmin,
+		Description: "Full access",
+		BuiltIn:     true,
+		Grants:      allPermissions(),
+	},
+}
+
+func allPermissions() map[Permission][]Relation {
+	grants := make(map[Permission][]Relation, len(relations))
+	for permission := range relations {
+		grants[permission] = []Relation{Any}
+	}
+	return grants
+}
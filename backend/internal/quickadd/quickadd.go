@@ -0,0 +1,383 @@
+// Package quickadd reads a one-line todo such as
+// "Deploy hotfix tomorrow 3pm #infra !high @alice" and splits it into the
+// fields of a todo. Words that are not recognised stay in the name.
+package quickadd
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+)
+
+// Options describe the user the text is read for. Relative phrases are
+// resolved against Now in Location, and "next week" starts on WeekStart.
+type Options struct {
+	Now       time.Time
+	Location  *time.Location
+	WeekStart time.Weekday
+}
+
+// Result holds the fields found in the text. DueDate is nil when no date or
+// time was given; it is midnight in the user's zone when AllDay is set.
+type Result struct {
+	Name     string
+	DueDate  *time.Time
+	AllDay   bool
+	Tags     []string
+	Priority string
+	Mentions []string
+}
+
+var (
+	clock12Pattern = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)$`)
+	clock24Pattern = regexp.MustCompile(`^(\d{1,2}):(\d{2})$`)
+	hourPattern    = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?$`)
+	numericDate    = regexp.MustCompile(`^(\d{4}-\d{1,2}-\d{1,2}|\d{1,2}/\d{1,2}/\d{2,4})$`)
+	shortDate      = regexp.MustCompile(`^\d{1,2}/\d{1,2}$`)
+	dayOfMonth     = regexp.MustCompile(`^(\d{1,2})(st|nd|rd|th)?$`)
+	yearPattern    = regexp.MustCompile(`^\d{4}$`)
+
+	// connectors may precede a date or time and are dropped with it.
+	connectors = map[string]bool{"on": true, "at": true, "by": true, "due": true}
+
+	priorities = map[string]string{"low": "low", "medium": "medium", "med": "medium", "high": "high"}
+
+	weekdays = map[string]time.Weekday{
+		"sun": time.Sunday, "sunday": time.Sunday,
+		"mon": time.Monday, "monday": time.Monday,
+		"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+		"wed": time.Wednesday, "wednesday": time.Wednesday,
+		"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+		"fri": time.Friday, "friday": time.Friday,
+		"sat": time.Saturday, "saturday": time.Saturday,
+	}
+
+	months = map[string]time.Month{
+		"jan": time.January, "january": time.January,
+		"feb": time.February, "february": time.February,
+		"mar": time.March, "march": time.March,
+		"apr": time.April, "april": time.April,
+		"may": time.May,
+		"jun": time.June, "june": time.June,
+		"jul": time.July, "july": time.July,
+		"aug": time.August, "august": time.August,
+		"sep": time.September, "sept": time.September, "september": time.September,
+		"oct": time.October, "october": time.October,
+		"nov": time.November, "november": time.November,
+		"dec": time.December, "december": time.December,
+	}
+)
+
+type parser struct {
+	tokens    []string
+	now       time.Time
+	today     time.Time
+	weekStart time.Weekday
+}
+
+// Parse splits text into a todo's fields. The first date and the first time
+// of day are used; later ones are left in the name.
+func Parse(text string, opts Options) Result {
+	loc := opts.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	now := opts.Now.In(loc)
+
+	p := &parser{
+		tokens:    strings.Fields(text),
+		now:       now,
+		today:     time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc),
+		weekStart: opts.WeekStart,
+	}
+
+	var (
+		result  = Result{Tags: []string{}, Mentions: []string{}}
+		name    = []string{}
+		day     *time.Time
+		instant *time.Time
+		hour    = -1
+		minute  int
+	)
+
+	for i := 0; i < len(p.tokens); {
+		token := p.tokens[i]
+		value := trimPunctuation(token)
+
+		switch {
+		case strings.HasPrefix(value, "#") && len(value) > 1:
+			result.Tags = append(result.Tags, value[1:])
+			i++
+			continue
+		case strings.HasPrefix(value, "@") && len(value) > 1:
+			result.Mentions = append(result.Mentions, value[1:])
+			i++
+			continue
+		case strings.HasPrefix(value, "!") && priorities[strings.ToLower(value[1:])] != "":
+			result.Priority = priorities[strings.ToLower(value[1:])]
+			i++
+			continue
+		}
+
+		skip := 0
+		if connectors[p.word(i)] {
+			skip = 1
+		}
+		if day == nil && instant == nil {
+			if d, n := p.date(i + skip); n > 0 {
+				day = &d
+				i += skip + n
+				continue
+			}
+			if t, n := p.relative(i + skip); n > 0 && hour < 0 {
+				instant = &t
+				i += skip + n
+				continue
+			}
+		}
+		if hour < 0 && instant == nil {
+			if h, m, n := p.clock(i + skip); n > 0 {
+				hour, minute = h, m
+				i += skip + n
+				continue
+			}
+		}
+
+		name = append(name, token)
+		i++
+	}
+
+	result.Name = strings.Join(name, " ")
+
+	switch {
+	case instant != nil:
+		result.DueDate = instant
+	case day != nil && hour >= 0:
+		due := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+		result.DueDate = &due
+	case day != nil:
+		result.DueDate = day
+		result.AllDay = true
+	case hour >= 0:
+		// A bare time means the next time the clock shows it.
+		due := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, loc)
+		if due.Before(now) {
+			due = due.AddDate(0, 0, 1)
+		}
+		result.DueDate = &due
+	}
+
+	return result
+}
+
+// word returns the token at i in lower case without trailing punctuation, or
+// "" past the end of the text.
+func (p *parser) word(i int) string {
+	if i >= len(p.tokens) {
+		return ""
+	}
+	return strings.ToLower(trimPunctuation(p.tokens[i]))
+}
+
+// date matches a calendar day at i and returns it with the number of tokens
+// it spans.
+func (p *parser) date(i int) (time.Time, int) {
+	word := p.word(i)
+
+	switch word {
+	case "today":
+		return p.today, 1
+	case "tomorrow", "tmrw":
+		return p.today.AddDate(0, 0, 1), 1
+	case "this":
+		if weekday, ok := weekdays[p.word(i+1)]; ok {
+			return p.upcoming(weekday), 2
+		}
+	case "next":
+		next := p.word(i + 1)
+		if weekday, ok := weekdays[next]; ok {
+			start := p.startOfWeek().AddDate(0, 0, 7)
+			return start.AddDate(0, 0, (int(weekday)-int(p.weekStart)+7)%7), 2
+		}
+		switch next {
+		case "week":
+			return p.startOfWeek().AddDate(0, 0, 7), 2
+		case "month":
+			return time.Date(p.today.Year(), p.today.Month()+1, 1, 0, 0, 0, 0, p.today.Location()), 2
+		case "year":
+			return time.Date(p.today.Year()+1, time.January, 1, 0, 0, 0, 0, p.today.Location()), 2
+		}
+	case "in":
+		count, ok := p.count(i + 1)
+		if !ok {
+			break
+		}
+		switch strings.TrimSuffix(p.word(i+2), "s") {
+		case "day":
+			return p.today.AddDate(0, 0, count), 3
+		case "week":
+			return p.today.AddDate(0, 0, 7*count), 3
+		case "month":
+			return p.today.AddDate(0, count, 0), 3
+		case "year":
+			return p.today.AddDate(count, 0, 0), 3
+		}
+	}
+
+	if weekday, ok := weekdays[word]; ok {
+		return p.upcoming(weekday), 1
+	}
+
+	if numericDate.MatchString(word) {
+		if parsed, err := dateparse.ParseIn(word, p.today.Location()); err == nil {
+			return p.midnight(parsed), 1
+		}
+	}
+	if shortDate.MatchString(word) {
+		if parsed, err := dateparse.ParseIn(word+"/"+strconv.Itoa(p.today.Year()), p.today.Location()); err == nil {
+			return p.rollForward(p.midnight(parsed)), 1
+		}
+	}
+
+	// "May 3", "3rd May", optionally followed by a year.
+	var (
+		month  time.Month
+		dayNum string
+		ok     bool
+	)
+	if month, ok = months[word]; ok {
+		if match := dayOfMonth.FindStringSubmatch(p.word(i + 1)); match != nil {
+			dayNum = match[1]
+		}
+	} else if match := dayOfMonth.FindStringSubmatch(word); match != nil {
+		if month, ok = months[p.word(i+1)]; ok {
+			dayNum = match[1]
+		}
+	}
+	if dayNum == "" {
+		return time.Time{}, 0
+	}
+
+	n, year := 2, strconv.Itoa(p.today.Year())
+	if yearPattern.MatchString(p.word(i + 2)) {
+		n, year = 3, p.word(i+2)
+	}
+	parsed, err := dateparse.ParseIn(month.String()+" "+dayNum+" "+year, p.today.Location())
+	if err != nil {
+		return time.Time{}, 0
+	}
+	if n == 2 {
+		return p.rollForward(p.midnight(parsed)), n
+	}
+	return p.midnight(parsed), n
+}
+
+// relative matches "in 3 hours" or "in 20 minutes" at i.
+func (p *parser) relative(i int) (time.Time, int) {
+	if p.word(i) != "in" {
+		return time.Time{}, 0
+	}
+	count, ok := p.count(i + 1)
+	if !ok {
+		return time.Time{}, 0
+	}
+	switch strings.TrimSuffix(p.word(i+2), "s") {
+	case "hour", "hr":
+		return p.now.Add(time.Duration(count) * time.Hour), 3
+	case "minute", "min":
+		return p.now.Add(time.Duration(count) * time.Minute), 3
+	}
+	return time.Time{}, 0
+}
+
+// clock matches a time of day at i: "3pm", "3:30 pm", "15:00", "noon" or
+// "midnight".
+func (p *parser) clock(i int) (int, int, int) {
+	word := p.word(i)
+
+	switch word {
+	case "noon":
+		return 12, 0, 1
+	case "midnight":
+		return 0, 0, 1
+	}
+
+	if match := clock12Pattern.FindStringSubmatch(word); match != nil {
+		if hour, minute, ok := twelveHour(match[1], match[2], match[3]); ok {
+			return hour, minute, 1
+		}
+	}
+	if suffix := p.word(i + 1); suffix == "am" || suffix == "pm" {
+		if match := hourPattern.FindStringSubmatch(word); match != nil {
+			if hour, minute, ok := twelveHour(match[1], match[2], suffix); ok {
+				return hour, minute, 2
+			}
+		}
+	}
+	if match := clock24Pattern.FindStringSubmatch(word); match != nil {
+		hour, _ := strconv.Atoi(match[1])
+		minute, _ := strconv.Atoi(match[2])
+		if hour < 24 && minute < 60 {
+			return hour, minute, 1
+		}
+	}
+	return 0, 0, 0
+}
+
+// count reads the number in "in 3 days" or "in a week".
+func (p *parser) count(i int) (int, bool) {
+	word := p.word(i)
+	if word == "a" || word == "an" {
+		return 1, true
+	}
+	n, err := strconv.Atoi(word)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// upcoming is the next day that falls on weekday, today included.
+func (p *parser) upcoming(weekday time.Weekday) time.Time {
+	return p.today.AddDate(0, 0, (int(weekday)-int(p.today.Weekday())+7)%7)
+}
+
+func (p *parser) startOfWeek() time.Time {
+	return p.today.AddDate(0, 0, -((int(p.today.Weekday()) - int(p.weekStart) + 7) % 7))
+}
+
+func (p *parser) midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, p.today.Location())
+}
+
+// rollForward moves a date given without a year into next year once this
+// year's has passed.
+func (p *parser) rollForward(day time.Time) time.Time {
+	if day.Before(p.today) {
+		return day.AddDate(1, 0, 0)
+	}
+	return day
+}
+
+func twelveHour(hourText, minuteText, suffix string) (int, int, bool) {
+	hour, _ := strconv.Atoi(hourText)
+	minute := 0
+	if minuteText != "" {
+		minute, _ = strconv.Atoi(minuteText)
+	}
+	if hour < 1 || hour > 12 || minute > 59 {
+		return 0, 0, false
+	}
+	hour %= 12
+	if suffix == "pm" {
+		hour += 12
+	}
+	return hour, minute, true
+}
+
+func trimPunctuation(token string) string {
+	return strings.TrimRight(token, ",.;:")
+}
@@ -0,0 +1,79 @@
+// Package ratelimit implements token buckets. A bucket holds up to
+// Limit.Requests tokens and refills evenly over Limit.Period; every request
+// takes one token.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit parses limits written as "20/1m": 20 requests per minute.
+func ParseLimit(value string) (Limit, error) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected requests/period", value)
+	}
+
+	requests, err := strconv.Atoi(parts[0])
+	if err != nil || requests < 1 {
+		return Limit{}, fmt.Errorf("invalid request count in rate limit %q", value)
+	}
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("invalid period in rate limit %q", value)
+	}
+
+	return Limit{Requests: requests, Period: period}, nil
+}
+
+// Store keeps bucket state. Implementations must make Take atomic per key.
+type Store interface {
+	// Take removes a token from the bucket for key. When none is left it
+	// returns false and how long until the next token is available.
+	Take(key string, limit Limit, now time.Time) (bool, time.Duration, error)
+}
+
+// Bucket is the state of one token bucket.
+type Bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// NewBucket returns a full bucket.
+func NewBucket(limit Limit, now time.Time) Bucket {
+	return Bucket{Tokens: float64(limit.Requests), UpdatedAt: now}
+}
+
+// Take refills b for the time passed since it was last updated and tries to
+// remove one token.
+func (b *Bucket) Take(limit Limit, now time.Time) (bool, time.Duration) {
+	rate := float64(limit.Requests) / limit.Period.Seconds()
+
+	if elapsed := now.Sub(b.UpdatedAt).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(float64(limit.Requests), b.Tokens+elapsed*rate)
+	}
+	b.UpdatedAt = now
+
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return true, 0
+	}
+
+	wait := (1 - b.Tokens) / rate
+	return false, time.Duration(math.Ceil(wait * float64(time.Second)))
+}
+
+// Full reports whether the bucket would be full at now, i.e. its state can
+// be forgotten.
+func (b *Bucket) Full(limit Limit, now time.Time) bool {
+	return now.Sub(b.UpdatedAt) >= limit.Period
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+type AccountTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewAccountTokenRepository(db *gorm.DB) *AccountTokenRepository {
+	return &AccountTokenRepository{db: db}
+}
+
+func (r *AccountTokenRepository) Create(token *models.AccountToken) error {
+	return r.db.Create(token).Error
+}
+
+// Consume marks a valid token as used and returns it. It returns nil when
+// the token does not exist, has expired or was already used, including by a
+// concurrent request.
+func (r *AccountTokenRepository) Consume(hash, purpose string, now time.Time) (*models.AccountToken, error) {
+	var token models.AccountToken
+	err := r.db.Where("token_hash = ? AND purpose = ?", hash, purpose).First(&token).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	result := r.db.Model(&models.AccountToken{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", token.ID, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	token.UsedAt = &now
+	return &token, nil
+}
+
+// InvalidateForUser uses up every outstanding token of a user for purpose.
+func (r *AccountTokenRepository) InvalidateForUser(userID uint, purpose string, now time.Time) error {
+	return r.db.Model(&models.AccountToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", now).Error
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+// AuditFilter narrows the audit log. Zero values match everything.
+type AuditFilter struct {
+	Actions    []string
+	Outcome    string
+	ActorID    *uint
+	TargetType string
+	TargetID   *uint
+	IP         string
+	From       *time.Time
+	To         *time.Time
+	// AfterID returns only events newer than the one with this ID, so
+	// exports can continue where the last one stopped.
+	AfterID uint
+}
+
+type AuditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) Create(event *models.AuditEvent) error {
+	return r.db.Create(event).Error
+}
+
+// List returns a page of matching events, newest first, and how many match
+// in total.
+func (r *AuditRepository) List(filter AuditFilter, limit, offset int) ([]models.AuditEvent, int64, error) {
+	var (
+		events []models.AuditEvent
+		total  int64
+	)
+
+	if err := r.filtered(filter).Model(&models.AuditEvent{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := r.filtered(filter).Order("id desc").Limit(limit).Offset(offset).Find(&events).Error
+	return events, total, err
+}
+
+// Each calls fn with matching events in batches, oldest first.
+func (r *AuditRepository) Each(filter AuditFilter, batchSize int, fn func([]models.AuditEvent) error) error {
+	var events []models.AuditEvent
+	return r.filtered(filter).Order("id asc").FindInBatches(&events, batchSize, func(tx *gorm.DB, batch int) error {
+		return fn(events)
+	}).Error
+}
+
+func (r *AuditRepository) filtered(filter AuditFilter) *gorm.DB {
+	query := r.db
+
+	if len(filter.Actions) > 0 {
+		query = query.Where("action IN ?", filter.Actions)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != nil {
+		query = query.Where("target_id = ?", *filter.TargetID)
+	}
+	if filter.IP != "" {
+		query = query.Where("ip = ?", filter.IP)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	if filter.AfterID != 0 {
+		query = query.Where("id > ?", filter.AfterID)
+	}
+
+	return query
+}
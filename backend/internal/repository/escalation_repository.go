@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+type EscalationRepository struct {
+	db *gorm.DB
+}
+
+func NewEscalationRepository(db *gorm.DB) *EscalationRepository {
+	return &EscalationRepository{db: db}
+}
+
+func (r *EscalationRepository) Create(rule *models.EscalationRule) error {
+	return r.db.Create(rule).Error
+}
+
+// GetList returns the rules in the order they go off.
+func (r *EscalationRepository) GetList() ([]models.EscalationRule, error) {
+	var rules []models.EscalationRule
+	err := r.db.Order("after_seconds asc, id asc").Find(&rules).Error
+	return rules, err
+}
+
+func (r *EscalationRepository) GetByID(id uint) (*models.EscalationRule, error) {
+	var rule models.EscalationRule
+	err := r.db.First(&rule, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (r *EscalationRepository) Update(rule *models.EscalationRule) error {
+	return r.db.Save(rule).Error
+}
+
+func (r *EscalationRepository) Delete(id uint) (bool, error) {
+	result := r.db.Delete(&models.EscalationRule{}, id)
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+type IdempotencyRepository struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyRepository(db *gorm.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+// Create inserts a new record; it fails on the unique index when another
+// request already claimed the same key.
+func (r *IdempotencyRepository) Create(record *models.IdempotencyRecord) error {
+	return r.db.Create(record).Error
+}
+
+func (r *IdempotencyRepository) Find(userID uint, key string, now time.Time) (*models.IdempotencyRecord, error) {
+	var record models.IdempotencyRecord
+	err := r.db.Where("user_id = ? AND idempotency_key = ? AND expires_at > ?", userID, key, now).First(&record).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *IdempotencyRepository) Update(record *models.IdempotencyRecord) error {
+	return r.db.Save(record).Error
+}
+
+func (r *IdempotencyRepository) Delete(id uint) error {
+	return r.db.Delete(&models.IdempotencyRecord{}, id).Error
+}
+
+func (r *IdempotencyRepository) DeleteExpired(userID uint, key string, now time.Time) error {
+	return r.db.Where("user_id = ? AND idempotency_key = ? AND expires_at <= ?", userID, key, now).
+		Delete(&models.IdempotencyRecord{}).Error
+}
+
+func (r *IdempotencyRepository) DeleteAllExpired(now time.Time) (int64, error) {
+	result := r.db.Where("expires_at <= ?", now).Delete(&models.IdempotencyRecord{})
+	return result.RowsAffected, result.Error
+}
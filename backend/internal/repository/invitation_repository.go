@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+// errInvitationClosed rolls back Accept when the invitation was used,
+// revoked or expired while the account was being created.
+var errInvitationClosed = errors.New("invitation is no longer pending")
+
+type InvitationRepository struct {
+	db *gorm.DB
+}
+
+func NewInvitationRepository(db *gorm.DB) *InvitationRepository {
+	return &InvitationRepository{db: db}
+}
+
+func (r *InvitationRepository) Create(invitation *models.Invitation) error {
+	return r.db.Create(invitation).Error
+}
+
+func (r *InvitationRepository) GetByID(id uint) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := r.db.Preload("InvitedBy").First(&invitation, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *InvitationRepository) FindByHash(hash string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := r.db.Preload("InvitedBy").Where("token_hash = ?", hash).First(&invitation).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// FindPendingByEmail returns the open invitation for email, if any.
+func (r *InvitationRepository) FindPendingByEmail(email string, now time.Time) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := r.db.Where("email = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", email, now).
+		First(&invitation).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *InvitationRepository) GetAll() ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	err := r.db.Preload("InvitedBy").Order("created_at desc").Find(&invitations).Error
+	return invitations, err
+}
+
+// Renew replaces the secret of an open invitation and moves its expiry. It
+// returns false when the invitation was accepted or revoked.
+func (r *InvitationRepository) Renew(id uint, hash string, expiresAt, now time.Time) (bool, error) {
+	result := r.db.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{"token_hash": hash, "expires_at": expiresAt, "sent_at": now})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *InvitationRepository) Revoke(id uint, now time.Time) (bool, error) {
+	result := r.db.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+		Update("revoked_at", now)
+	return result.RowsAffected > 0, result.Error
+}
+
+// Accept creates user and marks the invitation accepted in one transaction.
+// It returns false, creating nothing, when the invitation is no longer
+// pending, including because a concurrent request accepted it first.
+func (r *InvitationRepository) Accept(invitation *models.Invitation, user *models.User, now time.Time) (bool, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Invitation{}).
+			Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", invitation.ID, now).
+			Update("accepted_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvitationClosed
+		}
+
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Invitation{}).Where("id = ?", invitation.ID).
+			Update("accepted_user_id", user.ID).Error
+	})
+	if err == errInvitationClosed {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	invitation.AcceptedAt = &now
+	invitation.AcceptedUserID = &user.ID
+	return true, nil
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+type NotificationRepository struct {
+	db *gorm.DB
+}
+
+func NewNotificationRepository(db *gorm.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+// Claim inserts the notification unless one with the same key exists. It
+// reports whether this call created it, which at most one caller does.
+func (r *NotificationRepository) Claim(notification *models.Notification) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "notification_key"}},
+		DoNothing: true,
+	}).Create(notification)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetList returns the user's newest notifications first, optionally only
+// the unread ones.
+func (r *NotificationRepository) GetList(userID uint, unreadOnly bool, limit int) ([]models.Notification, error) {
+	var notifications []models.Notification
+
+	query := r.db.Where("user_id = ?", userID)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+
+	err := query.Order("id desc").Limit(limit).Find(&notifications).Error
+
+	return notifications, err
+}
+
+func (r *NotificationRepository) CountUnread(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *NotificationRepository) MarkRead(id, userID uint, now time.Time) (bool, error) {
+	var notification models.Notification
+	if err := r.db.Where("id = ? AND user_id = ?", id, userID).First(&notification).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	err := r.db.Model(&models.Notification{}).Where("id = ? AND read_at IS NULL", id).Update("read_at", now).Error
+	return true, err
+}
+
+func (r *NotificationRepository) MarkAllRead(userID uint, now time.Time) (int64, error) {
+	result := r.db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Update("read_at", now)
+	return result.RowsAffected, result.Error
+}
+
+// GetUnrelayed returns the notifications of users created since since that
+// have not been pushed yet, oldest first.
+func (r *NotificationRepository) GetUnrelayed(userIDs []uint, since time.Time, limit int) ([]models.Notification, error) {
+	var notifications []models.Notification
+	if len(userIDs) == 0 {
+		return notifications, nil
+	}
+	err := r.db.Where("relayed_at IS NULL AND created_at >= ?", since).
+		Where("user_id IN (?)", userIDs).
+		Order("id asc").
+		Limit(limit).
+		Find(&notifications).Error
+	return notifications, err
+}
+
+// ClaimRelay marks the notification pushed unless it already is, and
+// reports whether this call did.
+func (r *NotificationRepository) ClaimRelay(id uint, now time.Time) (bool, error) {
+	result := r.db.Model(&models.Notification{}).
+		Where("id = ? AND relayed_at IS NULL", id).
+		Update("relayed_at", now)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetUnsentEmails returns notifications still waiting to be emailed, tried
+// fewer than maxAttempts times, whose claim, if any, has run out.
+func (r *NotificationRepository) GetUnsentEmails(now time.Time, maxAttempts, limit int) ([]models.Notification, error) {
+	var notifications []models.Notification
+	err := r.db.Where("email = ? AND emailed_at IS NULL AND email_attempts < ?", true, maxAttempts).
+		Where("email_claimed_until IS NULL OR email_claimed_until < ?", now).
+		Order("id asc").
+		Limit(limit).
+		Find(&notifications).Error
+	return notifications, err
+}
+
+// ClaimEmail takes the notification's email until until, unless another
+// claim is still running. It reports whether the claim was taken.
+func (r *NotificationRepository) ClaimEmail(id uint, now, until time.Time) (bool, error) {
+	result := r.db.Model(&models.Notification{}).
+		Where("id = ? AND emailed_at IS NULL", id).
+		Where("email_claimed_until IS NULL OR email_claimed_until < ?", now).
+		Update("email_claimed_until", until)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *NotificationRepository) MarkEmailed(id uint, now time.Time) error {
+	return r.db.Model(&models.Notification{}).Where("id = ?", id).Update("emailed_at", now).Error
+}
+
+// FailEmail counts a failed attempt at the notification's email and holds
+// off the next one until retryAt.
+func (r *NotificationRepository) FailEmail(id uint, retryAt time.Time) error {
+	return r.db.Model(&models.Notification{}).Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{
+			"email_attempts":      gorm.Expr("email_attempts + 1"),
+			"email_claimed_until": retryAt,
+		}).Error
+}
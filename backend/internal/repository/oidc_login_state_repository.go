@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+type OIDCLoginStateRepository struct {
+	db *gorm.DB
+}
+
+func NewOIDCLoginStateRepository(db *gorm.DB) *OIDCLoginStateRepository {
+	return &OIDCLoginStateRepository{db: db}
+}
+
+func (r *OIDCLoginStateRepository) Create(state *models.OIDCLoginState) error {
+	return r.db.Create(state).Error
+}
+
+// Consume deletes and returns the unexpired state, so each one can be used
+// at most once even with concurrent callbacks.
+func (r *OIDCLoginStateRepository) Consume(state string, now time.Time) (*models.OIDCLoginState, error) {
+	var record models.OIDCLoginState
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state = ? AND expires_at > ?", state, now).First(&record).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.OIDCLoginState{}, record.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *OIDCLoginStateRepository) DeleteExpired(now time.Time) error {
+	return r.db.Where("expires_at <= ?", now).Delete(&models.OIDCLoginState{}).Error
+}
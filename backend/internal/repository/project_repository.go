@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+type ProjectRepository struct {
+	db *gorm.DB
+}
+
+func NewProjectRepository(db *gorm.DB) *ProjectRepository {
+	return &ProjectRepository{db: db}
+}
+
+func (r *ProjectRepository) Create(project *models.Project, memberIDs []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Members").Create(project).Error; err != nil {
+			return err
+		}
+
+		if len(memberIDs) > 0 {
+			var members []models.User
+			if err := tx.Where("id IN ?", memberIDs).Find(&members).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(project).Association("Members").Append(members); err != nil {
+				return err
+			}
+			project.Members = members
+		}
+
+		return nil
+	})
+}
+
+func (r *ProjectRepository) GetList() ([]models.Project, error) {
+	var projects []models.Project
+	err := r.db.Preload("Lead").Preload("Members").Order("name asc").Find(&projects).Error
+	return projects, err
+}
+
+// GetIDsForUser returns the projects a user leads or is a member of.
+func (r *ProjectRepository) GetIDsForUser(userID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&models.Project{}).
+		Where("lead_id = ?", userID).
+		Or("id IN (SELECT project_id FROM project_members WHERE user_id = ?)", userID).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (r *ProjectRepository) GetByID(id uint) (*models.Project, error) {
+	var project models.Project
+	err := r.db.Preload("Lead").Preload("Members").First(&project, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &project, nil
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/ratelimit"
+)
+
+const rateLimitAttempts = 5
+
+var ErrRateLimitContention = errors.New("rate limit bucket is too contended")
+
+// RateLimitRepository is a ratelimit.Store backed by the database, so every
+// replica sees the same buckets. Updates are compare-and-swap on the
+// version column, which works without row locks on every dialect.
+type RateLimitRepository struct {
+	db *gorm.DB
+}
+
+func NewRateLimitRepository(db *gorm.DB) *RateLimitRepository {
+	return &RateLimitRepository{db: db}
+}
+
+func (r *RateLimitRepository) Take(key string, limit ratelimit.Limit, now time.Time) (bool, time.Duration, error) {
+	for attempt := 0; attempt < rateLimitAttempts; attempt++ {
+		var row models.RateLimitBucket
+		err := r.db.Where("bucket_key = ?", key).First(&row).Error
+		if err == gorm.ErrRecordNotFound {
+			bucket := ratelimit.NewBucket(limit, now)
+			allowed, retryAfter := bucket.Take(limit, now)
+			row = models.RateLimitBucket{BucketKey: key, Tokens: bucket.Tokens, RefilledAt: bucket.UpdatedAt}
+			if err := r.db.Create(&row).Error; err != nil {
+				// Another replica created the bucket first.
+				continue
+			}
+			return allowed, retryAfter, nil
+		}
+		if err != nil {
+			return false, 0, err
+		}
+
+		bucket := ratelimit.Bucket{Tokens: row.Tokens, UpdatedAt: row.RefilledAt}
+		allowed, retryAfter := bucket.Take(limit, now)
+
+		result := r.db.Model(&models.RateLimitBucket{}).
+			Where("bucket_key = ? AND version = ?", key, row.Version).
+			UpdateColumns(map[string]interface{}{
+				"tokens":      bucket.Tokens,
+				"refilled_at": bucket.UpdatedAt,
+				"version":     row.Version + 1,
+			})
+		if result.Error != nil {
+			return false, 0, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return allowed, retryAfter, nil
+		}
+	}
+	return false, 0, ErrRateLimitContention
+}
+
+// DeleteIdle removes buckets that have not been used since before.
+func (r *RateLimitRepository) DeleteIdle(before time.Time) (int64, error) {
+	result := r.db.Where("refilled_at < ?", before).Delete(&models.RateLimitBucket{})
+	return result.RowsAffected, result.Error
+}
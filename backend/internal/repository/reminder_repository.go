@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+type ReminderRepository struct {
+	db *gorm.DB
+}
+
+func NewReminderRepository(db *gorm.DB) *ReminderRepository {
+	return &ReminderRepository{db: db}
+}
+
+func (r *ReminderRepository) Create(reminder *models.Reminder) error {
+	return r.db.Create(reminder).Error
+}
+
+// GetForTodo returns the reminders userID set on a todo.
+func (r *ReminderRepository) GetForTodo(todoID, userID uint) ([]models.Reminder, error) {
+	var reminders []models.Reminder
+	err := r.db.Where("todo_id = ? AND user_id = ?", todoID, userID).Order("id asc").Find(&reminders).Error
+	return reminders, err
+}
+
+func (r *ReminderRepository) Delete(id, todoID, userID uint) (bool, error) {
+	result := r.db.Where("id = ? AND todo_id = ? AND user_id = ?", id, todoID, userID).Delete(&models.Reminder{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetDue returns the reminders that may go off in [from, to]: absolute ones
+// in the window, and relative ones on todos due in one of windows. The
+// bounds are loose; callers check Reminder.FireAt.
+func (r *ReminderRepository) GetDue(from, to time.Time, windows []DueWindow) ([]models.Reminder, error) {
+	var reminders []models.Reminder
+	query := r.db.Where("remind_at >= ? AND remind_at <= ?", from, to)
+	if len(windows) > 0 {
+		condition, args := dueWithin("due_date", windows)
+		query = query.Or("offset_seconds IS NOT NULL AND todo_id IN (SELECT id FROM todos WHERE ("+condition+") AND deleted_at IS NULL)", args...)
+	}
+	err := r.db.Where(query).Order("id asc").Find(&reminders).Error
+	return reminders, err
+}
+
+// GetOffsets returns the offsets relative reminders use, each once.
+func (r *ReminderRepository) GetOffsets() ([]int, error) {
+	var offsets []int
+	err := r.db.Model(&models.Reminder{}).
+		Where("offset_seconds IS NOT NULL").
+		Distinct().
+		Pluck("offset_seconds", &offsets).Error
+	return offsets, err
+}
+
+// GetReminderUsers returns, for each of todoIDs, the users who set
+// reminders on it.
+func (r *ReminderRepository) GetReminderUsers(todoIDs []uint) (map[uint]map[uint]bool, error) {
+	result := map[uint]map[uint]bool{}
+	if len(todoIDs) == 0 {
+		return result, nil
+	}
+
+	var reminders []models.Reminder
+	if err := r.db.Select("todo_id", "user_id").Where("todo_id IN (?)", todoIDs).Find(&reminders).Error; err != nil {
+		return nil, err
+	}
+	for _, reminder := range reminders {
+		if result[reminder.TodoID] == nil {
+			result[reminder.TodoID] = map[uint]bool{}
+		}
+		result[reminder.TodoID][reminder.UserID] = true
+	}
+	return result, nil
+}
+
+func (r *ReminderRepository) CreateRule(rule *models.ReminderRule) error {
+	return r.db.Create(rule).Error
+}
+
+func (r *ReminderRepository) GetRules(userID uint) ([]models.ReminderRule, error) {
+	var rules []models.ReminderRule
+	err := r.db.Where("user_id = ?", userID).Order("offset_seconds desc, id asc").Find(&rules).Error
+	return rules, err
+}
+
+// GetAllRules returns every user's rules, keyed by user.
+func (r *ReminderRepository) GetAllRules() (map[uint][]models.ReminderRule, error) {
+	var rules []models.ReminderRule
+	if err := r.db.Order("id asc").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	result := map[uint][]models.ReminderRule{}
+	for _, rule := range rules {
+		result[rule.UserID] = append(result[rule.UserID], rule)
+	}
+	return result, nil
+}
+
+func (r *ReminderRepository) DeleteRule(id, userID uint) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.ReminderRule{})
+	return result.RowsAffected > 0, result.Error
+}
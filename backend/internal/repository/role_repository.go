@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+type RoleRepository struct {
+	db *gorm.DB
+}
+
+func NewRoleRepository(db *gorm.DB) *RoleRepository {
+	return &RoleRepository{db: db}
+}
+
+func (r *RoleRepository) GetAll() ([]models.CustomRole, error) {
+	var roles []models.CustomRole
+	err := r.db.Order("name asc").Find(&roles).Error
+	return roles, err
+}
+
+func (r *RoleRepository) FindByName(name string) (*models.CustomRole, error) {
+	var role models.CustomRole
+	err := r.db.Where("name = ?", name).First(&role).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *RoleRepository) Create(role *models.CustomRole) error {
+	return r.db.Create(role).Error
+}
+
+func (r *RoleRepository) Update(role *models.CustomRole) error {
+	return r.db.Save(role).Error
+}
+
+func (r *RoleRepository) Delete(id uint) error {
+	return r.db.Delete(&models.CustomRole{}, id).Error
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+type SettingRepository struct {
+	db *gorm.DB
+}
+
+func NewSettingRepository(db *gorm.DB) *SettingRepository {
+	return &SettingRepository{db: db}
+}
+
+func (r *SettingRepository) GetAll() ([]models.Setting, error) {
+	var settings []models.Setting
+	err := r.db.Find(&settings).Error
+	return settings, err
+}
+
+// Set stores value under key, creating the setting if it does not exist.
+func (r *SettingRepository) Set(key, value string) error {
+	return r.db.Save(&models.Setting{Key: key, Value: value}).Error
+}
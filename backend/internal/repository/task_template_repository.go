@@ -50,8 +50,24 @@ func (r *TaskTemplateRepository) GetByID(id uint) (*models.TaskTemplate, error)
 	return &template, nil
 }
 
+// Update saves the template only if its version still matches the stored
+// one, bumping the version on success and returning
+// models.ErrVersionConflict otherwise.
 func (r *TaskTemplateRepository) Update(template *models.TaskTemplate) error {
-	return r.db.Save(template).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.TaskTemplate{}).
+			Where("id = ? AND version = ?", template.ID, template.Version).
+			UpdateColumn("version", gorm.Expr("version + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return models.ErrVersionConflict
+		}
+		template.Version++
+
+		return tx.Save(template).Error
+	})
 }
 
 func (r *TaskTemplateRepository) Delete(id uint) error {
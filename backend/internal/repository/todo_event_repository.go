@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+type TodoEventRepository struct {
+	db *gorm.DB
+}
+
+func NewTodoEventRepository(db *gorm.DB) *TodoEventRepository {
+	return &TodoEventRepository{db: db}
+}
+
+// Claim records the event unless the todo already has one with the same
+// key. It reports whether this call recorded it, which at most one caller
+// does.
+func (r *TodoEventRepository) Claim(event *models.TodoEvent) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "todo_id"}, {Name: "event_key"}},
+		DoNothing: true,
+	}).Create(event)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetForTodo returns the todo's history, oldest first.
+func (r *TodoEventRepository) GetForTodo(todoID uint) ([]models.TodoEvent, error) {
+	var events []models.TodoEvent
+	err := r.db.Where("todo_id = ?", todoID).Order("id asc").Find(&events).Error
+	return events, err
+}
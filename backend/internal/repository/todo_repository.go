@@ -2,6 +2,8 @@ package repository
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -16,6 +18,14 @@ func NewTodoRepository(db *gorm.DB) *TodoRepository {
 	return &TodoRepository{db: db}
 }
 
+// Transaction runs fn with a repository bound to a single database
+// transaction, rolling everything back if fn returns an error.
+func (r *TodoRepository) Transaction(fn func(repo *TodoRepository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&TodoRepository{db: tx})
+	})
+}
+
 func (r *TodoRepository) Create(todo *models.Todo, assigneeIDs []uint) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(todo).Error; err != nil {
@@ -56,10 +66,61 @@ func (r *TodoRepository) GetListByAdmin(statuses []string, sortBy, order string)
 	return todos, err
 }
 
+// TodoFilter narrows the list GetFiltered returns; zero fields do not
+// filter.
+type TodoFilter struct {
+	Statuses     []string
+	Open         bool
+	DueBefore    *time.Time
+	UpdatedSince *time.Time
+}
+
 func (r *TodoRepository) GetList(statuses []string, sortBy, order string, userID uint) ([]models.Todo, error) {
 
 	var todos []models.Todo
 
+	query := r.listQuery(statuses, userID)
+
+	if sortBy != "" {
+		if order == "desc" {
+			query = query.Order(fmt.Sprintf("%s desc", sortBy))
+		} else {
+			query = query.Order(fmt.Sprintf("%s asc", sortBy))
+		}
+	}
+
+	err := query.Find(&todos).Error
+
+	return todos, err
+}
+
+// GetFiltered returns the todos GetList would show userID, narrowed by
+// filter, in ID order.
+func (r *TodoRepository) GetFiltered(userID uint, filter TodoFilter) ([]models.Todo, error) {
+
+	var todos []models.Todo
+
+	query := r.listQuery(filter.Statuses, userID)
+
+	if filter.Open {
+		query = query.Where("status <> ?", "completed")
+	}
+	if filter.DueBefore != nil {
+		query = query.Where("due_date < ?", *filter.DueBefore)
+	}
+	if filter.UpdatedSince != nil {
+		query = query.Where("updated_at >= ?", *filter.UpdatedSince)
+	}
+
+	err := query.Order("id asc").Find(&todos).Error
+
+	return todos, err
+}
+
+// listQuery selects the todos with one of statuses that userID owns, is
+// assigned to or can see through a project, or every todo when userID is 0.
+func (r *TodoRepository) listQuery(statuses []string, userID uint) *gorm.DB {
+
 	query := r.db.Preload("Owner").Preload("Assignees")
 
 	if len(statuses) > 0 {
@@ -67,23 +128,212 @@ func (r *TodoRepository) GetList(statuses []string, sortBy, order string, userID
 	}
 
 	if userID != 0 {
-		query = query.Where("owner_id = ?", userID)
-		query = query.Or("id IN (SELECT todo_id FROM todo_assignees WHERE user_id = ?)", userID)
+		// Grouped so the status filter applies to every way of being related.
+		query = query.Where(r.db.
+			Where("owner_id = ?", userID).
+			Or("id IN (SELECT todo_id FROM todo_assignees WHERE user_id = ?)", userID).
+			Or("project_id IN (SELECT id FROM projects WHERE lead_id = ? AND deleted_at IS NULL)", userID).
+			Or("project_id IN (SELECT project_id FROM project_members WHERE user_id = ?)", userID))
 	}
 
-	if sortBy != "" {
-		if order == "desc" {
-			query = query.Order(fmt.Sprintf("%s desc", sortBy))
-		} else {
-			query = query.Order(fmt.Sprintf("%s asc", sortBy))
+	return query
+}
+
+// GetByOwnerOrAssignee returns the todos userID owns or is assigned to,
+// optionally narrowed to one project and a set of statuses.
+func (r *TodoRepository) GetByOwnerOrAssignee(userID uint, projectID *uint, statuses []string) ([]models.Todo, error) {
+
+	var todos []models.Todo
+
+	query := r.db.Preload("Owner").Preload("Assignees").
+		Where(r.db.
+			Where("owner_id = ?", userID).
+			Or("id IN (SELECT todo_id FROM todo_assignees WHERE user_id = ?)", userID))
+
+	if projectID != nil {
+		query = query.Where("project_id = ?", *projectID)
+	}
+	if len(statuses) > 0 {
+		query = query.Where("status IN (?)", statuses)
+	}
+
+	err := query.Order("id asc").Find(&todos).Error
+
+	return todos, err
+}
+
+// FindByCalDAVName returns the todo stored under a CalDAV resource name among
+// those userID owns or is assigned to, or nil if there is none.
+func (r *TodoRepository) FindByCalDAVName(userID uint, name string) (*models.Todo, error) {
+	var todo models.Todo
+	err := r.db.Preload("Owner").Preload("Assignees").
+		Where("caldav_name = ?", name).
+		Where(r.db.
+			Where("owner_id = ?", userID).
+			Or("id IN (SELECT todo_id FROM todo_assignees WHERE user_id = ?)", userID)).
+		First(&todo).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
 		}
+		return nil, err
 	}
+	return &todo, nil
+}
 
-	err := query.Find(&todos).Error
+// GetCalendar returns the todos that may overlap [from, to), filtered like
+// GetList when userID is set. The bounds are loose: callers narrow the result
+// with Todo.Overlaps.
+func (r *TodoRepository) GetCalendar(from, to time.Time, userID uint) ([]models.Todo, error) {
+
+	var todos []models.Todo
+
+	// All-day todos end a day after their due date, and blocks may run up to
+	// the longest estimate past their start.
+	var (
+		dueFrom   = from.Add(-48 * time.Hour)
+		blockFrom = from.Add(-models.MaxEstimatedDuration)
+	)
+
+	query := r.db.Preload("Owner").Preload("Assignees").
+		Where(r.db.
+			Where("scheduled_at < ?", to).
+			Or("start_at < ?", to).
+			Or("due_date < ?", to)).
+		Where(r.db.
+			Where("due_date >= ?", dueFrom).
+			Or("scheduled_at >= ?", blockFrom).
+			Or("start_at >= ?", blockFrom))
+
+	if userID != 0 {
+		query = query.Where(r.db.
+			Where("owner_id = ?", userID).
+			Or("id IN (SELECT todo_id FROM todo_assignees WHERE user_id = ?)", userID).
+			Or("project_id IN (SELECT id FROM projects WHERE lead_id = ? AND deleted_at IS NULL)", userID).
+			Or("project_id IN (SELECT project_id FROM project_members WHERE user_id = ?)", userID))
+	}
+
+	err := query.Order("id asc").Find(&todos).Error
+
+	return todos, err
+}
+
+// DueWindow is a span of due dates, both ends included.
+type DueWindow struct {
+	From, To time.Time
+}
+
+// dueWithin is the condition that column falls in one of windows.
+func dueWithin(column string, windows []DueWindow) (string, []interface{}) {
+	conditions := make([]string, 0, len(windows))
+	args := make([]interface{}, 0, 2*len(windows))
+	for _, window := range windows {
+		conditions = append(conditions, "("+column+" >= ? AND "+column+" <= ?)")
+		args = append(args, window.From, window.To)
+	}
+	return strings.Join(conditions, " OR "), args
+}
+
+// GetDueWithin returns the todos due in one of windows that are not
+// completed.
+func (r *TodoRepository) GetDueWithin(windows []DueWindow) ([]models.Todo, error) {
+
+	var todos []models.Todo
+	if len(windows) == 0 {
+		return todos, nil
+	}
+
+	condition, args := dueWithin("due_date", windows)
+	err := r.db.Preload("Owner").Preload("Assignees").
+		Where(condition, args...).
+		Where("status <> ?", "completed").
+		Order("id asc").
+		Find(&todos).Error
+
+	return todos, err
+}
+
+// GetByIDs returns the todos with the given IDs that still exist.
+func (r *TodoRepository) GetByIDs(ids []uint) ([]models.Todo, error) {
+
+	var todos []models.Todo
+	if len(ids) == 0 {
+		return todos, nil
+	}
+
+	err := r.db.Preload("Owner").Preload("Assignees").Where("id IN (?)", ids).Order("id asc").Find(&todos).Error
+
+	return todos, err
+}
+
+// GetOverdueCandidates returns the todos due before now that are not
+// completed and not yet marked overdue. All-day todos are due at the end of
+// their day, so callers check Todo.IsOverdue.
+func (r *TodoRepository) GetOverdueCandidates(now time.Time) ([]models.Todo, error) {
+
+	var todos []models.Todo
+
+	err := r.db.Where("due_date < ? AND overdue_at IS NULL", now).
+		Where("status <> ?", "completed").
+		Order("id asc").
+		Find(&todos).Error
+
+	return todos, err
+}
+
+// MarkOverdue sets the todo's OverdueAt unless it is already set, and
+// reports whether it did. Its escalation starts over, due at once. It leaves
+// the version alone: it is not an edit.
+func (r *TodoRepository) MarkOverdue(id uint, at time.Time) (bool, error) {
+	result := r.db.Model(&models.Todo{}).
+		Where("id = ? AND overdue_at IS NULL", id).
+		UpdateColumns(map[string]interface{}{
+			"overdue_at":         at,
+			"escalated_at":       nil,
+			"next_escalation_at": at,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetEscalationDue returns the overdue todos, not completed, whose next
+// escalation step has come due by now.
+func (r *TodoRepository) GetEscalationDue(now time.Time) ([]models.Todo, error) {
+
+	var todos []models.Todo
+
+	err := r.db.Preload("Owner").Preload("Assignees").
+		Where("overdue_at IS NOT NULL AND next_escalation_at <= ?", now).
+		Where("status <> ?", "completed").
+		Order("id asc").
+		Find(&todos).Error
 
 	return todos, err
 }
 
+// SetEscalation records that the todo's escalation steps were taken up to
+// at, and that the next one comes due at next, or never if it is nil. It
+// does nothing once the todo is no longer overdue since overdueAt.
+func (r *TodoRepository) SetEscalation(id uint, overdueAt, at time.Time, next *time.Time) error {
+	return r.db.Model(&models.Todo{}).
+		Where("id = ? AND overdue_at = ?", id, overdueAt).
+		UpdateColumns(map[string]interface{}{
+			"escalated_at":       at,
+			"next_escalation_at": next,
+		}).Error
+}
+
+// RescheduleEscalations has every overdue todo go through all the
+// escalation steps again on the next run, for when the rules change. Steps
+// already taken are not repeated, as they are claimed through unique keys.
+func (r *TodoRepository) RescheduleEscalations() error {
+	return r.db.Model(&models.Todo{}).
+		Where("overdue_at IS NOT NULL").
+		UpdateColumns(map[string]interface{}{
+			"escalated_at":       nil,
+			"next_escalation_at": gorm.Expr("overdue_at"),
+		}).Error
+}
+
 func (r *TodoRepository) GetByID(id uint) (*models.Todo, error) {
 	var todo models.Todo
 	err := r.db.Preload("Owner").Preload("Assignees").First(&todo, id).Error
@@ -96,8 +346,22 @@ func (r *TodoRepository) GetByID(id uint) (*models.Todo, error) {
 	return &todo, nil
 }
 
+// Update saves the todo only if its version still matches the stored one,
+// bumping the version on success and returning models.ErrVersionConflict
+// otherwise.
 func (r *TodoRepository) Update(todo *models.Todo) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Todo{}).
+			Where("id = ? AND version = ?", todo.ID, todo.Version).
+			UpdateColumn("version", gorm.Expr("version + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return models.ErrVersionConflict
+		}
+		todo.Version++
+
 		if err := tx.Save(todo).Error; err != nil {
 			return err
 		}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 
 	"github.com/harrisin2037/todoapp/internal/models"
@@ -14,6 +16,12 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
+func (r *UserRepository) Transaction(fn func(repo *UserRepository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&UserRepository{db: tx})
+	})
+}
+
 func (r *UserRepository) Create(user *models.User) error {
 	return r.db.Create(user).Error
 }
@@ -24,6 +32,12 @@ func (r *UserRepository) GetUsersByIDs(ids []uint) ([]models.User, error) {
 	return users, err
 }
 
+func (r *UserRepository) GetUsersByUsernames(usernames []string) ([]models.User, error) {
+	var users []models.User
+	err := r.db.Where("username IN ?", usernames).Find(&users).Error
+	return users, err
+}
+
 func (r *UserRepository) FindByUsername(username string) (*models.User, error) {
 	var user models.User
 	err := r.db.Where("username = ?", username).First(&user).Error
@@ -42,10 +56,128 @@ func (r *UserRepository) FindByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
+// FindByOIDCIdentity returns the user linked to a single sign-on account.
+func (r *UserRepository) FindByOIDCIdentity(issuer, subject string) (*models.User, error) {
+	var user models.User
+	err := r.db.Where("oidc_issuer = ? AND oidc_subject = ?", issuer, subject).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// LinkOIDCIdentity links the user to a single sign-on account unless they
+// are linked to one already, and reports whether it did.
+func (r *UserRepository) LinkOIDCIdentity(userID uint, issuer, subject string) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND oidc_subject IS NULL", userID).
+		UpdateColumns(map[string]interface{}{"oidc_issuer": issuer, "oidc_subject": subject})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *UserRepository) CountByRole(role models.Role) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.User{}).Where("role = ?", role).Count(&count).Error
+	return count, err
+}
+
 func (r *UserRepository) UpdateRole(userID uint, role models.Role) error {
 	return r.db.Model(&models.User{}).Where("id = ?", userID).Update("role", role).Error
 }
 
+// IncrementTokenVersion invalidates every access token issued to the user
+// so far.
+func (r *UserRepository) IncrementTokenVersion(userID uint) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error
+}
+
+// RecordLoginFailure counts a failed login attempt and returns the new
+// number of consecutive failures.
+func (r *UserRepository) RecordLoginFailure(userID uint) (int, error) {
+	err := r.db.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumn("failed_login_attempts", gorm.Expr("failed_login_attempts + 1")).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var user models.User
+	err = r.db.Select("failed_login_attempts").Where("id = ?", userID).First(&user).Error
+	return user.FailedLoginAttempts, err
+}
+
+func (r *UserRepository) LockUntil(userID uint, until time.Time) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumn("locked_until", until).Error
+}
+
+// ResetLoginFailures clears the failure count and any lock.
+func (r *UserRepository) ResetLoginFailures(userID uint) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"failed_login_attempts": 0,
+		"locked_until":          nil,
+	}).Error
+}
+
+// MarkEmailVerified records that the user proved they own email. Nothing
+// happens if the address was changed in the meantime.
+func (r *UserRepository) MarkEmailVerified(userID uint, email string, now time.Time) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND email = ?", userID, email).
+		UpdateColumn("email_verified_at", now)
+	return result.RowsAffected > 0, result.Error
+}
+
+// SetTOTP stores the TOTP secret and whether it is enabled. An empty secret
+// turns two-factor authentication off.
+func (r *UserRepository) SetTOTP(userID uint, secret string, enabled bool, counter int64) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"totp_secret":       secret,
+		"totp_enabled":      enabled,
+		"totp_last_counter": counter,
+	}).Error
+}
+
+// UseTOTPCounter records that a code for the given time step was accepted.
+// It returns false when that step or a later one was already used.
+func (r *UserRepository) UseTOTPCounter(userID uint, counter int64) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_counter < ?", userID, counter).
+		UpdateColumn("totp_last_counter", counter)
+	return result.RowsAffected > 0, result.Error
+}
+
+// SetDigest sets how often the user gets the digest email; an empty
+// frequency turns it off.
+func (r *UserRepository) SetDigest(userID uint, frequency string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumn("digest_frequency", frequency).Error
+}
+
+// GetDigestSubscribers returns the active users who get a digest.
+func (r *UserRepository) GetDigestSubscribers() ([]models.User, error) {
+	var users []models.User
+	err := r.db.Where("digest_frequency <> '' AND deactivated_at IS NULL").Order("id asc").Find(&users).Error
+	return users, err
+}
+
+// ClaimDigest records that the user's digest for period is being sent. It
+// returns false when it already was, including by a concurrent caller.
+func (r *UserRepository) ClaimDigest(userID uint, period string) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND digest_sent_for <> ?", userID, period).
+		UpdateColumn("digest_sent_for", period)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReleaseDigest undoes ClaimDigest, so a digest that could not be sent is
+// tried again.
+func (r *UserRepository) ReleaseDigest(userID uint, period, previous string) error {
+	return r.db.Model(&models.User{}).
+		Where("id = ? AND digest_sent_for = ?", userID, period).
+		UpdateColumn("digest_sent_for", previous).Error
+}
+
 func (r *UserRepository) FindByID(userID uint) (*models.User, error) {
 	var user models.User
 	err := r.db.Where("id = ?", userID).First(&user).Error
@@ -82,6 +214,78 @@ func (r *UserRepository) Update(user *models.User) error {
 	return err
 }
 
+// SetDeactivatedAt deactivates a user, or reactivates them when at is nil.
+func (r *UserRepository) SetDeactivatedAt(userID uint, at *time.Time) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).Update("deactivated_at", at).Error
+}
+
+// CountOwned returns how many todos and task templates a user owns.
+// UpdateProfile sets the given profile columns of a user.
+func (r *UserRepository) UpdateProfile(userID uint, fields map[string]interface{}) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).Updates(fields).Error
+}
+
+func (r *UserRepository) GetAvatar(userID uint) (*models.Avatar, error) {
+	var avatar models.Avatar
+	err := r.db.Where("user_id = ?", userID).First(&avatar).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &avatar, nil
+}
+
+// SaveAvatar replaces a user's avatar and records when it changed.
+func (r *UserRepository) SaveAvatar(avatar *models.Avatar) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(avatar).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", avatar.UserID).
+			Update("avatar_updated_at", avatar.UpdatedAt).Error
+	})
+}
+
+func (r *UserRepository) DeleteAvatar(userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.Avatar{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).
+			Update("avatar_updated_at", nil).Error
+	})
+}
+
+func (r *UserRepository) CountOwned(userID uint) (int64, int64, error) {
+	var todos, templates int64
+	if err := r.db.Model(&models.Todo{}).Where("owner_id = ?", userID).Count(&todos).Error; err != nil {
+		return 0, 0, err
+	}
+	if err := r.db.Model(&models.TaskTemplate{}).Where("owner_id = ?", userID).Count(&templates).Error; err != nil {
+		return 0, 0, err
+	}
+	return todos, templates, nil
+}
+
+// TransferOwnership makes toID the owner of every todo and task template
+// fromID owns and returns how many of each were moved. Versions are bumped
+// so clients holding an old ETag notice the change.
+func (r *UserRepository) TransferOwnership(fromID, toID uint) (int64, int64, error) {
+	changes := map[string]interface{}{"owner_id": toID, "version": gorm.Expr("version + 1")}
+
+	todos := r.db.Model(&models.Todo{}).Where("owner_id = ?", fromID).Updates(changes)
+	if todos.Error != nil {
+		return 0, 0, todos.Error
+	}
+	templates := r.db.Model(&models.TaskTemplate{}).Where("owner_id = ?", fromID).Updates(changes)
+	if templates.Error != nil {
+		return 0, 0, templates.Error
+	}
+	return todos.RowsAffected, templates.RowsAffected, nil
+}
+
 func (r *UserRepository) Delete(userID uint) error {
 	return r.db.Delete(&models.User{}, userID).Error
 }
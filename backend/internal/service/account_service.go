@@ -0,0 +1,199 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/mailer"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+)
+
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+)
+
+var (
+	ErrInvalidAccountToken  = errors.New("invalid or expired token")
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+)
+
+// AccountService runs the flows that prove ownership of an email address:
+// verifying it after registration and resetting a forgotten password.
+type AccountService struct {
+	repo      *repository.AccountTokenRepository
+	userRepo  *repository.UserRepository
+	tokens    *TokenService
+	mailer    mailer.Mailer
+	verifyURL string
+	resetURL  string
+}
+
+// NewAccountService sends links to verifyURL and resetURL with the token
+// appended as the "token" query parameter.
+func NewAccountService(repo *repository.AccountTokenRepository, userRepo *repository.UserRepository, tokens *TokenService, mailer mailer.Mailer, verifyURL, resetURL string) *AccountService {
+	return &AccountService{
+		repo:      repo,
+		userRepo:  userRepo,
+		tokens:    tokens,
+		mailer:    mailer,
+		verifyURL: verifyURL,
+		resetURL:  resetURL,
+	}
+}
+
+func (s *AccountService) SendEmailVerification(user *models.User) error {
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	now := time.Now()
+	if err := s.repo.InvalidateForUser(user.ID, models.AccountTokenEmailVerification, now); err != nil {
+		return err
+	}
+
+	token, err := s.issue(user, models.AccountTokenEmailVerification, now.Add(emailVerificationTTL))
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Verify your email address",
+		Text: fmt.Sprintf("Hi %s,\n\nplease confirm your email address by opening this link:\n\n%s\n\nThe link expires in %s.\n",
+			user.Username, withToken(s.verifyURL, token), formatTTL(emailVerificationTTL)),
+	})
+}
+
+// VerifyEmail marks the address the token was sent to as verified and
+// returns its user.
+func (s *AccountService) VerifyEmail(rawToken string) (*models.User, error) {
+	now := time.Now()
+
+	token, err := s.repo.Consume(hashToken(rawToken), models.AccountTokenEmailVerification, now)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, ErrInvalidAccountToken
+	}
+
+	verified, err := s.userRepo.MarkEmailVerified(token.UserID, token.Email, now)
+	if err != nil {
+		return nil, err
+	}
+	if !verified {
+		return nil, ErrInvalidAccountToken
+	}
+	return s.userRepo.FindByID(token.UserID)
+}
+
+// ForgotPassword mails a reset link if email belongs to a user. Unknown
+// addresses are ignored silently so the endpoint cannot be used to find out
+// who has an account.
+func (s *AccountService) ForgotPassword(email string) error {
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil || user.IsDeactivated() {
+		return nil
+	}
+
+	now := time.Now()
+	if err := s.repo.InvalidateForUser(user.ID, models.AccountTokenPasswordReset, now); err != nil {
+		return err
+	}
+
+	token, err := s.issue(user, models.AccountTokenPasswordReset, now.Add(passwordResetTTL))
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Reset your password",
+		Text: fmt.Sprintf("Hi %s,\n\nsomeone asked to reset the password of your account. If it was you, open this link to choose a new one:\n\n%s\n\nThe link expires in %s. If you did not ask for this, you can ignore this email.\n",
+			user.Username, withToken(s.resetURL, token), formatTTL(passwordResetTTL)),
+	})
+}
+
+// ResetPassword sets a new password and signs the user out everywhere.
+// Following the link also proves the user owns the address.
+func (s *AccountService) ResetPassword(rawToken, password string) (*models.User, error) {
+	now := time.Now()
+
+	token, err := s.repo.Consume(hashToken(rawToken), models.AccountTokenPasswordReset, now)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, ErrInvalidAccountToken
+	}
+
+	user, err := s.userRepo.FindByID(token.UserID)
+	if err != nil || user.Email != token.Email {
+		return nil, ErrInvalidAccountToken
+	}
+
+	if err := user.SetPassword(password); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.userRepo.MarkEmailVerified(user.ID, user.Email, now); err != nil {
+		return nil, err
+	}
+	if err := s.repo.InvalidateForUser(user.ID, models.AccountTokenPasswordReset, now); err != nil {
+		return nil, err
+	}
+	return user, s.tokens.RevokeUser(user.ID)
+}
+
+func (s *AccountService) issue(user *models.User, purpose string, expiresAt time.Time) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.repo.Create(&models.AccountToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		TokenHash: hashToken(token),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func withToken(link, token string) string {
+	separator := "?"
+	if strings.Contains(link, "?") {
+		separator = "&"
+	}
+	return link + separator + "token=" + url.QueryEscape(token)
+}
+
+func formatTTL(ttl time.Duration) string {
+	if ttl%(24*time.Hour) == 0 {
+		days := ttl / (24 * time.Hour)
+		if days == 1 {
+			return "1 day"
+		}
+		return fmt.Sprintf("%d days", days)
+	}
+	if ttl%time.Hour == 0 {
+		hours := ttl / time.Hour
+		if hours == 1 {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%d hours", hours)
+	}
+	return ttl.String()
+}
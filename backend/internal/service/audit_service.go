@@ -0,0 +1,51 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+)
+
+const auditExportBatchSize = 500
+
+type AuditService struct {
+	repo *repository.AuditRepository
+}
+
+func NewAuditService(repo *repository.AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record appends event to the audit log. A failure to write it is logged but
+// does not fail the action that was audited. A nil service records nothing.
+func (s *AuditService) Record(event *models.AuditEvent) {
+	if s == nil {
+		return
+	}
+	if event.Outcome == "" {
+		event.Outcome = models.AuditSuccess
+	}
+	if err := s.repo.Create(event); err != nil {
+		log.Printf("Failed to record audit event %s: %v", event.Action, err)
+	}
+}
+
+func (s *AuditService) List(filter repository.AuditFilter, limit, offset int) ([]models.AuditEvent, int64, error) {
+	return s.repo.List(filter, limit, offset)
+}
+
+// Export writes the matching events to w as JSON Lines, oldest first.
+func (s *AuditService) Export(filter repository.AuditFilter, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	return s.repo.Each(filter, auditExportBatchSize, func(events []models.AuditEvent) error {
+		for i := range events {
+			if err := encoder.Encode(&events[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+)
+
+var (
+	ErrCalendarFeedNotFound = errors.New("calendar feed not found")
+	ErrInvalidFeedToken     = errors.New("invalid calendar feed token")
+)
+
+// CalendarFeedFilter narrows a feed to one project and a set of statuses.
+type CalendarFeedFilter struct {
+	ProjectID *uint
+	Statuses  []string
+}
+
+type CalendarFeedService struct {
+	repo     *repository.CalendarFeedRepository
+	userRepo *repository.UserRepository
+	todoRepo *repository.TodoRepository
+}
+
+func NewCalendarFeedService(repo *repository.CalendarFeedRepository, userRepo *repository.UserRepository, todoRepo *repository.TodoRepository) *CalendarFeedService {
+	return &CalendarFeedService{repo: repo, userRepo: userRepo, todoRepo: todoRepo}
+}
+
+// GetFeed returns the user's feed, or nil when they have none.
+func (s *CalendarFeedService) GetFeed(userID uint) (*models.CalendarFeed, error) {
+	return s.repo.GetByUserID(userID)
+}
+
+// Rotate creates the user's feed, or replaces it so the old link stops
+// working. The secret is returned only here.
+func (s *CalendarFeedService) Rotate(userID uint) (*models.CalendarFeed, string, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secret = models.CalendarFeedTokenPrefix + secret
+
+	feed := &models.CalendarFeed{
+		UserID:    userID,
+		TokenHash: hashToken(secret),
+		Hint:      secret[:len(models.CalendarFeedTokenPrefix)+4],
+	}
+	if err := s.repo.Replace(feed); err != nil {
+		return nil, "", err
+	}
+	return feed, secret, nil
+}
+
+func (s *CalendarFeedService) Disable(userID uint) error {
+	deleted, err := s.repo.Delete(userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrCalendarFeedNotFound
+	}
+	return nil
+}
+
+// Resolve returns the user a feed secret belongs to. Feeds of deactivated
+// users stop working without being deleted.
+func (s *CalendarFeedService) Resolve(secret string) (*models.User, error) {
+	feed, err := s.repo.FindByHash(hashToken(secret))
+	if err != nil {
+		return nil, err
+	}
+	if feed == nil {
+		return nil, ErrInvalidFeedToken
+	}
+
+	user, err := s.userRepo.FindByID(feed.UserID)
+	if err != nil || user == nil || user.IsDeactivated() {
+		return nil, ErrInvalidFeedToken
+	}
+
+	now := time.Now()
+	if feed.LastUsedAt == nil || now.Sub(*feed.LastUsedAt) > lastUsedResolution {
+		if err := s.repo.TouchLastUsed(feed.ID, now); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// Todos returns the todos a user's feed shows: those they own or are
+// assigned to.
+func (s *CalendarFeedService) Todos(userID uint, filter CalendarFeedFilter) ([]models.Todo, error) {
+	return s.todoRepo.GetByOwnerOrAssignee(userID, filter.ProjectID, filter.Statuses)
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/digest"
+	"github.com/harrisin2037/todoapp/internal/mailer"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+)
+
+// digestUnsubscribeTTL is how long the unsubscribe link of a digest works.
+const digestUnsubscribeTTL = 60 * 24 * time.Hour
+
+// DigestService sends users who opted in a daily or weekly email of what is
+// due, what is overdue, what was assigned to them and what changed on the
+// todos in their list.
+type DigestService struct {
+	todoRepo       *repository.TodoRepository
+	userRepo       *repository.UserRepository
+	tokenRepo      *repository.AccountTokenRepository
+	mailer         mailer.Mailer
+	appURL         string
+	unsubscribeURL string
+}
+
+// NewDigestService links digests to appURL, the frontend, and to
+// unsubscribeURL with a token appended as the "token" query parameter.
+func NewDigestService(todoRepo *repository.TodoRepository, userRepo *repository.UserRepository, tokenRepo *repository.AccountTokenRepository, mailer mailer.Mailer, appURL, unsubscribeURL string) *DigestService {
+	return &DigestService{
+		todoRepo:       todoRepo,
+		userRepo:       userRepo,
+		tokenRepo:      tokenRepo,
+		mailer:         mailer,
+		appURL:         appURL,
+		unsubscribeURL: unsubscribeURL,
+	}
+}
+
+// SetFrequency subscribes the user to the daily or weekly digest, or
+// unsubscribes them when frequency is "off" or empty.
+func (s *DigestService) SetFrequency(userID uint, frequency string) error {
+	if frequency == "off" {
+		frequency = ""
+	}
+	if frequency != "" && !models.IsValidDigestFrequency(frequency) {
+		return models.ErrInvalidDigestFrequency
+	}
+	return s.userRepo.SetDigest(userID, frequency)
+}
+
+// Preview builds the digest of frequency the user would get now, whether or
+// not they subscribed. Its unsubscribe link carries no token.
+func (s *DigestService) Preview(userID uint, frequency string, now time.Time) (*digest.Digest, error) {
+	if !models.IsValidDigestFrequency(frequency) {
+		return nil, models.ErrInvalidDigestFrequency
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.build(user, frequency, now, s.unsubscribeURL)
+}
+
+// Send mails every subscriber whose digest has come due by now: each day, or
+// on the first day of their week, from DigestHour in their own time zone.
+// Each digest is claimed on the user's row before it is sent, so running
+// Send on several replicas at once mails it once. Digests with nothing to
+// say are skipped, and one that fails to send is logged and left for the
+// next run. It returns how many were sent.
+func (s *DigestService) Send(now time.Time) (int, error) {
+	users, err := s.userRepo.GetDigestSubscribers()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range users {
+		user := &users[i]
+		period, ok := digestPeriod(user, now)
+		if !ok || user.DigestSentFor == period {
+			continue
+		}
+		claimed, err := s.userRepo.ClaimDigest(user.ID, period)
+		if err != nil {
+			return sent, err
+		}
+		if !claimed {
+			continue
+		}
+
+		ok, err = s.send(user, now)
+		if err != nil {
+			// Let the next run try again, without holding up everyone else.
+			log.Printf("Failed to send the digest to user %d: %v", user.ID, err)
+			if err := s.userRepo.ReleaseDigest(user.ID, period, user.DigestSentFor); err != nil {
+				log.Printf("Failed to release the digest of user %d: %v", user.ID, err)
+			}
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+func (s *DigestService) send(user *models.User, now time.Time) (bool, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return false, err
+	}
+
+	unsubscribeURL := withToken(s.unsubscribeURL, token)
+	d, err := s.build(user, user.DigestFrequency, now, unsubscribeURL)
+	if err != nil || d.Empty() {
+		return false, err
+	}
+	text, html, err := digest.Render(d)
+	if err != nil {
+		return false, err
+	}
+
+	err = s.tokenRepo.Create(&models.AccountToken{
+		UserID:    user.ID,
+		Purpose:   models.AccountTokenDigestUnsubscribe,
+		Email:     user.Email,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(digestUnsubscribeTTL),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, s.mailer.Send(mailer.Message{
+		To:          []string{user.Email},
+		Subject:     d.Title + " for " + d.Date,
+		Text:        text,
+		HTML:        html,
+		Unsubscribe: unsubscribeURL,
+	})
+}
+
+// Unsubscribe turns off the digest of the user an unsubscribe link was sent
+// to and returns them.
+func (s *DigestService) Unsubscribe(rawToken string) (*models.User, error) {
+	token, err := s.tokenRepo.Consume(hashToken(rawToken), models.AccountTokenDigestUnsubscribe, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, ErrInvalidAccountToken
+	}
+
+	if err := s.userRepo.SetDigest(token.UserID, ""); err != nil {
+		return nil, err
+	}
+	return s.userRepo.FindByID(token.UserID)
+}
+
+// build gathers the user's digest from the todos in their list. Each todo
+// shows up once, under the first section it belongs to.
+func (s *DigestService) build(user *models.User, frequency string, now time.Time, unsubscribeURL string) (*digest.Digest, error) {
+	loc := user.Location()
+	local := now.In(loc)
+
+	days, title, dueTitle := 1, "Your daily digest", "Due today"
+	if frequency == models.DigestWeekly {
+		days, title, dueTitle = 7, "Your weekly digest", "Due this week"
+	}
+	dayStart := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	dueEnd := dayStart.AddDate(0, 0, days)
+	since := now.AddDate(0, 0, -days)
+
+	open, err := s.todoRepo.GetFiltered(user.ID, repository.TodoFilter{Open: true, DueBefore: &dueEnd})
+	if err != nil {
+		return nil, err
+	}
+	changed, err := s.todoRepo.GetFiltered(user.ID, repository.TodoFilter{UpdatedSince: &since})
+	if err != nil {
+		return nil, err
+	}
+
+	overdue := digest.Section{Title: "Overdue"}
+	due := digest.Section{Title: dueTitle}
+	assigned := digest.Section{Title: "Assigned to you"}
+	updated := digest.Section{Title: "Changed"}
+	listed := map[uint]bool{}
+
+	for i := range open {
+		todo := &open[i]
+		item := digest.Item{Name: todo.Name, Detail: dueText(todo, loc)}
+		switch {
+		case todo.IsOverdue(now):
+			overdue.Items = append(overdue.Items, item)
+		case !todo.AllDay || todo.DueLocalDate() < dueEnd.Format(time.DateOnly):
+			due.Items = append(due.Items, item)
+		default:
+			continue
+		}
+		listed[todo.ID] = true
+	}
+
+	for i := range changed {
+		todo := &changed[i]
+		if listed[todo.ID] {
+			continue
+		}
+		if todo.OwnerID != user.ID && todo.Status != "completed" && isAssignee(todo, user.ID) {
+			assigned.Items = append(assigned.Items, digest.Item{
+				Name:   todo.Name,
+				Detail: "From " + todo.Owner.Username + ". " + dueText(todo, loc),
+			})
+			continue
+		}
+		updated.Items = append(updated.Items, digest.Item{
+			Name:   todo.Name,
+			Detail: "Now " + strings.ReplaceAll(todo.Status, "_", " "),
+		})
+	}
+
+	name := user.DisplayName
+	if name == "" {
+		name = user.Username
+	}
+
+	return &digest.Digest{
+		Name:           name,
+		Title:          title,
+		Date:           local.Format("Mon, Jan 2 2006"),
+		Sections:       []digest.Section{overdue, due, assigned, updated},
+		AppURL:         s.appURL,
+		UnsubscribeURL: unsubscribeURL,
+	}, nil
+}
+
+func isAssignee(todo *models.Todo, userID uint) bool {
+	for _, assignee := range todo.Assignees {
+		if assignee.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// digestPeriod names the period whose digest the user should have by now,
+// or reports false when none is due yet today.
+func digestPeriod(user *models.User, now time.Time) (string, bool) {
+	local := now.In(user.Location())
+	if local.Hour() < models.DigestHour {
+		return "", false
+	}
+	switch user.DigestFrequency {
+	case models.DigestDaily:
+		return "daily:" + local.Format(time.DateOnly), true
+	case models.DigestWeekly:
+		if int(local.Weekday()) != user.WeekStart {
+			return "", false
+		}
+		return "weekly:" + local.Format(time.DateOnly), true
+	}
+	return "", false
+}
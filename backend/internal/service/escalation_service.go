@@ -0,0 +1,237 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+)
+
+var ErrEscalationRuleNotFound = errors.New("escalation rule not found")
+
+// EscalationService marks todos overdue and, following the rules admins set
+// up, tells more and more people about those that stay overdue. Each step is
+// recorded in the todo's history.
+type EscalationService struct {
+	repo          *repository.EscalationRepository
+	eventRepo     *repository.TodoEventRepository
+	todoRepo      *repository.TodoRepository
+	userRepo      *repository.UserRepository
+	projectRepo   *repository.ProjectRepository
+	notifications *NotificationService
+}
+
+func NewEscalationService(repo *repository.EscalationRepository, eventRepo *repository.TodoEventRepository, todoRepo *repository.TodoRepository, userRepo *repository.UserRepository, projectRepo *repository.ProjectRepository, notifications *NotificationService) *EscalationService {
+	return &EscalationService{
+		repo:          repo,
+		eventRepo:     eventRepo,
+		todoRepo:      todoRepo,
+		userRepo:      userRepo,
+		projectRepo:   projectRepo,
+		notifications: notifications,
+	}
+}
+
+func (s *EscalationService) GetRules() ([]models.EscalationRule, error) {
+	return s.repo.GetList()
+}
+
+func (s *EscalationService) GetRule(id uint) (*models.EscalationRule, error) {
+	rule, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if rule == nil {
+		return nil, ErrEscalationRuleNotFound
+	}
+	return rule, nil
+}
+
+func (s *EscalationService) CreateRule(rule *models.EscalationRule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	if err := s.repo.Create(rule); err != nil {
+		return err
+	}
+	return s.todoRepo.RescheduleEscalations()
+}
+
+func (s *EscalationService) UpdateRule(rule *models.EscalationRule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	if err := s.repo.Update(rule); err != nil {
+		return err
+	}
+	return s.todoRepo.RescheduleEscalations()
+}
+
+func (s *EscalationService) DeleteRule(id uint) error {
+	deleted, err := s.repo.Delete(id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrEscalationRuleNotFound
+	}
+	return nil
+}
+
+// History returns the todo's history, oldest first.
+func (s *EscalationService) History(todoID uint) ([]models.TodoEvent, error) {
+	return s.eventRepo.GetForTodo(todoID)
+}
+
+// Run marks the todos that became overdue by now, then takes the overdue
+// todos whose next escalation step has come due through the steps they have
+// not been through yet. Like reminders, the history entries and
+// notifications are claimed through unique keys that include the due date,
+// so Run can go on several replicas at once and a todo whose due date moves
+// is escalated afresh. It returns how many todos it marked and how many
+// steps it took.
+func (s *EscalationService) Run(now time.Time) (int, int, error) {
+	marked, err := s.markOverdue(now)
+	if err != nil {
+		return marked, 0, err
+	}
+
+	rules, err := s.repo.GetList()
+	if err != nil || len(rules) == 0 {
+		return marked, 0, err
+	}
+
+	todos, err := s.todoRepo.GetEscalationDue(now)
+	if err != nil {
+		return marked, 0, err
+	}
+
+	escalated := 0
+	for i := range todos {
+		todo := &todos[i]
+		var next *time.Time
+		for _, rule := range rules {
+			at := todo.OverdueAt.Add(time.Duration(rule.After) * time.Second)
+			if now.Before(at) {
+				next = &at
+				break
+			}
+			if todo.EscalatedAt != nil && !at.After(*todo.EscalatedAt) {
+				continue
+			}
+			ok, err := s.escalate(todo, rule)
+			if err != nil {
+				return marked, escalated, err
+			}
+			if ok {
+				escalated++
+			}
+		}
+		if err := s.todoRepo.SetEscalation(todo.ID, *todo.OverdueAt, now, next); err != nil {
+			return marked, escalated, err
+		}
+	}
+	return marked, escalated, nil
+}
+
+func (s *EscalationService) markOverdue(now time.Time) (int, error) {
+	todos, err := s.todoRepo.GetOverdueCandidates(now)
+	if err != nil {
+		return 0, err
+	}
+
+	marked := 0
+	for _, todo := range todos {
+		if !todo.IsOverdue(now) {
+			continue
+		}
+		at := *todo.DueEnd()
+		if _, err := s.eventRepo.Claim(&models.TodoEvent{
+			TodoID: todo.ID,
+			Key:    fmt.Sprintf("overdue:%d", at.Unix()),
+			Kind:   models.TodoEventOverdue,
+			Detail: "Marked overdue",
+		}); err != nil {
+			return marked, err
+		}
+		ok, err := s.todoRepo.MarkOverdue(todo.ID, at)
+		if err != nil {
+			return marked, err
+		}
+		if ok {
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+// escalate notifies the people the rule names about the todo, unless the
+// step was already taken for its current due date, and records it.
+func (s *EscalationService) escalate(todo *models.Todo, rule models.EscalationRule) (bool, error) {
+	overdueAt := todo.OverdueAt.Unix()
+
+	recipients, err := s.recipients(todo, rule.Notify)
+	if err != nil || len(recipients) == 0 {
+		return false, err
+	}
+
+	delay := "as soon as it was overdue"
+	if rule.After > 0 {
+		delay = "after " + formatTTL(time.Duration(rule.After)*time.Second) + " overdue"
+	}
+
+	todoID := todo.ID
+	names := make([]string, 0, len(recipients))
+	for _, user := range recipients {
+		names = append(names, user.Username)
+		if _, err := s.notifications.Notify(&models.Notification{
+			UserID: user.ID,
+			TodoID: &todoID,
+			Kind:   models.NotificationEscalation,
+			Key:    fmt.Sprintf("escalation:%d:%d:%d:%d", rule.ID, todo.ID, overdueAt, user.ID),
+			Title:  "Overdue: " + todo.Name,
+			Body:   "Was due " + todo.OverdueAt.In(user.Location()).Format("Mon, Jan 2 2006 15:04 MST"),
+			Email:  rule.Email,
+		}); err != nil {
+			return false, err
+		}
+	}
+
+	return s.eventRepo.Claim(&models.TodoEvent{
+		TodoID: todo.ID,
+		Key:    fmt.Sprintf("escalation:%d:%d", rule.ID, overdueAt),
+		Kind:   models.TodoEventEscalated,
+		Detail: fmt.Sprintf("Notified the %s (%s) %s", strings.ReplaceAll(rule.Notify, "_", " "), strings.Join(names, ", "), delay),
+	})
+}
+
+// recipients returns the active users a rule notifies about the todo.
+func (s *EscalationService) recipients(todo *models.Todo, notify string) ([]models.User, error) {
+	var users []models.User
+	switch notify {
+	case models.EscalateOwner:
+		users = []models.User{todo.Owner}
+	case models.EscalateAssignees:
+		users = todo.Assignees
+	case models.EscalateProjectLead:
+		if todo.ProjectID == nil {
+			return nil, nil
+		}
+		project, err := s.projectRepo.GetByID(*todo.ProjectID)
+		if err != nil || project == nil {
+			return nil, err
+		}
+		users = []models.User{project.Lead}
+	}
+
+	active := []models.User{}
+	for _, user := range users {
+		if user.ID != 0 && !user.IsDeactivated() {
+			active = append(active, user)
+		}
+	}
+	return active, nil
+}
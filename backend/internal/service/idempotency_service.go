@@ -0,0 +1,94 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+)
+
+// idempotencyPendingTTL is how long a key stays claimed by a request that is
+// still being processed. A replica that dies mid-request leaves its record
+// pending; once this runs out the client may retry the key.
+const idempotencyPendingTTL = 5 * time.Minute
+
+var (
+	ErrIdempotencyKeyReused     = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still being processed")
+)
+
+type IdempotencyService struct {
+	repo *repository.IdempotencyRepository
+	ttl  time.Duration
+}
+
+func NewIdempotencyService(repo *repository.IdempotencyRepository, ttl time.Duration) *IdempotencyService {
+	return &IdempotencyService{repo: repo, ttl: ttl}
+}
+
+// Begin claims key for a request. It returns the stored record when the key
+// was seen before with the same request hash, or a fresh pending record that
+// the caller must Complete or Release once the request has been handled.
+// Pending records only last idempotencyPendingTTL; completed ones the full
+// TTL.
+func (s *IdempotencyService) Begin(userID uint, key, requestHash string) (record *models.IdempotencyRecord, replay bool, err error) {
+	now := time.Now()
+
+	existing, err := s.repo.Find(userID, key, now)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		return s.checkExisting(existing, requestHash)
+	}
+
+	if err := s.repo.DeleteExpired(userID, key, now); err != nil {
+		return nil, false, err
+	}
+
+	record = &models.IdempotencyRecord{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   now.Add(idempotencyPendingTTL),
+	}
+	if err := s.repo.Create(record); err != nil {
+		// Lost the race against a concurrent request with the same key.
+		existing, findErr := s.repo.Find(userID, key, now)
+		if findErr != nil || existing == nil {
+			return nil, false, err
+		}
+		return s.checkExisting(existing, requestHash)
+	}
+
+	return record, false, nil
+}
+
+func (s *IdempotencyService) checkExisting(existing *models.IdempotencyRecord, requestHash string) (*models.IdempotencyRecord, bool, error) {
+	if existing.RequestHash != requestHash {
+		return nil, false, ErrIdempotencyKeyReused
+	}
+	if !existing.Completed() {
+		return nil, false, ErrIdempotencyKeyInProgress
+	}
+	return existing, true, nil
+}
+
+func (s *IdempotencyService) Complete(record *models.IdempotencyRecord, statusCode int, contentType, etag string, body []byte) error {
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.ETag = etag
+	record.ResponseBody = body
+	record.ExpiresAt = time.Now().Add(s.ttl)
+	return s.repo.Update(record)
+}
+
+// Release forgets a pending key so the client may retry the request.
+func (s *IdempotencyService) Release(record *models.IdempotencyRecord) error {
+	return s.repo.Delete(record.ID)
+}
+
+func (s *IdempotencyService) PurgeExpired() (int64, error) {
+	return s.repo.DeleteAllExpired(time.Now())
+}
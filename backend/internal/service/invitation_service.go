@@ -0,0 +1,203 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/mailer"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+)
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvitationPending  = errors.New("an invitation for this email is already pending")
+	ErrInvitationClosed   = errors.New("invitation was already accepted or revoked")
+	ErrInvalidInvitation  = errors.New("invalid or expired invitation")
+	// ErrInvitationNotSent means the invitation was saved but mailing the
+	// link failed; it can be resent.
+	ErrInvitationNotSent = errors.New("invitation email could not be sent")
+)
+
+// InvitationService invites people by email. The invitee picks their own
+// username and password and gets the role the admin chose.
+type InvitationService struct {
+	repo      *repository.InvitationRepository
+	userRepo  *repository.UserRepository
+	mailer    mailer.Mailer
+	acceptURL string
+	ttl       time.Duration
+}
+
+// NewInvitationService sends links to acceptURL with the token appended as
+// the "token" query parameter. Invitations expire after ttl.
+func NewInvitationService(repo *repository.InvitationRepository, userRepo *repository.UserRepository, mailer mailer.Mailer, acceptURL string, ttl time.Duration) *InvitationService {
+	return &InvitationService{
+		repo:      repo,
+		userRepo:  userRepo,
+		mailer:    mailer,
+		acceptURL: acceptURL,
+		ttl:       ttl,
+	}
+}
+
+func (s *InvitationService) Invite(email string, role models.Role, invitedByID uint) (*models.Invitation, error) {
+	if existing, _ := s.userRepo.FindByEmail(email); existing != nil {
+		return nil, ErrEmailAlreadyExists
+	}
+
+	now := time.Now()
+	pending, err := s.repo.FindPendingByEmail(email, now)
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		return nil, ErrInvitationPending
+	}
+
+	inviter, err := s.userRepo.FindByID(invitedByID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := &models.Invitation{
+		Email:       email,
+		Role:        role,
+		TokenHash:   hashToken(token),
+		InvitedByID: inviter.ID,
+		InvitedBy:   *inviter,
+		ExpiresAt:   now.Add(s.ttl),
+		SentAt:      now,
+	}
+	if err := s.repo.Create(invitation); err != nil {
+		return nil, err
+	}
+
+	return invitation, s.send(invitation, token)
+}
+
+func (s *InvitationService) List() ([]models.Invitation, error) {
+	return s.repo.GetAll()
+}
+
+// Resend mails a new link and restarts the expiry. The old link stops
+// working.
+func (s *InvitationService) Resend(id uint) (*models.Invitation, error) {
+	invitation, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if invitation == nil {
+		return nil, ErrInvitationNotFound
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	renewed, err := s.repo.Renew(id, hashToken(token), now.Add(s.ttl), now)
+	if err != nil {
+		return nil, err
+	}
+	if !renewed {
+		return nil, ErrInvitationClosed
+	}
+
+	invitation.TokenHash = hashToken(token)
+	invitation.ExpiresAt = now.Add(s.ttl)
+	invitation.SentAt = now
+	return invitation, s.send(invitation, token)
+}
+
+func (s *InvitationService) Revoke(id uint) (*models.Invitation, error) {
+	invitation, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if invitation == nil {
+		return nil, ErrInvitationNotFound
+	}
+
+	now := time.Now()
+	revoked, err := s.repo.Revoke(id, now)
+	if err != nil {
+		return nil, err
+	}
+	if !revoked {
+		return nil, ErrInvitationClosed
+	}
+
+	invitation.RevokedAt = &now
+	return invitation, nil
+}
+
+// Lookup returns the pending invitation a link belongs to, so the invitee
+// can see which address and role it is for before accepting.
+func (s *InvitationService) Lookup(rawToken string) (*models.Invitation, error) {
+	invitation, err := s.repo.FindByHash(hashToken(rawToken))
+	if err != nil {
+		return nil, err
+	}
+	if invitation == nil || invitation.Status(time.Now()) != models.InvitationPending {
+		return nil, ErrInvalidInvitation
+	}
+	return invitation, nil
+}
+
+// Accept creates the invitee's account. Following the link proves they own
+// the address, so it counts as verified.
+func (s *InvitationService) Accept(rawToken, username, password string) (*models.User, *models.Invitation, error) {
+	invitation, err := s.Lookup(rawToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if existing, _ := s.userRepo.FindByUsername(username); existing != nil {
+		return nil, nil, ErrUserAlreadyExists
+	}
+	if existing, _ := s.userRepo.FindByEmail(invitation.Email); existing != nil {
+		return nil, nil, ErrEmailAlreadyExists
+	}
+
+	now := time.Now()
+	user := &models.User{
+		Username: username,
+		Email:    invitation.Email,
+		Role:     invitation.Role,
+
+		EmailVerifiedAt: &now,
+	}
+	if err := user.SetPassword(password); err != nil {
+		return nil, nil, err
+	}
+
+	accepted, err := s.repo.Accept(invitation, user, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !accepted {
+		return nil, nil, ErrInvalidInvitation
+	}
+	return user, invitation, nil
+}
+
+func (s *InvitationService) send(invitation *models.Invitation, token string) error {
+	err := s.mailer.Send(mailer.Message{
+		To:      []string{invitation.Email},
+		Subject: "You have been invited to todoapp",
+		Text: fmt.Sprintf("Hi,\n\n%s has invited you to join todoapp as %s. Open this link to choose a username and password:\n\n%s\n\nThe link expires in %s and can only be used once.\n",
+			invitation.InvitedBy.Username, invitation.Role, withToken(s.acceptURL, token), formatTTL(s.ttl)),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvitationNotSent, err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/mailer"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/websocket"
+)
+
+const (
+	// emailClaimTTL is how long a replica has to send an email it claimed
+	// before another one may try again.
+	emailClaimTTL = 5 * time.Minute
+
+	// A failed email is tried again after emailRetryDelay, doubling each
+	// time, until it has been tried maxEmailAttempts times.
+	emailRetryDelay  = time.Minute
+	maxEmailAttempts = 6
+
+	// relayWindow is how old a notification may be and still be pushed to a
+	// connection; older ones wait in the inbox.
+	relayWindow = 5 * time.Minute
+
+	notificationBatch = 100
+)
+
+// NotificationService keeps users' in-app inboxes and delivers new entries
+// over websocket and, when asked for, by email.
+type NotificationService struct {
+	repo     *repository.NotificationRepository
+	userRepo *repository.UserRepository
+	hub      *websocket.Hub
+	mailer   mailer.Mailer
+	appURL   string
+}
+
+// NewNotificationService links emails to appURL, the frontend.
+func NewNotificationService(repo *repository.NotificationRepository, userRepo *repository.UserRepository, hub *websocket.Hub, mailer mailer.Mailer, appURL string) *NotificationService {
+	return &NotificationService{
+		repo:     repo,
+		userRepo: userRepo,
+		hub:      hub,
+		mailer:   mailer,
+		appURL:   appURL,
+	}
+}
+
+// Notify adds notification to its user's inbox unless one with the same key
+// is already there, and reports whether it was added. Delivery happens on
+// the next Deliver.
+func (s *NotificationService) Notify(notification *models.Notification) (bool, error) {
+	return s.repo.Claim(notification)
+}
+
+// Deliver pushes the new notifications of the users connected to this
+// replica's hub, whichever replica created them, then sends the emails that
+// are waiting.
+func (s *NotificationService) Deliver(now time.Time) error {
+	if err := s.relay(now); err != nil {
+		return err
+	}
+	return s.sendEmails(now)
+}
+
+// relay pushes each new notification once: the first replica with one of
+// the user's connections to claim it sends it. Claiming rows rather than
+// following the highest ID relayed so far also catches notifications
+// committed after ones with higher IDs.
+func (s *NotificationService) relay(now time.Time) error {
+	online := s.hub.Presence().Online
+	userIDs := make([]uint, 0, len(online))
+	for _, user := range online {
+		userIDs = append(userIDs, user.ID)
+	}
+
+	for {
+		notifications, err := s.repo.GetUnrelayed(userIDs, now.Add(-relayWindow), notificationBatch)
+		if err != nil {
+			return err
+		}
+		for _, notification := range notifications {
+			claimed, err := s.repo.ClaimRelay(notification.ID, now)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				continue
+			}
+			message, err := json.Marshal(map[string]any{
+				"message":      "notification",
+				"notification": notification,
+			})
+			if err != nil {
+				return err
+			}
+			s.hub.SendToUser(notification.UserID, message)
+		}
+		if len(notifications) < notificationBatch {
+			return nil
+		}
+	}
+}
+
+// sendEmails sends each waiting email once: a replica claims an email
+// before sending it. Only a replica that dies between sending and recording
+// it leaves the email to be sent again after the claim runs out. Failed
+// emails are tried again with backoff, up to maxEmailAttempts times.
+func (s *NotificationService) sendEmails(now time.Time) error {
+	notifications, err := s.repo.GetUnsentEmails(now, maxEmailAttempts, notificationBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, notification := range notifications {
+		claimed, err := s.repo.ClaimEmail(notification.ID, now, now.Add(emailClaimTTL))
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+
+		user, err := s.userRepo.FindByID(notification.UserID)
+		if err == nil && !user.IsDeactivated() {
+			err = s.mailer.Send(mailer.Message{
+				To:      []string{user.Email},
+				Subject: notification.Title,
+				Text: fmt.Sprintf("Hi %s,\n\n%s\n%s\n\nOpen todoapp: %s\n",
+					user.Username, notification.Title, notification.Body, s.appURL),
+			})
+			if err != nil {
+				// Carry on with the others; this one is retried later,
+				// unless it has been tried enough.
+				attempts := notification.EmailAttempts + 1
+				if attempts >= maxEmailAttempts {
+					log.Printf("Giving up emailing notification %d after %d attempts: %v", notification.ID, attempts, err)
+				} else {
+					log.Printf("Failed to email notification %d, attempt %d: %v", notification.ID, attempts, err)
+				}
+				retryAt := now.Add(emailRetryDelay << (attempts - 1))
+				if err := s.repo.FailEmail(notification.ID, retryAt); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if err := s.repo.MarkEmailed(notification.ID, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *NotificationService) GetNotifications(userID uint, unreadOnly bool, limit int) ([]models.Notification, error) {
+	return s.repo.GetList(userID, unreadOnly, limit)
+}
+
+func (s *NotificationService) CountUnread(userID uint) (int64, error) {
+	return s.repo.CountUnread(userID)
+}
+
+func (s *NotificationService) MarkRead(id, userID uint) (bool, error) {
+	return s.repo.MarkRead(id, userID, time.Now())
+}
+
+func (s *NotificationService) MarkAllRead(userID uint) (int64, error) {
+	return s.repo.MarkAllRead(userID, time.Now())
+}
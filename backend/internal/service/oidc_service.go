@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/oidc"
+	"github.com/harrisin2037/todoapp/internal/repository"
+)
+
+// oidcLoginTimeout bounds how long a user may take at the identity provider
+// before the callback is rejected.
+const oidcLoginTimeout = 10 * time.Minute
+
+var (
+	ErrInvalidOIDCState     = errors.New("invalid or expired login state")
+	ErrOIDCEmailNotVerified = errors.New("the identity provider has not verified this email address")
+	ErrOIDCAccountLinked    = errors.New("this account is linked to another single sign-on identity")
+)
+
+type OIDCService struct {
+	provider    *oidc.Provider
+	stateRepo   *repository.OIDCLoginStateRepository
+	userRepo    *repository.UserRepository
+	tokens      *TokenService
+	adminGroups []string
+}
+
+// NewOIDCService creates the single sign-on service. Logins by members of
+// adminGroups promote plain users to admin.
+func NewOIDCService(provider *oidc.Provider, stateRepo *repository.OIDCLoginStateRepository, userRepo *repository.UserRepository, tokens *TokenService, adminGroups []string) *OIDCService {
+	return &OIDCService{
+		provider:    provider,
+		stateRepo:   stateRepo,
+		userRepo:    userRepo,
+		tokens:      tokens,
+		adminGroups: adminGroups,
+	}
+}
+
+// BeginLogin records a new authorization request and returns the identity
+// provider URL to redirect the browser to, along with the state the
+// callback has to come back with.
+func (s *OIDCService) BeginLogin(ctx context.Context) (string, string, error) {
+	now := time.Now()
+	if err := s.stateRepo.DeleteExpired(now); err != nil {
+		return "", "", err
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.stateRepo.Create(&models.OIDCLoginState{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    now.Add(oidcLoginTimeout),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := s.provider.AuthCodeURL(ctx, state, nonce, challenge)
+	return authURL, state, err
+}
+
+// CompleteLogin handles the callback from the identity provider, finding,
+// linking or creating the local user and starting a session for them.
+func (s *OIDCService) CompleteLogin(ctx context.Context, state, code string) (*models.User, *TokenPair, error) {
+	loginState, err := s.stateRepo.Consume(state, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	if loginState == nil {
+		return nil, nil, ErrInvalidOIDCState
+	}
+
+	tokenResponse, err := s.provider.Exchange(ctx, code, loginState.CodeVerifier)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	identity, err := s.provider.VerifyIDToken(ctx, tokenResponse.IDToken, loginState.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.findOrCreateUser(identity)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.IsDeactivated() {
+		return nil, nil, ErrUserDeactivated
+	}
+
+	if err := s.syncRole(user, identity.Groups); err != nil {
+		return nil, nil, err
+	}
+
+	// The identity provider's own second factor is not visible here, so
+	// users who turned on two-factor authentication answer the same
+	// challenge as after a password, and these sessions never count as
+	// two-factor.
+	if user.TOTPEnabled {
+		return user, nil, requireTwoFactor(user)
+	}
+
+	tokens, err := s.tokens.IssueTokens(user, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, tokens, nil
+}
+
+// findOrCreateUser returns the user linked to the identity. On the first
+// login it links an existing user with the same email, or creates one; both
+// need the provider to have verified the address, as otherwise anyone who
+// can choose their email there could take over a local account.
+func (s *OIDCService) findOrCreateUser(identity *oidc.Identity) (*models.User, error) {
+	if user, err := s.userRepo.FindByOIDCIdentity(identity.Issuer, identity.Subject); err == nil {
+		return user, nil
+	}
+
+	if !identity.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+	now := time.Now()
+
+	if user, err := s.userRepo.FindByEmail(identity.Email); err == nil {
+		linked, err := s.userRepo.LinkOIDCIdentity(user.ID, identity.Issuer, identity.Subject)
+		if err != nil {
+			return nil, err
+		}
+		if !linked {
+			return nil, ErrOIDCAccountLinked
+		}
+		if user.EmailVerifiedAt == nil {
+			if _, err := s.userRepo.MarkEmailVerified(user.ID, user.Email, now); err != nil {
+				return nil, err
+			}
+			user.EmailVerifiedAt = &now
+		}
+		return user, nil
+	}
+
+	username, err := s.availableUsername(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	// Single sign-on users never log in with a local password, so they get a
+	// random one nobody knows.
+	password, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		Username: username,
+		Email:    identity.Email,
+		Role:     models.RoleUser,
+
+		OIDCIssuer:      &identity.Issuer,
+		OIDCSubject:     &identity.Subject,
+		EmailVerifiedAt: &now,
+	}
+	if err := user.SetPassword(password); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.Create(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *OIDCService) availableUsername(identity *oidc.Identity) (string, error) {
+	base := identity.PreferredUsername
+	if base == "" {
+		base = strings.Split(identity.Email, "@")[0]
+	}
+
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s%d", base, i)
+		}
+		if existing, _ := s.userRepo.FindByUsername(candidate); existing == nil {
+			return candidate, nil
+		}
+	}
+
+	return "", ErrUserAlreadyExists
+}
+
+// syncRole promotes a plain user who belongs to one of the admin groups.
+// Nothing else is touched, so roles given in the app, custom ones included,
+// are not overwritten by a login.
+func (s *OIDCService) syncRole(user *models.User, groups []string) error {
+	if user.Role != models.RoleUser || !s.inAdminGroup(groups) {
+		return nil
+	}
+
+	if err := s.userRepo.UpdateRole(user.ID, models.RoleAdmin); err != nil {
+		return err
+	}
+	if err := s.tokens.RevokeUser(user.ID); err != nil {
+		return err
+	}
+
+	updated, err := s.userRepo.FindByID(user.ID)
+	if err != nil {
+		return err
+	}
+	*user = *updated
+	return nil
+}
+
+func (s *OIDCService) inAdminGroup(groups []string) bool {
+	for _, group := range groups {
+		for _, adminGroup := range s.adminGroups {
+			if group == adminGroup {
+				return true
+			}
+		}
+	}
+	return false
+}
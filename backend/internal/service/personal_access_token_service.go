@@ -0,0 +1,116 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/policy"
+	"github.com/harrisin2037/todoapp/internal/repository"
+)
+
+var (
+	ErrInvalidScope        = errors.New("invalid scope")
+	ErrScopeNotAllowed     = errors.New("scope requires the user.manage permission")
+	ErrInvalidAccessToken  = errors.New("invalid personal access token")
+	ErrAccessTokenNotFound = errors.New("personal access token not found")
+)
+
+// lastUsedResolution limits how often LastUsedAt is written for a token that
+// is used in a tight loop.
+const lastUsedResolution = time.Minute
+
+type PersonalAccessTokenService struct {
+	repo     *repository.PersonalAccessTokenRepository
+	userRepo *repository.UserRepository
+	policies *PolicyService
+}
+
+func NewPersonalAccessTokenService(repo *repository.PersonalAccessTokenRepository, userRepo *repository.UserRepository, policies *PolicyService) *PersonalAccessTokenService {
+	return &PersonalAccessTokenService{repo: repo, userRepo: userRepo, policies: policies}
+}
+
+// CreateToken returns the stored token and its secret, which is never shown
+// again.
+func (s *PersonalAccessTokenService) CreateToken(user *models.User, name string, scopes []string, expiresAt *time.Time) (*models.PersonalAccessToken, string, error) {
+	for _, scope := range scopes {
+		if !models.IsValidScope(scope) {
+			return nil, "", ErrInvalidScope
+		}
+		if scope == models.ScopeAdminUsers && !s.policies.Can(policy.Subject{UserID: user.ID, Role: user.Role}, policy.UserManage) {
+			return nil, "", ErrScopeNotAllowed
+		}
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secret = models.PersonalAccessTokenPrefix + secret
+
+	token := &models.PersonalAccessToken{
+		UserID:    user.ID,
+		Name:      name,
+		TokenHash: hashToken(secret),
+		Hint:      secret[:len(models.PersonalAccessTokenPrefix)+4],
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.repo.Create(token); err != nil {
+		return nil, "", err
+	}
+
+	return token, secret, nil
+}
+
+func (s *PersonalAccessTokenService) GetTokens(userID uint) ([]models.PersonalAccessToken, error) {
+	return s.repo.GetByUserID(userID)
+}
+
+func (s *PersonalAccessTokenService) RevokeToken(id, userID uint) error {
+	revoked, err := s.repo.Revoke(id, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrAccessTokenNotFound
+	}
+	return nil
+}
+
+func (s *PersonalAccessTokenService) RevokeAllForUser(userID uint) error {
+	return s.repo.RevokeAllForUser(userID, time.Now())
+}
+
+// Authenticate resolves a personal access token to claims carrying the
+// token's scopes and the owner's current role.
+func (s *PersonalAccessTokenService) Authenticate(secret string) (*models.Claims, error) {
+	now := time.Now()
+
+	token, err := s.repo.FindByHash(hashToken(secret))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || !token.Active(now) {
+		return nil, ErrInvalidAccessToken
+	}
+
+	user, err := s.userRepo.FindByID(token.UserID)
+	if err != nil || user.IsDeactivated() {
+		return nil, ErrInvalidAccessToken
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > lastUsedResolution {
+		if err := s.repo.TouchLastUsed(token.ID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	return &models.Claims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		Scopes:   token.ScopeList(),
+	}, nil
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/policy"
+	"github.com/harrisin2037/todoapp/internal/repository"
+)
+
+// customRoleRefresh is how long custom roles are cached, so changes made on
+// another replica are picked up.
+const customRoleRefresh = 30 * time.Second
+
+var (
+	ErrRoleNotFound = errors.New("role not found")
+	ErrRoleExists   = errors.New("role already exists")
+	ErrRoleInUse    = errors.New("role is still assigned to users")
+)
+
+// PolicyService is the single place handlers ask whether a user may do
+// something. It feeds the policy engine with the custom roles and the facts
+// about users and resources that grants are checked against.
+type PolicyService struct {
+	engine      *policy.Engine
+	repo        *repository.RoleRepository
+	projectRepo *repository.ProjectRepository
+	userRepo    *repository.UserRepository
+
+	mu       sync.Mutex
+	loadedAt time.Time
+}
+
+func NewPolicyService(repo *repository.RoleRepository, projectRepo *repository.ProjectRepository, userRepo *repository.UserRepository) *PolicyService {
+	return &PolicyService{
+		engine:      policy.NewEngine(),
+		repo:        repo,
+		projectRepo: projectRepo,
+		userRepo:    userRepo,
+	}
+}
+
+// Subject describes the user behind claims for permission checks.
+func (s *PolicyService) Subject(claims *models.Claims) (policy.Subject, error) {
+	projectIDs, err := s.projectRepo.GetIDsForUser(claims.UserID)
+	if err != nil {
+		return policy.Subject{}, err
+	}
+	return policy.Subject{UserID: claims.UserID, Role: claims.Role, ProjectIDs: projectIDs}, nil
+}
+
+// Can reports whether subject has permission on every resource.
+func (s *PolicyService) Can(subject policy.Subject, permission policy.Permission) bool {
+	return s.currentEngine().Can(subject, permission, nil)
+}
+
+// IsAdministrative reports whether role grants any admin permission.
+func (s *PolicyService) IsAdministrative(role models.Role) bool {
+	subject := policy.Subject{Role: role}
+	for _, permission := range policy.AdminPermissions {
+		if s.Can(subject, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PolicyService) CanTodo(subject policy.Subject, permission policy.Permission, todo *models.Todo) bool {
+	resource := &policy.Resource{OwnerID: todo.OwnerID, ProjectID: todo.ProjectID}
+	for _, assignee := range todo.Assignees {
+		resource.AssigneeIDs = append(resource.AssigneeIDs, assignee.ID)
+	}
+	return s.currentEngine().Can(subject, permission, resource)
+}
+
+func (s *PolicyService) CanTemplate(subject policy.Subject, permission policy.Permission, template *models.TaskTemplate) bool {
+	return s.currentEngine().Can(subject, permission, &policy.Resource{OwnerID: template.OwnerID})
+}
+
+func (s *PolicyService) CanProject(subject policy.Subject, permission policy.Permission, project *models.Project) bool {
+	id := project.ID
+	return s.currentEngine().Can(subject, permission, &policy.Resource{OwnerID: project.LeadID, ProjectID: &id})
+}
+
+func (s *PolicyService) RoleExists(name models.Role) bool {
+	_, ok := s.currentEngine().Role(name)
+	return ok
+}
+
+// CanGrantRole reports whether a user with role actor may give role target
+// to someone, or manage someone who holds it, without gaining permissions
+// they do not have themselves.
+func (s *PolicyService) CanGrantRole(actor, target models.Role) bool {
+	return s.currentEngine().CanGrant(actor, target)
+}
+
+func (s *PolicyService) Roles() []policy.Role {
+	return s.currentEngine().Roles()
+}
+
+func (s *PolicyService) CreateRole(role policy.Role) error {
+	if err := role.Validate(); err != nil {
+		return err
+	}
+
+	existing, err := s.repo.FindByName(string(role.Name))
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrRoleExists
+	}
+
+	grants, err := json.Marshal(role.Grants)
+	if err != nil {
+		return err
+	}
+	record := &models.CustomRole{Name: string(role.Name), Description: role.Description, Grants: string(grants)}
+	if err := s.repo.Create(record); err != nil {
+		return err
+	}
+	return s.reload()
+}
+
+func (s *PolicyService) UpdateRole(role policy.Role) error {
+	if err := role.Validate(); err != nil {
+		return err
+	}
+
+	record, err := s.repo.FindByName(string(role.Name))
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return ErrRoleNotFound
+	}
+
+	grants, err := json.Marshal(role.Grants)
+	if err != nil {
+		return err
+	}
+	record.Description = role.Description
+	record.Grants = string(grants)
+	if err := s.repo.Update(record); err != nil {
+		return err
+	}
+	return s.reload()
+}
+
+// DeleteRole removes a custom role that nobody has any more.
+func (s *PolicyService) DeleteRole(name models.Role) error {
+	if role, ok := s.currentEngine().Role(name); ok && role.BuiltIn {
+		return policy.ErrBuiltInRole
+	}
+
+	record, err := s.repo.FindByName(string(name))
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return ErrRoleNotFound
+	}
+
+	count, err := s.userRepo.CountByRole(name)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleInUse
+	}
+
+	if err := s.repo.Delete(record.ID); err != nil {
+		return err
+	}
+	return s.reload()
+}
+
+// currentEngine returns the engine, reloading custom roles when the cache
+// is stale. A failed reload keeps the roles loaded before.
+func (s *PolicyService) currentEngine() *policy.Engine {
+	s.mu.Lock()
+	stale := time.Since(s.loadedAt) > customRoleRefresh
+	s.mu.Unlock()
+
+	if stale {
+		if err := s.reload(); err != nil {
+			log.Printf("Failed to load custom roles: %v", err)
+		}
+	}
+	return s.engine
+}
+
+func (s *PolicyService) reload() error {
+	records, err := s.repo.GetAll()
+	if err != nil {
+		return err
+	}
+
+	roles := make([]policy.Role, 0, len(records))
+	for _, record := range records {
+		role := policy.Role{Name: models.Role(record.Name), Description: record.Description}
+		if err := json.Unmarshal([]byte(record.Grants), &role.Grants); err != nil {
+			log.Printf("Ignoring custom role %q with invalid grants: %v", record.Name, err)
+			continue
+		}
+		roles = append(roles, role)
+	}
+	s.engine.SetCustomRoles(roles)
+
+	s.mu.Lock()
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+
+	"github.com/harrisin2037/todoapp/internal/avatar"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/utils"
+)
+
+var (
+	ErrInvalidTimezone  = errors.New("timezone must be an IANA zone name such as Europe/Berlin")
+	ErrInvalidLocale    = errors.New("locale must be a language tag such as en-US")
+	ErrInvalidWeekStart = errors.New("week_start must be between 0 (Sunday) and 6 (Saturday)")
+	ErrInvalidColor     = errors.New("color must be a hex color such as #7b68ee")
+	ErrAvatarNotFound   = errors.New("avatar not found")
+)
+
+var hexColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// ProfileUpdate holds the profile fields a user wants to change; nil fields
+// are left alone. An empty Color goes back to the generated one.
+type ProfileUpdate struct {
+	DisplayName *string
+	Timezone    *string
+	Locale      *string
+	WeekStart   *int
+	Color       *string
+}
+
+// ProfileService manages what users set about themselves: how they are
+// shown to others and how dates are read and displayed for them.
+type ProfileService struct {
+	userRepo *repository.UserRepository
+}
+
+func NewProfileService(userRepo *repository.UserRepository) *ProfileService {
+	return &ProfileService{userRepo: userRepo}
+}
+
+func (s *ProfileService) UpdateProfile(userID uint, update ProfileUpdate) (*models.User, error) {
+	fields := map[string]interface{}{}
+
+	if update.DisplayName != nil {
+		fields["display_name"] = strings.TrimSpace(*update.DisplayName)
+	}
+	if update.Timezone != nil {
+		timezone := *update.Timezone
+		if timezone != "" {
+			if _, err := time.LoadLocation(timezone); err != nil || strings.EqualFold(timezone, "Local") {
+				return nil, ErrInvalidTimezone
+			}
+		}
+		fields["timezone"] = timezone
+	}
+	if update.Locale != nil {
+		locale := *update.Locale
+		if locale != "" {
+			tag, err := language.Parse(locale)
+			if err != nil {
+				return nil, ErrInvalidLocale
+			}
+			locale = tag.String()
+		}
+		fields["locale"] = locale
+	}
+	if update.WeekStart != nil {
+		if *update.WeekStart < int(time.Sunday) || *update.WeekStart > int(time.Saturday) {
+			return nil, ErrInvalidWeekStart
+		}
+		fields["week_start"] = *update.WeekStart
+	}
+	if update.Color != nil {
+		color := *update.Color
+		if color == "" {
+			color = utils.GenerateColor(userID)
+		} else if !hexColorPattern.MatchString(color) {
+			return nil, ErrInvalidColor
+		}
+		fields["color"] = color
+	}
+
+	if len(fields) > 0 {
+		if err := s.userRepo.UpdateProfile(userID, fields); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// SetAvatar resizes the uploaded image and makes it the user's avatar.
+func (s *ProfileService) SetAvatar(userID uint, upload io.Reader) (*models.User, error) {
+	data, err := avatar.Process(upload)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.userRepo.SaveAvatar(&models.Avatar{UserID: userID, ContentType: avatar.ContentType, Data: data})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *ProfileService) Avatar(userID uint) (*models.Avatar, error) {
+	stored, err := s.userRepo.GetAvatar(userID)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, ErrAvatarNotFound
+	}
+	return stored, nil
+}
+
+func (s *ProfileService) RemoveAvatar(userID uint) error {
+	return s.userRepo.DeleteAvatar(userID)
+}
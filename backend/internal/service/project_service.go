@@ -0,0 +1,37 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+)
+
+var ErrProjectNotFound = errors.New("project not found")
+
+type ProjectService struct {
+	repo *repository.ProjectRepository
+}
+
+func NewProjectService(repo *repository.ProjectRepository) *ProjectService {
+	return &ProjectService{repo: repo}
+}
+
+func (s *ProjectService) CreateProject(project *models.Project, memberIDs []uint) error {
+	return s.repo.Create(project, memberIDs)
+}
+
+func (s *ProjectService) GetProjects() ([]models.Project, error) {
+	return s.repo.GetList()
+}
+
+func (s *ProjectService) GetProject(id uint) (*models.Project, error) {
+	project, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, ErrProjectNotFound
+	}
+	return project, nil
+}
@@ -0,0 +1,303 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/policy"
+	"github.com/harrisin2037/todoapp/internal/repository"
+)
+
+// reminderLookback is how late a reminder may still go off, for reminders
+// that came due while no scheduler was running, such as during a deploy.
+// After its first run, Fire only looks back to its last successful one.
+const reminderLookback = 24 * time.Hour
+
+var (
+	ErrReminderNotFound     = errors.New("reminder not found")
+	ErrReminderRuleNotFound = errors.New("reminder rule not found")
+)
+
+type ReminderService struct {
+	repo          *repository.ReminderRepository
+	todoRepo      *repository.TodoRepository
+	userRepo      *repository.UserRepository
+	policyService *PolicyService
+	notifications *NotificationService
+
+	fired time.Time
+}
+
+func NewReminderService(repo *repository.ReminderRepository, todoRepo *repository.TodoRepository, userRepo *repository.UserRepository, policyService *PolicyService, notifications *NotificationService) *ReminderService {
+	return &ReminderService{
+		repo:          repo,
+		todoRepo:      todoRepo,
+		userRepo:      userRepo,
+		policyService: policyService,
+		notifications: notifications,
+	}
+}
+
+func (s *ReminderService) AddReminder(reminder *models.Reminder) error {
+	if err := reminder.Validate(); err != nil {
+		return err
+	}
+	if reminder.RemindAt != nil && !reminder.RemindAt.After(time.Now()) {
+		return models.ErrReminderInPast
+	}
+	return s.repo.Create(reminder)
+}
+
+func (s *ReminderService) GetReminders(todoID, userID uint) ([]models.Reminder, error) {
+	return s.repo.GetForTodo(todoID, userID)
+}
+
+func (s *ReminderService) DeleteReminder(id, todoID, userID uint) error {
+	deleted, err := s.repo.Delete(id, todoID, userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrReminderNotFound
+	}
+	return nil
+}
+
+func (s *ReminderService) AddRule(rule *models.ReminderRule) error {
+	if !models.ValidReminderOffset(rule.Offset) {
+		return models.ErrInvalidReminder
+	}
+	return s.repo.CreateRule(rule)
+}
+
+func (s *ReminderService) GetRules(userID uint) ([]models.ReminderRule, error) {
+	return s.repo.GetRules(userID)
+}
+
+func (s *ReminderService) DeleteRule(id, userID uint) error {
+	deleted, err := s.repo.DeleteRule(id, userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrReminderRuleNotFound
+	}
+	return nil
+}
+
+// firing is one reminder going off for one user. key names it uniquely,
+// including the time, so a reminder whose due date moves goes off again.
+type firing struct {
+	key    string
+	userID uint
+	todo   models.Todo
+	email  bool
+}
+
+// Fire puts every reminder that has come due since the last successful run,
+// or within reminderLookback on the first, into its user's inbox. Each
+// firing is claimed through the inbox entry's unique key, so running Fire on
+// several replicas at once, or again after a restart, notifies once.
+// Reminders of completed todos, and those whose time had already passed
+// when they were set, do not go off. It returns how many were sent.
+func (s *ReminderService) Fire(now time.Time) (int, error) {
+	from := now.Add(-reminderLookback)
+	if s.fired.After(from) {
+		from = s.fired
+	}
+
+	explicit, err := s.explicitFirings(from, now)
+	if err != nil {
+		return 0, err
+	}
+	defaults, err := s.ruleFirings(from, now)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, firing := range append(explicit, defaults...) {
+		ok, err := s.send(firing)
+		if err != nil {
+			return sent, err
+		}
+		if ok {
+			sent++
+		}
+	}
+	s.fired = now
+	return sent, nil
+}
+
+// dueWindows returns the due dates for which a reminder offset seconds
+// before goes off in [from, now], for each of offsets, with overlapping
+// windows merged.
+func dueWindows(from, now time.Time, offsets []int) []repository.DueWindow {
+	sorted := append([]int(nil), offsets...)
+	sort.Ints(sorted)
+
+	windows := []repository.DueWindow{}
+	for _, offset := range sorted {
+		before := time.Duration(offset) * time.Second
+		window := repository.DueWindow{From: from.Add(before), To: now.Add(before)}
+		if last := len(windows) - 1; last >= 0 && !window.From.After(windows[last].To) {
+			windows[last].To = window.To
+			continue
+		}
+		windows = append(windows, window)
+	}
+	return windows
+}
+
+func (s *ReminderService) explicitFirings(from, now time.Time) ([]firing, error) {
+	offsets, err := s.repo.GetOffsets()
+	if err != nil {
+		return nil, err
+	}
+	reminders, err := s.repo.GetDue(from, now, dueWindows(from, now, offsets))
+	if err != nil || len(reminders) == 0 {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(reminders))
+	for _, reminder := range reminders {
+		ids = append(ids, reminder.TodoID)
+	}
+	todos, err := s.todoRepo.GetByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[uint]models.Todo{}
+	for _, todo := range todos {
+		byID[todo.ID] = todo
+	}
+
+	firings := []firing{}
+	for _, reminder := range reminders {
+		todo, ok := byID[reminder.TodoID]
+		if !ok || todo.Status == "completed" {
+			continue
+		}
+		at, ok := reminder.FireAt(&todo)
+		if !ok || !isDue(at, from, now, reminder.CreatedAt) {
+			continue
+		}
+		firings = append(firings, firing{
+			key:    fmt.Sprintf("reminder:%d:%d", reminder.ID, at.Unix()),
+			userID: reminder.UserID,
+			todo:   todo,
+			email:  reminder.Email,
+		})
+	}
+	return firings, nil
+}
+
+// ruleFirings applies users' default rules to the todos they own or are
+// assigned to, unless they set reminders of their own on them.
+func (s *ReminderService) ruleFirings(from, now time.Time) ([]firing, error) {
+	rules, err := s.repo.GetAllRules()
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+
+	offsets := []int{}
+	for _, userRules := range rules {
+		for _, rule := range userRules {
+			offsets = append(offsets, rule.Offset)
+		}
+	}
+	todos, err := s.todoRepo.GetDueWithin(dueWindows(from, now, offsets))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(todos))
+	for _, todo := range todos {
+		ids = append(ids, todo.ID)
+	}
+	ownReminders, err := s.repo.GetReminderUsers(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	firings := []firing{}
+	for _, todo := range todos {
+		recipients := []uint{todo.OwnerID}
+		for _, assignee := range todo.Assignees {
+			if assignee.ID != todo.OwnerID {
+				recipients = append(recipients, assignee.ID)
+			}
+		}
+
+		for _, userID := range recipients {
+			if ownReminders[todo.ID][userID] {
+				continue
+			}
+			for _, rule := range rules[userID] {
+				at, ok := rule.FireAt(&todo)
+				if !ok || !isDue(at, from, now, rule.CreatedAt) {
+					continue
+				}
+				firings = append(firings, firing{
+					key:    fmt.Sprintf("rule:%d:%d:%d", rule.ID, todo.ID, at.Unix()),
+					userID: userID,
+					todo:   todo,
+					email:  rule.Email,
+				})
+			}
+		}
+	}
+	return firings, nil
+}
+
+// isDue reports whether a reminder set at created that goes off at at is
+// due by now and not older than from.
+func isDue(at, from, now, created time.Time) bool {
+	if created.After(from) {
+		from = created
+	}
+	return at.After(from) && !at.After(now)
+}
+
+// send notifies the user, unless they can no longer see the todo or the
+// firing was already claimed.
+func (s *ReminderService) send(firing firing) (bool, error) {
+	user, err := s.userRepo.FindByID(firing.userID)
+	if err != nil || user.IsDeactivated() {
+		return false, nil
+	}
+
+	subject, err := s.policyService.Subject(&models.Claims{UserID: user.ID, Role: user.Role})
+	if err != nil {
+		return false, err
+	}
+	if !s.policyService.CanTodo(subject, policy.TodoRead, &firing.todo) {
+		return false, nil
+	}
+
+	todoID := firing.todo.ID
+	return s.notifications.Notify(&models.Notification{
+		UserID: user.ID,
+		TodoID: &todoID,
+		Kind:   models.NotificationReminder,
+		Key:    firing.key,
+		Title:  "Reminder: " + firing.todo.Name,
+		Body:   dueText(&firing.todo, user.Location()),
+		Email:  firing.email,
+	})
+}
+
+// dueText says when the todo is due, in the zone of an all-day due date or
+// else the user's own.
+func dueText(todo *models.Todo, loc *time.Location) string {
+	switch {
+	case todo.DueDate == nil:
+		return "No due date"
+	case todo.AllDay:
+		return "Due " + todo.DueDate.In(todo.DueLocation()).Format("Mon, Jan 2 2006")
+	default:
+		return "Due " + todo.DueDate.In(loc).Format("Mon, Jan 2 2006 15:04 MST")
+	}
+}
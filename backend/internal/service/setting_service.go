@@ -0,0 +1,49 @@
+package service
+
+import (
+	"strconv"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+)
+
+// Settings are the instance-wide options admins can change without a
+// restart.
+type Settings struct {
+	// RegistrationOpen lets anyone sign up through /register. When it is
+	// off, new accounts are only created by admins or through invitations.
+	RegistrationOpen bool `json:"registration_open"`
+}
+
+// SettingService stores Settings in the database. Options that were never
+// changed keep the defaults passed to NewSettingService.
+type SettingService struct {
+	repo     *repository.SettingRepository
+	defaults Settings
+}
+
+func NewSettingService(repo *repository.SettingRepository, defaults Settings) *SettingService {
+	return &SettingService{repo: repo, defaults: defaults}
+}
+
+func (s *SettingService) Get() (Settings, error) {
+	settings := s.defaults
+
+	stored, err := s.repo.GetAll()
+	if err != nil {
+		return settings, err
+	}
+	for _, setting := range stored {
+		switch setting.Key {
+		case models.SettingRegistrationOpen:
+			if open, err := strconv.ParseBool(setting.Value); err == nil {
+				settings.RegistrationOpen = open
+			}
+		}
+	}
+	return settings, nil
+}
+
+func (s *SettingService) SetRegistrationOpen(open bool) error {
+	return s.repo.Set(models.SettingRegistrationOpen, strconv.FormatBool(open))
+}
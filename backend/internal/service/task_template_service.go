@@ -62,18 +62,21 @@ func (s *TaskTemplateService) CreateTaskFromTemplate(templateID uint, ownerID ui
 		template.OwnerID = ownerID
 	}
 
-	dueDate := time.Now()
-	if template.DefaultDurationTimestamp != 0 {
-		dueDate = time.Now().Add(time.Duration(template.DefaultDurationTimestamp) * time.Second)
-	}
+	// The template's duration becomes the estimate, starting now.
+	startAt := time.Now().UTC()
+	dueDate := startAt.Add(time.Duration(template.DefaultDurationTimestamp) * time.Second)
 
 	todo := &models.Todo{
-		Name:        template.Name,
-		Description: template.Description,
-		Status:      "pending",
-		DueDate:     &dueDate,
-		OwnerID:     ownerID,
-		Owner:       template.Owner,
+		Name:              template.Name,
+		Description:       template.Description,
+		Status:            "pending",
+		OwnerID:           ownerID,
+		Owner:             template.Owner,
+		EstimatedDuration: template.DefaultDurationTimestamp,
+	}
+	todo.SetDueDate(dueDate, false, template.Owner.Location())
+	if template.DefaultDurationTimestamp > 0 {
+		todo.StartAt = &startAt
 	}
 
 	err = s.todoRepo.Create(todo, []uint{ownerID})
@@ -1,6 +1,9 @@
 package service
 
 import (
+	"sort"
+	"time"
+
 	"github.com/harrisin2037/todoapp/internal/models"
 	"github.com/harrisin2037/todoapp/internal/repository"
 )
@@ -13,6 +16,14 @@ func NewTodoService(repo *repository.TodoRepository) *TodoService {
 	return &TodoService{repo: repo}
 }
 
+// WithinTransaction runs fn with a service whose writes all share one
+// transaction, so they are committed or rolled back together.
+func (s *TodoService) WithinTransaction(fn func(tx *TodoService) error) error {
+	return s.repo.Transaction(func(repo *repository.TodoRepository) error {
+		return fn(&TodoService{repo: repo})
+	})
+}
+
 func (s *TodoService) CreateTodo(todo *models.Todo, assigneeIDs []uint) error {
 	return s.repo.Create(todo, assigneeIDs)
 }
@@ -25,11 +36,54 @@ func (s *TodoService) GetTodos(statuses []string, sortBy, order string, userID u
 	return s.repo.GetList(statuses, sortBy, order, userID)
 }
 
+// GetCalendar returns the todos overlapping [from, to) ordered by start. A
+// userID of 0 returns everyone's todos.
+func (s *TodoService) GetCalendar(from, to time.Time, userID uint) ([]models.Todo, error) {
+	todos, err := s.repo.GetCalendar(from, to, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.Todo{}
+	for _, todo := range todos {
+		if todo.Overlaps(from, to) {
+			result = append(result, todo)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		a, _, _ := result[i].Span()
+		b, _, _ := result[j].Span()
+		return a.Before(b)
+	})
+	return result, nil
+}
+
+// GetOwnedOrAssigned returns the todos userID owns or is assigned to, the
+// set a CalDAV client syncs.
+func (s *TodoService) GetOwnedOrAssigned(userID uint) ([]models.Todo, error) {
+	return s.repo.GetByOwnerOrAssignee(userID, nil, nil)
+}
+
+// GetTodoByCalDAVName returns the todo a CalDAV client stored under name in
+// userID's task list, or nil.
+func (s *TodoService) GetTodoByCalDAVName(userID uint, name string) (*models.Todo, error) {
+	return s.repo.FindByCalDAVName(userID, name)
+}
+
 func (s *TodoService) GetTodo(id uint) (*models.Todo, error) {
 	return s.repo.GetByID(id)
 }
 
+// UpdateTodo saves the todo, clearing its overdue mark once it is completed
+// or its due date moves; the overdue job marks it again if need be.
 func (s *TodoService) UpdateTodo(todo *models.Todo) error {
+	if todo.OverdueAt != nil {
+		if end := todo.DueEnd(); end == nil || !end.Equal(*todo.OverdueAt) || todo.Status == "completed" {
+			todo.OverdueAt = nil
+			todo.EscalatedAt = nil
+			todo.NextEscalationAt = nil
+		}
+	}
 	return s.repo.Update(todo)
 }
 
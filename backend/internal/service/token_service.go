@@ -0,0 +1,214 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrTokenRevoked        = errors.New("token has been revoked")
+)
+
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+type TokenService struct {
+	repo       *repository.RefreshTokenRepository
+	userRepo   *repository.UserRepository
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewTokenService(repo *repository.RefreshTokenRepository, userRepo *repository.UserRepository, accessTTL, refreshTTL time.Duration) *TokenService {
+	return &TokenService{
+		repo:       repo,
+		userRepo:   userRepo,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// IssueTokens starts a new login session for user. twoFactor records
+// whether the login passed a second factor.
+func (s *TokenService) IssueTokens(user *models.User, twoFactor bool) (*TokenPair, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, record, err := s.newRefreshToken(user.ID, sessionID, twoFactor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(record); err != nil {
+		return nil, err
+	}
+
+	return s.pair(user, sessionID, twoFactor, refreshToken)
+}
+
+// Refresh exchanges a refresh token for a new token pair, revoking the one
+// presented. Presenting an already rotated token is treated as theft and
+// ends the whole session.
+func (s *TokenService) Refresh(rawToken string) (*models.User, *TokenPair, error) {
+	now := time.Now()
+
+	record, err := s.repo.FindByHash(hashToken(rawToken))
+	if err != nil {
+		return nil, nil, err
+	}
+	if record == nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	if record.RevokedAt != nil {
+		if err := s.repo.RevokeSession(record.SessionID, now); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if !record.Active(now) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.FindByID(record.UserID)
+	if err != nil || user.IsDeactivated() {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	refreshToken, next, err := s.newRefreshToken(user.ID, record.SessionID, record.TwoFactor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rotated, err := s.repo.Rotate(record, next, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !rotated {
+		if err := s.repo.RevokeSession(record.SessionID, now); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	pair, err := s.pair(user, record.SessionID, record.TwoFactor, refreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, pair, nil
+}
+
+// Authenticate validates an access token and checks that neither the user
+// nor the session it belongs to has been revoked since it was issued.
+func (s *TokenService) Authenticate(tokenString string) (*models.Claims, error) {
+	claims, err := models.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(claims.UserID)
+	if err != nil {
+		return nil, ErrTokenRevoked
+	}
+	if user.TokenVersion != claims.TokenVersion {
+		return nil, ErrTokenRevoked
+	}
+
+	if claims.Impersonator != nil {
+		admin, err := s.userRepo.FindByID(claims.Impersonator.UserID)
+		if err != nil || admin.IsDeactivated() || admin.TokenVersion != claims.Impersonator.TokenVersion {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	if claims.SessionID == "" {
+		return nil, ErrTokenRevoked
+	}
+	active, err := s.repo.IsSessionActive(claims.SessionID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// Impersonate issues an access token acting as target for the admin behind
+// claims. There is no refresh token: the admin asks again once it expires.
+func (s *TokenService) Impersonate(claims *models.Claims, target *models.User) (*TokenPair, error) {
+	accessToken, err := models.GenerateImpersonationToken(target, claims, s.accessTTL)
+	if err != nil {
+		return nil, ErrFailedToGenerateJWT
+	}
+	return &TokenPair{AccessToken: accessToken, ExpiresIn: s.accessTTL}, nil
+}
+
+// Logout ends the session the access token belongs to.
+func (s *TokenService) Logout(claims *models.Claims) error {
+	return s.repo.RevokeSession(claims.SessionID, time.Now())
+}
+
+// RevokeUser invalidates every access and refresh token of a user, so role
+// changes and deletions take effect immediately.
+func (s *TokenService) RevokeUser(userID uint) error {
+	if err := s.userRepo.IncrementTokenVersion(userID); err != nil {
+		return err
+	}
+	return s.repo.RevokeAllForUser(userID, time.Now())
+}
+
+func (s *TokenService) pair(user *models.User, sessionID string, twoFactor bool, refreshToken string) (*TokenPair, error) {
+	accessToken, err := models.GenerateToken(user, sessionID, twoFactor, s.accessTTL)
+	if err != nil {
+		return nil, ErrFailedToGenerateJWT
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    s.accessTTL,
+	}, nil
+}
+
+func (s *TokenService) newRefreshToken(userID uint, sessionID string, twoFactor bool) (string, *models.RefreshToken, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	record := &models.RefreshToken{
+		UserID:    userID,
+		SessionID: sessionID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.refreshTTL),
+		TwoFactor: twoFactor,
+	}
+	return token, record, nil
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
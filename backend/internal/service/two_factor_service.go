@@ -0,0 +1,200 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/totp"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrTwoFactorAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled      = errors.New("two-factor enrollment has not been started")
+	ErrTwoFactorNotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrInvalidTwoFactorCode      = errors.New("invalid two-factor code")
+	ErrTwoFactorRequiredByPolicy = errors.New("two-factor authentication is required for admins")
+)
+
+type TwoFactorStatus struct {
+	Enabled                bool
+	Required               bool
+	RecoveryCodesRemaining int64
+}
+
+type TwoFactorService struct {
+	userRepo         *repository.UserRepository
+	codeRepo         *repository.RecoveryCodeRepository
+	issuer           string
+	requireForAdmins bool
+}
+
+func NewTwoFactorService(userRepo *repository.UserRepository, codeRepo *repository.RecoveryCodeRepository, issuer string, requireForAdmins bool) *TwoFactorService {
+	return &TwoFactorService{
+		userRepo:         userRepo,
+		codeRepo:         codeRepo,
+		issuer:           issuer,
+		requireForAdmins: requireForAdmins,
+	}
+}
+
+// RequiredFor reports whether the policy demands a second factor for role.
+func (s *TwoFactorService) RequiredFor(role models.Role) bool {
+	return s.requireForAdmins && role == models.RoleAdmin
+}
+
+func (s *TwoFactorService) Status(user *models.User) (*TwoFactorStatus, error) {
+	status := &TwoFactorStatus{
+		Enabled:  user.TOTPEnabled,
+		Required: s.RequiredFor(user.Role),
+	}
+	if user.TOTPEnabled {
+		remaining, err := s.codeRepo.CountUnused(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		status.RecoveryCodesRemaining = remaining
+	}
+	return status, nil
+}
+
+// Enroll starts enrollment with a fresh secret. Two-factor authentication
+// stays off until Confirm sees a valid code for it, so an abandoned
+// enrollment cannot lock the user out.
+func (s *TwoFactorService) Enroll(user *models.User) (string, string, error) {
+	if user.TOTPEnabled {
+		return "", "", ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.userRepo.SetTOTP(user.ID, secret, false, 0); err != nil {
+		return "", "", err
+	}
+
+	return secret, totp.URI(s.issuer, user.Username, secret), nil
+}
+
+// Confirm enables two-factor authentication once the user proves the
+// authenticator works, and returns the recovery codes. They are only ever
+// shown this once.
+func (s *TwoFactorService) Confirm(user *models.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	counter, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, err := s.newRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.SetTOTP(user.ID, user.TOTPSecret, true, counter); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *TwoFactorService) Disable(user *models.User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if s.RequiredFor(user.Role) {
+		return ErrTwoFactorRequiredByPolicy
+	}
+	if err := s.Verify(user, code); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.SetTOTP(user.ID, "", false, 0); err != nil {
+		return err
+	}
+	return s.codeRepo.DeleteForUser(user.ID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes, used or not.
+func (s *TwoFactorService) RegenerateRecoveryCodes(user *models.User, code string) ([]string, error) {
+	if !user.TOTPEnabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if err := s.Verify(user, code); err != nil {
+		return nil, err
+	}
+	return s.newRecoveryCodes(user.ID)
+}
+
+// Verify accepts either a current TOTP code or an unused recovery code.
+// Each is only accepted once.
+func (s *TwoFactorService) Verify(user *models.User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if counter, ok := totp.Validate(user.TOTPSecret, code, time.Now()); ok {
+		fresh, err := s.userRepo.UseTOTPCounter(user.ID, counter)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	used, err := s.codeRepo.Use(user.ID, hashToken(normalizeRecoveryCode(code)), time.Now())
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (s *TwoFactorService) newRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+
+	if err := s.codeRepo.Replace(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// randomRecoveryCode returns a code such as "k3x7q-mp2ab" that is easy to
+// write down.
+func randomRecoveryCode() (string, error) {
+	buf := make([]byte, 7)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
@@ -2,13 +2,71 @@ package service
 
 import (
 	"errors"
+	"time"
 
 	"github.com/harrisin2037/todoapp/internal/models"
 	"github.com/harrisin2037/todoapp/internal/repository"
 )
 
+// twoFactorChallengeTTL is how long the user has to enter a TOTP code after
+// the password step of a login.
+const twoFactorChallengeTTL = 5 * time.Minute
+
 type UserService struct {
-	repo *repository.UserRepository
+	repo      *repository.UserRepository
+	tokens    *TokenService
+	twoFactor *TwoFactorService
+
+	// requireVerifiedEmail refuses logins until the email address has been
+	// verified.
+	requireVerifiedEmail bool
+	lockout              LockoutPolicy
+}
+
+// LockoutPolicy locks an account for BaseDelay once Threshold consecutive
+// logins have failed, doubling the delay with every further failure up to
+// MaxDelay. A zero Threshold disables lockouts.
+type LockoutPolicy struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+func (p LockoutPolicy) delay(failures int) time.Duration {
+	if p.Threshold <= 0 || failures < p.Threshold {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.Threshold; i < failures; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return delay
+}
+
+// AccountLockedError is returned by Login while an account is locked after
+// too many failed attempts.
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string {
+	return "account is temporarily locked"
+}
+
+// TwoFactorRequiredError is returned by Login when the password was correct
+// but the account has two-factor authentication enabled. Challenge has to be
+// passed to LoginTwoFactor together with a code to finish the login.
+type TwoFactorRequiredError struct {
+	Challenge string
+	ExpiresIn time.Duration
+}
+
+func (e *TwoFactorRequiredError) Error() string {
+	return "two-factor authentication required"
 }
 
 var (
@@ -19,21 +77,33 @@ var (
 	ErrInvalidCredentials  = errors.New("invalid credentials")
 	ErrFailedToGenerateJWT = errors.New("failed to generate JWT token")
 	ErrSameRole            = errors.New("user already has this role")
+	ErrEmailNotVerified    = errors.New("email address has not been verified")
+	ErrUserDeactivated     = errors.New("account has been deactivated")
+	ErrUserNotDeactivated  = errors.New("account is not deactivated")
+	ErrTransferToSelf      = errors.New("cannot transfer ownership to the same user")
+	ErrTransferTarget      = errors.New("ownership can only be transferred to an active user")
+	ErrUserOwnsResources   = errors.New("user still owns todos or task templates; transfer them first")
 )
 
-func NewUserService(repo *repository.UserRepository) *UserService {
-	return &UserService{repo: repo}
+// OwnershipTransfer reports how many todos and task templates changed owner.
+type OwnershipTransfer struct {
+	Todos     int64 `json:"todos"`
+	Templates int64 `json:"templates"`
 }
 
-func (s *UserService) Register(username, email, password string) error {
+func NewUserService(repo *repository.UserRepository, tokens *TokenService, twoFactor *TwoFactorService, requireVerifiedEmail bool, lockout LockoutPolicy) *UserService {
+	return &UserService{repo: repo, tokens: tokens, twoFactor: twoFactor, requireVerifiedEmail: requireVerifiedEmail, lockout: lockout}
+}
+
+func (s *UserService) Register(username, email, password string) (*models.User, error) {
 	existingUser, _ := s.repo.FindByUsername(username)
 	if existingUser != nil {
-		return ErrUserAlreadyExists
+		return nil, ErrUserAlreadyExists
 	}
 
 	existingUser, _ = s.repo.FindByEmail(email)
 	if existingUser != nil {
-		return ErrEmailAlreadyExists
+		return nil, ErrEmailAlreadyExists
 	}
 
 	newUser := &models.User{
@@ -43,35 +113,150 @@ func (s *UserService) Register(username, email, password string) error {
 	}
 	err := newUser.SetPassword(password)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return s.repo.Create(newUser)
+	if err := s.repo.Create(newUser); err != nil {
+		return nil, err
+	}
+	return newUser, nil
 }
 
-func (s *UserService) Login(username, password string) (*models.User, string, error) {
+func (s *UserService) Login(username, password string) (*models.User, *TokenPair, error) {
 
 	user, err := s.repo.FindByUsername(username)
 	if err != nil {
-		return nil, "", ErrInvalidCredentials
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	if user.IsLocked(now) {
+		return nil, nil, &AccountLockedError{Until: *user.LockedUntil}
 	}
 
 	if !user.CheckPassword(password) {
-		return nil, "", ErrInvalidCredentials
+		if err := s.recordLoginFailure(user.ID, now); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidCredentials
 	}
 
-	token, err := models.GenerateToken(user)
+	if user.IsDeactivated() {
+		return nil, nil, ErrUserDeactivated
+	}
+
+	if s.requireVerifiedEmail && user.EmailVerifiedAt == nil {
+		return nil, nil, ErrEmailNotVerified
+	}
+
+	if user.TOTPEnabled {
+		return user, nil, requireTwoFactor(user)
+	}
+
+	// Failures are only forgiven once the whole login succeeded, otherwise
+	// the password step would reset the count for guessing the second
+	// factor.
+	if err := s.resetLoginFailures(user); err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.tokens.IssueTokens(user, false)
 	if err != nil {
-		return nil, "", ErrFailedToGenerateJWT
+		return nil, nil, err
 	}
 
-	return user, token, nil
+	return user, tokens, nil
+}
+
+// requireTwoFactor returns the challenge a user with two-factor
+// authentication has to answer at LoginTwoFactor to get tokens.
+func requireTwoFactor(user *models.User) error {
+	challenge, err := models.GenerateTwoFactorChallenge(user, twoFactorChallengeTTL)
+	if err != nil {
+		return ErrFailedToGenerateJWT
+	}
+	return &TwoFactorRequiredError{Challenge: challenge, ExpiresIn: twoFactorChallengeTTL}
+}
+
+// LoginTwoFactor is the second login step for accounts with two-factor
+// authentication. It issues tokens only if code is a valid TOTP or recovery
+// code for the user the challenge was issued to.
+func (s *UserService) LoginTwoFactor(challenge, code string) (*models.User, *TokenPair, error) {
+	claims, err := models.ValidateTwoFactorChallenge(challenge)
+	if err != nil {
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	user, err := s.repo.FindByID(claims.UserID)
+	if err != nil || user.TokenVersion != claims.TokenVersion {
+		return nil, nil, ErrInvalidCredentials
+	}
+	if user.IsDeactivated() {
+		return nil, nil, ErrUserDeactivated
+	}
+
+	now := time.Now()
+	if user.IsLocked(now) {
+		return nil, nil, &AccountLockedError{Until: *user.LockedUntil}
+	}
+
+	if err := s.twoFactor.Verify(user, code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) || errors.Is(err, ErrTwoFactorNotEnabled) {
+			if err := s.recordLoginFailure(user.ID, now); err != nil {
+				return nil, nil, err
+			}
+			return nil, nil, ErrInvalidTwoFactorCode
+		}
+		return nil, nil, err
+	}
+
+	if err := s.resetLoginFailures(user); err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.tokens.IssueTokens(user, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, tokens, nil
+}
+
+// UnlockUser lifts a lockout and forgets earlier failed attempts.
+func (s *UserService) UnlockUser(userID uint) error {
+	if _, err := s.repo.FindByID(userID); err != nil {
+		return ErrUserNotFound
+	}
+	return s.repo.ResetLoginFailures(userID)
+}
+
+func (s *UserService) recordLoginFailure(userID uint, now time.Time) error {
+	failures, err := s.repo.RecordLoginFailure(userID)
+	if err != nil {
+		return err
+	}
+
+	if delay := s.lockout.delay(failures); delay > 0 {
+		return s.repo.LockUntil(userID, now.Add(delay))
+	}
+	return nil
+}
+
+func (s *UserService) resetLoginFailures(user *models.User) error {
+	if user.FailedLoginAttempts == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	return s.repo.ResetLoginFailures(user.ID)
 }
 
 func (s *UserService) GetUsersByIDs(ids []uint) ([]models.User, error) {
 	return s.repo.GetUsersByIDs(ids)
 }
 
+func (s *UserService) GetUsersByUsernames(usernames []string) ([]models.User, error) {
+	return s.repo.GetUsersByUsernames(usernames)
+}
+
 func (s *UserService) ChangeRole(userID uint, newRole models.Role) error {
 	user, err := s.repo.FindByID(userID)
 	if err != nil {
@@ -82,7 +267,11 @@ func (s *UserService) ChangeRole(userID uint, newRole models.Role) error {
 		return ErrSameRole
 	}
 
-	return s.repo.UpdateRole(userID, newRole)
+	if err := s.repo.UpdateRole(userID, newRole); err != nil {
+		return err
+	}
+
+	return s.tokens.RevokeUser(userID)
 }
 
 func (s *UserService) GetUserByID(userID uint) (*models.User, error) {
@@ -114,57 +303,172 @@ func (s *UserService) UpdateUser(userID uint, username, email, password, role st
 		user.Username = username
 	}
 
-	if email != "" {
+	// Addresses set by an admin are trusted like those of CreateUser.
+	if email != "" && email != user.Email {
+		now := time.Now()
 		user.Email = email
+		user.EmailVerifiedAt = &now
 	}
 
+	revoke := false
+
 	if password != "" {
 		err = user.SetPassword(password)
 		if err != nil {
 			return err
 		}
+		revoke = true
 	}
 
 	if role != "" {
-		newRole, err := models.ParseRole(role)
-		if err != nil {
-			return err
-		}
+		// The handler checks the role exists; custom roles are not known here.
+		newRole := models.Role(role)
+		revoke = revoke || newRole != user.Role
 		user.Role = newRole
 	}
 
-	return s.repo.Update(user)
+	if err := s.repo.Update(user); err != nil {
+		return err
+	}
+
+	if revoke {
+		return s.tokens.RevokeUser(userID)
+	}
+	return nil
 }
 
+// DeleteUser removes a user who owns nothing any more. Users who leave
+// should usually be deactivated instead, which keeps them in the history.
 func (s *UserService) DeleteUser(userID uint) error {
 	_, err := s.repo.FindByID(userID)
 	if err != nil {
 		return ErrUserNotFound
 	}
 
+	todos, templates, err := s.repo.CountOwned(userID)
+	if err != nil {
+		return err
+	}
+	if todos > 0 || templates > 0 {
+		return ErrUserOwnsResources
+	}
+
+	if err := s.tokens.RevokeUser(userID); err != nil {
+		return err
+	}
+
 	return s.repo.Delete(userID)
 }
 
-func (s *UserService) CreateUser(username, email, password string, role models.Role) error {
+// DeactivateUser signs a user out everywhere and stops them from logging
+// in. When transferTo is set, their todos and templates move to that user in
+// the same transaction.
+func (s *UserService) DeactivateUser(userID uint, transferTo *uint) (*OwnershipTransfer, error) {
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.IsDeactivated() {
+		return nil, ErrUserDeactivated
+	}
+
+	transfer := &OwnershipTransfer{}
+	err = s.repo.Transaction(func(repo *repository.UserRepository) error {
+		if transferTo != nil {
+			moved, err := transferOwnership(repo, userID, *transferTo)
+			if err != nil {
+				return err
+			}
+			transfer = moved
+		}
+
+		now := time.Now()
+		return repo.SetDeactivatedAt(userID, &now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.tokens.RevokeUser(userID); err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+func (s *UserService) ReactivateUser(userID uint) error {
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if !user.IsDeactivated() {
+		return ErrUserNotDeactivated
+	}
+	return s.repo.SetDeactivatedAt(userID, nil)
+}
+
+// TransferOwnership moves every todo and task template of one user to
+// another in a single transaction.
+func (s *UserService) TransferOwnership(fromID, toID uint) (*OwnershipTransfer, error) {
+	if _, err := s.repo.FindByID(fromID); err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	var transfer *OwnershipTransfer
+	err := s.repo.Transaction(func(repo *repository.UserRepository) error {
+		var err error
+		transfer, err = transferOwnership(repo, fromID, toID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+func transferOwnership(repo *repository.UserRepository, fromID, toID uint) (*OwnershipTransfer, error) {
+	if fromID == toID {
+		return nil, ErrTransferToSelf
+	}
+
+	target, err := repo.FindByID(toID)
+	if err != nil || target.IsDeactivated() {
+		return nil, ErrTransferTarget
+	}
+
+	todos, templates, err := repo.TransferOwnership(fromID, toID)
+	if err != nil {
+		return nil, err
+	}
+	return &OwnershipTransfer{Todos: todos, Templates: templates}, nil
+}
+
+func (s *UserService) CreateUser(username, email, password string, role models.Role) (*models.User, error) {
 	existingUser, _ := s.repo.FindByUsername(username)
 	if existingUser != nil {
-		return ErrUserAlreadyExists
+		return nil, ErrUserAlreadyExists
 	}
 
 	existingUser, _ = s.repo.FindByEmail(email)
 	if existingUser != nil {
-		return ErrEmailAlreadyExists
+		return nil, ErrEmailAlreadyExists
 	}
 
+	// An admin vouches for the address, so it does not need verifying.
+	now := time.Now()
 	newUser := &models.User{
 		Username: username,
 		Email:    email,
 		Role:     role,
+
+		EmailVerifiedAt: &now,
 	}
 	err := newUser.SetPassword(password)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return s.repo.Create(newUser)
+	if err := s.repo.Create(newUser); err != nil {
+		return nil, err
+	}
+	return newUser, nil
 }
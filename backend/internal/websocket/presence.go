@@ -0,0 +1,178 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+)
+
+const (
+	ActionView  = "view"
+	ActionLeave = "leave"
+
+	MessageViewerJoined = "viewer joined"
+	MessageViewerLeft   = "viewer left"
+)
+
+// ClientMessage is sent by a connected client to report which todo it is
+// currently looking at, e.g. {"action":"view","todo_id":5}.
+type ClientMessage struct {
+	Action string `json:"action"`
+	TodoID uint   `json:"todo_id"`
+}
+
+type viewRequest struct {
+	client *Client
+	todoID uint
+}
+
+type PresenceUser struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+}
+
+type PresenceEvent struct {
+	Message string       `json:"message"`
+	TodoID  uint         `json:"todo_id"`
+	User    PresenceUser `json:"user"`
+}
+
+type PresenceSnapshot struct {
+	Online  []PresenceUser          `json:"online"`
+	Viewing map[uint][]PresenceUser `json:"viewing"`
+}
+
+// setViewing moves a client to a new todo, notifying the viewers of the todo
+// it left and of the todo it joined. The caller must hold h.mutex.
+func (h *Hub) setViewing(client *Client, todoID uint) {
+	previous := client.viewing
+	if previous == todoID {
+		return
+	}
+	client.viewing = todoID
+
+	user := PresenceUser{ID: client.userID, Username: client.username}
+
+	// A user with several tabs open on the same todo only leaves once the
+	// last of them is gone, and only joins once.
+	if previous != 0 && !h.isViewingLocked(client.userID, previous) {
+		h.notifyViewersLocked(previous, client, PresenceEvent{Message: MessageViewerLeft, TodoID: previous, User: user})
+	}
+	if todoID != 0 && h.countViewingLocked(client.userID, todoID) == 1 {
+		h.notifyViewersLocked(todoID, client, PresenceEvent{Message: MessageViewerJoined, TodoID: todoID, User: user})
+	}
+}
+
+func (h *Hub) isViewingLocked(userID, todoID uint) bool {
+	return h.countViewingLocked(userID, todoID) > 0
+}
+
+func (h *Hub) countViewingLocked(userID, todoID uint) int {
+	count := 0
+	for client := range h.clients {
+		if client.userID == userID && client.viewing == todoID {
+			count++
+		}
+	}
+	return count
+}
+
+func (h *Hub) notifyViewersLocked(todoID uint, from *Client, event PresenceEvent) {
+	message, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	for client := range h.clients {
+		if client == from || client.viewing != todoID || client.userID == from.userID {
+			continue
+		}
+		h.sendLocked(client, message)
+	}
+}
+
+// Presence returns the users currently connected and the todos they view.
+func (h *Hub) Presence() PresenceSnapshot {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var (
+		online  = map[uint]PresenceUser{}
+		viewing = map[uint]map[uint]PresenceUser{}
+	)
+
+	for client := range h.clients {
+		if client.userID == 0 {
+			continue
+		}
+		user := PresenceUser{ID: client.userID, Username: client.username}
+		online[user.ID] = user
+		if client.viewing != 0 {
+			if viewing[client.viewing] == nil {
+				viewing[client.viewing] = map[uint]PresenceUser{}
+			}
+			viewing[client.viewing][user.ID] = user
+		}
+	}
+
+	snapshot := PresenceSnapshot{
+		Online:  sortedUsers(online),
+		Viewing: map[uint][]PresenceUser{},
+	}
+	for todoID, users := range viewing {
+		snapshot.Viewing[todoID] = sortedUsers(users)
+	}
+	return snapshot
+}
+
+func sortedUsers(users map[uint]PresenceUser) []PresenceUser {
+	list := make([]PresenceUser, 0, len(users))
+	for _, user := range users {
+		list = append(list, user)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// HandlePresence reports who is online and, for the todos the user may read,
+// who is viewing them.
+func (h *Hub) HandlePresence(access TodoAccess) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.MustGet("user").(*models.Claims)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user claims"})
+			return
+		}
+
+		snapshot := h.Presence()
+
+		if todoParam := c.Query("todo_id"); todoParam != "" {
+			todoID, err := strconv.ParseUint(todoParam, 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid todo ID"})
+				return
+			}
+			if !access.CanReadTodo(claims, uint(todoID)) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to view this todo"})
+				return
+			}
+			viewers := snapshot.Viewing[uint(todoID)]
+			if viewers == nil {
+				viewers = []PresenceUser{}
+			}
+			c.JSON(http.StatusOK, gin.H{"todo_id": todoID, "viewers": viewers})
+			return
+		}
+
+		for todoID := range snapshot.Viewing {
+			if !access.CanReadTodo(claims, todoID) {
+				delete(snapshot.Viewing, todoID)
+			}
+		}
+		c.JSON(http.StatusOK, snapshot)
+	}
+}
@@ -1,12 +1,16 @@
 package websocket
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+
+	"github.com/harrisin2037/todoapp/internal/models"
 )
 
 var Upgrader = websocket.Upgrader{
@@ -15,9 +19,26 @@ var Upgrader = websocket.Upgrader{
 	},
 }
 
+// Authenticator checks a bearer access token, including whether its user or
+// session has been revoked since it was issued.
+type Authenticator interface {
+	Authenticate(token string) (*models.Claims, error)
+}
+
+// TodoAccess tells the hub whether a user may read a todo, so that who is
+// viewing a todo is only shared with users who can see it.
+type TodoAccess interface {
+	CanReadTodo(claims *models.Claims, todoID uint) bool
+}
+
 type Client struct {
-	conn *websocket.Conn
-	send chan []byte
+	conn     *websocket.Conn
+	send     chan []byte
+	claims   *models.Claims
+	access   TodoAccess
+	userID   uint
+	username string
+	viewing  uint
 }
 
 type Hub struct {
@@ -25,18 +46,34 @@ type Hub struct {
 	Broadcast  chan []byte
 	register   chan *Client
 	unregister chan *Client
+	view       chan viewRequest
+	direct     chan directMessage
 	mutex      sync.Mutex
 }
 
+// directMessage is a message for every connection of one user.
+type directMessage struct {
+	userID  uint
+	message []byte
+}
+
 func NewHub() *Hub {
 	return &Hub{
 		clients:    make(map[*Client]bool),
 		Broadcast:  make(chan []byte),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		view:       make(chan viewRequest),
+		direct:     make(chan directMessage),
 	}
 }
 
+// SendToUser delivers message to the user's connections on this hub.
+// Anonymous connections never receive it.
+func (h *Hub) SendToUser(userID uint, message []byte) {
+	h.direct <- directMessage{userID: userID, message: message}
+}
+
 func (h *Hub) Run() {
 	for {
 		select {
@@ -47,36 +84,95 @@ func (h *Hub) Run() {
 		case client := <-h.unregister:
 			h.mutex.Lock()
 			if _, ok := h.clients[client]; ok {
+				h.setViewing(client, 0)
 				delete(h.clients, client)
 				close(client.send)
 			}
 			h.mutex.Unlock()
-		case message := <-h.Broadcast:
+		case req := <-h.view:
+			h.mutex.Lock()
+			if _, ok := h.clients[req.client]; ok {
+				h.setViewing(req.client, req.todoID)
+			}
+			h.mutex.Unlock()
+		case direct := <-h.direct:
 			h.mutex.Lock()
 			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+				if client.userID != 0 && client.userID == direct.userID {
+					h.sendLocked(client, direct.message)
 				}
 			}
 			h.mutex.Unlock()
+		case message := <-h.Broadcast:
+			h.mutex.Lock()
+			for client := range h.clients {
+				h.sendLocked(client, message)
+			}
+			h.mutex.Unlock()
 		}
 	}
 }
 
-func (h *Hub) HandleWebSocket(c *gin.Context) {
-	conn, err := Upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		log.Println(err)
-		return
+// sendLocked queues a message for a client, dropping the client when its
+// buffer is full. A dropped client stops viewing its todo, so the others see
+// it leave. The caller must hold h.mutex.
+func (h *Hub) sendLocked(client *Client, message []byte) {
+	select {
+	case client.send <- message:
+	default:
+		// Remove it first: telling the viewers sends to other clients, which
+		// may in turn be dropped, and must not reach this one again.
+		close(client.send)
+		delete(h.clients, client)
+		h.setViewing(client, 0)
+	}
+}
+
+// HandleWebSocket upgrades the connection and registers it with the hub,
+// identifying the user through auth. A user can only view todos access lets
+// them read.
+func (h *Hub) HandleWebSocket(auth Authenticator, access TodoAccess) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conn, err := Upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		client := &Client{conn: conn, send: make(chan []byte, 256), access: access}
+
+		// Browsers cannot set headers on a websocket handshake, so the token is
+		// also accepted as a query parameter. Anonymous clients still receive
+		// broadcasts but are not tracked for presence.
+		if claims := clientClaims(c, auth); claims != nil {
+			client.claims = claims
+			client.userID = claims.UserID
+			client.username = claims.Username
+		}
+
+		h.register <- client
+
+		go client.WritePump(h)
+		go client.ReadPump(h)
+	}
+}
+
+func clientClaims(c *gin.Context, auth Authenticator) *models.Claims {
+	token := c.Query("token")
+	if token == "" {
+		bearerToken := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(bearerToken) == 2 {
+			token = bearerToken[1]
+		}
+	}
+	if token == "" {
+		return nil
 	}
-	client := &Client{conn: conn, send: make(chan []byte, 256)}
-	h.register <- client
 
-	go client.WritePump(h)
-	go client.ReadPump(h)
+	claims, err := auth.Authenticate(token)
+	if err != nil {
+		return nil
+	}
+	return claims
 }
 
 func (c *Client) WritePump(h *Hub) {
@@ -116,12 +212,36 @@ func (c *Client) ReadPump(h *Hub) {
 		c.conn.Close()
 	}()
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("error: %v", err)
 			}
 			break
 		}
+		h.handleClientMessage(c, message)
+	}
+}
+
+func (h *Hub) handleClientMessage(c *Client, message []byte) {
+	if c.userID == 0 {
+		return
+	}
+
+	var msg ClientMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return
+	}
+
+	switch msg.Action {
+	case ActionView:
+		// Viewing a todo the user cannot read would tell them, and the
+		// others on it, who is working on it.
+		if !c.access.CanReadTodo(c.claims, msg.TodoID) {
+			return
+		}
+		h.view <- viewRequest{client: c, todoID: msg.TodoID}
+	case ActionLeave:
+		h.view <- viewRequest{client: c, todoID: 0}
 	}
 }
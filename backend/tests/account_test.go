@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/mailer"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+type recordingMailer struct {
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(msg mailer.Message) error {
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+func (m *recordingMailer) lastToken(t *testing.T) string {
+	t.Helper()
+	if len(m.messages) == 0 {
+		t.Fatal("Expected an email to be sent")
+	}
+	match := linkToken.FindStringSubmatch(m.messages[len(m.messages)-1].Text)
+	if match == nil {
+		t.Fatal("Expected the email to contain a link with a token")
+	}
+	return match[1]
+}
+
+func TestEmailVerificationAndPasswordReset(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.AccountToken{})
+
+	mail := &recordingMailer{}
+	userRepo := repository.NewUserRepository(db)
+	tokenService := service.NewTokenService(repository.NewRefreshTokenRepository(db), userRepo, time.Minute, time.Hour)
+	userService := service.NewUserService(userRepo, tokenService, nil, true, service.LockoutPolicy{})
+	accountService := service.NewAccountService(repository.NewAccountTokenRepository(db), userRepo, tokenService, mail,
+		"http://api.test/auth/verify-email", "http://app.test/reset-password")
+
+	user, err := userService.Register("alice", "alice@example.com", "secret1")
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	if _, _, err := userService.Login("alice", "secret1"); err != service.ErrEmailNotVerified {
+		t.Errorf("Expected unverified login to be refused, got %v", err)
+	}
+
+	if err := accountService.SendEmailVerification(user); err != nil {
+		t.Fatalf("Failed to send verification: %v", err)
+	}
+	if to := mail.messages[0].To; len(to) != 1 || to[0] != "alice@example.com" {
+		t.Errorf("Expected mail to alice, got %v", to)
+	}
+	verifyToken := mail.lastToken(t)
+
+	if _, err := accountService.VerifyEmail(verifyToken); err != nil {
+		t.Fatalf("Failed to verify email: %v", err)
+	}
+	if _, err := accountService.VerifyEmail(verifyToken); err != service.ErrInvalidAccountToken {
+		t.Errorf("Expected verification token to be single-use, got %v", err)
+	}
+
+	_, tokens, err := userService.Login("alice", "secret1")
+	if err != nil {
+		t.Fatalf("Expected verified user to log in: %v", err)
+	}
+
+	sent := len(mail.messages)
+	if err := accountService.ForgotPassword("nobody@example.com"); err != nil {
+		t.Errorf("Expected unknown address to be ignored, got %v", err)
+	}
+	if len(mail.messages) != sent {
+		t.Error("Expected no email for an unknown address")
+	}
+
+	if err := accountService.ForgotPassword("alice@example.com"); err != nil {
+		t.Fatalf("Failed to request reset: %v", err)
+	}
+	staleToken := mail.lastToken(t)
+	if err := accountService.ForgotPassword("alice@example.com"); err != nil {
+		t.Fatalf("Failed to request reset: %v", err)
+	}
+	resetToken := mail.lastToken(t)
+
+	if _, err := accountService.ResetPassword(staleToken, "newsecret"); err != service.ErrInvalidAccountToken {
+		t.Errorf("Expected older reset link to be invalidated, got %v", err)
+	}
+	if _, err := accountService.ResetPassword(resetToken, "newsecret"); err != nil {
+		t.Fatalf("Failed to reset password: %v", err)
+	}
+	if _, err := accountService.ResetPassword(resetToken, "another"); err != service.ErrInvalidAccountToken {
+		t.Errorf("Expected reset token to be single-use, got %v", err)
+	}
+
+	if _, err := tokenService.Authenticate(tokens.AccessToken); err != service.ErrTokenRevoked {
+		t.Errorf("Expected reset to end existing sessions, got %v", err)
+	}
+	if _, _, err := userService.Login("alice", "newsecret"); err != nil {
+		t.Errorf("Expected login with new password, got %v", err)
+	}
+
+	accountService.ForgotPassword("alice@example.com")
+	expired := mail.lastToken(t)
+	db.Model(&models.AccountToken{}).Where("used_at IS NULL").Update("expires_at", time.Now().Add(-time.Minute))
+	if _, err := accountService.ResetPassword(expired, "newsecret"); err != service.ErrInvalidAccountToken {
+		t.Errorf("Expected expired token to be rejected, got %v", err)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+
+	dir := t.TempDir()
+	m, err := mailer.New(mailer.Config{Driver: mailer.DriverFile, Dir: dir, From: "todoapp <no-reply@example.com>"})
+	if err != nil {
+		t.Fatalf("Failed to create mailer: %v", err)
+	}
+
+	err = m.Send(mailer.Message{
+		To:      []string{"alice@example.com"},
+		Subject: "Hello",
+		Text:    "Plain body",
+		HTML:    "<p>HTML body</p>",
+	})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one .eml file, got %d", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	for _, want := range []string{"To: alice@example.com", "Subject: Hello", "multipart/alternative", "Plain body", "<p>HTML body</p>"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected message to contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+func TestAuditLog(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.AuditEvent{})
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser}
+	user.SetPassword("secret1")
+	db.Create(user)
+
+	userRepo := repository.NewUserRepository(db)
+	tokenService := service.NewTokenService(repository.NewRefreshTokenRepository(db), userRepo, time.Minute, time.Hour)
+	userService := service.NewUserService(userRepo, tokenService, nil, false, service.LockoutPolicy{})
+	auditService := service.NewAuditService(repository.NewAuditRepository(db))
+	userHandler := handlers.NewUserHandler(userService, tokenService, nil, nil, auditService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/login", userHandler.Login)
+	router.GET("/admin/audit", auditHandler.GetAuditEvents)
+	router.GET("/admin/audit/export", auditHandler.ExportAuditEvents)
+
+	login := func(password string) int {
+		body := `{"username": "alice", "password": "` + password + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "audit-test")
+		req.RemoteAddr = "203.0.113.7:4321"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := login("wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("Expected wrong password to fail, got %d", code)
+	}
+	if code := login("secret1"); code != http.StatusOK {
+		t.Fatalf("Expected login to succeed, got %d", code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/audit?action=auth.login&outcome=failure", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var list handlers.AuditEventListResponse
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || list.Total != 1 {
+		t.Fatalf("Expected one failed login, got %d %+v", w.Code, list)
+	}
+	failed := list.Events[0]
+	if failed.IP != "203.0.113.7" || failed.UserAgent != "audit-test" || failed.TargetName != "alice" {
+		t.Errorf("Expected request details to be recorded, got %+v", failed)
+	}
+	if failed.ActorID != nil || failed.Details["reason"] != "invalid_credentials" {
+		t.Errorf("Expected anonymous failure with reason, got %+v", failed)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/audit/export?after_id=1", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var exported []models.AuditEvent
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var event models.AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Expected JSON Lines, got %q", scanner.Text())
+		}
+		exported = append(exported, event)
+	}
+	if len(exported) != 1 || exported[0].Outcome != models.AuditSuccess || *exported[0].ActorID != user.ID {
+		t.Errorf("Expected the successful login after the first event, got %+v", exported)
+	}
+
+	if err := db.Model(&failed).Update("outcome", models.AuditSuccess).Error; err != models.ErrAuditEventImmutable {
+		t.Errorf("Expected audit events to be immutable, got %v", err)
+	}
+	if err := db.Delete(&failed).Error; err != models.ErrAuditEventImmutable {
+		t.Errorf("Expected audit events not to be deleted, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/middlewares"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/websocket"
+)
+
+func TestCalDAV(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Todo{}, &models.Project{}, &models.CustomRole{}, &models.PersonalAccessToken{})
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser, Timezone: "Europe/Berlin"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", Role: models.RoleUser}
+	db.Create(alice)
+	db.Create(bob)
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	userRepo := repository.NewUserRepository(db)
+	userService := service.NewUserService(userRepo, nil, nil, false, service.LockoutPolicy{})
+	policyService := service.NewPolicyService(repository.NewRoleRepository(db), repository.NewProjectRepository(db), userRepo)
+	patService := service.NewPersonalAccessTokenService(repository.NewPersonalAccessTokenRepository(db), userRepo, policyService)
+	todoService := service.NewTodoService(repository.NewTodoRepository(db))
+	caldavHandler := handlers.NewCalDAVHandler(todoService, userService, policyService, hub, "https://todo.example.com/caldav")
+
+	_, writeToken, err := patService.CreateToken(alice, "phone", []string{models.ScopeReadTodos, models.ScopeWriteTodos}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	_, readToken, _ := patService.CreateToken(alice, "reader", []string{models.ScopeReadTodos}, nil)
+
+	todoService.CreateTodo(&models.Todo{Name: "Water plants", Status: "pending", OwnerID: alice.ID}, nil)
+	todoService.CreateTodo(&models.Todo{Name: "Review PR", Status: "pending", OwnerID: bob.ID}, []uint{alice.ID})
+	todoService.CreateTodo(&models.Todo{Name: "Bob's own", Status: "pending", OwnerID: bob.ID}, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	dav := router.Group("/caldav", middlewares.BasicAuthMiddleware(patService, "todoapp"), middlewares.MethodScope(models.ScopeReadTodos, models.ScopeWriteTodos))
+	dav.Handle("PROPFIND", "/*path", caldavHandler.PropFind)
+	dav.Handle("REPORT", "/*path", caldavHandler.Report)
+	dav.GET("/*path", caldavHandler.GetResource)
+	dav.PUT("/*path", caldavHandler.PutResource)
+	dav.DELETE("/*path", caldavHandler.DeleteResource)
+
+	send := func(method, path, token, body string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.SetBasicAuth("alice", token)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	collection := "/caldav/calendars/alice/todos/"
+
+	req := httptest.NewRequest("PROPFIND", "/caldav/", nil)
+	req.SetBasicAuth("bob", writeToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Basic") {
+		t.Errorf("Expected another user's token to be challenged, got %d", w.Code)
+	}
+
+	w = send("PROPFIND", "/caldav/", writeToken, `<d:propfind xmlns:d="DAV:"><d:prop><d:current-user-principal/></d:prop></d:propfind>`, "Depth", "0")
+	if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "<d:href>/caldav/principals/alice/</d:href>") {
+		t.Errorf("Expected the service root to name the principal, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = send("PROPFIND", collection, readToken, `<d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/"><d:prop><d:getetag/><cs:getctag/><d:quota-used-bytes/></d:prop></d:propfind>`, "Depth", "1")
+	listing := w.Body.String()
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected a multistatus, got %d %s", w.Code, listing)
+	}
+	for _, want := range []string{collection + "todo-1.ics", collection + "todo-2.ics", "<cs:getctag>", `<d:getetag>&#34;1&#34;</d:getetag>`, "<d:quota-used-bytes/></d:prop><d:status>HTTP/1.1 404 Not Found"} {
+		if !strings.Contains(listing, want) {
+			t.Errorf("Expected the listing to contain %q:\n%s", want, listing)
+		}
+	}
+	if strings.Contains(listing, "todo-3.ics") {
+		t.Error("Expected todos alice neither owns nor is assigned to to be left out")
+	}
+
+	if w := send(http.MethodGet, collection+"todo-3.ics", writeToken, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected other users' todos to be hidden, got %d", w.Code)
+	}
+	if w := send(http.MethodPut, collection+"new.ics", readToken, ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a read-only token to be refused writes, got %d", w.Code)
+	}
+
+	// A client creates a task under its own name and UID.
+	created := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VTODO\r\nUID:ABC-123\r\nSUMMARY:Buy milk\r\n" +
+		"DUE;TZID=Europe/Berlin:20240501T180000\r\nPRIORITY:1\r\nCATEGORIES:errands,home\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+	if w := send(http.MethodPut, collection+"ABC-123.ics", writeToken, created, "If-None-Match", "*"); w.Code != http.StatusCreated {
+		t.Fatalf("Expected the task to be created, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send(http.MethodPut, collection+"ABC-123.ics", writeToken, created, "If-None-Match", "*"); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected If-None-Match to protect the existing task, got %d", w.Code)
+	}
+
+	todo, _ := todoService.GetTodoByCalDAVName(alice.ID, "ABC-123.ics")
+	if todo == nil || todo.Name != "Buy milk" || todo.Priority != "high" || todo.Tags != "errands,home" || todo.OwnerID != alice.ID {
+		t.Fatalf("Expected the VTODO to be stored, got %+v", todo)
+	}
+	if want := time.Date(2024, 5, 1, 16, 0, 0, 0, time.UTC); todo.DueDate == nil || !todo.DueDate.Equal(want) || todo.DueTimezone != "Europe/Berlin" {
+		t.Errorf("Expected the due date in its zone, got %v %s", todo.DueDate, todo.DueTimezone)
+	}
+
+	w = send(http.MethodGet, collection+"ABC-123.ics", writeToken, "")
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"1"` || !strings.Contains(w.Body.String(), "UID:ABC-123") {
+		t.Errorf("Expected the task back with its UID, got %d %s %s", w.Code, w.Header().Get("ETag"), w.Body.String())
+	}
+
+	// Ticking it off updates the todo like the JSON API would.
+	completed := strings.Replace(created, "PRIORITY:1\r\n", "STATUS:COMPLETED\r\n", 1)
+	if w := send(http.MethodPut, collection+"ABC-123.ics", writeToken, completed, "If-Match", `"2"`); w.Code != http.StatusPreconditionFailed || w.Header().Get("ETag") != `"1"` {
+		t.Errorf("Expected a stale ETag to be refused, got %d %s", w.Code, w.Header().Get("ETag"))
+	}
+	if w := send(http.MethodPut, collection+"ABC-123.ics", writeToken, completed, "If-Match", `"1"`); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected the task to be updated, got %d %s", w.Code, w.Body.String())
+	}
+	todo, _ = todoService.GetTodo(todo.ID)
+	if todo.Status != "completed" || todo.Priority != "" || todo.Version != 2 {
+		t.Errorf("Expected the update to replace the todo and bump its version, got %+v", todo)
+	}
+
+	multiget := `<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><d:getetag/><c:calendar-data/></d:prop>` +
+		`<d:href>` + collection + `ABC-123.ics</d:href><d:href>` + collection + `todo-3.ics</d:href></c:calendar-multiget>`
+	w = send("REPORT", collection, readToken, multiget)
+	if body := w.Body.String(); w.Code != http.StatusMultiStatus || !strings.Contains(body, "STATUS:COMPLETED") || !strings.Contains(body, "<d:status>HTTP/1.1 404 Not Found</d:status>") {
+		t.Errorf("Expected the multiget to return the task and miss the hidden one, got %d %s", w.Code, body)
+	}
+
+	query := `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><d:getetag/></d:prop>` +
+		`<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT"/></c:comp-filter></c:filter></c:calendar-query>`
+	if w := send("REPORT", collection, readToken, query); strings.Contains(w.Body.String(), "<d:response>") {
+		t.Errorf("Expected no events, got %s", w.Body.String())
+	}
+	query = strings.Replace(query, "VEVENT", "VTODO", 1)
+	if w := send("REPORT", collection, readToken, query); strings.Count(w.Body.String(), "<d:response>") != 3 {
+		t.Errorf("Expected every task, got %s", w.Body.String())
+	}
+
+	if w := send(http.MethodDelete, collection+"todo-2.ics", writeToken, ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected an assignee to be refused deleting, got %d", w.Code)
+	}
+	if w := send(http.MethodDelete, collection+"ABC-123.ics", writeToken, "", "If-Match", `"2"`); w.Code != http.StatusNoContent {
+		t.Errorf("Expected the task to be deleted, got %d", w.Code)
+	}
+	if w := send(http.MethodGet, collection+"ABC-123.ics", writeToken, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the deleted task to be gone, got %d", w.Code)
+	}
+}
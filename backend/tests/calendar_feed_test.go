@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+func TestCalendarFeed(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Todo{}, &models.CalendarFeed{}, &models.AuditEvent{})
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser, Timezone: "Asia/Tokyo"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", Role: models.RoleUser}
+	db.Create(alice)
+	db.Create(bob)
+
+	todoRepo := repository.NewTodoRepository(db)
+	todoService := service.NewTodoService(todoRepo)
+	feedService := service.NewCalendarFeedService(repository.NewCalendarFeedRepository(db), repository.NewUserRepository(db), todoRepo)
+	feedHandler := handlers.NewCalendarFeedHandler(feedService, service.NewAuditService(repository.NewAuditRepository(db)), "https://todo.example.com/feeds")
+
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	projectID := uint(7)
+
+	rent := &models.Todo{Name: "Pay rent", Description: "Bank: Mizuho, ref; 42\nAsk about the deposit " + strings.Repeat("again and ", 10), Status: "pending", Priority: "high", OwnerID: alice.ID, ProjectID: &projectID}
+	rent.SetTagList([]string{"home", "money"})
+	rent.SetDueDate(time.Date(2024, 5, 1, 0, 0, 0, 0, tokyo), true, tokyo)
+	todoService.CreateTodo(rent, nil)
+
+	review := &models.Todo{Name: "Review PR", Status: "in_progress", OwnerID: bob.ID}
+	scheduled := time.Date(2024, 5, 2, 1, 0, 0, 0, time.UTC)
+	review.ScheduledAt = &scheduled
+	review.EstimatedDuration = 1800
+	todoService.CreateTodo(review, []uint{alice.ID})
+
+	todoService.CreateTodo(&models.Todo{Name: "Done already", Status: "completed", OwnerID: alice.ID}, nil)
+	todoService.CreateTodo(&models.Todo{Name: "Bob's own", Status: "pending", OwnerID: bob.ID}, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	authed := router.Group("/", func(c *gin.Context) {
+		c.Set("user", &models.Claims{UserID: alice.ID, Username: alice.Username, Role: alice.Role})
+	})
+	authed.POST("/me/calendar-feed", feedHandler.RotateFeed)
+	authed.DELETE("/me/calendar-feed", feedHandler.DisableFeed)
+	router.GET("/feeds/:token", feedHandler.ServeFeed)
+
+	send := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	_, secret, err := feedService.Rotate(alice.ID)
+	if err != nil {
+		t.Fatalf("Failed to create feed: %v", err)
+	}
+	feedPath := "/feeds/" + secret + ".ics"
+
+	w := send(http.MethodGet, feedPath)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("Expected an iCalendar feed, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	feed := w.Body.String()
+
+	for _, line := range strings.Split(strings.TrimSuffix(feed, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Expected lines to be folded at 75 octets, got %q", line)
+		}
+	}
+	unfolded := strings.ReplaceAll(feed, "\r\n ", "")
+
+	for _, want := range []string{
+		"UID:todo-1@todo.example.com",
+		"DUE;VALUE=DATE:20240501",
+		"PRIORITY:1",
+		"CATEGORIES:home,money",
+		`DESCRIPTION:Bank: Mizuho\, ref\; 42\nAsk about the deposit again`,
+		"STATUS:IN-PROCESS",
+		"DTSTART:20240502T010000Z",
+		"DTEND:20240502T013000Z",
+		"STATUS:COMPLETED",
+	} {
+		if !strings.Contains(unfolded, want) {
+			t.Errorf("Expected the feed to contain %q:\n%s", want, unfolded)
+		}
+	}
+	if strings.Contains(unfolded, "Bob's own") {
+		t.Error("Expected todos alice neither owns nor is assigned to to be left out")
+	}
+
+	filtered := send(http.MethodGet, feedPath+"?status=pending,in_progress&project_id=7&component=todo").Body.String()
+	if !strings.Contains(filtered, "SUMMARY:Pay rent") || strings.Contains(filtered, "Review PR") || strings.Contains(filtered, "BEGIN:VEVENT") {
+		t.Errorf("Expected only the project's todos as VTODOs:\n%s", filtered)
+	}
+	if w := send(http.MethodGet, feedPath+"?status=someday"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid status to be refused, got %d", w.Code)
+	}
+
+	// Rotating replaces the link.
+	if w := send(http.MethodPost, "/me/calendar-feed"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "https://todo.example.com/feeds/tdc_") {
+		t.Fatalf("Expected a new feed URL, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send(http.MethodGet, feedPath); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the old link to stop working, got %d", w.Code)
+	}
+
+	if w := send(http.MethodDelete, "/me/calendar-feed"); w.Code != http.StatusNoContent {
+		t.Errorf("Expected the feed to be disabled, got %d", w.Code)
+	}
+	if w := send(http.MethodDelete, "/me/calendar-feed"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected disabling twice to report a missing feed, got %d", w.Code)
+	}
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/websocket"
+)
+
+func TestCalendar(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Todo{}, &models.Project{}, &models.CustomRole{})
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", Role: models.RoleUser}
+	db.Create(alice)
+	db.Create(bob)
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	userRepo := repository.NewUserRepository(db)
+	userService := service.NewUserService(userRepo, nil, nil, false, service.LockoutPolicy{})
+	policyService := service.NewPolicyService(repository.NewRoleRepository(db), repository.NewProjectRepository(db), userRepo)
+	todoService := service.NewTodoService(repository.NewTodoRepository(db))
+	todoHandler := handlers.NewTodoHandler(todoService, userService, nil, policyService, hub)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	authed := router.Group("/", func(c *gin.Context) {
+		c.Set("user", &models.Claims{UserID: alice.ID, Username: alice.Username, Role: alice.Role})
+	})
+	authed.POST("/todos", todoHandler.CreateTodo)
+	authed.GET("/calendar", todoHandler.GetCalendar)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, body := range []string{
+		`{"name": "Late start", "start_at": "2024-05-03T00:00:00Z", "due_date": "2024-05-02T12:00:00Z"}`,
+		`{"name": "Late block", "scheduled_at": "2024-05-03T00:00:00Z", "due_date": "2024-05-02"}`,
+		`{"name": "Endless", "estimated_duration": -60}`,
+	} {
+		if w := send(http.MethodPost, "/todos", body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be refused, got %d", body, w.Code)
+		}
+	}
+
+	// Starting during an all-day due date is still before it ends.
+	if w := send(http.MethodPost, "/todos", `{"name": "Same day", "start_at": "2024-05-02T09:00:00Z", "due_date": "2024-05-02"}`); w.Code != http.StatusCreated {
+		t.Errorf("Expected a start on the due day to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, body := range []string{
+		`{"name": "Standup", "scheduled_at": "2024-05-01T09:00:00Z", "estimated_duration": 3600}`,
+		`{"name": "Project", "start_at": "2024-04-20T00:00:00Z", "due_date": "2024-05-10T00:00:00Z"}`,
+		`{"name": "Someday"}`,
+		`{"name": "Vacation", "due_date": "2024-06-01"}`,
+	} {
+		if w := send(http.MethodPost, "/todos", body); w.Code != http.StatusCreated {
+			t.Fatalf("Failed to create %s: %d %s", body, w.Code, w.Body.String())
+		}
+	}
+
+	hidden := &models.Todo{Name: "Bob's block", Status: "pending", OwnerID: bob.ID}
+	scheduled := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	hidden.ScheduledAt = &scheduled
+	todoService.CreateTodo(hidden, nil)
+
+	w := send(http.MethodGet, "/calendar?from=2024-05-01&to=2024-05-03", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to get calendar: %d %s", w.Code, w.Body.String())
+	}
+
+	var entries []handlers.CalendarEntryResponse
+	json.Unmarshal(w.Body.Bytes(), &entries)
+
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Todo.Name)
+	}
+	if strings.Join(names, ",") != "Project,Standup,Same day" {
+		t.Errorf("Expected the overlapping todos in start order, got %v", names)
+	}
+	if len(entries) == 3 && !entries[1].End.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the standup to last an hour, got %v", entries[1].End)
+	}
+
+	if w := send(http.MethodGet, "/calendar?from=2024-05-03&to=2024-05-01", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a reversed window to be refused, got %d", w.Code)
+	}
+	if w := send(http.MethodGet, "/calendar?from=2024-01-01&to=2026-01-01", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a window over a year to be refused, got %d", w.Code)
+	}
+}
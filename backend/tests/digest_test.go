@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/mailer"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/websocket"
+)
+
+func TestDigest(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Todo{}, &models.Project{}, &models.AccountToken{})
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser, Timezone: "Europe/Berlin"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", Role: models.RoleUser}
+	carol := &models.User{Username: "carol", Email: "carol@example.com", Role: models.RoleUser}
+	db.Create(alice)
+	db.Create(bob)
+	db.Create(carol)
+
+	mail := &recordingMailer{}
+	userRepo := repository.NewUserRepository(db)
+	todoRepo := repository.NewTodoRepository(db)
+	userService := service.NewUserService(userRepo, nil, nil, false, service.LockoutPolicy{})
+	todoService := service.NewTodoService(todoRepo)
+
+	// Two services stand in for two replicas sharing the database.
+	newDigests := func() *service.DigestService {
+		return service.NewDigestService(todoRepo, userRepo, repository.NewAccountTokenRepository(db), mail, "https://todo.example.com", "https://api.example.com/digest/unsubscribe")
+	}
+	digests, otherDigests := newDigests(), newDigests()
+	handler := handlers.NewDigestHandler(digests, userService)
+
+	// Digests go out at seven in alice's morning.
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	today := time.Now().In(berlin)
+	at := time.Date(today.Year(), today.Month(), today.Day(), 8, 0, 0, 0, berlin)
+
+	overdue := at.Add(-26 * time.Hour)
+	dueToday := at.Add(3 * time.Hour)
+	dueLater := at.AddDate(0, 0, 5)
+	todoService.CreateTodo(&models.Todo{Name: "Overdue report", Status: "pending", OwnerID: alice.ID, DueDate: &overdue}, nil)
+	// Previews are of the real now, so this one is due all day to stay due.
+	callBank := &models.Todo{Name: "Call bank & <insurer>", Status: "pending", OwnerID: alice.ID}
+	callBank.SetDueDate(at, true, berlin)
+	todoService.CreateTodo(callBank, nil)
+	todoService.CreateTodo(&models.Todo{Name: "Review PR", Status: "in_progress", OwnerID: bob.ID, DueDate: &dueLater}, []uint{alice.ID})
+	todoService.CreateTodo(&models.Todo{Name: "Book flights", Status: "completed", OwnerID: alice.ID}, nil)
+	todoService.CreateTodo(&models.Todo{Name: "Bob's own", Status: "pending", OwnerID: bob.ID, DueDate: &dueToday}, nil)
+	tomorrow := &models.Todo{Name: "Pay rent", Status: "pending", OwnerID: alice.ID}
+	tomorrow.SetDueDate(at.AddDate(0, 0, 1), true, berlin)
+	todoService.CreateTodo(tomorrow, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var current *models.User
+	authed := router.Group("/", func(c *gin.Context) {
+		c.Set("user", &models.Claims{UserID: current.ID, Username: current.Username, Role: current.Role})
+	})
+	authed.GET("/me/digest", handler.GetDigest)
+	authed.PUT("/me/digest", handler.UpdateDigest)
+	authed.GET("/me/digest/preview", handler.PreviewDigest)
+	router.GET("/digest/unsubscribe", handler.ConfirmUnsubscribe)
+	router.POST("/digest/unsubscribe", handler.Unsubscribe)
+
+	sendAs := func(user *models.User, method, path, contentType, body string) *httptest.ResponseRecorder {
+		current = user
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	send := func(user *models.User, method, path, body string) *httptest.ResponseRecorder {
+		return sendAs(user, method, path, "application/json", body)
+	}
+
+	if w := send(alice, http.MethodPut, "/me/digest", `{"frequency": "hourly"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown frequency to be refused, got %d", w.Code)
+	}
+	for _, user := range []*models.User{alice, carol} {
+		if w := send(user, http.MethodPut, "/me/digest", `{"frequency": "daily"}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"daily"`) {
+			t.Fatalf("Expected the digest to be turned on, got %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	w := send(alice, http.MethodGet, "/me/digest/preview?format=text", "")
+	text := w.Body.String()
+	for _, want := range []string{"Overdue\n  - Overdue report", "Due today\n  - Call bank & <insurer>", "Assigned to you\n  - Review PR (From bob.", "Book flights (Now completed)"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected the preview to mention %q, got:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "Bob's own") || strings.Contains(text, "Pay rent (Due") {
+		t.Errorf("Expected the preview to stick to alice's todos due today, got:\n%s", text)
+	}
+	w = send(alice, http.MethodGet, "/me/digest/preview?frequency=weekly", "")
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") || !strings.Contains(w.Body.String(), "Call bank &amp; &lt;insurer&gt;") || !strings.Contains(w.Body.String(), "<strong>Pay rent</strong> <span style=\"color: #666;\">Due") {
+		t.Errorf("Expected an escaped HTML preview of the week, got:\n%s", w.Body.String())
+	}
+
+	if sent, err := digests.Send(at.Add(-2 * time.Hour)); err != nil || sent != 0 {
+		t.Errorf("Expected nothing before seven, got %d %v", sent, err)
+	}
+	if sent, err := digests.Send(at); err != nil || sent != 1 {
+		t.Fatalf("Expected alice's digest, got %d %v", sent, err)
+	}
+	if sent, _ := otherDigests.Send(at.Add(time.Hour)); sent != 0 {
+		t.Errorf("Expected another replica not to send it again, got %d", sent)
+	}
+	if len(mail.messages) != 1 || mail.messages[0].To[0] != "alice@example.com" || mail.messages[0].HTML == "" {
+		t.Fatalf("Expected one HTML and text email to alice, got %+v", mail.messages)
+	}
+
+	// Opening the link in the email only asks for confirmation; the POST
+	// from that page, or from a one-click mail client, turns the digest off
+	// once.
+	text = mail.messages[0].Text
+	link := strings.TrimSpace(text[strings.Index(text, "https://api.example.com/digest/unsubscribe"):])
+	if mail.messages[0].Unsubscribe != link {
+		t.Errorf("Expected a one-click unsubscribe header for %s, got %q", link, mail.messages[0].Unsubscribe)
+	}
+	unsubscribe, _ := url.Parse(link)
+	for i := 0; i < 2; i++ {
+		w = send(alice, http.MethodGet, "/digest/unsubscribe?"+unsubscribe.RawQuery, "")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<form method="post">`) || !strings.Contains(w.Body.String(), unsubscribe.Query().Get("token")) {
+			t.Fatalf("Expected a confirmation page, got %d %s", w.Code, w.Body.String())
+		}
+	}
+	if w := send(alice, http.MethodGet, "/me/digest", ""); !strings.Contains(w.Body.String(), `"daily"`) {
+		t.Fatalf("Expected opening the link to leave the digest on, got %s", w.Body.String())
+	}
+	if w := sendAs(alice, http.MethodPost, "/digest/unsubscribe?"+unsubscribe.RawQuery, "application/x-www-form-urlencoded", "List-Unsubscribe=One-Click"); w.Code != http.StatusOK {
+		t.Fatalf("Expected the one-click unsubscribe to work, got %d %s", w.Code, w.Body.String())
+	}
+	if w := sendAs(alice, http.MethodPost, "/digest/unsubscribe", "application/x-www-form-urlencoded", url.Values{"token": {unsubscribe.Query().Get("token")}}.Encode()); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected the link to work once, got %d", w.Code)
+	}
+	var settings handlers.DigestResponse
+	json.Unmarshal(send(alice, http.MethodGet, "/me/digest", "").Body.Bytes(), &settings)
+	if settings.Frequency != "off" {
+		t.Errorf("Expected the digest to be off, got %q", settings.Frequency)
+	}
+	if sent, _ := digests.Send(at.AddDate(0, 0, 1)); sent != 0 {
+		t.Errorf("Expected no more digests, got %d", sent)
+	}
+}
+
+// bouncingMailer fails every message to one address.
+type bouncingMailer struct {
+	recordingMailer
+	bounce string
+}
+
+func (m *bouncingMailer) Send(msg mailer.Message) error {
+	if msg.To[0] == m.bounce {
+		return errors.New("mailbox unavailable")
+	}
+	return m.recordingMailer.Send(msg)
+}
+
+func TestScheduledEmailsCarryOnAfterAFailure(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Todo{}, &models.Project{}, &models.AccountToken{}, &models.Notification{})
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser, DigestFrequency: models.DigestDaily}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", Role: models.RoleUser, DigestFrequency: models.DigestDaily}
+	db.Create(alice)
+	db.Create(bob)
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	mail := &bouncingMailer{bounce: "alice@example.com"}
+	userRepo := repository.NewUserRepository(db)
+	todoRepo := repository.NewTodoRepository(db)
+	todoService := service.NewTodoService(todoRepo)
+	digests := service.NewDigestService(todoRepo, userRepo, repository.NewAccountTokenRepository(db), mail, "https://todo.example.com", "https://api.example.com/digest/unsubscribe")
+	notifications := service.NewNotificationService(repository.NewNotificationRepository(db), userRepo, hub, mail, "https://todo.example.com")
+
+	today := time.Now().UTC()
+	at := time.Date(today.Year(), today.Month(), today.Day(), 8, 0, 0, 0, time.UTC)
+	overdue := at.AddDate(0, 0, -2)
+	for _, user := range []*models.User{alice, bob} {
+		todoService.CreateTodo(&models.Todo{Name: "Late", Status: "pending", OwnerID: user.ID, DueDate: &overdue}, nil)
+		notifications.Notify(&models.Notification{UserID: user.ID, Kind: models.NotificationReminder, Key: "test:" + user.Username, Title: "Late is due", Email: true})
+	}
+
+	// alice's mailbox bounces first, which must not keep bob waiting.
+	if sent, err := digests.Send(at); err != nil || sent != 1 {
+		t.Fatalf("Expected bob's digest despite alice's failing, got %d %v", sent, err)
+	}
+	if err := notifications.Deliver(at); err != nil {
+		t.Fatalf("Expected failed emails not to stop delivery, got %v", err)
+	}
+	if len(mail.messages) != 2 || mail.messages[0].To[0] != "bob@example.com" || mail.messages[1].To[0] != "bob@example.com" {
+		t.Fatalf("Expected bob's digest and notification, got %+v", mail.messages)
+	}
+
+	// Once alice's mailbox works again, the next runs catch up.
+	mail.bounce = ""
+	if sent, err := digests.Send(at.Add(time.Hour)); err != nil || sent != 1 {
+		t.Errorf("Expected alice's digest to be retried, got %d %v", sent, err)
+	}
+	if err := notifications.Deliver(at.Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to deliver notifications: %v", err)
+	}
+	if len(mail.messages) != 4 || mail.messages[2].To[0] != "alice@example.com" || mail.messages[3].To[0] != "alice@example.com" {
+		t.Errorf("Expected alice's digest and notification on the retry, got %+v", mail.messages)
+	}
+}
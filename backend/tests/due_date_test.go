@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/websocket"
+)
+
+func TestAllDayDueDates(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Todo{}, &models.Project{}, &models.CustomRole{})
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser, Timezone: "Asia/Tokyo"}
+	db.Create(alice)
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	userRepo := repository.NewUserRepository(db)
+	userService := service.NewUserService(userRepo, nil, nil, false, service.LockoutPolicy{})
+	policyService := service.NewPolicyService(repository.NewRoleRepository(db), repository.NewProjectRepository(db), userRepo)
+	todoHandler := handlers.NewTodoHandler(service.NewTodoService(repository.NewTodoRepository(db)), userService, nil, policyService, hub)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	authed := router.Group("/", func(c *gin.Context) {
+		c.Set("user", &models.Claims{UserID: alice.ID, Username: alice.Username, Role: alice.Role})
+	})
+	authed.POST("/todos", todoHandler.CreateTodo)
+	authed.PATCH("/todos/:id", todoHandler.PatchTodo)
+
+	send := func(method, path, body string) handlers.TodoResponse {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK && w.Code != http.StatusCreated {
+			t.Fatalf("%s %s failed: %d %s", method, path, w.Code, w.Body.String())
+		}
+		var todo handlers.TodoResponse
+		json.Unmarshal(w.Body.Bytes(), &todo)
+		return todo
+	}
+
+	// A bare date is an all-day task starting at midnight in the user's zone.
+	todo := send(http.MethodPost, "/todos", `{"name": "Pay rent", "due_date": "2024-05-01"}`)
+	if want := time.Date(2024, 4, 30, 15, 0, 0, 0, time.UTC); !todo.AllDay || !todo.DueDate.Equal(want) {
+		t.Errorf("Expected an all-day task due at %v, got %+v", want, todo)
+	}
+	if todo.DueLocalDate != "2024-05-01" || todo.DueTimezone != "Asia/Tokyo" {
+		t.Errorf("Expected the local date in Tokyo, got %s in %s", todo.DueLocalDate, todo.DueTimezone)
+	}
+
+	var stored models.Todo
+	db.First(&stored, todo.ID)
+	if stored.DueDate.Location() != time.UTC || !stored.AllDay {
+		t.Errorf("Expected the due date to be stored in UTC, got %v", stored.DueDate)
+	}
+
+	// Late evening UTC is already the next day in Tokyo.
+	todo = send(http.MethodPatch, "/todos/1", `{"due_date": "2024-05-01T20:00:00Z", "all_day": true}`)
+	if todo.DueLocalDate != "2024-05-02" || !todo.DueDate.Equal(time.Date(2024, 5, 1, 15, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected an all-day task on 2024-05-02 in Tokyo, got %v (%s)", todo.DueDate, todo.DueLocalDate)
+	}
+
+	todo = send(http.MethodPatch, "/todos/1", `{"all_day": false}`)
+	if todo.AllDay || todo.DueLocalDate != "2024-05-02" {
+		t.Errorf("Expected clearing all_day to keep the due date, got %+v", todo)
+	}
+
+	todo = send(http.MethodPatch, "/todos/1", `{"due_date": null}`)
+	if todo.DueDate != nil || todo.AllDay || todo.DueTimezone != "" {
+		t.Errorf("Expected the due date to be cleared, got %+v", todo)
+	}
+}
@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/websocket"
+)
+
+func TestEscalation(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Todo{}, &models.Project{}, &models.CustomRole{}, &models.Notification{}, &models.EscalationRule{}, &models.TodoEvent{}, &models.AuditEvent{})
+
+	admin := &models.User{Username: "admin", Email: "admin@example.com", Role: models.RoleAdmin}
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser}
+	carol := &models.User{Username: "carol", Email: "carol@example.com", Role: models.RoleUser}
+	db.Create(admin)
+	db.Create(alice)
+	db.Create(carol)
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	mail := &recordingMailer{}
+	userRepo := repository.NewUserRepository(db)
+	todoRepo := repository.NewTodoRepository(db)
+	projectRepo := repository.NewProjectRepository(db)
+	policyService := service.NewPolicyService(repository.NewRoleRepository(db), projectRepo, userRepo)
+	todoService := service.NewTodoService(todoRepo)
+	notifications := service.NewNotificationService(repository.NewNotificationRepository(db), userRepo, hub, mail, "https://todo.example.com")
+
+	// Two services stand in for two replicas sharing the database.
+	newEscalations := func() *service.EscalationService {
+		return service.NewEscalationService(repository.NewEscalationRepository(db), repository.NewTodoEventRepository(db), todoRepo, userRepo, projectRepo, notifications)
+	}
+	escalations, otherEscalations := newEscalations(), newEscalations()
+	handler := handlers.NewEscalationHandler(escalations, todoService, policyService, service.NewAuditService(repository.NewAuditRepository(db)))
+
+	project := &models.Project{Name: "Launch", LeadID: carol.ID}
+	projectRepo.Create(project, []uint{alice.ID})
+
+	now := time.Now().Truncate(time.Second)
+	due := now.Add(-time.Hour)
+	todo := &models.Todo{Name: "Submit report", Status: "pending", OwnerID: alice.ID, DueDate: &due, ProjectID: &project.ID}
+	todoService.CreateTodo(todo, nil)
+	later := now.Add(30 * 24 * time.Hour)
+	todoService.CreateTodo(&models.Todo{Name: "Not due yet", Status: "pending", OwnerID: alice.ID, DueDate: &later}, nil)
+	todoService.CreateTodo(&models.Todo{Name: "Already done", Status: "completed", OwnerID: alice.ID, DueDate: &due}, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var current *models.User
+	authed := router.Group("/", func(c *gin.Context) {
+		c.Set("user", &models.Claims{UserID: current.ID, Username: current.Username, Role: current.Role})
+	})
+	authed.POST("/admin/escalation-rules", handler.CreateRule)
+	authed.PUT("/admin/escalation-rules/:id", handler.UpdateRule)
+	authed.GET("/todos/:id/history", handler.GetHistory)
+
+	send := func(user *models.User, method, path, body string) *httptest.ResponseRecorder {
+		current = user
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, body := range []string{`{"notify": "owner"}`, `{"after": -1, "notify": "owner"}`, `{"after": 60, "notify": "everyone"}`} {
+		if w := send(admin, http.MethodPost, "/admin/escalation-rules", body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be refused, got %d", body, w.Code)
+		}
+	}
+	if w := send(admin, http.MethodPost, "/admin/escalation-rules", `{"after": 86400, "notify": "owner", "email": true}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected the rule to be created, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send(admin, http.MethodPost, "/admin/escalation-rules", `{"after": 86400, "notify": "assignees"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected the rule to be created, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send(admin, http.MethodPut, "/admin/escalation-rules/2", `{"after": 259200, "notify": "project_lead"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected the rule to be updated, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send(admin, http.MethodPut, "/admin/escalation-rules/9", `{"after": 60, "notify": "owner"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a missing rule to be reported, got %d", w.Code)
+	}
+
+	if marked, escalated, err := escalations.Run(now); err != nil || marked != 1 || escalated != 0 {
+		t.Fatalf("Expected one todo to be marked overdue, got %d %d %v", marked, escalated, err)
+	}
+	todo, _ = todoService.GetTodo(todo.ID)
+	if todo.OverdueAt == nil || !todo.OverdueAt.Equal(due) {
+		t.Fatalf("Expected the todo to be overdue since its due date, got %v", todo.OverdueAt)
+	}
+
+	// A day later the owner hears about it, once across replicas; after
+	// three days the project lead does too.
+	if _, escalated, _ := escalations.Run(due.Add(25 * time.Hour)); escalated != 1 {
+		t.Errorf("Expected the owner to be notified, got %d steps", escalated)
+	}
+	if _, escalated, _ := otherEscalations.Run(due.Add(26 * time.Hour)); escalated != 0 {
+		t.Errorf("Expected another replica not to escalate again, got %d steps", escalated)
+	}
+
+	// Until the next step comes due, runs have nothing to look at.
+	if pending, _ := todoRepo.GetEscalationDue(due.Add(71 * time.Hour)); len(pending) != 0 {
+		t.Errorf("Expected no todo to be due for escalation, got %d", len(pending))
+	}
+	if _, escalated, _ := escalations.Run(due.Add(73 * time.Hour)); escalated != 1 {
+		t.Errorf("Expected the project lead to be notified, got %d steps", escalated)
+	}
+	if pending, _ := todoRepo.GetEscalationDue(due.Add(365 * 24 * time.Hour)); len(pending) != 0 {
+		t.Errorf("Expected no steps to be left, got %d todos", len(pending))
+	}
+
+	for user, want := range map[uint]int{alice.ID: 1, carol.ID: 1, admin.ID: 0} {
+		if count, _ := notifications.CountUnread(user); int(count) != want {
+			t.Errorf("Expected user %d to have %d notifications, got %d", user, want, count)
+		}
+	}
+	notifications.Deliver(now)
+	notifications.Deliver(now)
+	if len(mail.messages) != 1 || mail.messages[0].To[0] != "alice@example.com" {
+		t.Errorf("Expected one email to alice, got %+v", mail.messages)
+	}
+
+	var history []models.TodoEvent
+	w := send(carol, http.MethodGet, "/todos/1/history", "")
+	json.Unmarshal(w.Body.Bytes(), &history)
+	if len(history) != 3 || history[0].Kind != models.TodoEventOverdue ||
+		history[1].Detail != "Notified the owner (alice) after 1 day overdue" ||
+		history[2].Detail != "Notified the project lead (carol) after 3 days overdue" {
+		t.Fatalf("Expected the escalation steps in the history, got %s", w.Body.String())
+	}
+	if w := send(admin, http.MethodGet, "/todos/2/history", ""); w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Errorf("Expected an empty history, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Completing the todo clears the mark and stops the escalation.
+	todo.Status = "completed"
+	todoService.UpdateTodo(todo)
+	todo, _ = todoService.GetTodo(todo.ID)
+	if todo.OverdueAt != nil {
+		t.Errorf("Expected a completed todo not to be overdue, got %v", todo.OverdueAt)
+	}
+	if marked, escalated, _ := escalations.Run(due.Add(100 * time.Hour)); marked != 0 || escalated != 0 {
+		t.Errorf("Expected nothing more to happen, got %d %d", marked, escalated)
+	}
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/middlewares"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.IdempotencyRecord{})
+
+	idempotencyService := service.NewIdempotencyService(repository.NewIdempotencyRepository(db), time.Hour)
+
+	created := 0
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// As in production, recovery sits in front of the middleware.
+	router.Use(gin.CustomRecovery(func(c *gin.Context, _ any) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}), func(c *gin.Context) {
+		c.Set("user", &models.Claims{UserID: 1, Username: "alice", Role: models.RoleUser})
+	}, middlewares.IdempotencyMiddleware(idempotencyService))
+	router.POST("/todos", func(c *gin.Context) {
+		created++
+		c.JSON(http.StatusCreated, gin.H{"id": created})
+	})
+	crashes := 0
+	router.POST("/crash", func(c *gin.Context) {
+		crashes++
+		panic("handler crashed")
+	})
+
+	sendTo := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	send := func(body string) *httptest.ResponseRecorder {
+		return sendTo("/todos", "retry-1", body)
+	}
+
+	first := send(`{"name":"Deploy"}`)
+	retry := send(`{"name":"Deploy"}`)
+
+	if created != 1 {
+		t.Fatalf("Expected handler to run once, ran %d times", created)
+	}
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() {
+		t.Errorf("Expected replayed response %d %s, got %d %s", first.Code, first.Body, retry.Code, retry.Body)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected replayed response to be flagged")
+	}
+
+	if w := send(`{"name":"Something else"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a reused key with a different body, got %d", w.Code)
+	}
+
+	// A panicking handler must not leave its key stuck as in progress.
+	for i := 0; i < 2; i++ {
+		if w := sendTo("/crash", "crash-1", `{}`); w.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected the crash to be retried, got %d %s", w.Code, w.Body.String())
+		}
+	}
+	if crashes != 2 {
+		t.Errorf("Expected the handler to run on each retry, ran %d times", crashes)
+	}
+
+	// A claimed key only holds for a short while until it is completed.
+	record, _, err := idempotencyService.Begin(2, "pending-1", "hash")
+	if err != nil {
+		t.Fatalf("Failed to claim key: %v", err)
+	}
+	if record.ExpiresAt.After(time.Now().Add(10 * time.Minute)) {
+		t.Errorf("Expected a pending key to expire soon, expires %v", record.ExpiresAt)
+	}
+	if err := idempotencyService.Complete(record, http.StatusCreated, "application/json", "", []byte(`{}`)); err != nil {
+		t.Fatalf("Failed to complete key: %v", err)
+	}
+	if record.ExpiresAt.Before(time.Now().Add(50 * time.Minute)) {
+		t.Errorf("Expected a completed key to last the full TTL, expires %v", record.ExpiresAt)
+	}
+}
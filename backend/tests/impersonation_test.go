@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/middlewares"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/policy"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/websocket"
+)
+
+func TestImpersonation(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.AuditEvent{}, &models.Todo{}, &models.Project{}, &models.CustomRole{})
+
+	admin := &models.User{Username: "root", Email: "root@example.com", Role: models.RoleAdmin}
+	other := &models.User{Username: "ops", Email: "ops@example.com", Role: models.RoleAdmin}
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser}
+	db.Create(admin)
+	db.Create(other)
+	db.Create(alice)
+
+	userRepo := repository.NewUserRepository(db)
+	tokenService := service.NewTokenService(repository.NewRefreshTokenRepository(db), userRepo, time.Minute, time.Hour)
+	userService := service.NewUserService(userRepo, tokenService, nil, false, service.LockoutPolicy{})
+	policyService := service.NewPolicyService(repository.NewRoleRepository(db), repository.NewProjectRepository(db), userRepo)
+	auditService := service.NewAuditService(repository.NewAuditRepository(db))
+	todoService := service.NewTodoService(repository.NewTodoRepository(db))
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	userHandler := handlers.NewUserHandler(userService, tokenService, nil, policyService, auditService)
+	todoHandler := handlers.NewTodoHandler(todoService, userService, nil, policyService, hub)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	auth := middlewares.AuthMiddleware(tokenService, nil)
+	router.POST("/admin/impersonate/:id", auth, middlewares.RequireSession(), middlewares.RequirePermission(policyService, policy.UserImpersonate), userHandler.Impersonate)
+	userRouter := router.Group("/", auth, middlewares.AuditImpersonation(auditService))
+	userRouter.GET("/roles", userHandler.CheckRoles)
+	userRouter.POST("/todos", todoHandler.CreateTodo)
+
+	send := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	session, err := tokenService.IssueTokens(admin, false)
+	if err != nil {
+		t.Fatalf("Failed to issue tokens: %v", err)
+	}
+
+	if w := send(session.AccessToken, http.MethodPost, "/admin/impersonate/2", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected impersonating another admin to be forbidden, got %d", w.Code)
+	}
+
+	w := send(session.AccessToken, http.MethodPost, "/admin/impersonate/3", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected impersonation to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	var issued struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &issued)
+
+	w = send(issued.Token, http.MethodGet, "/roles", "")
+	var roles map[string]string
+	json.Unmarshal(w.Body.Bytes(), &roles)
+	if roles["username"] != "alice" || roles["impersonated_by"] != "root" {
+		t.Errorf("Expected to act as alice for root, got %v", roles)
+	}
+
+	if w := send(issued.Token, http.MethodPost, "/todos", `{"name": "Reproduce bug", "status": "pending"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected todo to be created, got %d: %s", w.Code, w.Body.String())
+	}
+	var todo models.Todo
+	db.First(&todo)
+	if todo.OwnerID != alice.ID {
+		t.Errorf("Expected the todo to belong to alice, got owner %d", todo.OwnerID)
+	}
+
+	var events []models.AuditEvent
+	db.Where("action = ?", models.AuditImpersonatedRequest).Find(&events)
+	if len(events) != 1 || *events[0].ActorID != admin.ID || *events[0].TargetID != alice.ID || events[0].Details["path"] != "/todos" {
+		t.Errorf("Expected the change to be audited as root acting as alice, got %+v", events)
+	}
+
+	if w := send(issued.Token, http.MethodPost, "/admin/impersonate/3", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected impersonation tokens not to start another impersonation, got %d", w.Code)
+	}
+
+	// Revoking the admin's tokens ends the impersonation too.
+	tokenService.RevokeUser(admin.ID)
+	if w := send(issued.Token, http.MethodGet, "/roles", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected impersonation token to be revoked with the admin's, got %d", w.Code)
+	}
+}
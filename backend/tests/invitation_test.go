@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+func TestInvitations(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Invitation{})
+
+	admin := &models.User{Username: "root", Email: "root@example.com", Role: models.RoleAdmin}
+	db.Create(admin)
+
+	mail := &recordingMailer{}
+	userRepo := repository.NewUserRepository(db)
+	invitationService := service.NewInvitationService(repository.NewInvitationRepository(db), userRepo, mail, "http://app.test/accept-invite", time.Hour)
+
+	invitation, err := invitationService.Invite("alice@example.com", models.RoleAdmin, admin.ID)
+	if err != nil {
+		t.Fatalf("Failed to invite: %v", err)
+	}
+	if mail.messages[0].To[0] != "alice@example.com" || !strings.Contains(mail.messages[0].Text, "root") {
+		t.Errorf("Expected the invitation to be mailed, got %+v", mail.messages[0])
+	}
+	first := mail.lastToken(t)
+
+	if _, err := invitationService.Invite("alice@example.com", models.RoleUser, admin.ID); err != service.ErrInvitationPending {
+		t.Errorf("Expected a second invitation to the same address to be refused, got %v", err)
+	}
+	if _, err := invitationService.Invite("root@example.com", models.RoleUser, admin.ID); err != service.ErrEmailAlreadyExists {
+		t.Errorf("Expected inviting an existing user to be refused, got %v", err)
+	}
+
+	if _, err := invitationService.Resend(invitation.ID); err != nil {
+		t.Fatalf("Failed to resend: %v", err)
+	}
+	if _, _, err := invitationService.Accept(first, "alice", "secret1"); err != service.ErrInvalidInvitation {
+		t.Errorf("Expected the replaced link to stop working, got %v", err)
+	}
+
+	user, _, err := invitationService.Accept(mail.lastToken(t), "alice", "secret1")
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+	if user.Role != models.RoleAdmin || user.Email != "alice@example.com" || user.EmailVerifiedAt == nil || !user.CheckPassword("secret1") {
+		t.Errorf("Expected a verified admin with the chosen password, got %+v", user)
+	}
+	if _, _, err := invitationService.Accept(mail.lastToken(t), "alice2", "secret1"); err != service.ErrInvalidInvitation {
+		t.Errorf("Expected the link to be single use, got %v", err)
+	}
+
+	// Revoked and expired invitations cannot be accepted.
+	revoked, _ := invitationService.Invite("bob@example.com", models.RoleUser, admin.ID)
+	bobToken := mail.lastToken(t)
+	if _, err := invitationService.Revoke(revoked.ID); err != nil {
+		t.Fatalf("Failed to revoke: %v", err)
+	}
+	if _, _, err := invitationService.Accept(bobToken, "bob", "secret1"); err != service.ErrInvalidInvitation {
+		t.Errorf("Expected a revoked invitation to be refused, got %v", err)
+	}
+	if _, err := invitationService.Resend(revoked.ID); err != service.ErrInvitationClosed {
+		t.Errorf("Expected a revoked invitation not to be resent, got %v", err)
+	}
+
+	expired, _ := invitationService.Invite("carol@example.com", models.RoleUser, admin.ID)
+	db.Model(expired).Update("expires_at", time.Now().Add(-time.Minute))
+	if _, _, err := invitationService.Accept(mail.lastToken(t), "carol", "secret1"); err != service.ErrInvalidInvitation {
+		t.Errorf("Expected an expired invitation to be refused, got %v", err)
+	}
+
+	invitations, _ := invitationService.List()
+	statuses := map[string]string{}
+	for _, invitation := range invitations {
+		statuses[invitation.Email] = invitation.Status(time.Now())
+	}
+	if statuses["alice@example.com"] != models.InvitationAccepted || statuses["bob@example.com"] != models.InvitationRevoked || statuses["carol@example.com"] != models.InvitationExpired {
+		t.Errorf("Unexpected invitation statuses %v", statuses)
+	}
+}
+
+func TestInviteOnlyRegistration(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Setting{})
+
+	settingService := service.NewSettingService(repository.NewSettingRepository(db), service.Settings{RegistrationOpen: true})
+	invitationHandler := handlers.NewInvitationHandler(nil, settingService, nil, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/register", invitationHandler.RequireOpenRegistration, func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	register := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/register", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := register(); code != http.StatusCreated {
+		t.Errorf("Expected registration to be open by default, got %d", code)
+	}
+
+	if err := settingService.SetRegistrationOpen(false); err != nil {
+		t.Fatalf("Failed to close registration: %v", err)
+	}
+	if code := register(); code != http.StatusForbidden {
+		t.Errorf("Expected registration to be invite-only, got %d", code)
+	}
+
+	settingService.SetRegistrationOpen(true)
+	if code := register(); code != http.StatusCreated {
+		t.Errorf("Expected registration to reopen, got %d", code)
+	}
+}
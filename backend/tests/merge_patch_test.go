@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/websocket"
+)
+
+func TestPatchTodoClearsFields(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Todo{}, &models.Project{}, &models.CustomRole{})
+
+	owner := &models.User{Username: "owner", Email: "owner@example.com", Role: models.RoleUser}
+	owner.SetPassword("secret")
+	db.Create(owner)
+
+	todoService := service.NewTodoService(repository.NewTodoRepository(db))
+	userRepo := repository.NewUserRepository(db)
+	userService := service.NewUserService(userRepo, nil, nil, false, service.LockoutPolicy{})
+	policyService := service.NewPolicyService(repository.NewRoleRepository(db), repository.NewProjectRepository(db), userRepo)
+
+	dueDate := time.Now().Add(24 * time.Hour)
+	todo := &models.Todo{
+		Name:        "Patch me",
+		Description: "To be cleared",
+		DueDate:     &dueDate,
+		Status:      "in_progress",
+		OwnerID:     owner.ID,
+	}
+	if err := todoService.CreateTodo(todo, []uint{owner.ID}); err != nil {
+		t.Fatalf("Failed to create todo: %v", err)
+	}
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", &models.Claims{UserID: owner.ID, Username: owner.Username, Role: owner.Role})
+	})
+	router.PATCH("/todos/:id", handlers.NewTodoHandler(todoService, userService, nil, policyService, hub).PatchTodo)
+
+	body := `{"description": null, "due_date": null, "assignee_ids": null}`
+	req := httptest.NewRequest(http.MethodPatch, "/todos/1", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	stored, _ := todoService.GetTodo(todo.ID)
+	if stored.Description != "" {
+		t.Errorf("Expected description to be cleared, got '%s'", stored.Description)
+	}
+	if stored.DueDate != nil {
+		t.Errorf("Expected due date to be cleared, got %v", stored.DueDate)
+	}
+	if len(stored.Assignees) != 0 {
+		t.Errorf("Expected assignees to be cleared, got %d", len(stored.Assignees))
+	}
+	if stored.Name != "Patch me" || stored.Status != "in_progress" {
+		t.Errorf("Expected absent fields to be unchanged, got name '%s' status '%s'", stored.Name, stored.Status)
+	}
+}
@@ -0,0 +1,331 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/oidc"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+// mockIdP is a minimal OpenID provider that issues one authorization code
+// per authorize request and checks the PKCE verifier on exchange. The ID
+// token asserts subject and email, and email_verified unless it is nil.
+type mockIdP struct {
+	server        *httptest.Server
+	key           *rsa.PrivateKey
+	subject       string
+	email         string
+	emailVerified interface{}
+	groups        []string
+	challenge     string
+	nonce         string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	idp := &mockIdP{key: key, subject: "alice-subject", email: "alice@example.com", emailVerified: true}
+
+	router := gin.New()
+	router.GET("/.well-known/openid-configuration", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	router.GET("/jwks", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"keys": []gin.H{{
+			"kid": "test",
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	router.POST("/token", func(c *gin.Context) {
+		if oidc.CodeChallenge(c.PostForm("code_verifier")) != idp.challenge {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":    idp.server.URL,
+			"aud":    "todoapp",
+			"sub":    idp.subject,
+			"email":  idp.email,
+			"nonce":  idp.nonce,
+			"groups": idp.groups,
+			"exp":    time.Now().Add(time.Minute).Unix(),
+		}
+		if idp.emailVerified != nil {
+			claims["email_verified"] = idp.emailVerified
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		signed, _ := token.SignedString(key)
+		c.JSON(http.StatusOK, gin.H{"access_token": "opaque", "id_token": signed, "token_type": "Bearer"})
+	})
+
+	idp.server = httptest.NewServer(router)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize plays the browser: it follows the login URL and returns the
+// state and code the provider would redirect back with.
+func (idp *mockIdP) authorize(t *testing.T, authURL string) (string, string) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("Invalid authorization URL: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("Expected PKCE S256, got %q", query.Get("code_challenge_method"))
+	}
+	idp.challenge = query.Get("code_challenge")
+	idp.nonce = query.Get("nonce")
+	return query.Get("state"), "auth-code"
+}
+
+func TestOIDCLoginCreatesAndLinksUsers(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+	idp := newMockIdP(t)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.OIDCLoginState{})
+
+	userRepo := repository.NewUserRepository(db)
+	tokenService := service.NewTokenService(repository.NewRefreshTokenRepository(db), userRepo, time.Minute, time.Hour)
+	provider := oidc.NewProvider(oidc.Config{
+		IssuerURL:   idp.server.URL,
+		ClientID:    "todoapp",
+		RedirectURL: "http://localhost/auth/oidc/callback",
+	})
+	oidcService := service.NewOIDCService(provider, repository.NewOIDCLoginStateRepository(db), userRepo, tokenService, []string{"todo-admins"})
+
+	ctx := context.Background()
+
+	idp.groups = []string{"todo-admins"}
+	authURL, _, err := oidcService.BeginLogin(ctx)
+	if err != nil {
+		t.Fatalf("Failed to begin login: %v", err)
+	}
+	state, code := idp.authorize(t, authURL)
+
+	user, tokens, err := oidcService.CompleteLogin(ctx, state, code)
+	if err != nil {
+		t.Fatalf("Failed to complete login: %v", err)
+	}
+	if user.Username != "alice" || user.Role != models.RoleAdmin {
+		t.Errorf("Expected new admin alice, got %s with role %s", user.Username, user.Role)
+	}
+	if _, err := tokenService.Authenticate(tokens.AccessToken); err != nil {
+		t.Errorf("Expected issued token to be valid: %v", err)
+	}
+
+	if _, _, err := oidcService.CompleteLogin(ctx, state, code); err != service.ErrInvalidOIDCState {
+		t.Errorf("Expected state to be single use, got %v", err)
+	}
+
+	login := func() (*models.User, *service.TokenPair, error) {
+		authURL, _, err := oidcService.BeginLogin(ctx)
+		if err != nil {
+			t.Fatalf("Failed to begin login: %v", err)
+		}
+		state, code := idp.authorize(t, authURL)
+		return oidcService.CompleteLogin(ctx, state, code)
+	}
+
+	// Outside the admin groups the role is left as it is, whether it came
+	// from an earlier login or was given in the app.
+	idp.groups = []string{"staff"}
+	linked, _, err := login()
+	if err != nil {
+		t.Fatalf("Failed to complete second login: %v", err)
+	}
+	if linked.ID != user.ID {
+		t.Errorf("Expected login to link to existing user %d, got %d", user.ID, linked.ID)
+	}
+	if linked.Role != models.RoleAdmin {
+		t.Errorf("Expected the admin to stay admin, got %s", linked.Role)
+	}
+
+	// A custom role is not overwritten by the admin groups either.
+	db.Model(&models.User{}).Where("id = ?", user.ID).Update("role", "auditor")
+	idp.groups = []string{"todo-admins"}
+	if linked, _, err = login(); err != nil || linked.Role != "auditor" {
+		t.Errorf("Expected the custom role to be kept, got %v %v", linked, err)
+	}
+
+	// With two-factor authentication on, single sign-on only gets as far as
+	// the challenge, the same as a password.
+	db.Model(&models.User{}).Where("id = ?", user.ID).Update("totp_enabled", true)
+	_, tokens, err = login()
+	var challenge *service.TwoFactorRequiredError
+	if !errors.As(err, &challenge) || tokens != nil {
+		t.Fatalf("Expected the login to stop at the second step, got %v %v", tokens, err)
+	}
+	if claims, err := models.ValidateTwoFactorChallenge(challenge.Challenge); err != nil || claims.UserID != user.ID {
+		t.Errorf("Expected a challenge for %d, got %v %v", user.ID, claims, err)
+	}
+}
+
+func TestOIDCLoginNeedsVerifiedEmailToLink(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+	idp := newMockIdP(t)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.OIDCLoginState{})
+
+	admin := &models.User{Username: "admin", Email: "admin@example.com", Role: models.RoleAdmin}
+	admin.SetPassword("password")
+	db.Create(admin)
+
+	userRepo := repository.NewUserRepository(db)
+	tokenService := service.NewTokenService(repository.NewRefreshTokenRepository(db), userRepo, time.Minute, time.Hour)
+	provider := oidc.NewProvider(oidc.Config{
+		IssuerURL:   idp.server.URL,
+		ClientID:    "todoapp",
+		RedirectURL: "http://localhost/auth/oidc/callback",
+	})
+	oidcService := service.NewOIDCService(provider, repository.NewOIDCLoginStateRepository(db), userRepo, tokenService, nil)
+
+	ctx := context.Background()
+	login := func() (*models.User, error) {
+		authURL, _, err := oidcService.BeginLogin(ctx)
+		if err != nil {
+			t.Fatalf("Failed to begin login: %v", err)
+		}
+		state, code := idp.authorize(t, authURL)
+		user, _, err := oidcService.CompleteLogin(ctx, state, code)
+		return user, err
+	}
+
+	// Someone who set the admin's address at the provider without proving
+	// it must not get the admin account.
+	idp.subject, idp.email = "mallory-subject", "admin@example.com"
+	for _, verified := range []interface{}{nil, false, "false"} {
+		idp.emailVerified = verified
+		if user, err := login(); err != service.ErrOIDCEmailNotVerified {
+			t.Errorf("Expected email_verified=%v to be refused, got %v %v", verified, user, err)
+		}
+	}
+	if stored, _ := userRepo.FindByID(admin.ID); stored.OIDCSubject != nil || stored.EmailVerifiedAt != nil {
+		t.Fatalf("Expected the admin not to be linked, got %v", *stored.OIDCSubject)
+	}
+
+	// A verified address links the account, once.
+	idp.subject, idp.emailVerified = "admin-subject", true
+	linked, err := login()
+	if err != nil || linked.ID != admin.ID {
+		t.Fatalf("Expected the verified login to link the admin, got %v %v", linked, err)
+	}
+	idp.subject = "other-subject"
+	if _, err := login(); err != service.ErrOIDCAccountLinked {
+		t.Errorf("Expected a second identity not to take over a linked account, got %v", err)
+	}
+
+	// From then on the subject decides, whatever the email says.
+	idp.subject, idp.email, idp.emailVerified = "admin-subject", "renamed@example.com", nil
+	if user, err := login(); err != nil || user.ID != admin.ID {
+		t.Errorf("Expected the linked subject to log in, got %v %v", user, err)
+	}
+}
+
+func TestOIDCCallbackNeedsStateCookie(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+	idp := newMockIdP(t)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.OIDCLoginState{}, &models.AuditEvent{})
+
+	userRepo := repository.NewUserRepository(db)
+	tokenService := service.NewTokenService(repository.NewRefreshTokenRepository(db), userRepo, time.Minute, time.Hour)
+	provider := oidc.NewProvider(oidc.Config{
+		IssuerURL:   idp.server.URL,
+		ClientID:    "todoapp",
+		RedirectURL: "http://localhost/auth/oidc/callback",
+	})
+	oidcService := service.NewOIDCService(provider, repository.NewOIDCLoginStateRepository(db), userRepo, tokenService, nil)
+	handler := handlers.NewOIDCHandler(oidcService, service.NewAuditService(repository.NewAuditRepository(db)), "")
+
+	router := gin.New()
+	router.GET("/auth/oidc/login", handler.Login)
+	router.GET("/auth/oidc/callback", handler.Callback)
+
+	begin := func() (string, string, *http.Cookie) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || !cookies[0].HttpOnly {
+			t.Fatalf("Expected an HttpOnly state cookie, got %v", cookies)
+		}
+		state, code := idp.authorize(t, w.Header().Get("Location"))
+		return state, code, cookies[0]
+	}
+	callback := func(state, code string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?state="+url.QueryEscape(state)+"&code="+code, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The attacker's callback URL opened in the victim's browser, which has
+	// no cookie or one of its own login.
+	state, code, _ := begin()
+	if w := callback(state, code, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a callback without the state cookie to be refused, got %d", w.Code)
+	}
+	_, _, otherCookie := begin()
+	if w := callback(state, code, otherCookie); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a callback with another login's cookie to be refused, got %d", w.Code)
+	}
+
+	state, code, cookie := begin()
+	w := callback(state, code, cookie)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the login to succeed, got %d %s", w.Code, w.Body.String())
+	}
+	if cleared := w.Result().Cookies(); len(cleared) != 1 || cleared[0].MaxAge >= 0 {
+		t.Errorf("Expected the state cookie to be cleared, got %v", cleared)
+	}
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/middlewares"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.PersonalAccessToken{}, &models.Project{}, &models.CustomRole{})
+
+	user := &models.User{Username: "ci", Email: "ci@example.com", Role: models.RoleUser}
+	db.Create(user)
+
+	userRepo := repository.NewUserRepository(db)
+	tokenService := service.NewTokenService(repository.NewRefreshTokenRepository(db), userRepo, time.Minute, time.Hour)
+	policyService := service.NewPolicyService(repository.NewRoleRepository(db), repository.NewProjectRepository(db), userRepo)
+	patService := service.NewPersonalAccessTokenService(repository.NewPersonalAccessTokenRepository(db), userRepo, policyService)
+
+	if _, _, err := patService.CreateToken(user, "admin", []string{models.ScopeAdminUsers}, nil); err != service.ErrScopeNotAllowed {
+		t.Errorf("Expected non-admin to be refused admin scope, got %v", err)
+	}
+
+	token, secret, err := patService.CreateToken(user, "ci", []string{models.ScopeReadTodos}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(
+		middlewares.AuthMiddleware(tokenService, patService),
+		middlewares.MethodScope(models.ScopeReadTodos, models.ScopeWriteTodos),
+	)
+	router.GET("/todos", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/todos", func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	send := func(method string) int {
+		req := httptest.NewRequest(method, "/todos", nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send(http.MethodGet); code != http.StatusOK {
+		t.Errorf("Expected read scope to allow GET, got %d", code)
+	}
+	if code := send(http.MethodPost); code != http.StatusForbidden {
+		t.Errorf("Expected missing write scope to forbid POST, got %d", code)
+	}
+
+	var stored models.PersonalAccessToken
+	db.First(&stored, token.ID)
+	if stored.LastUsedAt == nil {
+		t.Errorf("Expected last used timestamp to be recorded")
+	}
+
+	patService.RevokeToken(token.ID, user.ID)
+	if code := send(http.MethodGet); code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked token to be rejected, got %d", code)
+	}
+}
@@ -0,0 +1,287 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/policy"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/websocket"
+)
+
+func TestResourcePermissions(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Todo{}, &models.TaskTemplate{}, &models.Project{}, &models.CustomRole{})
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", Role: models.RoleUser}
+	admin := &models.User{Username: "root", Email: "root@example.com", Role: models.RoleAdmin}
+	db.Create(alice)
+	db.Create(bob)
+	db.Create(admin)
+
+	userRepo := repository.NewUserRepository(db)
+	projectRepo := repository.NewProjectRepository(db)
+	todoService := service.NewTodoService(repository.NewTodoRepository(db))
+	templateService := service.NewTaskTemplateService(repository.NewTaskTemplateRepository(db))
+	userService := service.NewUserService(userRepo, nil, nil, false, service.LockoutPolicy{})
+	policyService := service.NewPolicyService(repository.NewRoleRepository(db), projectRepo, userRepo)
+
+	project := &models.Project{Name: "Launch", LeadID: bob.ID, Members: []models.User{*alice}}
+	db.Create(project)
+
+	private := &models.Todo{Name: "Private", Status: "pending", OwnerID: bob.ID}
+	shared := &models.Todo{Name: "Shared", Status: "pending", OwnerID: bob.ID, ProjectID: &project.ID}
+	todoService.CreateTodo(private, nil)
+	todoService.CreateTodo(shared, nil)
+	template := &models.TaskTemplate{Name: "Weekly report", OwnerID: bob.ID}
+	templateService.CreateTaskTemplate(template)
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	todoHandler := handlers.NewTodoHandler(todoService, userService, nil, policyService, hub)
+	templateHandler := handlers.NewTaskTemplateHandler(templateService, userService, policyService, hub)
+
+	var current *models.User
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", &models.Claims{UserID: current.ID, Username: current.Username, Role: current.Role})
+	})
+	router.GET("/todos", todoHandler.GetTodos)
+	router.GET("/todos/:id", todoHandler.GetTodo)
+	router.DELETE("/todos/:id", todoHandler.DeleteTodo)
+	router.GET("/task-templates/:id", templateHandler.GetTaskTemplate)
+	router.DELETE("/task-templates/:id", templateHandler.DeleteTaskTemplate)
+
+	send := func(user *models.User, method, path string) *httptest.ResponseRecorder {
+		current = user
+		req := httptest.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send(alice, http.MethodDelete, "/todos/1"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected deleting another user's todo to be forbidden, got %d", w.Code)
+	}
+	if stored, _ := todoService.GetTodo(private.ID); stored == nil {
+		t.Fatal("Expected forbidden delete to keep the todo")
+	}
+	if w := send(alice, http.MethodGet, "/todos/1"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected reading another user's private todo to be forbidden, got %d", w.Code)
+	}
+
+	// Project members may read the project's todos but not delete them.
+	if w := send(alice, http.MethodGet, "/todos/2"); w.Code != http.StatusOK {
+		t.Errorf("Expected project member to read project todo, got %d", w.Code)
+	}
+	if w := send(alice, http.MethodDelete, "/todos/2"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected project member delete to be forbidden, got %d", w.Code)
+	}
+
+	w := send(alice, http.MethodGet, "/todos")
+	var listed []handlers.TodoResponse
+	json.Unmarshal(w.Body.Bytes(), &listed)
+	if len(listed) != 1 || listed[0].ID != shared.ID {
+		t.Errorf("Expected only the project todo to be listed, got %+v", listed)
+	}
+
+	if w := send(alice, http.MethodGet, "/task-templates/1"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected reading another user's template to be forbidden, got %d", w.Code)
+	}
+	if w := send(alice, http.MethodDelete, "/task-templates/1"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected deleting another user's template to be forbidden, got %d", w.Code)
+	}
+	if w := send(bob, http.MethodDelete, "/task-templates/1"); w.Code != http.StatusNoContent {
+		t.Errorf("Expected owner to delete template, got %d", w.Code)
+	}
+
+	if w := send(admin, http.MethodDelete, "/todos/1"); w.Code != http.StatusNoContent {
+		t.Errorf("Expected admin to delete any todo, got %d", w.Code)
+	}
+}
+
+func TestCustomRoles(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Project{}, &models.CustomRole{})
+
+	userRepo := repository.NewUserRepository(db)
+	policyService := service.NewPolicyService(repository.NewRoleRepository(db), repository.NewProjectRepository(db), userRepo)
+
+	if err := policyService.CreateRole(policy.Role{Name: models.RoleAdmin}); err != policy.ErrBuiltInRole {
+		t.Errorf("Expected built-in role name to be refused, got %v", err)
+	}
+	invalid := policy.Role{Name: "bad", Grants: map[policy.Permission][]policy.Relation{policy.TodoCreate: {policy.Owner}}}
+	if err := policyService.CreateRole(invalid); err != policy.ErrInvalidRelation {
+		t.Errorf("Expected invalid relation to be refused, got %v", err)
+	}
+
+	reviewer := policy.Role{
+		Name: "reviewer",
+		Grants: map[policy.Permission][]policy.Relation{
+			policy.TodoRead:   {policy.Any},
+			policy.TodoUpdate: {policy.Assignee},
+		},
+	}
+	if err := policyService.CreateRole(reviewer); err != nil {
+		t.Fatalf("Failed to create role: %v", err)
+	}
+	if !policyService.RoleExists("reviewer") {
+		t.Fatal("Expected custom role to exist")
+	}
+
+	carol := &models.User{Username: "carol", Email: "carol@example.com", Role: "reviewer"}
+	db.Create(carol)
+
+	subject := policy.Subject{UserID: carol.ID, Role: carol.Role}
+	todo := &models.Todo{OwnerID: 99}
+	if !policyService.CanTodo(subject, policy.TodoRead, todo) {
+		t.Error("Expected reviewer to read any todo")
+	}
+	if policyService.CanTodo(subject, policy.TodoUpdate, todo) {
+		t.Error("Expected reviewer not to update unassigned todos")
+	}
+	todo.Assignees = []models.User{*carol}
+	if !policyService.CanTodo(subject, policy.TodoUpdate, todo) {
+		t.Error("Expected reviewer to update assigned todos")
+	}
+	if policyService.CanTodo(subject, policy.TodoDelete, todo) {
+		t.Error("Expected reviewer not to delete todos")
+	}
+
+	if err := policyService.DeleteRole("reviewer"); err != service.ErrRoleInUse {
+		t.Errorf("Expected assigned role to be kept, got %v", err)
+	}
+	db.Model(carol).Update("role", models.RoleUser)
+	if err := policyService.DeleteRole("reviewer"); err != nil {
+		t.Fatalf("Failed to delete role: %v", err)
+	}
+	if policyService.RoleExists("reviewer") {
+		t.Error("Expected deleted role to be gone")
+	}
+}
+
+func TestRoleGrantsAreBounded(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Project{}, &models.CustomRole{}, &models.Invitation{}, &models.AuditEvent{}, &models.RefreshToken{})
+
+	userRepo := repository.NewUserRepository(db)
+	policyService := service.NewPolicyService(repository.NewRoleRepository(db), repository.NewProjectRepository(db), userRepo)
+	tokenService := service.NewTokenService(repository.NewRefreshTokenRepository(db), userRepo, time.Minute, time.Hour)
+	userService := service.NewUserService(userRepo, tokenService, nil, false, service.LockoutPolicy{})
+	auditService := service.NewAuditService(repository.NewAuditRepository(db))
+	invitationService := service.NewInvitationService(repository.NewInvitationRepository(db), userRepo, &recordingMailer{}, "https://todo.example.com/accept-invite", time.Hour)
+
+	// A manager may do what users do and manage users, but nothing more.
+	manager := policy.Role{Name: "manager", Grants: map[policy.Permission][]policy.Relation{policy.UserManage: {policy.Any}}}
+	for _, role := range policyService.Roles() {
+		if role.Name == models.RoleUser {
+			for permission, relations := range role.Grants {
+				manager.Grants[permission] = relations
+			}
+		}
+	}
+	if err := policyService.CreateRole(manager); err != nil {
+		t.Fatalf("Failed to create role: %v", err)
+	}
+
+	mona := &models.User{Username: "mona", Email: "mona@example.com", Role: "manager"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", Role: models.RoleUser}
+	root := &models.User{Username: "root", Email: "root@example.com", Role: models.RoleAdmin}
+	for _, user := range []*models.User{mona, bob, root} {
+		user.SetPassword("password")
+		db.Create(user)
+	}
+
+	userHandler := handlers.NewUserHandler(userService, nil, nil, policyService, auditService)
+	invitationHandler := handlers.NewInvitationHandler(invitationService, nil, policyService, auditService)
+
+	var current *models.User
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", &models.Claims{UserID: current.ID, Username: current.Username, Role: current.Role})
+	})
+	router.PUT("/admin/role", userHandler.ChangeRole)
+	router.PUT("/admin/users/:id", userHandler.UpdateUser)
+	router.POST("/admin/invitations", invitationHandler.CreateInvitation)
+	router.POST("/admin/users", userHandler.CreateUser)
+	router.DELETE("/admin/users/:id", userHandler.DeleteUser)
+	router.POST("/admin/users/:id/unlock", userHandler.UnlockUser)
+	router.POST("/admin/users/:id/deactivate", userHandler.DeactivateUser)
+	router.POST("/admin/users/:id/reactivate", userHandler.ReactivateUser)
+	router.POST("/admin/users/:id/transfer", userHandler.TransferOwnership)
+
+	send := func(user *models.User, method, path, body string) int {
+		current = user
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPut, "/admin/role", `{"user_id": 2, "new_role": "admin"}`, http.StatusForbidden},
+		{http.MethodPut, "/admin/users/2", `{"role": "admin"}`, http.StatusForbidden},
+		{http.MethodPost, "/admin/invitations", `{"email": "eve@example.com", "role": "admin"}`, http.StatusForbidden},
+		{http.MethodPut, "/admin/users/3", `{"password": "taken-over"}`, http.StatusForbidden},
+		{http.MethodPut, "/admin/role", `{"user_id": 3, "new_role": "user"}`, http.StatusForbidden},
+		{http.MethodPost, "/admin/users", `{"username": "eve", "email": "eve@example.com", "password": "secret1", "role": "admin"}`, http.StatusForbidden},
+		{http.MethodDelete, "/admin/users/3", ``, http.StatusForbidden},
+		{http.MethodPost, "/admin/users/3/unlock", ``, http.StatusForbidden},
+		{http.MethodPost, "/admin/users/3/deactivate", ``, http.StatusForbidden},
+		{http.MethodPost, "/admin/users/3/reactivate", ``, http.StatusForbidden},
+		{http.MethodPost, "/admin/users/3/transfer", `{"to_user_id": 1}`, http.StatusForbidden},
+		{http.MethodPost, "/admin/users", `{"username": "dave", "email": "dave@example.com", "password": "secret1", "role": "user"}`, http.StatusCreated},
+		{http.MethodPost, "/admin/users/2/unlock", ``, http.StatusOK},
+		{http.MethodPut, "/admin/role", `{"user_id": 2, "new_role": "manager"}`, http.StatusOK},
+		{http.MethodPut, "/admin/users/2", `{"username": "robert"}`, http.StatusOK},
+		{http.MethodPost, "/admin/invitations", `{"email": "dan@example.com", "role": "user"}`, http.StatusCreated},
+	} {
+		if code := send(mona, tc.method, tc.path, tc.body); code != tc.want {
+			t.Errorf("Expected %s %s %s by a manager to get %d, got %d", tc.method, tc.path, tc.body, tc.want, code)
+		}
+	}
+
+	if stored, _ := userRepo.FindByID(root.ID); stored.Role != models.RoleAdmin || !stored.CheckPassword("password") || stored.IsDeactivated() {
+		t.Error("Expected the admin account to be untouched")
+	}
+	if _, err := userRepo.FindByUsername("eve"); err == nil {
+		t.Error("Expected no admin to be created by a manager")
+	}
+	if code := send(root, http.MethodPut, "/admin/role", `{"user_id": 2, "new_role": "admin"}`); code != http.StatusOK {
+		t.Errorf("Expected an admin to grant admin, got %d", code)
+	}
+}
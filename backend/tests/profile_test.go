@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/avatar"
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/utils"
+	"github.com/harrisin2037/todoapp/internal/websocket"
+)
+
+func TestProfile(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Avatar{}, &models.Todo{}, &models.Project{}, &models.CustomRole{})
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser}
+	db.Create(alice)
+
+	userRepo := repository.NewUserRepository(db)
+	userService := service.NewUserService(userRepo, nil, nil, false, service.LockoutPolicy{})
+	profileService := service.NewProfileService(userRepo)
+
+	str := func(s string) *string { return &s }
+	sunday := 0
+
+	for _, invalid := range []service.ProfileUpdate{
+		{Timezone: str("Mars/Olympus")},
+		{Locale: str("not a locale")},
+		{Color: str("red")},
+	} {
+		if _, err := profileService.UpdateProfile(alice.ID, invalid); err == nil {
+			t.Errorf("Expected %+v to be refused", invalid)
+		}
+	}
+
+	user, err := profileService.UpdateProfile(alice.ID, service.ProfileUpdate{
+		DisplayName: str("Alice Liddell"),
+		Timezone:    str("Asia/Tokyo"),
+		Locale:      str("ja-jp"),
+		WeekStart:   &sunday,
+		Color:       str("#7b68ee"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to update profile: %v", err)
+	}
+	if user.Name() != "Alice Liddell" || user.Locale != "ja-JP" || user.Color != "#7b68ee" || user.Location().String() != "Asia/Tokyo" {
+		t.Errorf("Expected the profile to be saved, got %+v", user)
+	}
+
+	if user, _ := profileService.UpdateProfile(alice.ID, service.ProfileUpdate{Color: str("")}); user.Color != utils.GenerateColor(alice.ID) {
+		t.Errorf("Expected an empty color to restore the generated one, got %s", user.Color)
+	}
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	policyService := service.NewPolicyService(repository.NewRoleRepository(db), repository.NewProjectRepository(db), userRepo)
+	profileHandler := handlers.NewProfileHandler(profileService, userService, 1<<20)
+	todoHandler := handlers.NewTodoHandler(service.NewTodoService(repository.NewTodoRepository(db)), userService, nil, policyService, hub)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	authed := router.Group("/", func(c *gin.Context) {
+		c.Set("user", &models.Claims{UserID: alice.ID, Username: alice.Username, Role: alice.Role})
+	})
+	authed.PUT("/me/avatar", profileHandler.UploadAvatar)
+	authed.POST("/todos", todoHandler.CreateTodo)
+	router.GET("/users/:id/avatar", profileHandler.GetAvatar)
+
+	picture := image.NewRGBA(image.Rect(0, 0, 600, 300))
+	for x := 0; x < 600; x++ {
+		for y := 0; y < 300; y++ {
+			picture.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var upload bytes.Buffer
+	form := multipart.NewWriter(&upload)
+	part, _ := form.CreateFormFile("avatar", "me.png")
+	png.Encode(part, picture)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPut, "/me/avatar", &upload)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var profile handlers.ProfileResponse
+	json.Unmarshal(w.Body.Bytes(), &profile)
+	if w.Code != http.StatusOK || profile.AvatarURL == "" {
+		t.Fatalf("Expected the avatar to be uploaded, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, profile.AvatarURL, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Header().Get("Content-Type") != avatar.ContentType {
+		t.Fatalf("Expected a JPEG avatar, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	resized, err := jpeg.Decode(w.Body)
+	if err != nil || resized.Bounds().Dx() != avatar.Size || resized.Bounds().Dy() != avatar.Size {
+		t.Errorf("Expected a %dpx square avatar, got %v (%v)", avatar.Size, resized.Bounds(), err)
+	}
+
+	// Due dates without a zone are read in the user's time zone.
+	req = httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(`{"name": "Call Osaka", "due_date": "2024-05-01 09:00"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Failed to create todo: %d %s", w.Code, w.Body.String())
+	}
+
+	var todo models.Todo
+	db.First(&todo)
+	if want := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC); !todo.DueDate.Equal(want) {
+		t.Errorf("Expected 09:00 in Tokyo to be %v, got %v", want, todo.DueDate.UTC())
+	}
+}
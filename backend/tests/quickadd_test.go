@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/quickadd"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/websocket"
+)
+
+func TestQuickAddParse(t *testing.T) {
+
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	at := func(year int, month time.Month, day, hour, minute int) *time.Time {
+		due := time.Date(year, month, day, hour, minute, 0, 0, tokyo)
+		return &due
+	}
+
+	// Wednesday morning in Tokyo, with weeks starting on Monday.
+	opts := quickadd.Options{
+		Now:       time.Date(2024, 5, 1, 10, 0, 0, 0, tokyo),
+		Location:  tokyo,
+		WeekStart: time.Monday,
+	}
+
+	tests := []struct {
+		text   string
+		name   string
+		due    *time.Time
+		allDay bool
+	}{
+		{"Deploy hotfix tomorrow 3pm", "Deploy hotfix", at(2024, 5, 2, 15, 0), false},
+		{"Pay rent friday", "Pay rent", at(2024, 5, 3, 0, 0), true},
+		{"Pay rent next friday", "Pay rent", at(2024, 5, 10, 0, 0), true},
+		{"Plan sprint next week", "Plan sprint", at(2024, 5, 6, 0, 0), true},
+		{"Review PR in 3 days", "Review PR", at(2024, 5, 4, 0, 0), true},
+		{"Call back in 2 hours", "Call back", at(2024, 5, 1, 12, 0), false},
+		{"Standup at 9:30am", "Standup", at(2024, 5, 2, 9, 30), false},
+		{"Lunch on May 3rd at noon", "Lunch", at(2024, 5, 3, 12, 0), false},
+		{"Dentist March 3", "Dentist", at(2025, 3, 3, 0, 0), true},
+		{"Ship by 2024-06-15 17:45", "Ship", at(2024, 6, 15, 17, 45), false},
+		{"Read 3 chapters", "Read 3 chapters", nil, false},
+	}
+
+	for _, test := range tests {
+		result := quickadd.Parse(test.text, opts)
+		if result.Name != test.name || result.AllDay != test.allDay {
+			t.Errorf("%q: expected name %q all day %v, got %q %v", test.text, test.name, test.allDay, result.Name, result.AllDay)
+		}
+		if (result.DueDate == nil) != (test.due == nil) || (test.due != nil && !result.DueDate.Equal(*test.due)) {
+			t.Errorf("%q: expected due %v, got %v", test.text, test.due, result.DueDate)
+		}
+	}
+
+	result := quickadd.Parse("Deploy hotfix #infra !high @alice #ops !urgent", opts)
+	if result.Name != "Deploy hotfix !urgent" || result.Priority != "high" {
+		t.Errorf("Expected name and priority to be split, got %+v", result)
+	}
+	if !reflect.DeepEqual(result.Tags, []string{"infra", "ops"}) || !reflect.DeepEqual(result.Mentions, []string{"alice"}) {
+		t.Errorf("Expected tags and mentions, got %v %v", result.Tags, result.Mentions)
+	}
+}
+
+func TestQuickAddTodo(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Todo{}, &models.Project{}, &models.CustomRole{})
+
+	owner := &models.User{Username: "owner", Email: "owner@example.com", Role: models.RoleUser}
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser}
+	db.Create(owner)
+	db.Create(alice)
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	userRepo := repository.NewUserRepository(db)
+	userService := service.NewUserService(userRepo, nil, nil, false, service.LockoutPolicy{})
+	policyService := service.NewPolicyService(repository.NewRoleRepository(db), repository.NewProjectRepository(db), userRepo)
+	todoHandler := handlers.NewTodoHandler(service.NewTodoService(repository.NewTodoRepository(db)), userService, nil, policyService, hub)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/todos/quick", func(c *gin.Context) {
+		c.Set("user", &models.Claims{UserID: owner.ID, Username: owner.Username, Role: owner.Role})
+	}, todoHandler.QuickAddTodo)
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/todos/quick", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(`{"text": "Deploy hotfix tomorrow 3pm #infra !high @alice @ghost", "preview": true}`)
+	var preview handlers.TodoQuickPreviewResponse
+	json.Unmarshal(w.Body.Bytes(), &preview)
+	if w.Code != http.StatusOK || preview.Todo.Name != "Deploy hotfix" || preview.Todo.Priority != "high" || preview.Todo.DueDate == nil {
+		t.Fatalf("Expected a parsed preview, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(preview.Todo.Assignees) != 1 || preview.Todo.Assignees[0].ID != alice.ID || !reflect.DeepEqual(preview.UnknownMentions, []string{"ghost"}) {
+		t.Errorf("Expected alice to be assigned and ghost to be unknown, got %+v %v", preview.Todo.Assignees, preview.UnknownMentions)
+	}
+
+	var count int64
+	db.Model(&models.Todo{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected a preview not to save, found %d todos", count)
+	}
+
+	if w := send(`{"text": "Deploy hotfix @ghost"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected unknown mentions to be refused, got %d", w.Code)
+	}
+	if w := send(`{"text": "tomorrow #infra"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a todo without a name to be refused, got %d", w.Code)
+	}
+
+	w = send(`{"text": "Deploy hotfix tomorrow 3pm #infra !high @alice"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected the todo to be created, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var todo models.Todo
+	db.Preload("Assignees").First(&todo)
+	if todo.Name != "Deploy hotfix" || todo.Tags != "infra" || todo.Priority != "high" || todo.DueDate == nil || len(todo.Assignees) != 1 {
+		t.Errorf("Expected the parsed fields to be saved, got %+v", todo)
+	}
+}
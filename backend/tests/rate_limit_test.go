@@ -0,0 +1,224 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/middlewares"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/ratelimit"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+func TestRateLimitStores(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.RateLimitBucket{})
+
+	stores := map[string]ratelimit.Store{
+		"memory": ratelimit.NewMemoryStore(),
+		"db":     repository.NewRateLimitRepository(db),
+	}
+	limit := ratelimit.Limit{Requests: 2, Period: time.Minute}
+
+	for name, store := range stores {
+		now := time.Now()
+
+		for i := 0; i < 2; i++ {
+			if allowed, _, err := store.Take("ip:1.2.3.4", limit, now); err != nil || !allowed {
+				t.Fatalf("%s: expected request %d to be allowed, got %v %v", name, i+1, allowed, err)
+			}
+		}
+
+		allowed, retryAfter, _ := store.Take("ip:1.2.3.4", limit, now)
+		if allowed {
+			t.Errorf("%s: expected third request to be limited", name)
+		}
+		if retryAfter != 30*time.Second {
+			t.Errorf("%s: expected retry after 30s, got %s", name, retryAfter)
+		}
+
+		if allowed, _, _ := store.Take("ip:5.6.7.8", limit, now); !allowed {
+			t.Errorf("%s: expected other keys to have their own bucket", name)
+		}
+
+		if allowed, _, _ := store.Take("ip:1.2.3.4", limit, now.Add(30*time.Second)); !allowed {
+			t.Errorf("%s: expected a token to be refilled after 30s", name)
+		}
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	limit := ratelimit.Limit{Requests: 1, Period: time.Minute}
+	router.POST("/login",
+		middlewares.RateLimit(ratelimit.NewMemoryStore(), "login", limit, middlewares.JSONFieldKey("username")),
+		func(c *gin.Context) {
+			var req struct{ Username string }
+			c.ShouldBindJSON(&req)
+			c.JSON(http.StatusOK, gin.H{"username": req.Username})
+		})
+
+	send := func(username string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username":"`+username+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("alice"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "alice") {
+		t.Fatalf("Expected first request to reach the handler with its body, got %d %s", w.Code, w.Body.String())
+	}
+
+	w := send("Alice")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 for the same username, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected Retry-After 60, got %q", w.Header().Get("Retry-After"))
+	}
+
+	if w := send("bob"); w.Code != http.StatusOK {
+		t.Errorf("Expected other usernames to be unaffected, got %d", w.Code)
+	}
+}
+
+// contendedStore loses every other update the way the database store does
+// when too many replicas race on one bucket.
+type contendedStore struct {
+	ratelimit.Store
+	calls atomic.Int64
+}
+
+func (s *contendedStore) Take(key string, limit ratelimit.Limit, now time.Time) (bool, time.Duration, error) {
+	if s.calls.Add(1)%2 == 0 {
+		return false, 0, repository.ErrRateLimitContention
+	}
+	return s.Store.Take(key, limit, now)
+}
+
+func TestRateLimitHoldsUnderConcurrency(t *testing.T) {
+
+	// A file database gives every connection the same buckets, so parallel
+	// requests really race on the database store.
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "ratelimit.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.RateLimitBucket{})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	limit := ratelimit.Limit{Requests: 5, Period: time.Hour}
+	router.POST("/login",
+		middlewares.RateLimit(&contendedStore{Store: repository.NewRateLimitRepository(db)}, "login", limit, middlewares.JSONFieldKey("username")),
+		func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{})
+		})
+
+	var (
+		wg                 sync.WaitGroup
+		allowed, noHeaders atomic.Int64
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username":"alice"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			switch {
+			case w.Code == http.StatusOK:
+				allowed.Add(1)
+			case w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "":
+				noHeaders.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed.Load() > int64(limit.Requests) {
+		t.Errorf("Expected at most %d requests through, got %d", limit.Requests, allowed.Load())
+	}
+	if noHeaders.Load() > 0 {
+		t.Errorf("Expected every other request to get 429 with Retry-After, %d did not", noHeaders.Load())
+	}
+}
+
+func TestAccountLockout(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.RefreshToken{})
+
+	userRepo := repository.NewUserRepository(db)
+	tokenService := service.NewTokenService(repository.NewRefreshTokenRepository(db), userRepo, time.Minute, time.Hour)
+	lockout := service.LockoutPolicy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: 10 * time.Minute}
+	userService := service.NewUserService(userRepo, tokenService, nil, false, lockout)
+
+	user, err := userService.Register("alice", "alice@example.com", "secret1")
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	var locked *service.AccountLockedError
+	for i := 0; i < 3; i++ {
+		if _, _, err := userService.Login("alice", "wrong"); err != service.ErrInvalidCredentials {
+			t.Fatalf("Expected invalid credentials, got %v", err)
+		}
+	}
+	_, _, err = userService.Login("alice", "secret1")
+	if !errors.As(err, &locked) {
+		t.Fatalf("Expected account to be locked, got %v", err)
+	}
+	if wait := time.Until(locked.Until); wait <= 0 || wait > time.Minute {
+		t.Errorf("Expected a lock of about a minute, got %s", wait)
+	}
+
+	// Every failure after the lock expires doubles the delay.
+	db.Model(&models.User{}).Where("id = ?", user.ID).Update("locked_until", time.Now().Add(-time.Second))
+	userService.Login("alice", "wrong")
+	_, _, err = userService.Login("alice", "secret1")
+	if !errors.As(err, &locked) {
+		t.Fatalf("Expected account to be locked again, got %v", err)
+	}
+	if wait := time.Until(locked.Until); wait <= time.Minute || wait > 2*time.Minute {
+		t.Errorf("Expected the lock to double to two minutes, got %s", wait)
+	}
+
+	if err := userService.UnlockUser(user.ID); err != nil {
+		t.Fatalf("Failed to unlock: %v", err)
+	}
+	if _, _, err := userService.Login("alice", "secret1"); err != nil {
+		t.Errorf("Expected unlocked user to log in, got %v", err)
+	}
+
+	stored, _ := userRepo.FindByID(user.ID)
+	if stored.FailedLoginAttempts != 0 || stored.LockedUntil != nil {
+		t.Errorf("Expected failures to be reset, got %d %v", stored.FailedLoginAttempts, stored.LockedUntil)
+	}
+}
@@ -0,0 +1,284 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/mailer"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/websocket"
+)
+
+func TestReminders(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Todo{}, &models.Project{}, &models.CustomRole{}, &models.Reminder{}, &models.ReminderRule{}, &models.Notification{})
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser, Timezone: "Europe/Berlin"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", Role: models.RoleUser}
+	db.Create(alice)
+	db.Create(bob)
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	mail := &recordingMailer{}
+	userRepo := repository.NewUserRepository(db)
+	todoRepo := repository.NewTodoRepository(db)
+	userService := service.NewUserService(userRepo, nil, nil, false, service.LockoutPolicy{})
+	policyService := service.NewPolicyService(repository.NewRoleRepository(db), repository.NewProjectRepository(db), userRepo)
+	todoService := service.NewTodoService(todoRepo)
+
+	// Two schedulers stand in for two replicas sharing the database.
+	newScheduler := func() (*service.ReminderService, *service.NotificationService) {
+		notifications := service.NewNotificationService(repository.NewNotificationRepository(db), userRepo, hub, mail, "https://todo.example.com")
+		return service.NewReminderService(repository.NewReminderRepository(db), todoRepo, userRepo, policyService, notifications), notifications
+	}
+	reminders, notifications := newScheduler()
+	otherReminders, otherNotifications := newScheduler()
+	notifications.Deliver(time.Now())
+	otherNotifications.Deliver(time.Now())
+
+	reminderHandler := handlers.NewReminderHandler(reminders, todoService, userService, policyService)
+	notificationHandler := handlers.NewNotificationHandler(notifications)
+
+	now := time.Now().Truncate(time.Second)
+	due := now.Add(2 * time.Hour)
+	todo := &models.Todo{Name: "Submit report", Status: "pending", OwnerID: alice.ID, DueDate: &due}
+	todoService.CreateTodo(todo, []uint{bob.ID})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var current *models.User
+	authed := router.Group("/", func(c *gin.Context) {
+		c.Set("user", &models.Claims{UserID: current.ID, Username: current.Username, Role: current.Role})
+	})
+	authed.POST("/todos/:id/reminders", reminderHandler.CreateReminder)
+	authed.GET("/todos/:id/reminders", reminderHandler.GetReminders)
+	authed.POST("/me/reminder-rules", reminderHandler.CreateRule)
+	authed.GET("/notifications", notificationHandler.GetNotifications)
+	authed.POST("/notifications/read", notificationHandler.MarkAllRead)
+	authed.POST("/notifications/:id/read", notificationHandler.MarkRead)
+
+	send := func(user *models.User, method, path, body string) *httptest.ResponseRecorder {
+		current = user
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, body := range []string{
+		`{}`,
+		`{"offset": 60, "remind_at": "2030-01-01T00:00:00Z"}`,
+		`{"offset": -60}`,
+		`{"offset": 3000000}`,
+		`{"remind_at": "2001-01-01T00:00:00Z"}`,
+	} {
+		if w := send(alice, http.MethodPost, "/todos/1/reminders", body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be refused, got %d", body, w.Code)
+		}
+	}
+
+	// Alice wants an email an hour before; her own reminder replaces her
+	// default. Bob relies on his default of half an hour before.
+	if w := send(alice, http.MethodPost, "/todos/1/reminders", `{"offset": 3600, "email": true}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected the reminder to be created, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send(alice, http.MethodPost, "/me/reminder-rules", `{"offset": 600}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected the rule to be created, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send(bob, http.MethodPost, "/me/reminder-rules", `{"offset": 1800}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected the rule to be created, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send(bob, http.MethodGet, "/todos/1/reminders", ""); w.Body.String() != "[]" {
+		t.Errorf("Expected reminders to be private, got %s", w.Body.String())
+	}
+
+	if sent, err := reminders.Fire(now.Add(30 * time.Minute)); err != nil || sent != 0 {
+		t.Errorf("Expected nothing to be due yet, got %d %v", sent, err)
+	}
+	if sent, err := reminders.Fire(now.Add(100 * time.Minute)); err != nil || sent != 2 {
+		t.Fatalf("Expected alice's and bob's reminders, got %d %v", sent, err)
+	}
+	if sent, _ := otherReminders.Fire(now.Add(101 * time.Minute)); sent != 0 {
+		t.Errorf("Expected another replica not to send them again, got %d", sent)
+	}
+	if sent, _ := reminders.Fire(now.Add(102 * time.Minute)); sent != 0 {
+		t.Errorf("Expected a later run not to send them again, got %d", sent)
+	}
+
+	notifications.Deliver(now.Add(100 * time.Minute))
+	otherNotifications.Deliver(now.Add(100 * time.Minute))
+	if len(mail.messages) != 1 || mail.messages[0].To[0] != "alice@example.com" || !strings.Contains(mail.messages[0].Text, "Submit report") {
+		t.Fatalf("Expected one email to alice, got %+v", mail.messages)
+	}
+
+	var inbox handlers.NotificationListResponse
+	w := send(alice, http.MethodGet, "/notifications", "")
+	json.Unmarshal(w.Body.Bytes(), &inbox)
+	if inbox.Unread != 1 || len(inbox.Notifications) != 1 || inbox.Notifications[0].Title != "Reminder: Submit report" {
+		t.Fatalf("Expected the reminder in alice's inbox, got %s", w.Body.String())
+	}
+	if want := "Due " + due.In(alice.Location()).Format("Mon, Jan 2 2006 15:04 MST"); inbox.Notifications[0].Body != want {
+		t.Errorf("Expected the due date in alice's zone, got %q", inbox.Notifications[0].Body)
+	}
+
+	// Moving the due date moves the reminders, which go off again.
+	later := due.Add(time.Hour)
+	todo, _ = todoService.GetTodo(todo.ID)
+	todo.DueDate = &later
+	todoService.UpdateTodo(todo)
+	if sent, _ := reminders.Fire(now.Add(160 * time.Minute)); sent != 2 {
+		t.Errorf("Expected the moved reminders to go off, got %d", sent)
+	}
+
+	// Completed todos stay quiet.
+	done := &models.Todo{Name: "Already done", Status: "completed", OwnerID: bob.ID, DueDate: &due}
+	todoService.CreateTodo(done, nil)
+	if sent, _ := reminders.Fire(now.Add(110 * time.Minute)); sent != 0 {
+		t.Errorf("Expected no reminders for completed todos, got %d", sent)
+	}
+
+	if w := send(bob, http.MethodPost, "/notifications/1/read", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected other users' notifications to be out of reach, got %d", w.Code)
+	}
+	if w := send(alice, http.MethodPost, "/notifications/read", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected the inbox to be marked read, got %d", w.Code)
+	}
+	w = send(alice, http.MethodGet, "/notifications?unread=true", "")
+	json.Unmarshal(w.Body.Bytes(), &inbox)
+	if inbox.Unread != 0 || len(inbox.Notifications) != 0 {
+		t.Errorf("Expected no unread notifications, got %s", w.Body.String())
+	}
+}
+
+// failingMailer fails every email, counting the attempts.
+type failingMailer struct {
+	attempts int
+}
+
+func (m *failingMailer) Send(msg mailer.Message) error {
+	m.attempts++
+	return errors.New("mail server unavailable")
+}
+
+func TestNotificationDelivery(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Notification{})
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser}
+	db.Create(alice)
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws", hub.HandleWebSocket(staticAuth{"alice": {UserID: alice.ID, Username: "alice"}}, staticAccess{}))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn := dialHub(t, server, "alice")
+	waitForPresence(t, hub, func(s websocket.PresenceSnapshot) bool { return isOnline(s, "alice") })
+
+	mail := &failingMailer{}
+	userRepo := repository.NewUserRepository(db)
+	newNotifications := func() *service.NotificationService {
+		return service.NewNotificationService(repository.NewNotificationRepository(db), userRepo, hub, mail, "https://todo.example.com")
+	}
+	notifications, otherNotifications := newNotifications(), newNotifications()
+
+	pushed := make(chan uint, 16)
+	go func() {
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var event struct {
+				Message      string              `json:"message"`
+				Notification models.Notification `json:"notification"`
+			}
+			if json.Unmarshal(message, &event) == nil && event.Message == "notification" {
+				pushed <- event.Notification.ID
+			}
+		}
+	}()
+	received := func() []uint {
+		ids := []uint{}
+		for {
+			select {
+			case id := <-pushed:
+				ids = append(ids, id)
+			case <-time.After(200 * time.Millisecond):
+				return ids
+			}
+		}
+	}
+
+	// Notification 1 commits after notification 2 has been pushed; it is
+	// pushed all the same, and each only once across replicas.
+	notify := func(id uint, key string) {
+		if _, err := notifications.Notify(&models.Notification{ID: id, UserID: alice.ID, Kind: models.NotificationReminder, Key: key, Title: key, Email: true}); err != nil {
+			t.Fatalf("Failed to notify: %v", err)
+		}
+	}
+	now := time.Now()
+	notify(2, "second")
+	notifications.Deliver(now)
+	otherNotifications.Deliver(now)
+	if ids := received(); len(ids) != 1 || ids[0] != 2 {
+		t.Fatalf("Expected notification 2 to be pushed once, got %v", ids)
+	}
+	notify(1, "first")
+	otherNotifications.Deliver(now)
+	notifications.Deliver(now)
+	if ids := received(); len(ids) != 1 || ids[0] != 1 {
+		t.Fatalf("Expected notification 1 to be pushed once, got %v", ids)
+	}
+
+	// Both emails failed just now. They are tried again after a minute, then
+	// two, four and so on, and given up after six attempts.
+	if mail.attempts != 2 {
+		t.Fatalf("Expected both emails to be tried, got %d attempts", mail.attempts)
+	}
+	notifications.Deliver(now.Add(30 * time.Second))
+	if mail.attempts != 2 {
+		t.Errorf("Expected failed emails to wait before the next attempt, got %d attempts", mail.attempts)
+	}
+	at := now
+	for attempt := 1; attempt < 6; attempt++ {
+		at = at.Add(time.Duration(1<<(attempt-1))*time.Minute + time.Second)
+		notifications.Deliver(at)
+	}
+	if mail.attempts != 12 {
+		t.Errorf("Expected six attempts at each email, got %d", mail.attempts)
+	}
+	notifications.Deliver(at.Add(24 * time.Hour))
+	if mail.attempts != 12 {
+		t.Errorf("Expected the emails to be given up, got %d attempts", mail.attempts)
+	}
+}
@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/websocket"
+)
+
+func TestBulkTodos(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Todo{}, &models.Project{}, &models.CustomRole{})
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", Role: models.RoleUser}
+	db.Create(alice)
+	db.Create(bob)
+
+	todoService := service.NewTodoService(repository.NewTodoRepository(db))
+	userRepo := repository.NewUserRepository(db)
+	projectRepo := repository.NewProjectRepository(db)
+	userService := service.NewUserService(userRepo, nil, nil, false, service.LockoutPolicy{})
+	projectService := service.NewProjectService(projectRepo)
+	policyService := service.NewPolicyService(repository.NewRoleRepository(db), projectRepo, userRepo)
+
+	mine := &models.Todo{Name: "Mine", Status: "pending", OwnerID: alice.ID}
+	theirs := &models.Todo{Name: "Theirs", Status: "pending", OwnerID: bob.ID}
+	todoService.CreateTodo(mine, nil)
+	todoService.CreateTodo(theirs, nil)
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", &models.Claims{UserID: alice.ID, Username: alice.Username, Role: alice.Role})
+	})
+	router.POST("/todos/bulk", handlers.NewTodoHandler(todoService, userService, projectService, policyService, hub).BulkTodos)
+
+	bulk := func(body string) (int, handlers.TodoBulkResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/todos/bulk", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response handlers.TodoBulkResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	code, response := bulk(`{"ids": [1, 2], "action": {"type": "set_status", "status": "completed"}}`)
+	if code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected all-or-nothing failure to return 422, got %d", code)
+	}
+	if response.Results[0].Status != "rolled_back" || response.Results[1].Status != "failed" {
+		t.Errorf("Unexpected results: %+v", response.Results)
+	}
+	stored, _ := todoService.GetTodo(mine.ID)
+	if stored.Status != "pending" {
+		t.Errorf("Expected rolled back todo to stay pending, got '%s'", stored.Status)
+	}
+
+	for _, tags := range []string{`["a,b"]`, `[""]`, `["infra", "  "]`} {
+		if code, _ := bulk(`{"ids": [1], "action": {"type": "add_tags", "tags": ` + tags + `}}`); code != http.StatusBadRequest {
+			t.Errorf("Expected tags %s to be refused, got %d", tags, code)
+		}
+	}
+
+	code, response = bulk(`{"ids": [1, 2], "mode": "best_effort", "action": {"type": "add_tags", "tags": ["infra"]}}`)
+	if code != http.StatusOK {
+		t.Fatalf("Expected best-effort to return 200, got %d", code)
+	}
+	if response.Succeeded != 1 || response.Failed != 1 {
+		t.Errorf("Expected one success and one failure, got %+v", response)
+	}
+	stored, _ = todoService.GetTodo(mine.ID)
+	if stored.Tags != "infra" {
+		t.Errorf("Expected tag to be added, got '%s'", stored.Tags)
+	}
+	stored, _ = todoService.GetTodo(theirs.ID)
+	if stored.Tags != "" {
+		t.Errorf("Expected forbidden todo to be untouched, got '%s'", stored.Tags)
+	}
+}
+
+func TestProjectsNeedMembership(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Todo{}, &models.Project{}, &models.CustomRole{})
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", Role: models.RoleUser}
+	carol := &models.User{Username: "carol", Email: "carol@example.com", Role: models.RoleUser}
+	root := &models.User{Username: "root", Email: "root@example.com", Role: models.RoleAdmin}
+	db.Create(alice)
+	db.Create(bob)
+	db.Create(carol)
+	db.Create(root)
+
+	todoService := service.NewTodoService(repository.NewTodoRepository(db))
+	userRepo := repository.NewUserRepository(db)
+	projectRepo := repository.NewProjectRepository(db)
+	userService := service.NewUserService(userRepo, nil, nil, false, service.LockoutPolicy{})
+	projectService := service.NewProjectService(projectRepo)
+	policyService := service.NewPolicyService(repository.NewRoleRepository(db), projectRepo, userRepo)
+
+	ops := &models.Project{Name: "Ops", LeadID: carol.ID}
+	projectService.CreateProject(ops, []uint{bob.ID})
+	mine := &models.Todo{Name: "Mine", Status: "pending", OwnerID: alice.ID}
+	todoService.CreateTodo(mine, nil)
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var current *models.User
+	router.Use(func(c *gin.Context) {
+		c.Set("user", &models.Claims{UserID: current.ID, Username: current.Username, Role: current.Role})
+	})
+	projectHandler := handlers.NewProjectHandler(projectService, userService, policyService)
+	router.GET("/projects", projectHandler.GetProjects)
+	router.POST("/projects", projectHandler.CreateProject)
+	router.GET("/projects/:id", projectHandler.GetProject)
+	router.POST("/todos/bulk", handlers.NewTodoHandler(todoService, userService, projectService, policyService, hub).BulkTodos)
+
+	send := func(user *models.User, method, path, body string) *httptest.ResponseRecorder {
+		current = user
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	projectNames := func(user *models.User) []string {
+		var projects []handlers.ProjectResponse
+		json.Unmarshal(send(user, http.MethodGet, "/projects", "").Body.Bytes(), &projects)
+		names := []string{}
+		for _, project := range projects {
+			names = append(names, project.Name)
+		}
+		return names
+	}
+
+	for _, user := range []*models.User{bob, carol} {
+		if w := send(user, http.MethodGet, "/projects/1", ""); w.Code != http.StatusOK {
+			t.Errorf("Expected %s to see the project, got %d", user.Username, w.Code)
+		}
+	}
+	if w := send(alice, http.MethodGet, "/projects/1", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected an outsider not to see the project, got %d", w.Code)
+	}
+	if names := projectNames(alice); len(names) != 0 {
+		t.Errorf("Expected an outsider to see no projects, got %v", names)
+	}
+
+	if w := send(alice, http.MethodPost, "/todos/bulk", `{"ids": [1], "action": {"type": "move_project", "project_id": 1}}`); w.Code != http.StatusForbidden {
+		t.Errorf("Expected moving into someone else's project to be refused, got %d %s", w.Code, w.Body.String())
+	}
+	stored, _ := todoService.GetTodo(mine.ID)
+	if stored.ProjectID != nil {
+		t.Errorf("Expected the todo to stay out of the project, got %v", *stored.ProjectID)
+	}
+
+	if w := send(alice, http.MethodPost, "/projects", `{"name": "Home", "member_ids": [2, 99]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected unknown members to be refused, got %d", w.Code)
+	}
+	if w := send(alice, http.MethodPost, "/projects", `{"name": "Home", "member_ids": [2, 2]}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected the project to be created, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send(alice, http.MethodPost, "/todos/bulk", `{"ids": [1], "action": {"type": "move_project", "project_id": 2}}`); w.Code != http.StatusOK {
+		t.Errorf("Expected moving into her own project to work, got %d %s", w.Code, w.Body.String())
+	}
+
+	if names := projectNames(alice); len(names) != 1 || names[0] != "Home" {
+		t.Errorf("Expected alice to see only her project, got %v", names)
+	}
+	if names := projectNames(bob); len(names) != 2 {
+		t.Errorf("Expected bob to see both projects he is in, got %v", names)
+	}
+	if names := projectNames(root); len(names) != 2 {
+		t.Errorf("Expected an admin to see every project, got %v", names)
+	}
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+func TestRefreshTokenRotationAndRevocation(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.RefreshToken{})
+
+	userRepo := repository.NewUserRepository(db)
+	tokenService := service.NewTokenService(repository.NewRefreshTokenRepository(db), userRepo, time.Minute, time.Hour)
+	userService := service.NewUserService(userRepo, tokenService, nil, false, service.LockoutPolicy{})
+
+	if _, err := userService.Register("alice", "alice@example.com", "secret1"); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	user, tokens, err := userService.Login("alice", "secret1")
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+
+	if _, err := tokenService.Authenticate(tokens.AccessToken); err != nil {
+		t.Fatalf("Expected fresh access token to be accepted: %v", err)
+	}
+
+	_, rotated, err := tokenService.Refresh(tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+
+	if _, _, err := tokenService.Refresh(tokens.RefreshToken); err != service.ErrInvalidRefreshToken {
+		t.Fatalf("Expected reused refresh token to be rejected, got %v", err)
+	}
+	if _, _, err := tokenService.Refresh(rotated.RefreshToken); err != service.ErrInvalidRefreshToken {
+		t.Errorf("Expected reuse to revoke the whole session, got %v", err)
+	}
+
+	_, tokens, _ = userService.Login("alice", "secret1")
+	if err := userService.ChangeRole(user.ID, models.RoleAdmin); err != nil {
+		t.Fatalf("Failed to change role: %v", err)
+	}
+	if _, err := tokenService.Authenticate(tokens.AccessToken); err != service.ErrTokenRevoked {
+		t.Errorf("Expected role change to revoke access token, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/middlewares"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/totp"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 test vector for SHA-1, truncated to six digits.
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	code, err := totp.Code(secret, totp.Counter(time.Unix(59, 0)))
+	if err != nil {
+		t.Fatalf("Failed to compute code: %v", err)
+	}
+	if code != "287082" {
+		t.Errorf("Expected 287082, got %s", code)
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.RecoveryCode{})
+
+	userRepo := repository.NewUserRepository(db)
+	tokenService := service.NewTokenService(repository.NewRefreshTokenRepository(db), userRepo, time.Minute, time.Hour)
+	twoFactorService := service.NewTwoFactorService(userRepo, repository.NewRecoveryCodeRepository(db), "todoapp", true)
+	userService := service.NewUserService(userRepo, tokenService, twoFactorService, false, service.LockoutPolicy{})
+
+	if _, err := userService.CreateUser("root", "root@example.com", "secret1", models.RoleAdmin); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	_, tokens, err := userService.Login("root", "secret1")
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(
+		middlewares.AuthMiddleware(tokenService, nil),
+		middlewares.AdminMiddleware(),
+		middlewares.RequireTwoFactor(twoFactorService),
+	)
+	router.GET("/admin/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send(tokens.AccessToken); code != http.StatusForbidden {
+		t.Errorf("Expected admin without 2FA to be refused, got %d", code)
+	}
+
+	user, _ := userRepo.FindByUsername("root")
+	secret, uri, err := twoFactorService.Enroll(user)
+	if err != nil {
+		t.Fatalf("Failed to enroll: %v", err)
+	}
+	if uri == "" {
+		t.Error("Expected an otpauth URI")
+	}
+
+	user, _ = userRepo.FindByUsername("root")
+	if _, err := twoFactorService.Confirm(user, "000000"); err != service.ErrInvalidTwoFactorCode {
+		t.Errorf("Expected wrong code to be rejected, got %v", err)
+	}
+
+	now := totp.Counter(time.Now())
+	code, _ := totp.Code(secret, now)
+	recoveryCodes, err := twoFactorService.Confirm(user, code)
+	if err != nil {
+		t.Fatalf("Failed to confirm: %v", err)
+	}
+	if len(recoveryCodes) != 10 {
+		t.Errorf("Expected 10 recovery codes, got %d", len(recoveryCodes))
+	}
+
+	_, tokens, err = userService.Login("root", "secret1")
+	var challenge *service.TwoFactorRequiredError
+	if !errors.As(err, &challenge) || tokens != nil {
+		t.Fatalf("Expected password login to stop at the second step, got %v", err)
+	}
+
+	if _, _, err := userService.LoginTwoFactor(challenge.Challenge, code); err != service.ErrInvalidTwoFactorCode {
+		t.Errorf("Expected replayed code to be rejected, got %v", err)
+	}
+
+	next, _ := totp.Code(secret, now+1)
+	_, tokens, err = userService.LoginTwoFactor(challenge.Challenge, next)
+	if err != nil {
+		t.Fatalf("Failed second login step: %v", err)
+	}
+	if code := send(tokens.AccessToken); code != http.StatusOK {
+		t.Errorf("Expected two-factor session to reach admin routes, got %d", code)
+	}
+
+	if _, _, err := userService.LoginTwoFactor(challenge.Challenge, recoveryCodes[0]); err != nil {
+		t.Errorf("Expected recovery code to be accepted, got %v", err)
+	}
+	if _, _, err := userService.LoginTwoFactor(challenge.Challenge, recoveryCodes[0]); err != service.ErrInvalidTwoFactorCode {
+		t.Errorf("Expected used recovery code to be rejected, got %v", err)
+	}
+
+	if _, err := tokenService.Authenticate(challenge.Challenge); err == nil {
+		t.Error("Expected challenge to be refused as an access token")
+	}
+
+	user, _ = userRepo.FindByUsername("root")
+	if err := twoFactorService.Disable(user, recoveryCodes[1]); err != service.ErrTwoFactorRequiredByPolicy {
+		t.Errorf("Expected policy to keep admin 2FA on, got %v", err)
+	}
+}
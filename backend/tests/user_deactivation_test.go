@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+)
+
+func TestUserDeactivation(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.Todo{}, &models.TaskTemplate{})
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser}
+	alice.SetPassword("secret1")
+	bob := &models.User{Username: "bob", Email: "bob@example.com", Role: models.RoleUser}
+	db.Create(alice)
+	db.Create(bob)
+
+	userRepo := repository.NewUserRepository(db)
+	tokenService := service.NewTokenService(repository.NewRefreshTokenRepository(db), userRepo, time.Minute, time.Hour)
+	userService := service.NewUserService(userRepo, tokenService, nil, false, service.LockoutPolicy{})
+	todoService := service.NewTodoService(repository.NewTodoRepository(db))
+
+	todo := &models.Todo{Name: "Write report", Status: "pending", OwnerID: alice.ID}
+	todoService.CreateTodo(todo, nil)
+	db.Create(&models.TaskTemplate{Name: "Weekly report", OwnerID: alice.ID})
+
+	if err := userService.DeleteUser(alice.ID); err != service.ErrUserOwnsResources {
+		t.Errorf("Expected delete to be refused while alice owns items, got %v", err)
+	}
+
+	if _, _, err := userService.Login("alice", "secret1"); err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+
+	// Transferring to a missing user fails and leaves alice active.
+	missing := uint(99)
+	if _, err := userService.DeactivateUser(alice.ID, &missing); err != service.ErrTransferTarget {
+		t.Fatalf("Expected transfer to a missing user to fail, got %v", err)
+	}
+	if user, _ := userService.GetUserByID(alice.ID); user.IsDeactivated() {
+		t.Fatal("Expected failed transfer to roll back the deactivation")
+	}
+
+	transfer, err := userService.DeactivateUser(alice.ID, &bob.ID)
+	if err != nil {
+		t.Fatalf("Failed to deactivate user: %v", err)
+	}
+	if transfer.Todos != 1 || transfer.Templates != 1 {
+		t.Errorf("Expected one todo and one template to move, got %+v", transfer)
+	}
+
+	stored, _ := todoService.GetTodo(todo.ID)
+	if stored.OwnerID != bob.ID || stored.Version != todo.Version+1 {
+		t.Errorf("Expected bob to own the todo at a new version, got owner %d version %d", stored.OwnerID, stored.Version)
+	}
+
+	if _, _, err := userService.Login("alice", "secret1"); err != service.ErrUserDeactivated {
+		t.Errorf("Expected deactivated user login to fail, got %v", err)
+	}
+	if _, err := userService.DeactivateUser(alice.ID, nil); err != service.ErrUserDeactivated {
+		t.Errorf("Expected second deactivation to be refused, got %v", err)
+	}
+	if _, err := userService.TransferOwnership(bob.ID, alice.ID); err != service.ErrTransferTarget {
+		t.Errorf("Expected transfer to a deactivated user to fail, got %v", err)
+	}
+
+	if err := userService.ReactivateUser(alice.ID); err != nil {
+		t.Fatalf("Failed to reactivate user: %v", err)
+	}
+	if _, _, err := userService.Login("alice", "secret1"); err != nil {
+		t.Errorf("Expected reactivated user to login, got %v", err)
+	}
+	if err := userService.DeleteUser(alice.ID); err != nil {
+		t.Errorf("Expected delete to succeed once nothing is owned, got %v", err)
+	}
+}
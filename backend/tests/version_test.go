@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/handlers"
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/websocket"
+)
+
+func TestUpdateTodoVersionConflict(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Todo{})
+
+	todoService := service.NewTodoService(repository.NewTodoRepository(db))
+
+	todo := &models.Todo{Name: "Versioned"}
+	if err := todoService.CreateTodo(todo, []uint{}); err != nil {
+		t.Fatalf("Failed to create todo: %v", err)
+	}
+	if todo.Version != 1 {
+		t.Fatalf("Expected new todo to have version 1, got %d", todo.Version)
+	}
+
+	first, _ := todoService.GetTodo(todo.ID)
+	second, _ := todoService.GetTodo(todo.ID)
+
+	first.Name = "First writer"
+	if err := todoService.UpdateTodo(first); err != nil {
+		t.Fatalf("Failed to update todo: %v", err)
+	}
+	if first.Version != 2 {
+		t.Errorf("Expected version 2 after update, got %d", first.Version)
+	}
+
+	second.Name = "Second writer"
+	if err := todoService.UpdateTodo(second); !errors.Is(err, models.ErrVersionConflict) {
+		t.Fatalf("Expected version conflict, got %v", err)
+	}
+
+	stored, _ := todoService.GetTodo(todo.ID)
+	if stored.Name != "First writer" {
+		t.Errorf("Expected stale write to be rejected, got name '%s'", stored.Name)
+	}
+}
+
+func TestIfMatchHandlers(t *testing.T) {
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.Todo{}, &models.TaskTemplate{}, &models.Project{}, &models.CustomRole{})
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleUser}
+	db.Create(alice)
+
+	userRepo := repository.NewUserRepository(db)
+	todoService := service.NewTodoService(repository.NewTodoRepository(db))
+	templateService := service.NewTaskTemplateService(repository.NewTaskTemplateRepository(db))
+	userService := service.NewUserService(userRepo, nil, nil, false, service.LockoutPolicy{})
+	policyService := service.NewPolicyService(repository.NewRoleRepository(db), repository.NewProjectRepository(db), userRepo)
+
+	todoService.CreateTodo(&models.Todo{Name: "Versioned", Status: "pending", OwnerID: alice.ID}, nil)
+	templateService.CreateTaskTemplate(&models.TaskTemplate{Name: "Versioned", OwnerID: alice.ID})
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	todoHandler := handlers.NewTodoHandler(todoService, userService, nil, policyService, hub)
+	templateHandler := handlers.NewTaskTemplateHandler(templateService, userService, policyService, hub)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", &models.Claims{UserID: alice.ID, Username: alice.Username, Role: alice.Role})
+	})
+	router.GET("/todos/:id", todoHandler.GetTodo)
+	router.PUT("/todos/:id", todoHandler.UpdateTodo)
+	router.PATCH("/todos/:id", todoHandler.PatchTodo)
+	router.GET("/task-templates/:id", templateHandler.GetTaskTemplate)
+	router.PUT("/task-templates/:id", templateHandler.UpdateTaskTemplate)
+	router.PATCH("/task-templates/:id", templateHandler.PatchTaskTemplate)
+
+	send := func(method, path, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, path := range []string{"/todos/1", "/task-templates/1"} {
+		w := send(http.MethodGet, path, "", "")
+		if w.Code != http.StatusOK || w.Header().Get("ETag") != `"1"` {
+			t.Fatalf("%s: Expected ETag \"1\" on GET, got %d %q", path, w.Code, w.Header().Get("ETag"))
+		}
+
+		w = send(http.MethodPut, path, `"1"`, `{"name": "First writer"}`)
+		if w.Code != http.StatusOK || w.Header().Get("ETag") != `"2"` {
+			t.Fatalf("%s: Expected a matching If-Match to update, got %d %q", path, w.Code, w.Header().Get("ETag"))
+		}
+
+		// A stale version gets the current representation to merge with.
+		for _, method := range []string{http.MethodPut, http.MethodPatch} {
+			w = send(method, path, `"1"`, `{"name": "Second writer"}`)
+			var conflict struct {
+				Error   string `json:"error"`
+				Current struct {
+					Name    string `json:"name"`
+					Version uint   `json:"version"`
+				} `json:"current"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &conflict)
+			if w.Code != http.StatusPreconditionFailed || w.Header().Get("ETag") != `"2"` ||
+				conflict.Current.Name != "First writer" || conflict.Current.Version != 2 {
+				t.Errorf("%s: Expected %s with a stale If-Match to return 412 with the current state, got %d %s", path, method, w.Code, w.Body.String())
+			}
+		}
+
+		if w := send(http.MethodPut, path, "not-an-etag", `{"name": "Second writer"}`); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: Expected a malformed If-Match to be refused, got %d", path, w.Code)
+		}
+
+		// Without If-Match, or with "*", the last write wins.
+		if w := send(http.MethodPut, path, "", `{"name": "Unconditional"}`); w.Code != http.StatusOK || w.Header().Get("ETag") != `"3"` {
+			t.Errorf("%s: Expected an update without If-Match to apply, got %d %q", path, w.Code, w.Header().Get("ETag"))
+		}
+		if w := send(http.MethodPatch, path, "*", `{"name": "Wildcard"}`); w.Code != http.StatusOK || w.Header().Get("ETag") != `"4"` {
+			t.Errorf("%s: Expected an update with If-Match * to apply, got %d %q", path, w.Code, w.Header().Get("ETag"))
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	gorillaws "github.com/gorilla/websocket"
+	"gorm.io/gorm"
+
+	"github.com/harrisin2037/todoapp/internal/models"
+	"github.com/harrisin2037/todoapp/internal/repository"
+	"github.com/harrisin2037/todoapp/internal/service"
+	"github.com/harrisin2037/todoapp/internal/websocket"
+)
+
+// staticAuth accepts the tokens it maps to claims.
+type staticAuth map[string]*models.Claims
+
+func (a staticAuth) Authenticate(token string) (*models.Claims, error) {
+	if claims, ok := a[token]; ok {
+		return claims, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+// staticAccess lets each user read the todos it lists for them.
+type staticAccess map[uint][]uint
+
+func (a staticAccess) CanReadTodo(claims *models.Claims, todoID uint) bool {
+	if claims == nil {
+		return false
+	}
+	for _, id := range a[claims.UserID] {
+		if id == todoID {
+			return true
+		}
+	}
+	return false
+}
+
+func dialHub(t *testing.T, server *httptest.Server, token string) *gorillaws.Conn {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	if token != "" {
+		url += "?token=" + token
+	}
+	conn, _, err := gorillaws.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// waitForPresence polls the hub until ok accepts its snapshot.
+func waitForPresence(t *testing.T, hub *websocket.Hub, ok func(websocket.PresenceSnapshot) bool) websocket.PresenceSnapshot {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		snapshot := hub.Presence()
+		if ok(snapshot) {
+			return snapshot
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for presence, last snapshot: %+v", snapshot)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func isOnline(snapshot websocket.PresenceSnapshot, username string) bool {
+	for _, user := range snapshot.Online {
+		if user.Username == username {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWebSocketRejectsRevokedTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	db.AutoMigrate(&models.User{}, &models.RefreshToken{})
+
+	userRepo := repository.NewUserRepository(db)
+	tokenService := service.NewTokenService(repository.NewRefreshTokenRepository(db), userRepo, time.Minute, time.Hour)
+	userService := service.NewUserService(userRepo, tokenService, nil, false, service.LockoutPolicy{})
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	router := gin.New()
+	router.GET("/ws", hub.HandleWebSocket(tokenService, staticAccess{}))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	login := func(username string) *service.TokenPair {
+		if _, err := userService.Register(username, username+"@example.com", "secret1"); err != nil {
+			t.Fatalf("Failed to register %s: %v", username, err)
+		}
+		_, tokens, err := userService.Login(username, "secret1")
+		if err != nil {
+			t.Fatalf("Failed to login %s: %v", username, err)
+		}
+		return tokens
+	}
+
+	alice := login("alice")
+	bob := login("bob")
+
+	claims, err := tokenService.Authenticate(bob.AccessToken)
+	if err != nil {
+		t.Fatalf("Failed to authenticate bob: %v", err)
+	}
+	if err := tokenService.Logout(claims); err != nil {
+		t.Fatalf("Failed to log bob out: %v", err)
+	}
+
+	dialHub(t, server, bob.AccessToken)
+	dialHub(t, server, alice.AccessToken)
+
+	snapshot := waitForPresence(t, hub, func(s websocket.PresenceSnapshot) bool { return isOnline(s, "alice") })
+	if isOnline(snapshot, "bob") {
+		t.Errorf("Expected a logged-out token to connect anonymously, got %+v", snapshot.Online)
+	}
+}
+
+// presenceEvents reads conn in the background and passes on the presence
+// events, skipping everything else. received counts every message read.
+func presenceEvents(conn *gorillaws.Conn, received *atomic.Int64) <-chan websocket.PresenceEvent {
+	events := make(chan websocket.PresenceEvent, 16)
+	go func() {
+		defer close(events)
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received.Add(1)
+			var event websocket.PresenceEvent
+			if bytes.HasPrefix(message, []byte(`{"message":"viewer`)) && json.Unmarshal(message, &event) == nil {
+				events <- event
+			}
+		}
+	}()
+	return events
+}
+
+func expectPresenceEvent(t *testing.T, events <-chan websocket.PresenceEvent, message, username string) {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		if event.Message != message || event.User.Username != username || event.TodoID != 1 {
+			t.Fatalf("Expected %s %s, got %+v", username, message, event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for %s %s", username, message)
+	}
+}
+
+func TestHubPresence(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	router := gin.New()
+	router.GET("/ws", hub.HandleWebSocket(staticAuth{
+		"alice": {UserID: 1, Username: "alice"},
+		"bob":   {UserID: 2, Username: "bob"},
+		"carol": {UserID: 3, Username: "carol"},
+	}, staticAccess{1: {1}, 2: {1}, 3: {1}}))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	view := func(conn *gorillaws.Conn, action string) {
+		t.Helper()
+		if err := conn.WriteJSON(websocket.ClientMessage{Action: action, TodoID: 1}); err != nil {
+			t.Fatalf("Failed to send %s: %v", action, err)
+		}
+	}
+	viewers := func(s websocket.PresenceSnapshot) []websocket.PresenceUser { return s.Viewing[1] }
+
+	var aliceReceived, bobReceived atomic.Int64
+	alice := dialHub(t, server, "alice")
+	aliceEvents := presenceEvents(alice, &aliceReceived)
+	view(alice, websocket.ActionView)
+	waitForPresence(t, hub, func(s websocket.PresenceSnapshot) bool { return len(viewers(s)) == 1 })
+
+	// Joining and leaving are announced to the others on the todo.
+	bob := dialHub(t, server, "bob")
+	presenceEvents(bob, &bobReceived)
+	view(bob, websocket.ActionView)
+	expectPresenceEvent(t, aliceEvents, websocket.MessageViewerJoined, "bob")
+	view(bob, websocket.ActionLeave)
+	expectPresenceEvent(t, aliceEvents, websocket.MessageViewerLeft, "bob")
+	bob.Close()
+	waitForPresence(t, hub, func(s websocket.PresenceSnapshot) bool { return !isOnline(s, "bob") })
+
+	// carol stops reading. Once her buffer is full the hub drops her, and
+	// that counts as leaving too.
+	carol := dialHub(t, server, "carol")
+	view(carol, websocket.ActionView)
+	expectPresenceEvent(t, aliceEvents, websocket.MessageViewerJoined, "carol")
+
+	// alice keeps up, so only carol falls behind.
+	filler := []byte(`{"message":"` + strings.Repeat("x", 256*1024) + `"}`)
+	deadline := time.Now().Add(10 * time.Second)
+	for isOnline(hub.Presence(), "carol") {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the hub to drop carol")
+		}
+		before := aliceReceived.Load()
+		hub.Broadcast <- filler
+		for aliceReceived.Load() == before && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	expectPresenceEvent(t, aliceEvents, websocket.MessageViewerLeft, "carol")
+
+	snapshot := hub.Presence()
+	if len(viewers(snapshot)) != 1 || viewers(snapshot)[0].Username != "alice" {
+		t.Errorf("Expected only alice on the todo, got %+v", snapshot.Viewing)
+	}
+}
+
+func TestPresenceOnlyCoversReadableTodos(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	users := staticAuth{
+		"alice":   {UserID: 1, Username: "alice"},
+		"mallory": {UserID: 2, Username: "mallory"},
+	}
+	access := staticAccess{1: {1, 2}, 2: {2}}
+
+	router := gin.New()
+	router.GET("/ws", hub.HandleWebSocket(users, access))
+	router.GET("/presence", func(c *gin.Context) {
+		c.Set("user", users[c.Query("as")])
+		c.Next()
+	}, hub.HandlePresence(access))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	view := func(conn *gorillaws.Conn, todoID uint) {
+		t.Helper()
+		if err := conn.WriteJSON(websocket.ClientMessage{Action: websocket.ActionView, TodoID: todoID}); err != nil {
+			t.Fatalf("Failed to send view: %v", err)
+		}
+	}
+
+	var aliceReceived, malloryReceived atomic.Int64
+	alice := dialHub(t, server, "alice")
+	aliceEvents := presenceEvents(alice, &aliceReceived)
+	view(alice, 1)
+	waitForPresence(t, hub, func(s websocket.PresenceSnapshot) bool { return len(s.Viewing[1]) == 1 })
+
+	// mallory cannot read todo 1, so viewing it is ignored and nobody on it
+	// hears about her. Her view of todo 2 goes through, which also shows the
+	// earlier one has been handled.
+	mallory := dialHub(t, server, "mallory")
+	malloryEvents := presenceEvents(mallory, &malloryReceived)
+	view(mallory, 1)
+	view(mallory, 2)
+	waitForPresence(t, hub, func(s websocket.PresenceSnapshot) bool { return len(s.Viewing[2]) == 1 })
+	if viewers := hub.Presence().Viewing[1]; len(viewers) != 1 || viewers[0].Username != "alice" {
+		t.Errorf("Expected only alice on todo 1, got %+v", viewers)
+	}
+	select {
+	case event := <-aliceEvents:
+		t.Errorf("Expected alice to hear nothing, got %+v", event)
+	case event := <-malloryEvents:
+		t.Errorf("Expected mallory to hear nothing, got %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	get := func(as, query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/presence?as="+as+query, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var snapshot websocket.PresenceSnapshot
+	w := get("mallory", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	json.Unmarshal(w.Body.Bytes(), &snapshot)
+	if _, ok := snapshot.Viewing[1]; ok || len(snapshot.Viewing[2]) != 1 {
+		t.Errorf("Expected mallory to see only todo 2, got %+v", snapshot.Viewing)
+	}
+
+	if w := get("mallory", "&todo_id=1"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for an unreadable todo, got %d", w.Code)
+	}
+
+	snapshot = websocket.PresenceSnapshot{}
+	json.Unmarshal(get("alice", "").Body.Bytes(), &snapshot)
+	if len(snapshot.Viewing[1]) != 1 || len(snapshot.Viewing[2]) != 1 {
+		t.Errorf("Expected alice to see both todos, got %+v", snapshot.Viewing)
+	}
+}
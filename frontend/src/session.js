@@ -0,0 +1,114 @@
+import { API_BASE_URL } from './config.js';
+
+// Access tokens are short-lived. The session is kept alive by trading the
+// refresh token for a new pair shortly before the access token runs out.
+const REFRESH_MARGIN = 60 * 1000;
+
+let refreshTimer;
+let pendingRefresh;
+
+// While an admin is impersonating someone, the admin's own session is kept
+// aside under adminToken, and that is the session the refresh token belongs to.
+function accessTokenKey() {
+    return localStorage.getItem("adminToken") ? "adminToken" : "token";
+}
+
+export function saveSession(data) {
+    localStorage.setItem(accessTokenKey(), data.token);
+    if (data.refresh_token) {
+        localStorage.setItem("refreshToken", data.refresh_token);
+    }
+    if (data.expires_in) {
+        localStorage.setItem("tokenExpiresAt", String(Date.now() + Number(data.expires_in) * 1000));
+    }
+    scheduleRefresh();
+}
+
+export function clearSession() {
+    clearTimeout(refreshTimer);
+    localStorage.removeItem("token");
+    localStorage.removeItem("adminToken");
+    localStorage.removeItem("refreshToken");
+    localStorage.removeItem("tokenExpiresAt");
+}
+
+// Single sign-on redirects back with the tokens in the URL fragment.
+export function saveSessionFromFragment() {
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    if (!params.get("token")) {
+        return false;
+    }
+    saveSession({
+        token: params.get("token"),
+        refresh_token: params.get("refresh_token"),
+        expires_in: params.get("expires_in"),
+    });
+    history.replaceState(null, "", window.location.pathname + window.location.search);
+    return true;
+}
+
+export function refreshSession() {
+    if (!pendingRefresh) {
+        pendingRefresh = doRefresh().finally(() => {
+            pendingRefresh = undefined;
+        });
+    }
+    return pendingRefresh;
+}
+
+async function doRefresh() {
+    const refreshToken = localStorage.getItem("refreshToken");
+    if (!refreshToken) {
+        return false;
+    }
+    try {
+        const response = await fetch(`${API_BASE_URL}/auth/refresh`, {
+            method: "POST",
+            headers: {
+                "Content-Type": "application/json",
+            },
+            body: JSON.stringify({ refresh_token: refreshToken }),
+        });
+        if (response.status === 401) {
+            clearSession();
+            return false;
+        }
+        if (!response.ok) {
+            return false;
+        }
+        saveSession(await response.json());
+        return true;
+    } catch (error) {
+        console.error('Error refreshing session:', error);
+        return false;
+    }
+}
+
+// Refreshes now if the access token is about to expire, e.g. after the tab
+// was asleep and the timer did not fire.
+export async function ensureFreshSession() {
+    const expiresAt = Number(localStorage.getItem("tokenExpiresAt"));
+    if (expiresAt && expiresAt - Date.now() < REFRESH_MARGIN) {
+        return refreshSession();
+    }
+    return true;
+}
+
+function scheduleRefresh() {
+    clearTimeout(refreshTimer);
+    const expiresAt = Number(localStorage.getItem("tokenExpiresAt"));
+    if (!expiresAt || !localStorage.getItem("refreshToken")) {
+        return;
+    }
+    const delay = Math.max(expiresAt - Date.now() - REFRESH_MARGIN, 0);
+    refreshTimer = setTimeout(refreshSession, delay);
+}
+
+export function keepSessionAlive() {
+    scheduleRefresh();
+    document.addEventListener("visibilitychange", () => {
+        if (document.visibilityState === "visible") {
+            ensureFreshSession();
+        }
+    });
+}